@@ -0,0 +1,58 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/audit"
+)
+
+// buildAuditCommand builds the "audit" command, which works with the audit log.
+func buildAuditCommand(opt *Options) *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "管理审计日志",
+	}
+
+	auditCmd.AddCommand(&cobra.Command{
+		Use:   "verify [审计日志路径]",
+		Short: "校验审计日志的哈希链，检查日志是否被篡改",
+		Long:  "校验审计日志的哈希链，检查日志是否被篡改。默认校验配置中的审计日志（--audit-log）。\n输出中的最后一个哈希值可以保存到其他地方，用于发现日志末尾的条目被删除。",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := opt.AuditLogPath
+			if len(args) > 0 {
+				path = args[0]
+			}
+			if path == "" {
+				return fmt.Errorf("请指定审计日志路径，或在配置中设置 auditLogPath")
+			}
+
+			result, err := audit.VerifyFile(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "审计日志 %s 校验通过：%d 条记录，最后的哈希值 %s\n", path, result.Entries, result.LastHash)
+			return nil
+		},
+	})
+
+	return auditCmd
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/kubeconfig"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/tools"
+	"k8s.io/klog/v2"
+)
+
+// pinKubeContext pins the session to the context given by the options, or the current one:
+// it writes a copy of the kubeconfig whose current context is the pinned one (and, unless other contexts are
+// allowed, no other context), and points the options at it,
+// so that neither the agent nor changes to the original kubeconfig can switch the cluster the tools act on.
+// Sessions with a dedicated (agent or read-only) identity are always pinned, as the identity only applies to the pinned context.
+// It returns nil if pinning is off or there is no context to pin; the returned function removes the copy.
+func pinKubeContext(opt *Options) (*tools.ContextPin, func(), error) {
+	pin := opt.PinContext || hasSessionIdentity(opt)
+	if !pin && opt.KubeContext == "" {
+		return nil, func() {}, nil
+	}
+
+	config, err := kubeconfig.Load(opt.KubeConfigPath)
+	if err != nil {
+		if opt.KubeContext != "" || hasSessionIdentity(opt) {
+			return nil, nil, fmt.Errorf("加载kubeconfig失败: %w", err)
+		}
+		klog.Warningf("not pinning the kubeconfig context: %v", err)
+		return nil, func() {}, nil
+	}
+	pinned := opt.KubeContext
+	if pinned == "" {
+		pinned = config.CurrentContext()
+	}
+	if pinned == "" && hasSessionIdentity(opt) {
+		return nil, nil, fmt.Errorf("kubeconfig %q 没有当前上下文，请使用 --kube-context 指定", config.Path())
+	}
+	if pinned == "" {
+		klog.Warningf("not pinning the kubeconfig context: kubeconfig %q has no current context", config.Path())
+		return nil, func() {}, nil
+	}
+	if err := config.SetCurrentContext(pinned); err != nil {
+		return nil, nil, fmt.Errorf("设置kubeconfig上下文失败: %w", err)
+	}
+	if pin && len(opt.AllowedContexts) == 0 {
+		// No other context may be used, so leave them out of the copy altogether.
+		if err := config.Minify(); err != nil {
+			return nil, nil, fmt.Errorf("精简kubeconfig失败: %w", err)
+		}
+	}
+
+	originalPaths := filepath.SplitList(opt.KubeConfigPath)
+	cleanup, err := writeSessionKubeconfig(opt, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !pin {
+		klog.Infof("using kubeconfig context %q", pinned)
+		return nil, cleanup, nil
+	}
+	klog.Infof("session pinned to kubeconfig context %q (also allowed: %v)", pinned, opt.AllowedContexts)
+	contextPin := &tools.ContextPin{Context: pinned, Allowed: opt.AllowedContexts, Identity: hasSessionIdentity(opt)}
+	if contextPin.Identity {
+		// Both the original kubeconfig and the pinned copy hold the user's own credentials.
+		contextPin.CredentialFiles = append(originalPaths, opt.KubeConfigPath)
+	}
+	return contextPin, cleanup, nil
+}
+
+// writeSessionKubeconfig writes a derived kubeconfig for the session to a temporary file,
+// and points the options at it. The returned function removes the file.
+func writeSessionKubeconfig(opt *Options, config *kubeconfig.Config) (func(), error) {
+	dir, err := os.MkdirTemp("", "kubelet-wuhrai-kubeconfig-*")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	path := filepath.Join(dir, "config")
+	if err := config.WriteFile(path); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	// Make accidental rewrites (e.g. "kubectl config use-context") fail too.
+	if err := os.Chmod(path, 0o400); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("设置kubeconfig权限失败: %w", err)
+	}
+	opt.KubeConfigPath = path
+	return func() { os.RemoveAll(dir) }, nil
+}
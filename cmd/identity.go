@@ -0,0 +1,189 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/kubeconfig"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/tools"
+	"k8s.io/klog/v2"
+)
+
+// agentUserName is the kubeconfig user holding the credentials given by --identity-kubeconfig.
+const agentUserName = "kubelet-wuhrai-agent"
+
+// maxPermissionLines limits the permissions listed in the system prompt.
+const maxPermissionLines = 100
+
+// hasAgentIdentity returns true if the options make the agent run commands as a dedicated identity.
+func hasAgentIdentity(opt *Options) bool {
+	return opt.As != "" || len(opt.AsGroups) > 0 || opt.IdentityKubeconfig != ""
+}
+
+// hasSessionIdentity returns true if the session's commands run as a dedicated identity:
+// the agent identity, or the read-only identity.
+func hasSessionIdentity(opt *Options) bool {
+	return hasAgentIdentity(opt) || hasReadOnlyIdentity(opt)
+}
+
+// applyAgentIdentity makes every command the agent runs (kubectl, bash, helm and custom tools) use the
+// least-privilege identity given by the options: it writes a minified copy of the kubeconfig whose current
+// context uses the credentials of --identity-kubeconfig and impersonates --as/--as-group, and points the
+// options at it. The API server then enforces RBAC for the commands that use it, even if our classification
+// of a command is wrong; identityLimitations describes what it does not cover.
+// The returned function removes the copy.
+func applyAgentIdentity(opt *Options) (func(), error) {
+	if !hasAgentIdentity(opt) {
+		return func() {}, nil
+	}
+	if hasReadOnlyIdentity(opt) {
+		return nil, fmt.Errorf("--as、--as-group 和 --identity-kubeconfig 不能与 --read-only-as、--read-only-as-group 同时使用")
+	}
+	if len(opt.AllowedContexts) > 0 {
+		// The identity only applies to the pinned context.
+		return nil, fmt.Errorf("--as、--as-group 和 --identity-kubeconfig 不能与 --allowed-contexts 同时使用")
+	}
+
+	config, err := kubeconfig.Load(opt.KubeConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载kubeconfig失败: %w", err)
+	}
+	if opt.IdentityKubeconfig != "" {
+		identity, err := kubeconfig.Load(opt.IdentityKubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("加载身份kubeconfig失败: %w", err)
+		}
+		if err := config.UseCredentialsOf(identity, agentUserName); err != nil {
+			return nil, fmt.Errorf("设置代理身份失败: %w", err)
+		}
+	}
+	if opt.As != "" || len(opt.AsGroups) > 0 {
+		if err := config.SetImpersonation(opt.As, opt.AsGroups); err != nil {
+			return nil, fmt.Errorf("设置代理身份失败: %w", err)
+		}
+	}
+
+	// Drop the other contexts and their credentials.
+	if err := config.Minify(); err != nil {
+		return nil, fmt.Errorf("设置代理身份失败: %w", err)
+	}
+
+	cleanup, err := writeSessionKubeconfig(opt, config)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("agent commands run as user %q, groups %v (credentials from %q)", opt.As, opt.AsGroups, opt.IdentityKubeconfig)
+	return cleanup, nil
+}
+
+// identityLimitations describes what the agent identity does not protect against, for the doctor command.
+func identityLimitations(opt *Options) []string {
+	var limitations []string
+	if opt.IdentityKubeconfig == "" {
+		limitations = append(limitations, "仅使用 --as/--as-group 时，代理使用的kubeconfig仍包含您自己的凭据，API服务器只在命令使用模拟身份时执行RBAC；请使用 --identity-kubeconfig 提供专用服务账号的凭据")
+	}
+	limitations = append(limitations,
+		"您原来的kubeconfig仍保留在本机上：固定上下文会拒绝引用kubeconfig文件、设置KUBECONFIG或在嵌套shell中切换上下文的命令，但无法识别所有读取该文件的方式（例如脚本）",
+		"若要确保代理无法使用您的凭据，请在不包含管理员kubeconfig的机器、容器或用户下运行代理")
+	return limitations
+}
+
+// describePermissions lists the permissions of the agent's identity for the system prompt,
+// so that the model avoids commands that will be forbidden. It returns "" if they cannot be listed.
+func describePermissions(ctx context.Context, kubeconfigPath string) string {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	permissions, err := tools.ListPermissions(ctx, kubeconfigPath, "")
+	if err != nil {
+		klog.Warningf("listing the permissions of the agent identity: %v", err)
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(permissions, "\n"), "\n")
+	if len(lines) > maxPermissionLines {
+		lines = append(lines[:maxPermissionLines], fmt.Sprintf("... (%d more)", len(lines)-maxPermissionLines))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// buildDoctorCommand builds the "doctor" command, which checks the identity and permissions
+// the agent's commands will have.
+func buildDoctorCommand(opt *Options) *cobra.Command {
+	var namespace string
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "检查代理执行命令时使用的kubeconfig上下文、身份和权限",
+		Long:  "检查代理执行命令时使用的kubeconfig上下文、身份和权限（kubectl auth can-i --list），\n与会话使用相同的 --kubeconfig、--kube-context、--as、--as-group 和 --identity-kubeconfig 设置。",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opt := *opt
+			if err := resolveKubeConfigPath(&opt); err != nil {
+				return fmt.Errorf("解析kubeconfig路径失败: %w", err)
+			}
+			_, cleanupPinnedKubeconfig, err := pinKubeContext(&opt)
+			if err != nil {
+				return err
+			}
+			defer cleanupPinnedKubeconfig()
+			cleanupAgentIdentity, err := applyAgentIdentity(&opt)
+			if err != nil {
+				return err
+			}
+			defer cleanupAgentIdentity()
+			cleanupReadOnlyIdentity, err := applyReadOnlyIdentity(&opt)
+			if err != nil {
+				return err
+			}
+			defer cleanupReadOnlyIdentity()
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "上下文: %s\n", tools.CurrentKubeContext(opt.KubeConfigPath))
+			if whoami, err := tools.WhoAmI(cmd.Context(), opt.KubeConfigPath); err != nil {
+				fmt.Fprintf(out, "身份: 未知 (%v)\n", err)
+			} else {
+				fmt.Fprintf(out, "身份:\n%s", whoami)
+			}
+			permissions, err := tools.ListPermissions(cmd.Context(), opt.KubeConfigPath, namespace)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "\n权限:\n%s", permissions)
+			if hasAgentIdentity(&opt) {
+				fmt.Fprintf(out, "\n限制:\n")
+				for _, limitation := range identityLimitations(&opt) {
+					fmt.Fprintf(out, "- %s\n", limitation)
+				}
+			}
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&opt.KubeConfigPath, "kubeconfig", opt.KubeConfigPath, "kubeconfig文件的路径")
+	f.StringVar(&opt.KubeContext, "kube-context", opt.KubeContext, "使用的kubeconfig上下文（默认为当前上下文）")
+	f.StringVar(&opt.As, "as", opt.As, "代理执行命令时模拟(impersonate)的用户")
+	f.StringSliceVar(&opt.AsGroups, "as-group", opt.AsGroups, "代理执行命令时模拟的用户组（逗号分隔）")
+	f.StringVar(&opt.IdentityKubeconfig, "identity-kubeconfig", opt.IdentityKubeconfig, "代理执行命令时使用其凭据的kubeconfig，例如专用服务账号的kubeconfig")
+	f.StringVarP(&namespace, "namespace", "n", "", "列出权限的命名空间（默认为上下文的命名空间）")
+	return cmd
+}
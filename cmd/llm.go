@@ -0,0 +1,184 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/st-lzh/kubelet-wuhrai/gollm"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/agent"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/ui"
+	"k8s.io/klog/v2"
+)
+
+// LLMRoute is one of the providers of the LLM route of a task.
+type LLMRoute struct {
+	Provider string `json:"provider"`
+	// Model is the model to use with the provider; if empty, the provider picks its default model.
+	Model string `json:"model,omitempty"`
+}
+
+// The tasks the LLM is used for, which can be routed to different providers.
+const (
+	// llmTaskChat is the agent loop.
+	llmTaskChat = "chat"
+	// llmTaskSummarize is the summary of the session ("summarize" REPL command).
+	llmTaskSummarize = "summarize"
+)
+
+var llmTasks = []string{llmTaskChat, llmTaskSummarize}
+
+// llmRoute returns the providers to use for a task, in failover order.
+// The chat route of the config takes precedence over --llm-provider, a comma-separated list of providers
+// whose first one uses --model. Tasks without a route use the chat route.
+func (o *Options) llmRoute(task string) ([]LLMRoute, error) {
+	for name, route := range o.LLMRoutes {
+		if !slices.Contains(llmTasks, name) {
+			return nil, fmt.Errorf("未知的LLM路由任务 %q，支持的任务：%s", name, strings.Join(llmTasks, ", "))
+		}
+		for _, r := range route {
+			if r.Provider == "" {
+				return nil, fmt.Errorf("LLM路由 %q 中有未指定provider的条目", name)
+			}
+		}
+	}
+
+	if route := o.LLMRoutes[task]; len(route) > 0 {
+		return route, nil
+	}
+	if task != llmTaskChat {
+		return o.llmRoute(llmTaskChat)
+	}
+
+	var route []LLMRoute
+	for _, provider := range strings.Split(o.ProviderID, ",") {
+		if provider = strings.TrimSpace(provider); provider == "" {
+			continue
+		}
+		r := LLMRoute{Provider: provider}
+		if len(route) == 0 {
+			r.Model = o.ModelID
+		}
+		route = append(route, r)
+	}
+	if len(route) == 0 {
+		return nil, fmt.Errorf("未指定语言模型提供商（--llm-provider）")
+	}
+	return route, nil
+}
+
+// newLLMClient creates the client of a route: the client of its provider, or a client failing over
+// from one provider to the next if it has several. Providers that cannot be used are skipped, so it also
+// returns the entry of the route the client starts with, whose model the requests must use.
+func newLLMClient(ctx context.Context, opt *Options, route []LLMRoute) (gollm.Client, LLMRoute, error) {
+	var clientOpts []gollm.Option
+	if opt.SkipVerifySSL {
+		clientOpts = append(clientOpts, gollm.WithSkipVerifySSL())
+	}
+
+	limits := opt.llmRateLimits()
+	if len(limits) > 0 {
+		klog.Infof("LLM rate limits: %s", limits)
+	}
+
+	var targets []gollm.FailoverTarget
+	var used []LLMRoute
+	for _, r := range route {
+		client, err := gollm.NewClient(ctx, r.Provider, clientOpts...)
+		if err != nil && len(route) > 1 {
+			// A provider to fail over to that cannot be used, e.g. without an API key, is skipped.
+			klog.Warningf("skipping LLM provider %q: %v", r.Provider, err)
+			continue
+		}
+		if err != nil {
+			return nil, LLMRoute{}, fmt.Errorf("创建语言模型提供商 %q 的客户端失败: %w", r.Provider, err)
+		}
+		if len(limits) > 0 {
+			client = gollm.NewRateLimitedClient(client, r.Provider, limits)
+		}
+		targets = append(targets, gollm.FailoverTarget{Name: r.Provider, Client: client, Model: r.Model})
+		used = append(used, r)
+	}
+	switch len(targets) {
+	case 0:
+		return nil, LLMRoute{}, fmt.Errorf("无法创建任何语言模型提供商的客户端：%v", route)
+	case 1:
+		return targets[0].Client, used[0], nil
+	}
+	klog.Infof("LLM providers in failover order: %v", used)
+	client, err := gollm.NewFailoverClient(agent.LLMRetryConfig, targets...)
+	if err != nil {
+		return nil, LLMRoute{}, err
+	}
+	return client, used[0], nil
+}
+
+// llmRateLimits returns the rate limits of the LLM requests: the ones of the config,
+// with the limit given by the --llm-* flags for the providers without a limit of their own.
+func (o *Options) llmRateLimits() gollm.RateLimits {
+	limits := gollm.RateLimits{}
+	for key, limit := range o.LLMRateLimits {
+		limits[key] = limit
+	}
+	flagLimit := gollm.RateLimit{
+		RequestsPerMinute: o.LLMRequestsPerMinute,
+		TokensPerMinute:   o.LLMTokensPerMinute,
+		MaxInFlight:       o.LLMMaxInFlight,
+	}
+	if !flagLimit.IsZero() {
+		limits["*"] = flagLimit
+	}
+	return limits
+}
+
+// summarize asks the LLM of the summarize route for a summary of the session so far.
+func (s *session) summarize(ctx context.Context) error {
+	var transcript strings.Builder
+	for _, block := range s.doc.Blocks() {
+		switch block := block.(type) {
+		case *ui.InputTextBlock:
+			if text, err := block.Text(); err == nil && text != "" {
+				fmt.Fprintf(&transcript, "User: %s\n", text)
+			}
+		case *ui.AgentTextBlock:
+			if text := strings.TrimSpace(block.Text()); text != "" {
+				fmt.Fprintf(&transcript, "Assistant: %s\n", text)
+			}
+		case *ui.FunctionCallRequestBlock:
+			fmt.Fprintf(&transcript, "Ran: %s\n", block.Description())
+		}
+	}
+	if transcript.Len() == 0 {
+		s.doc.AddBlock(ui.NewAgentTextBlock().WithText("Nothing to summarize yet.\n"))
+		return nil
+	}
+
+	response, err := s.summaryLLM.GenerateCompletion(ctx, &gollm.CompletionRequest{
+		Model: s.summaryModel,
+		Prompt: "Summarize this session of a user with a Kubernetes assistant in a few bullet points: " +
+			"what was asked, what was found, and what was changed in the cluster.\n\n" + transcript.String(),
+	})
+	if err != nil {
+		return fmt.Errorf("summarizing the session: %w", err)
+	}
+	s.doc.AddBlock(ui.NewAgentTextBlock().WithText(response.Response() + "\n"))
+	return nil
+}
@@ -30,15 +30,21 @@ import (
 	"os/signal"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/st-lzh/kubelet-wuhrai/gollm"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/agent"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/audit"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/journal"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/mcp"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/policy"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/redact"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/sandbox"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/tools"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/ui"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/ui/html"
@@ -74,6 +80,10 @@ func BuildRootCommand(opt *Options) (*cobra.Command, error) {
 		},
 	})
 
+	rootCmd.AddCommand(buildSandboxForwardCommand())
+	rootCmd.AddCommand(buildAuditCommand(opt))
+	rootCmd.AddCommand(buildDoctorCommand(opt))
+
 	if err := opt.bindCLIFlags(rootCmd.Flags()); err != nil {
 		return nil, err
 	}
@@ -81,11 +91,44 @@ func BuildRootCommand(opt *Options) (*cobra.Command, error) {
 }
 
 type Options struct {
+	// ProviderID is the LLM provider, or a comma-separated list of providers to fail over to in order.
 	ProviderID string `json:"llmProvider,omitempty"`
 	ModelID    string `json:"model,omitempty"`
+	// LLMRoutes are the providers (in failover order) of the tasks the LLM is used for: "chat" and "summarize".
+	// The chat route takes precedence over ProviderID and ModelID.
+	LLMRoutes map[string][]LLMRoute `json:"llmRoutes,omitempty"`
+	// LLMRateLimits are the rate limits of the LLM requests, keyed by provider or by provider and model
+	// ("deepseek/deepseek-chat"); "*" applies to the providers without a limit of their own.
+	LLMRateLimits gollm.RateLimits `json:"llmRateLimits,omitempty"`
+	// LLMRequestsPerMinute, LLMTokensPerMinute and LLMMaxInFlight, if set, are the "*" rate limit.
+	LLMRequestsPerMinute int `json:"llmRequestsPerMinute,omitempty"`
+	LLMTokensPerMinute   int `json:"llmTokensPerMinute,omitempty"`
+	LLMMaxInFlight       int `json:"llmMaxInFlight,omitempty"`
 	// SkipPermissions is a flag to skip asking for confirmation before executing kubectl commands
 	// that modifies resources in the cluster.
 	SkipPermissions bool `json:"skipPermissions,omitempty"`
+	// ReadOnly refuses every tool call that is not known to be read-only,
+	// in the interactive, quiet and MCP server modes.
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// ReadOnlyAs and ReadOnlyAsGroups, if set with ReadOnly, make kubectl impersonate a
+	// (read-only) user and groups, so that the API server enforces read-only access too.
+	ReadOnlyAs       string   `json:"readOnlyAs,omitempty"`
+	ReadOnlyAsGroups []string `json:"readOnlyAsGroups,omitempty"`
+	// As and AsGroups make every command the agent runs impersonate a (least-privilege) user and groups.
+	As       string   `json:"as,omitempty"`
+	AsGroups []string `json:"asGroups,omitempty"`
+	// IdentityKubeconfig is a kubeconfig, e.g. of a dedicated service account, whose credentials
+	// every command the agent runs uses.
+	IdentityKubeconfig string `json:"identityKubeconfig,omitempty"`
+	// ProductionContexts are glob patterns of kubeconfig contexts that are considered production,
+	// which raises the risk tier of commands run against them.
+	ProductionContexts []string `json:"productionContexts,omitempty"`
+	// SystemNamespaces are glob patterns of namespaces holding cluster infrastructure.
+	SystemNamespaces []string `json:"systemNamespaces,omitempty"`
+	// BlockCriticalRisk refuses critical-risk operations instead of asking for confirmation.
+	BlockCriticalRisk bool `json:"blockCriticalRisk,omitempty"`
+	// PolicyFile is the path of a policy file with allow/deny/ask rules for tool calls.
+	PolicyFile string `json:"policyFile,omitempty"`
 	// EnableToolUseShim is a flag to enable tool use shim.
 	// TODO(droot): figure out a better way to discover if the model supports tool use
 	// and set this automatically.
@@ -102,6 +145,14 @@ type Options struct {
 	// KubeConfigPath is the path to the kubeconfig file.
 	// If not provided, the default kubeconfig path will be used.
 	KubeConfigPath string `json:"kubeConfigPath,omitempty"`
+	// KubeContext is the kubeconfig context to use, instead of the current one.
+	KubeContext string `json:"kubeContext,omitempty"`
+	// PinContext pins the session to its kubeconfig context: commands that switch the context,
+	// rewrite the kubeconfig or target other clusters are refused.
+	PinContext bool `json:"pinContext,omitempty"`
+	// AllowedContexts are glob patterns of other contexts that commands may select with --context,
+	// for multi-cluster work in a pinned session.
+	AllowedContexts []string `json:"allowedContexts,omitempty"`
 
 	PromptTemplateFilePath string   `json:"promptTemplateFilePath,omitempty"`
 	ExtraPromptPaths       []string `json:"extraPromptPaths,omitempty"`
@@ -109,6 +160,31 @@ type Options struct {
 	RemoveWorkDir          bool     `json:"removeWorkDir,omitempty"`
 	ToolConfigPaths        []string `json:"toolConfigPaths,omitempty"`
 
+	// AuditLogPath is the path of the append-only audit log of tool calls; empty disables it.
+	AuditLogPath string `json:"auditLogPath,omitempty"`
+
+	// RedactSecrets replaces secrets in tool results before they reach the LLM or the trace.
+	RedactSecrets bool `json:"redactSecrets,omitempty"`
+	// RedactionPatterns are extra regular expressions of values to redact.
+	RedactionPatterns []string `json:"redactionPatterns,omitempty"`
+
+	// ShowReasoning expands the reasoning of reasoning models instead of collapsing it.
+	ShowReasoning bool `json:"showReasoning,omitempty"`
+
+	// EnableTools, if set, restricts the agent to the listed tools (glob patterns are supported).
+	EnableTools []string `json:"enableTools,omitempty"`
+	// DisableTools lists tools (glob patterns are supported) that the agent may not use.
+	DisableTools []string `json:"disableTools,omitempty"`
+
+	// Sandbox runs the shell commands of the tools selected by SandboxTools in a sandbox (Linux only).
+	Sandbox bool `json:"sandbox,omitempty"`
+	// SandboxTools lists the tools (glob patterns are supported) whose commands run sandboxed.
+	SandboxTools []string `json:"sandboxTools,omitempty"`
+	// SandboxNetwork is the network access of sandboxed commands.
+	SandboxNetwork sandbox.NetworkMode `json:"sandboxNetwork,omitempty"`
+	// SandboxAllowedCommands are the only commands available on the PATH inside the sandbox.
+	SandboxAllowedCommands []string `json:"sandboxAllowedCommands,omitempty"`
+
 	// UserInterface is the type of user interface to use.
 	UserInterface UserInterface `json:"userInterface,omitempty"`
 	// UIListenAddress is the address to listen for the HTML UI.
@@ -116,6 +192,11 @@ type Options struct {
 
 	// SkipVerifySSL is a flag to skip verifying the SSL certificate of the LLM provider.
 	SkipVerifySSL bool `json:"skipVerifySSL,omitempty"`
+
+	// RecordLLMPath, if set, records the requests to the LLM and its responses to a cassette file.
+	RecordLLMPath string `json:"recordLLMPath,omitempty"`
+	// ReplayLLMPath, if set, replays the LLM responses from a cassette file instead of calling the LLM.
+	ReplayLLMPath string `json:"replayLLMPath,omitempty"`
 }
 
 type UserInterface string
@@ -159,6 +240,18 @@ func (o *Options) InitDefaults() {
 	o.ModelID = "deepseek-chat"
 	// by default, confirm before executing kubectl commands that modify resources in the cluster.
 	o.SkipPermissions = false
+	o.ReadOnly = false
+	o.ReadOnlyAs = ""
+	o.ReadOnlyAsGroups = []string{}
+	// by default, commands run as the user of the kubeconfig
+	o.As = ""
+	o.AsGroups = []string{}
+	o.IdentityKubeconfig = ""
+	defaultRiskConfig := tools.DefaultRiskConfig()
+	o.ProductionContexts = defaultRiskConfig.ProductionContexts
+	o.SystemNamespaces = defaultRiskConfig.SystemNamespaces
+	o.BlockCriticalRisk = false
+	o.PolicyFile = ""
 	o.MCPServer = false
 	o.MCPClient = false
 	// by default, external tools are disabled (only works with --mcp-server)
@@ -169,11 +262,28 @@ func (o *Options) InitDefaults() {
 	o.MCPServer = false
 	o.MaxIterations = 20
 	o.KubeConfigPath = ""
+	o.KubeContext = ""
+	// by default, the session stays on the context it started with
+	o.PinContext = true
+	o.AllowedContexts = []string{}
 	o.PromptTemplateFilePath = ""
 	o.ExtraPromptPaths = []string{}
 	o.TracePath = filepath.Join(os.TempDir(), "kubelet-wuhrai-trace.txt")
+	// by default, there is no audit log
+	o.AuditLogPath = ""
+	// by default, secrets are redacted from tool results
+	o.RedactSecrets = true
+	o.RedactionPatterns = []string{}
 	o.RemoveWorkDir = false
 	o.ToolConfigPaths = defaultToolConfigPaths
+	o.EnableTools = []string{}
+	o.DisableTools = []string{}
+	// by default, commands are not sandboxed
+	o.Sandbox = false
+	defaultSandboxPolicy := sandbox.DefaultPolicy()
+	o.SandboxTools = defaultSandboxPolicy.Tools
+	o.SandboxNetwork = defaultSandboxPolicy.Network
+	o.SandboxAllowedCommands = defaultSandboxPolicy.AllowedCommands
 	// Default to terminal UI
 	o.UserInterface = UserInterfaceTerminal
 	// Default UI listen address for HTML UI
@@ -292,17 +402,43 @@ func run(ctx context.Context) error {
 func (opt *Options) bindCLIFlags(f *pflag.FlagSet) error {
 	f.IntVar(&opt.MaxIterations, "max-iterations", opt.MaxIterations, "代理在放弃之前尝试的最大迭代次数")
 	f.StringVar(&opt.KubeConfigPath, "kubeconfig", opt.KubeConfigPath, "kubeconfig文件的路径")
+	f.StringVar(&opt.KubeContext, "kube-context", opt.KubeContext, "使用的kubeconfig上下文（默认为当前上下文）")
+	f.BoolVar(&opt.PinContext, "pin-context", opt.PinContext, "将会话固定在启动时的kubeconfig上下文：拒绝切换上下文、修改kubeconfig或指向其他集群的命令")
+	f.StringSliceVar(&opt.AllowedContexts, "allowed-contexts", opt.AllowedContexts, "固定上下文时，命令可以通过--context使用的其他上下文（逗号分隔，支持通配符），用于多集群操作")
 	f.StringVar(&opt.PromptTemplateFilePath, "prompt-template-file-path", opt.PromptTemplateFilePath, "自定义提示模板文件的路径")
 	f.StringArrayVar(&opt.ExtraPromptPaths, "extra-prompt-paths", opt.ExtraPromptPaths, "额外的提示模板路径")
 	f.StringVar(&opt.TracePath, "trace-path", opt.TracePath, "跟踪文件的路径")
+	f.StringVar(&opt.AuditLogPath, "audit-log", opt.AuditLogPath, "审计日志的路径：以追加方式记录所有执行、拒绝的工具调用，带哈希链防篡改（使用 audit verify 校验）")
+	f.BoolVar(&opt.RedactSecrets, "redact-secrets", opt.RedactSecrets, "在工具结果发送给语言模型或写入跟踪文件之前，将Secret数据、令牌和密钥替换为占位符（--redact-secrets=false 关闭）")
+	f.StringArrayVar(&opt.RedactionPatterns, "redaction-pattern", opt.RedactionPatterns, "额外需要脱敏的正则表达式，可重复使用；若包含命名分组 secret，则只替换该分组")
+	f.BoolVar(&opt.ShowReasoning, "show-reasoning", opt.ShowReasoning, "展开显示推理模型的推理过程（默认折叠，可在会话中使用 thinking 命令查看）")
 	f.BoolVar(&opt.RemoveWorkDir, "remove-workdir", opt.RemoveWorkDir, "执行后删除临时工作目录")
 
-	f.StringVar(&opt.ProviderID, "llm-provider", opt.ProviderID, "语言模型提供商")
+	f.StringVar(&opt.ProviderID, "llm-provider", opt.ProviderID, "语言模型提供商，可以是逗号分隔的列表（例如 deepseek,qwen,ollama），出错时按顺序切换到下一个提供商")
 	f.StringVar(&opt.ModelID, "model", opt.ModelID, "语言模型，例如 deepseek-chat, deepseek-coder, qwen-plus, doubao-pro-4k")
+	f.IntVar(&opt.LLMRequestsPerMinute, "llm-requests-per-minute", opt.LLMRequestsPerMinute, "每个语言模型提供商每分钟最多发送的请求数，超出时等待而不是报错（0表示不限制）")
+	f.IntVar(&opt.LLMTokensPerMinute, "llm-tokens-per-minute", opt.LLMTokensPerMinute, "每个语言模型提供商每分钟最多使用的令牌数，超出时等待（0表示不限制）")
+	f.IntVar(&opt.LLMMaxInFlight, "llm-max-in-flight", opt.LLMMaxInFlight, "每个语言模型提供商同时进行的最大请求数（0表示不限制）")
 	f.BoolVar(&opt.SkipPermissions, "skip-permissions", opt.SkipPermissions, "(危险) 跳过在执行修改资源的kubectl命令前的确认询问")
+	f.BoolVar(&opt.ReadOnly, "read-only", opt.ReadOnly, "只读模式：拒绝执行任何可能修改资源的工具调用（包括自定义工具和MCP服务器模式）")
+	f.StringVar(&opt.ReadOnlyAs, "read-only-as", opt.ReadOnlyAs, "只读模式下kubectl模拟(impersonate)的用户，例如绑定了view角色的用户或服务账号，需要配合--read-only使用")
+	f.StringSliceVar(&opt.ReadOnlyAsGroups, "read-only-as-group", opt.ReadOnlyAsGroups, "只读模式下kubectl模拟的用户组（逗号分隔），需要配合--read-only使用")
+	f.StringVar(&opt.As, "as", opt.As, "代理执行的所有命令（kubectl、bash、helm和自定义工具）模拟(impersonate)的用户，由API服务器按RBAC限制权限")
+	f.StringSliceVar(&opt.AsGroups, "as-group", opt.AsGroups, "代理执行的所有命令模拟的用户组（逗号分隔）")
+	f.StringVar(&opt.IdentityKubeconfig, "identity-kubeconfig", opt.IdentityKubeconfig, "代理执行的所有命令使用其凭据的kubeconfig，例如专用的最小权限服务账号的kubeconfig")
+	f.StringSliceVar(&opt.ProductionContexts, "production-contexts", opt.ProductionContexts, "视为生产环境的kubeconfig上下文（逗号分隔，支持通配符），会提高命令的风险等级")
+	f.StringSliceVar(&opt.SystemNamespaces, "system-namespaces", opt.SystemNamespaces, "视为系统命名空间的命名空间（逗号分隔，支持通配符），会提高命令的风险等级")
+	f.BoolVar(&opt.BlockCriticalRisk, "block-critical-risk", opt.BlockCriticalRisk, "直接拒绝严重风险的操作，而不是请求确认")
+	f.StringVar(&opt.PolicyFile, "policy-file", opt.PolicyFile, "策略文件的路径，其中按顺序定义允许(allow)/拒绝(deny)/询问(ask)工具调用的规则")
 	f.BoolVar(&opt.MCPServer, "mcp-server", opt.MCPServer, "以MCP服务器模式运行")
 	f.BoolVar(&opt.ExternalTools, "external-tools", opt.ExternalTools, "在MCP服务器模式下，发现并暴露外部MCP工具")
 	f.StringArrayVar(&opt.ToolConfigPaths, "custom-tools-config", opt.ToolConfigPaths, "自定义工具配置文件或目录的路径")
+	f.StringSliceVar(&opt.EnableTools, "enable-tools", opt.EnableTools, "仅启用列出的工具（逗号分隔，支持通配符，例如 kubectl,github_*）")
+	f.StringSliceVar(&opt.DisableTools, "disable-tools", opt.DisableTools, "禁用列出的工具（逗号分隔，支持通配符），优先于--enable-tools")
+	f.BoolVar(&opt.Sandbox, "sandbox", opt.Sandbox, "在沙箱中执行工具命令（仅限Linux，需要bubblewrap）：只读根文件系统，仅工作目录可写，受限的网络和PATH")
+	f.StringSliceVar(&opt.SandboxTools, "sandbox-tools", opt.SandboxTools, "在沙箱中执行命令的工具（逗号分隔，支持通配符，包括内置的kubectl和helm工具）")
+	f.Var(&opt.SandboxNetwork, "sandbox-network", "沙箱的网络访问。支持的值：none, apiserver（仅访问当前上下文的API服务器）, host")
+	f.StringSliceVar(&opt.SandboxAllowedCommands, "sandbox-allowed-commands", opt.SandboxAllowedCommands, "沙箱内PATH中可用的命令（逗号分隔）；这不是安全边界，根文件系统只读可见，其他程序仍可通过绝对路径执行")
 	f.BoolVar(&opt.MCPClient, "mcp-client", opt.MCPClient, "启用MCP客户端模式以连接到外部MCP服务器")
 	f.BoolVar(&opt.EnableToolUseShim, "enable-tool-use-shim", opt.EnableToolUseShim, "启用工具使用垫片")
 	f.BoolVar(&opt.Quiet, "quiet", opt.Quiet, "以非交互模式运行，需要提供查询作为位置参数")
@@ -310,6 +446,8 @@ func (opt *Options) bindCLIFlags(f *pflag.FlagSet) error {
 	f.Var(&opt.UserInterface, "user-interface", "要使用的用户界面模式。支持的值：terminal, html")
 	f.StringVar(&opt.UIListenAddress, "ui-listen-address", opt.UIListenAddress, "HTML UI监听的地址")
 	f.BoolVar(&opt.SkipVerifySSL, "skip-verify-ssl", opt.SkipVerifySSL, "跳过验证LLM提供商的SSL证书")
+	f.StringVar(&opt.RecordLLMPath, "record-llm", opt.RecordLLMPath, "将发送给LLM的请求及其响应记录到该文件（cassette），用于复现问题")
+	f.StringVar(&opt.ReplayLLMPath, "replay-llm", opt.ReplayLLMPath, "从记录文件（cassette）回放LLM的响应，而不调用LLM")
 
 	return nil
 }
@@ -327,14 +465,71 @@ func RunRootCommand(ctx context.Context, opt Options, args []string) error {
 		return fmt.Errorf("解析kubeconfig路径失败: %w", err)
 	}
 
+	contextPin, cleanupPinnedKubeconfig, err := pinKubeContext(&opt)
+	if err != nil {
+		return err
+	}
+	defer cleanupPinnedKubeconfig()
+
+	cleanupAgentIdentity, err := applyAgentIdentity(&opt)
+	if err != nil {
+		return err
+	}
+	defer cleanupAgentIdentity()
+
+	cleanupReadOnlyIdentity, err := applyReadOnlyIdentity(&opt)
+	if err != nil {
+		return err
+	}
+	defer cleanupReadOnlyIdentity()
+
+	registry, err := newToolRegistry(opt)
+	if err != nil {
+		return err
+	}
+
+	sb, err := newSandbox(opt)
+	if err != nil {
+		return err
+	}
+	if sb != nil {
+		defer sb.Close()
+	}
+
+	var toolPolicy *policy.Policy
+	if opt.PolicyFile != "" {
+		toolPolicy, err = policy.LoadFile(opt.PolicyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	var auditLog *audit.Logger
+	if opt.AuditLogPath != "" {
+		auditLog, err = audit.Open(opt.AuditLogPath)
+		if err != nil {
+			return err
+		}
+		defer auditLog.Close()
+	}
+
+	var redactor *redact.Redactor
+	if opt.RedactSecrets {
+		redactor, err = redact.New(redact.Config{Patterns: opt.RedactionPatterns})
+		if err != nil {
+			return err
+		}
+	}
+
 	if opt.MCPServer {
-		if err = startMCPServer(ctx, opt); err != nil {
+		if err = startMCPServer(ctx, opt, registry, sb, auditLog, redactor, contextPin); err != nil {
 			return fmt.Errorf("启动MCP服务器失败: %w", err)
 		}
 		return nil // MCP server mode blocks, so we return here
 	}
 
-	if err := handleCustomTools(opt.ToolConfigPaths); err != nil {
+	customTools, err := handleCustomTools(registry, opt.ToolConfigPaths)
+	if err != nil {
 		return fmt.Errorf("failed to process custom tools: %w", err)
 	}
 
@@ -342,7 +537,7 @@ func RunRootCommand(ctx context.Context, opt Options, args []string) error {
 	var mcpManager *mcp.Manager
 	if opt.MCPClient {
 		var err error
-		mcpManager, err = InitializeMCPClient()
+		mcpManager, err = InitializeMCPClient(registry)
 		if err != nil {
 			klog.Errorf("Failed to initialize MCP client: %v", err)
 			os.Exit(1) // Fail fast instead of continuing with degraded functionality
@@ -367,17 +562,46 @@ func RunRootCommand(ctx context.Context, opt Options, args []string) error {
 
 	klog.Info("Application started", "pid", os.Getpid())
 
+	chatRoute, err := opt.llmRoute(llmTaskChat)
+	if err != nil {
+		return err
+	}
+	summaryRoute, err := opt.llmRoute(llmTaskSummarize)
+	if err != nil {
+		return err
+	}
+
 	var llmClient gollm.Client
-	if opt.SkipVerifySSL {
-		llmClient, err = gollm.NewClient(ctx, opt.ProviderID, gollm.WithSkipVerifySSL())
-	} else {
-		llmClient, err = gollm.NewClient(ctx, opt.ProviderID)
+	// chatTarget is the provider and model the chat starts with.
+	chatTarget := chatRoute[0]
+	switch {
+	case opt.ReplayLLMPath != "" && opt.RecordLLMPath != "":
+		return fmt.Errorf("--record-llm and --replay-llm cannot be used together")
+	case opt.ReplayLLMPath != "":
+		llmClient, err = gollm.NewReplayClient(opt.ReplayLLMPath)
+	default:
+		llmClient, chatTarget, err = newLLMClient(ctx, &opt, chatRoute)
 	}
 	if err != nil {
 		return fmt.Errorf("creating llm client: %w", err)
 	}
+	if opt.RecordLLMPath != "" {
+		llmClient = gollm.NewRecordingClient(llmClient, opt.RecordLLMPath)
+	}
 	defer llmClient.Close()
 
+	// The summaries use the chat client, unless they have a route of their own.
+	summaryLLM, summaryModel := llmClient, chatTarget.Model
+	if _, ok := opt.LLMRoutes[llmTaskSummarize]; ok && opt.ReplayLLMPath == "" {
+		var summaryTarget LLMRoute
+		summaryLLM, summaryTarget, err = newLLMClient(ctx, &opt, summaryRoute)
+		if err != nil {
+			return fmt.Errorf("creating llm client: %w", err)
+		}
+		defer summaryLLM.Close()
+		summaryModel = summaryTarget.Model
+	}
+
 	var recorder journal.Recorder
 	if opt.TracePath != "" {
 		var fileRecorder journal.Recorder
@@ -428,19 +652,39 @@ func RunRootCommand(ctx context.Context, opt Options, args []string) error {
 		return fmt.Errorf("user-interface mode %q is not known", opt.UserInterface)
 	}
 
+	// Tell the model what a dedicated identity may do, so that it avoids commands that will be forbidden.
+	var permissions string
+	if hasAgentIdentity(&opt) || opt.ReadOnlyAs != "" || len(opt.ReadOnlyAsGroups) > 0 {
+		permissions = describePermissions(ctx, opt.KubeConfigPath)
+	}
+
 	conversation := &agent.Conversation{
-		Model:              opt.ModelID,
+		Model:              chatTarget.Model,
+		Provider:           chatTarget.Provider,
 		Kubeconfig:         opt.KubeConfigPath,
 		LLM:                llmClient,
 		MaxIterations:      opt.MaxIterations,
 		PromptTemplateFile: opt.PromptTemplateFilePath,
 		ExtraPromptPaths:   opt.ExtraPromptPaths,
-		Tools:              tools.Default(),
+		Tools:              registry,
+		Sandbox:            sb,
 		Recorder:           recorder,
 		RemoveWorkDir:      opt.RemoveWorkDir,
 		SkipPermissions:    opt.SkipPermissions,
-		EnableToolUseShim:  opt.EnableToolUseShim,
-		MCPClientEnabled:   opt.MCPClient,
+		ReadOnly:           opt.ReadOnly,
+		ContextPin:         contextPin,
+		Permissions:        permissions,
+		RiskConfig: tools.RiskConfig{
+			ProductionContexts: opt.ProductionContexts,
+			SystemNamespaces:   opt.SystemNamespaces,
+		},
+		BlockCriticalRisk: opt.BlockCriticalRisk,
+		Policy:            toolPolicy,
+		Audit:             auditLog,
+		Redactor:          redactor,
+		EnableToolUseShim: opt.EnableToolUseShim,
+		MCPClientEnabled:  opt.MCPClient,
+		ShowReasoning:     opt.ShowReasoning,
 	}
 
 	err = conversation.Init(ctx, doc)
@@ -450,12 +694,27 @@ func RunRootCommand(ctx context.Context, opt Options, args []string) error {
 	defer conversation.Close()
 
 	chatSession := session{
-		model:        opt.ModelID,
 		doc:          doc,
 		ui:           userInterface,
 		conversation: conversation,
 		LLM:          llmClient,
+		summaryLLM:   summaryLLM,
+		summaryModel: summaryModel,
 		mcpManager:   mcpManager,
+		customTools:  customTools,
+	}
+
+	if !opt.Quiet {
+		// Pick up edits to the custom tool configs while the session is running.
+		go customTools.Watch(ctx, customToolsWatchInterval, func(result *tools.ReloadResult) {
+			if err := result.Err(); err != nil {
+				klog.Warningf("Errors reloading custom tools: %v", err)
+			}
+			if result.Changed() {
+				klog.Infof("Reloaded custom tools: %s", result)
+				conversation.ToolsChanged()
+			}
+		})
 	}
 
 	// Prepare MCP server status blocks only when MCP client is enabled
@@ -481,8 +740,24 @@ func RunRootCommand(ctx context.Context, opt Options, args []string) error {
 	return chatSession.repl(ctx, queryFromCmd, mcpBlocks)
 }
 
-func handleCustomTools(toolConfigPaths []string) error {
+// newToolRegistry creates the tool registry for this session, holding the built-in tools
+// allowed by the --enable-tools / --disable-tools filters.
+func newToolRegistry(opt Options) (*tools.Tools, error) {
+	registry := tools.NewTools(tools.WithFilter(&tools.ToolFilter{
+		Enable:  opt.EnableTools,
+		Disable: opt.DisableTools,
+	}))
+	if err := registry.RegisterBuiltinTools(); err != nil && !errors.Is(err, tools.ErrToolFiltered) {
+		return nil, fmt.Errorf("registering built-in tools: %w", err)
+	}
+	return registry, nil
+}
+
+// handleCustomTools loads and registers custom tools from the given config files and dirs.
+// It returns a loader that can be used to reload the tools when the configs change.
+func handleCustomTools(registry *tools.Tools, toolConfigPaths []string) (*tools.CustomToolLoader, error) {
 	// resolve tool config paths, and then load and register custom tools from config files and dirs
+	var cleanedPaths []string
 	for _, path := range toolConfigPaths {
 		pathWithPlaceholdersExpanded := path
 
@@ -508,29 +783,37 @@ func handleCustomTools(toolConfigPaths []string) error {
 
 		klog.Infof("Attempting to load custom tools from processed path: %q (original value from config: %q)", cleanedPath, path)
 
-		if err := tools.LoadAndRegisterCustomTools(cleanedPath); err != nil {
-			if errors.Is(err, os.ErrNotExist) && !slices.Contains(defaultToolConfigPaths, path) {
-				// user specified a directory that does not exist, we must error out
-				return fmt.Errorf("custom tools directory not found (original value: %q, processed path: %q)", path, cleanedPath)
-			} else {
-				klog.Warningf("Failed to load or register custom tools (original value: %q, processed path: %q): %v", path, cleanedPath, err)
-			}
+		if _, err := os.Stat(cleanedPath); errors.Is(err, os.ErrNotExist) && !slices.Contains(defaultToolConfigPaths, path) {
+			// user specified a directory that does not exist, we must error out
+			return nil, fmt.Errorf("custom tools directory not found (original value: %q, processed path: %q)", path, cleanedPath)
 		}
+		cleanedPaths = append(cleanedPaths, cleanedPath)
 	}
-	return nil
+
+	loader := tools.NewCustomToolLoader(registry, cleanedPaths)
+	if result := loader.Reload(); result.Err() != nil {
+		klog.Warningf("Failed to load or register some custom tools: %v", result.Err())
+	}
+	return loader, nil
 }
 
 // session represents the user chat session (interactive/non-interactive both)
 type session struct {
-	model           string
 	ui              ui.UI
 	doc             *ui.Document
 	conversation    *agent.Conversation
 	availableModels []string
 	LLM             gollm.Client
-	mcpManager      *mcp.Manager
+	// summaryLLM and summaryModel are the LLM of the summarize route.
+	summaryLLM   gollm.Client
+	summaryModel string
+	mcpManager   *mcp.Manager
+	customTools  *tools.CustomToolLoader
 }
 
+// customToolsWatchInterval is how often we check the custom tool configs for changes.
+const customToolsWatchInterval = 2 * time.Second
+
 // repl is a read-eval-print loop for the chat session.
 func (s *session) repl(ctx context.Context, initialQuery string, initialBlocks []ui.Block) error {
 	for _, block := range initialBlocks {
@@ -597,8 +880,12 @@ func (s *session) listModels(ctx context.Context) ([]string, error) {
 func (s *session) answerQuery(ctx context.Context, query string) error {
 	switch {
 	case query == "model":
+		provider, model := s.conversation.ActiveModel()
+		if model == "" {
+			model = "default"
+		}
 		infoBlock := &ui.AgentTextBlock{}
-		infoBlock.AppendText(fmt.Sprintf("Current model is `%s`\n", s.model))
+		infoBlock.AppendText(fmt.Sprintf("Current model is `%s` (provider `%s`)\n", model, provider))
 		s.doc.AddBlock(infoBlock)
 
 	case query == "version":
@@ -623,14 +910,178 @@ func (s *session) answerQuery(ctx context.Context, query string) error {
 		infoBlock := &ui.AgentTextBlock{}
 		infoBlock.AppendText("\n  Available tools:\n")
 		infoBlock.AppendText(strings.Join(s.conversation.Tools.Names(), "\n"))
+		if disabled := s.conversation.Tools.DisabledNames(); len(disabled) > 0 {
+			infoBlock.AppendText("\n\n  Disabled tools:\n")
+			infoBlock.AppendText(strings.Join(disabled, "\n"))
+		}
 		s.doc.AddBlock(infoBlock)
 
+	case strings.HasPrefix(query, "tools "):
+		return s.handleToolsCommand(strings.Fields(query)[1:])
+
+	case query == "redaction" || strings.HasPrefix(query, "redaction "):
+		return s.handleRedactionCommand(strings.Fields(query)[1:])
+
+	case query == "thinking" || strings.HasPrefix(query, "thinking "):
+		return s.handleThinkingCommand(strings.Fields(query)[1:])
+
+	case query == "approvals" || strings.HasPrefix(query, "approvals "):
+		return s.handleApprovalsCommand(strings.Fields(query)[1:])
+
+	case query == "summarize":
+		return s.summarize(ctx)
+
+	case query == "usage":
+		if s.conversation == nil {
+			return fmt.Errorf("showing usage: conversation is not initialized")
+		}
+		usage := s.conversation.Usage()
+		if usage.Requests == 0 {
+			s.doc.AddBlock(ui.NewAgentTextBlock().WithText("No token usage reported by the LLM yet.\n"))
+		} else {
+			s.doc.AddBlock(ui.NewAgentTextBlock().WithText(fmt.Sprintf("Token usage of this session: %s\n", usage.String())))
+		}
+		if limiters := gollm.RateLimiterMetrics(); len(limiters) > 0 {
+			infoBlock := ui.NewAgentTextBlock().WithText("Rate limits:\n")
+			for _, stats := range limiters {
+				infoBlock.AppendText(fmt.Sprintf("  %s\n", stats.String()))
+			}
+			s.doc.AddBlock(infoBlock)
+		}
+
 	default:
 		return s.conversation.RunOneRound(ctx, query)
 	}
 	return nil
 }
 
+// handleToolsCommand handles the "tools reload|enable|disable" REPL commands.
+func (s *session) handleToolsCommand(args []string) error {
+	if s.conversation == nil {
+		return fmt.Errorf("managing tools: conversation is not initialized")
+	}
+
+	switch {
+	case len(args) == 1 && args[0] == "reload":
+		if s.customTools == nil {
+			return fmt.Errorf("reloading tools: no custom tool configuration")
+		}
+		result := s.customTools.Reload()
+		if result.Changed() {
+			s.conversation.ToolsChanged()
+		}
+		infoBlock := ui.NewAgentTextBlock().WithText(fmt.Sprintf("\n  Reloaded custom tools:\n%s", result))
+		s.doc.AddBlock(infoBlock)
+
+	case len(args) == 2 && (args[0] == "enable" || args[0] == "disable"):
+		enabled := args[0] == "enable"
+		if err := s.conversation.Tools.SetEnabled(args[1], enabled); err != nil {
+			return fmt.Errorf("%s tool: %w", args[0], err)
+		}
+		s.conversation.ToolsChanged()
+		s.doc.AddBlock(ui.NewAgentTextBlock().WithText(fmt.Sprintf("Tool `%s` %sd\n", args[1], args[0])))
+
+	default:
+		return fmt.Errorf("usage: tools [reload | enable <name> | disable <name>]")
+	}
+	return nil
+}
+
+// handleRedactionCommand handles the "redaction [on | off]" REPL commands,
+// which let the user explicitly inspect secrets for the rest of the session.
+func (s *session) handleRedactionCommand(args []string) error {
+	redactor := s.conversation.Redactor
+	if redactor == nil {
+		return fmt.Errorf("secret redaction is disabled by --redact-secrets=false")
+	}
+
+	switch {
+	case len(args) == 0:
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		redactor.SetEnabled(args[0] == "on")
+	default:
+		return fmt.Errorf("usage: redaction [on | off]")
+	}
+
+	if redactor.Enabled() {
+		s.doc.AddBlock(ui.NewAgentTextBlock().WithText("Secret redaction is on: secrets in tool results are replaced with placeholders.\n"))
+	} else {
+		s.doc.AddBlock(ui.NewAgentTextBlock().WithText("Secret redaction is off: tool results, including Secret data, are sent to the LLM and the trace unmodified. Use `redaction on` to turn it back on.\n"))
+	}
+	return nil
+}
+
+// handleThinkingCommand handles the "thinking [on | off]" REPL commands.
+// Without arguments it shows the collapsed reasoning of the last answer;
+// "on" and "off" choose whether reasoning is shown expanded from now on.
+func (s *session) handleThinkingCommand(args []string) error {
+	if s.conversation == nil {
+		return fmt.Errorf("showing reasoning: conversation is not initialized")
+	}
+
+	switch {
+	case len(args) == 0:
+		blocks := s.doc.Blocks()
+		for i := len(blocks) - 1; i >= 0; i-- {
+			if block, ok := blocks[i].(*ui.ReasoningBlock); ok {
+				reasoningBlock := ui.NewReasoningBlock().SetExpanded(true)
+				reasoningBlock.SetText(block.Text())
+				s.doc.AddBlock(reasoningBlock)
+				return nil
+			}
+		}
+		s.doc.AddBlock(ui.NewAgentTextBlock().WithText("The model has not reported any reasoning yet.\n"))
+	case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+		s.conversation.ShowReasoning = args[0] == "on"
+		if s.conversation.ShowReasoning {
+			s.doc.AddBlock(ui.NewAgentTextBlock().WithText("Reasoning is shown expanded.\n"))
+		} else {
+			s.doc.AddBlock(ui.NewAgentTextBlock().WithText("Reasoning is collapsed. Use `thinking` to show the last one.\n"))
+		}
+	default:
+		return fmt.Errorf("usage: thinking [on | off]")
+	}
+	return nil
+}
+
+// handleApprovalsCommand handles the "approvals [revoke <id> | clear]" REPL commands,
+// which list and revoke the approvals granted with "Yes, and don't ask again".
+func (s *session) handleApprovalsCommand(args []string) error {
+	if s.conversation == nil {
+		return fmt.Errorf("managing approvals: conversation is not initialized")
+	}
+	approvals := s.conversation.Approvals
+
+	switch {
+	case len(args) == 0:
+		list := approvals.List()
+		if len(list) == 0 {
+			s.doc.AddBlock(ui.NewAgentTextBlock().WithText("No approvals: every operation that modifies resources is confirmed.\n"))
+			return nil
+		}
+		infoBlock := ui.NewAgentTextBlock().WithText("\n  Approved for this session (`approvals revoke <id>` or `approvals clear` to revoke):\n")
+		for _, approval := range list {
+			infoBlock.AppendText(fmt.Sprintf("  %d) %s\n", approval.ID, approval.String()))
+		}
+		s.doc.AddBlock(infoBlock)
+
+	case len(args) == 2 && args[0] == "revoke":
+		id, err := strconv.Atoi(args[1])
+		if err != nil || !approvals.Revoke(id) {
+			return fmt.Errorf("no approval %q, use `approvals` to list them", args[1])
+		}
+		s.doc.AddBlock(ui.NewAgentTextBlock().WithText(fmt.Sprintf("Approval %d revoked\n", id)))
+
+	case len(args) == 1 && args[0] == "clear":
+		n := approvals.Clear()
+		s.doc.AddBlock(ui.NewAgentTextBlock().WithText(fmt.Sprintf("%d approvals revoked\n", n)))
+
+	default:
+		return fmt.Errorf("usage: approvals [revoke <id> | clear]")
+	}
+	return nil
+}
+
 // Redirect standard log output to our custom klog writer
 // This is primarily to suppress warning messages from
 // genai library https://github.com/googleapis/go-genai/blob/6ac4afc0168762dc3b7a4d940fc463cc1854f366/types.go#L1633
@@ -741,14 +1192,19 @@ func resolveKubeConfigPath(opt *Options) error {
 	return nil
 }
 
-func startMCPServer(ctx context.Context, opt Options) error {
+func startMCPServer(ctx context.Context, opt Options, registry *tools.Tools, sb *sandbox.Sandbox, auditLog *audit.Logger, redactor *redact.Redactor, contextPin *tools.ContextPin) error {
 	workDir := filepath.Join(os.TempDir(), "kubelet-wuhrai-mcp")
 	if err := os.MkdirAll(workDir, 0o755); err != nil {
 		return fmt.Errorf("error creating work directory: %w", err)
 	}
-	mcpServer, err := newKubectlMCPServer(ctx, opt.KubeConfigPath, tools.Default(), workDir, opt.ExternalTools)
+	mcpServer, err := newKubectlMCPServer(ctx, opt.KubeConfigPath, registry, workDir, opt.ExternalTools)
 	if err != nil {
 		return fmt.Errorf("creating mcp server: %w", err)
 	}
+	mcpServer.sandbox = sb
+	mcpServer.readOnly = opt.ReadOnly
+	mcpServer.audit = auditLog
+	mcpServer.redactor = redactor
+	mcpServer.contextPin = contextPin
 	return mcpServer.Serve(ctx)
 }
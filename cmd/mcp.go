@@ -22,7 +22,10 @@ import (
 	"fmt"
 
 	"github.com/st-lzh/kubelet-wuhrai/gollm"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/audit"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/mcp"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/redact"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/sandbox"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/tools"
 	mcpgo "github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -32,12 +35,21 @@ import (
 type kubectlMCPServer struct {
 	kubectlConfig string
 	server        *server.MCPServer
-	tools         tools.Tools
+	tools         *tools.Tools
 	workDir       string
 	mcpManager    *mcp.Manager // Add MCP manager for external tool calls
+	sandbox       *sandbox.Sandbox
+	// readOnly refuses tool calls that are not known to be read-only.
+	readOnly bool
+	// audit, if set, records the built-in tool calls.
+	audit *audit.Logger
+	// redactor, if set, replaces secrets in tool results before they are returned to the client.
+	redactor *redact.Redactor
+	// contextPin, if set, refuses tool calls that would act on other clusters or switch the kubeconfig context.
+	contextPin *tools.ContextPin
 }
 
-func newKubectlMCPServer(ctx context.Context, kubectlConfig string, tools tools.Tools, workDir string, exposeExternalTools bool) (*kubectlMCPServer, error) {
+func newKubectlMCPServer(ctx context.Context, kubectlConfig string, registry *tools.Tools, workDir string, exposeExternalTools bool) (*kubectlMCPServer, error) {
 	s := &kubectlMCPServer{
 		kubectlConfig: kubectlConfig,
 		workDir:       workDir,
@@ -46,7 +58,7 @@ func newKubectlMCPServer(ctx context.Context, kubectlConfig string, tools tools.
 			"0.0.1",
 			server.WithToolCapabilities(true),
 		),
-		tools: tools,
+		tools: registry,
 	}
 
 	// Add built-in tools
@@ -90,19 +102,12 @@ func newKubectlMCPServer(ctx context.Context, kubectlConfig string, tools tools.
 
 		// Add tools from MCP servers
 		totalToolsRegistered := 0
-		for serverName, tools := range serverTools {
-			klog.V(2).Infof("Processing tools from MCP server %s: %d tools found", serverName, len(tools))
-
-			for _, tool := range tools {
-				// Create unique tool name to avoid conflicts between servers
-				uniqueToolName := tool.Name
-				if tool.Server != "" {
-					// If tool already has server info, use it as-is
-					uniqueToolName = tool.Name
-				} else {
-					// Add server prefix to avoid name conflicts
-					uniqueToolName = fmt.Sprintf("%s_%s", serverName, tool.Name)
-				}
+		for serverName, serverToolList := range serverTools {
+			klog.V(2).Infof("Processing tools from MCP server %s: %d tools found", serverName, len(serverToolList))
+
+			for _, tool := range serverToolList {
+				// Namespace the tool name to avoid conflicts between servers
+				uniqueToolName := tools.MCPToolName(serverName, tool.Name)
 
 				// Use the actual tool schema instead of creating a generic wrapper
 				var schema *gollm.FunctionDefinition
@@ -182,6 +187,10 @@ func (s *kubectlMCPServer) handleToolCall(ctx context.Context, request mcpgo.Cal
 
 	// If not a built-in tool, try to handle as external MCP tool
 	if s.mcpManager != nil {
+		if s.readOnly {
+			// We cannot tell what external tools do, so they are never read-only.
+			return readOnlyRefusal(fmt.Errorf("%w: external tool %q might modify resources", tools.ErrReadOnly, toolName)), nil
+		}
 		return s.handleExternalMCPToolCall(ctx, request)
 	}
 
@@ -202,6 +211,9 @@ func (s *kubectlMCPServer) handleBuiltinToolCall(ctx context.Context, request mc
 	// Set up context for built-in tools
 	ctx = context.WithValue(ctx, tools.KubeconfigKey, s.kubectlConfig)
 	ctx = context.WithValue(ctx, tools.WorkDirKey, s.workDir)
+	if s.sandbox != nil {
+		ctx = context.WithValue(ctx, tools.SandboxKey, s.sandbox)
+	}
 
 	// Convert arguments to the expected type
 	args, ok := request.Params.Arguments.(map[string]any)
@@ -217,8 +229,54 @@ func (s *kubectlMCPServer) handleBuiltinToolCall(ctx context.Context, request mc
 		}, nil
 	}
 
+	auditEntry := &audit.Entry{
+		User:             audit.CurrentUser(),
+		Context:          tools.CurrentKubeContext(s.kubectlConfig),
+		Tool:             tool.Name(),
+		Arguments:        args,
+		ModifiesResource: tool.CheckModifiesResource(args),
+	}
+	if command, ok := args["command"].(string); ok {
+		auditEntry.Command = command
+	}
+
+	if s.readOnly {
+		if err := tools.CheckReadOnly(tool, args); err != nil {
+			auditEntry.Decision = audit.DecisionRefused
+			auditEntry.Reason = err.Error()
+			s.recordAudit(auditEntry)
+			return readOnlyRefusal(err), nil
+		}
+	}
+
+	if err := s.contextPin.Check(tool, args); err != nil {
+		auditEntry.Decision = audit.DecisionRefused
+		auditEntry.Reason = err.Error()
+		s.recordAudit(auditEntry)
+		return &mcpgo.CallToolResult{
+			IsError: true,
+			Content: []mcpgo.Content{
+				mcpgo.TextContent{
+					Type: "text",
+					Text: fmt.Sprintf("the tool call was not run: %v", err),
+				},
+			},
+		}, nil
+	}
+
 	// Execute the built-in tool
 	result, err := tool.Run(ctx, args)
+	if s.redactor.Enabled() {
+		var invocations []*tools.KubectlInvocation
+		if toolCall, err := s.tools.ParseToolInvocation(ctx, tool.Name(), args); err == nil {
+			invocations = toolCall.KubectlInvocations()
+		}
+		result = tools.RedactResult(s.redactor, invocations, result)
+	}
+	auditEntry.Decision = audit.DecisionApproved
+	auditEntry.ApprovedBy = "MCP client"
+	auditEntry.SetResult(result, err)
+	s.recordAudit(auditEntry)
 	if err != nil {
 		return &mcpgo.CallToolResult{
 			IsError: true,
@@ -250,6 +308,29 @@ func (s *kubectlMCPServer) handleBuiltinToolCall(ctx context.Context, request mc
 	}, nil
 }
 
+// recordAudit appends an entry to the audit log, if there is one.
+func (s *kubectlMCPServer) recordAudit(entry *audit.Entry) {
+	if s.audit == nil {
+		return
+	}
+	if err := s.audit.Append(entry); err != nil {
+		klog.Errorf("writing audit log: %v", err)
+	}
+}
+
+// readOnlyRefusal is the result of a tool call refused because the server is read-only.
+func readOnlyRefusal(err error) *mcpgo.CallToolResult {
+	return &mcpgo.CallToolResult{
+		IsError: true,
+		Content: []mcpgo.Content{
+			mcpgo.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("this MCP server is read-only and the tool call was not run: %v", err),
+			},
+		},
+	}
+}
+
 // handleExternalMCPToolCall handles calls to external MCP tools
 func (s *kubectlMCPServer) handleExternalMCPToolCall(ctx context.Context, request mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
 	toolName := request.Params.Name
@@ -272,16 +353,10 @@ func (s *kubectlMCPServer) handleExternalMCPToolCall(ctx context.Context, reques
 	var originalToolName string
 
 	// Look for the tool by checking both original name and server-prefixed name
-	for serverName, tools := range serverTools {
-		for _, tool := range tools {
+	for serverName, serverToolList := range serverTools {
+		for _, tool := range serverToolList {
 			// Check if this matches the requested tool (either direct name or server-prefixed name)
-			uniqueToolName := tool.Name
-			if tool.Server == "" {
-				// Add server prefix to match what was registered
-				uniqueToolName = fmt.Sprintf("%s_%s", serverName, tool.Name)
-			}
-
-			if uniqueToolName == toolName || tool.Name == toolName {
+			if tools.MCPToolName(serverName, tool.Name) == toolName || tool.Name == toolName {
 				targetServerName = serverName
 				originalToolName = tool.Name // Use the original tool name for the MCP call
 				break
@@ -364,7 +439,7 @@ func (s *kubectlMCPServer) handleExternalMCPToolCall(ctx context.Context, reques
 		Content: []mcpgo.Content{
 			mcpgo.TextContent{
 				Type: "text",
-				Text: result,
+				Text: s.redactor.Redact(result),
 			},
 		},
 	}, nil
@@ -19,6 +19,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -29,8 +30,9 @@ import (
 )
 
 // InitializeMCPClient initializes MCP client functionality when --mcp-client flag is used.
-// It connects to servers and registers discovered tools with the kubectl-ai tool system.
-func InitializeMCPClient() (*mcp.Manager, error) {
+// It connects to servers and registers discovered tools into the given registry,
+// under names namespaced by their server (see tools.MCPToolName).
+func InitializeMCPClient(registry *tools.Tools) (*mcp.Manager, error) {
 	// Initialize the MCP manager
 	manager, err := mcp.InitializeManager()
 	if err != nil {
@@ -41,14 +43,20 @@ func InitializeMCPClient() (*mcp.Manager, error) {
 	ctx := context.Background()
 	err = manager.RegisterWithToolSystem(ctx, func(serverName string, toolInfo mcp.Tool) error {
 		// Create schema for the tool
-		schema, err := tools.ConvertToolToGollm(&toolInfo)
+		schema, err := tools.ConvertToolToGollm(serverName, &toolInfo)
 		if err != nil {
 			return err
 		}
 
 		// Create and register MCP tool wrapper
 		mcpTool := tools.NewMCPTool(serverName, toolInfo.Name, toolInfo.Description, schema, manager)
-		tools.RegisterTool(mcpTool)
+		if err := registry.RegisterTool(mcpTool); err != nil {
+			if errors.Is(err, tools.ErrToolFiltered) {
+				klog.V(2).Infof("MCP tool %q is excluded by the tool filter", mcpTool.Name())
+				return nil
+			}
+			return err
+		}
 		return nil
 	})
 
@@ -0,0 +1,66 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/kubeconfig"
+	"k8s.io/klog/v2"
+)
+
+// hasReadOnlyIdentity returns true if the options give a read-only identity for commands to impersonate.
+func hasReadOnlyIdentity(opt *Options) bool {
+	return opt.ReadOnlyAs != "" || len(opt.ReadOnlyAsGroups) > 0
+}
+
+// applyReadOnlyIdentity makes kubectl impersonate the read-only identity given by the options:
+// it writes a minified copy of the kubeconfig whose current user impersonates it, and points the options at it.
+// Like the agent identity, the session is then pinned to the context, and commands may not select another
+// identity or kubeconfig (see pinKubeContext). The returned function removes the copy.
+func applyReadOnlyIdentity(opt *Options) (func(), error) {
+	if !hasReadOnlyIdentity(opt) {
+		return func() {}, nil
+	}
+	if !opt.ReadOnly {
+		return nil, fmt.Errorf("--read-only-as 和 --read-only-as-group 需要配合 --read-only 使用")
+	}
+	if len(opt.AllowedContexts) > 0 {
+		// The identity only applies to the pinned context.
+		return nil, fmt.Errorf("--read-only-as 和 --read-only-as-group 不能与 --allowed-contexts 同时使用")
+	}
+
+	config, err := kubeconfig.Load(opt.KubeConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("加载kubeconfig失败: %w", err)
+	}
+	if err := config.SetImpersonation(opt.ReadOnlyAs, opt.ReadOnlyAsGroups); err != nil {
+		return nil, fmt.Errorf("设置只读身份失败: %w", err)
+	}
+	// Drop the other contexts and their credentials.
+	if err := config.Minify(); err != nil {
+		return nil, fmt.Errorf("设置只读身份失败: %w", err)
+	}
+
+	cleanup, err := writeSessionKubeconfig(opt, config)
+	if err != nil {
+		return nil, err
+	}
+	klog.Infof("read-only mode: kubectl impersonates user %q, groups %v", opt.ReadOnlyAs, opt.ReadOnlyAsGroups)
+	return cleanup, nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/sandbox"
+	"k8s.io/klog/v2"
+)
+
+// newSandbox creates the sandbox requested by the options, or returns nil if sandboxing is off.
+func newSandbox(opt Options) (*sandbox.Sandbox, error) {
+	if !opt.Sandbox {
+		return nil, nil
+	}
+
+	policy := sandbox.DefaultPolicy()
+	policy.Tools = opt.SandboxTools
+	policy.Network = opt.SandboxNetwork
+	policy.AllowedCommands = opt.SandboxAllowedCommands
+
+	sb, err := sandbox.New(policy)
+	if err != nil {
+		return nil, fmt.Errorf("创建沙箱失败: %w", err)
+	}
+	klog.Infof("sandbox enabled for tools %v (network: %s)", policy.Tools, policy.Network)
+	return sb, nil
+}
+
+// buildSandboxForwardCommand builds the hidden command that relays API server traffic
+// from inside the sandbox; it is started by the sandbox itself, not by users.
+func buildSandboxForwardCommand() *cobra.Command {
+	var listen, socket string
+	cmd := &cobra.Command{
+		Use:    sandbox.ForwarderCommand,
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return sandbox.RunForwarder(cmd.Context(), listen, socket, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", "", "address to listen on")
+	cmd.Flags().StringVar(&socket, "socket", "", "unix socket to forward connections to")
+	return cmd
+}
@@ -0,0 +1,672 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	anthropicDefaultBaseURL = "https://api.anthropic.com"
+	anthropicDefaultModel   = "claude-sonnet-4-20250514"
+	anthropicAPIVersion     = "2023-06-01"
+	// anthropicMaxTokens is the maximum number of tokens of a response; the API requires one.
+	anthropicMaxTokens = 8192
+	// anthropicOverloaded is the status of "overloaded_error" responses.
+	anthropicOverloaded = 529
+)
+
+func init() {
+	if err := RegisterProvider("anthropic", anthropicFactory); err != nil {
+		klog.Fatalf("Failed to register anthropic provider: %v", err)
+	}
+}
+
+// anthropicFactory is the provider factory function for the Anthropic Messages API.
+// The endpoint is the host and path of the URL (e.g. "anthropic://gateway:8443?scheme=http"),
+// or ANTHROPIC_BASE_URL. The thinking_budget query parameter enables extended thinking with
+// that many tokens (e.g. "anthropic://?thinking_budget=4096").
+func anthropicFactory(ctx context.Context, opts ClientOptions) (Client, error) {
+	return NewAnthropicClient(ctx, opts)
+}
+
+// AnthropicClient is a Client for the Anthropic Messages API.
+type AnthropicClient struct {
+	baseURL      string
+	apiKey       string
+	defaultModel string
+	httpClient   *http.Client
+	// thinkingBudget is the number of tokens of extended thinking, or 0 to disable it.
+	thinkingBudget int
+}
+
+var _ Client = &AnthropicClient{}
+
+// NewAnthropicClient creates a client for the Anthropic Messages API.
+// The API key is read from ANTHROPIC_API_KEY, and the default model from ANTHROPIC_MODEL.
+func NewAnthropicClient(ctx context.Context, opts ClientOptions) (*AnthropicClient, error) {
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return nil, errors.New("Anthropic API key not found. Set via ANTHROPIC_API_KEY env var")
+	}
+
+	baseURL := anthropicDefaultBaseURL
+	if v := os.Getenv("ANTHROPIC_BASE_URL"); v != "" {
+		baseURL = v
+	}
+	if u := opts.URL; u != nil && u.Host != "" {
+		scheme := "https"
+		if s := u.Query().Get("scheme"); s != "" {
+			if s != "http" && s != "https" {
+				return nil, fmt.Errorf("invalid scheme %q in provider URL, want http or https", s)
+			}
+			scheme = s
+		}
+		baseURL = (&url.URL{Scheme: scheme, Host: u.Host, Path: u.Path}).String()
+	}
+	klog.V(1).Infof("Using Anthropic endpoint: %s", baseURL)
+
+	var thinkingBudget int
+	if u := opts.URL; u != nil && u.Query().Has("thinking_budget") {
+		budget, err := strconv.Atoi(u.Query().Get("thinking_budget"))
+		if err != nil || budget < 0 {
+			return nil, fmt.Errorf("invalid thinking_budget %q in provider URL, want a number of tokens", u.Query().Get("thinking_budget"))
+		}
+		thinkingBudget = budget
+	}
+
+	defaultModel := anthropicDefaultModel
+	if v := os.Getenv("ANTHROPIC_MODEL"); v != "" {
+		defaultModel = v
+	}
+
+	return &AnthropicClient{
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		apiKey:         apiKey,
+		defaultModel:   defaultModel,
+		httpClient:     createCustomHTTPClient(opts.SkipVerifySSL),
+		thinkingBudget: thinkingBudget,
+	}, nil
+}
+
+func (c *AnthropicClient) Close() error {
+	return nil
+}
+
+// model returns the model to use for the requested one. Models of other providers, like the
+// default model of the command line, fall back to the default model.
+func (c *AnthropicClient) model(model string) string {
+	if model == "" {
+		return c.defaultModel
+	}
+	if !strings.HasPrefix(model, "claude-") {
+		klog.Warningf("%q is not an Anthropic model, using %s", model, c.defaultModel)
+		return c.defaultModel
+	}
+	return model
+}
+
+// do sends a request to the API, and returns the response if it succeeded.
+// Errors of the API are returned as *APIError.
+func (c *AnthropicClient) do(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("building json body: %w", err)
+		}
+		klog.V(2).Infof("sending %s request to %s: %s", method, path, b)
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("building http request: %w", err)
+	}
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("performing http request: %w", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    string(b),
+			RetryAfter: ParseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		var errResp anthropicErrorResponse
+		if json.Unmarshal(b, &errResp) == nil && errResp.Error.Message != "" {
+			apiErr.Message = errResp.Error.Type + ": " + errResp.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// createMessage sends a non-streaming Messages API request.
+func (c *AnthropicClient) createMessage(ctx context.Context, req *anthropicRequest) (*anthropicResponse, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/v1/messages", req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	response := &anthropicResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return nil, fmt.Errorf("decoding Anthropic response: %w", err)
+	}
+	return response, nil
+}
+
+func (c *AnthropicClient) GenerateCompletion(ctx context.Context, request *CompletionRequest) (CompletionResponse, error) {
+	response, err := c.createMessage(ctx, &anthropicRequest{
+		Model:     c.model(request.Model),
+		MaxTokens: anthropicMaxTokens,
+		Messages: []anthropicMessage{{
+			Role:    "user",
+			Content: []anthropicContentBlock{{Type: "text", Text: request.Prompt}},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Anthropic completion: %w", err)
+	}
+
+	var text strings.Builder
+	for _, block := range response.Content {
+		text.WriteString(block.Text)
+	}
+	if text.Len() == 0 {
+		return nil, errors.New("received an empty response from Anthropic")
+	}
+	return &anthropicCompletionResponse{text: text.String(), usage: response.Usage.normalize(response.Model)}, nil
+}
+
+// SetResponseSchema is not supported by the Messages API.
+func (c *AnthropicClient) SetResponseSchema(schema *Schema) error {
+	klog.Warning("AnthropicClient.SetResponseSchema is not implemented")
+	return nil
+}
+
+func (c *AnthropicClient) ListModels(ctx context.Context) ([]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/v1/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error listing models from Anthropic: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return nil, fmt.Errorf("decoding Anthropic models: %w", err)
+	}
+	var ids []string
+	for _, model := range models.Data {
+		ids = append(ids, model.ID)
+	}
+	return ids, nil
+}
+
+func (c *AnthropicClient) StartChat(systemPrompt, model string) Chat {
+	selectedModel := c.model(model)
+	klog.V(1).Infof("Starting new Anthropic chat session with model: %s", selectedModel)
+	return &AnthropicChat{
+		client: c,
+		model:  selectedModel,
+		system: systemPrompt,
+	}
+}
+
+type anthropicCompletionResponse struct {
+	text  string
+	usage *Usage
+}
+
+func (r *anthropicCompletionResponse) Response() string {
+	return r.text
+}
+
+func (r *anthropicCompletionResponse) UsageMetadata() *Usage {
+	return r.usage
+}
+
+// AnthropicChat is a chat with the Anthropic Messages API.
+type AnthropicChat struct {
+	client  *AnthropicClient
+	model   string
+	system  string
+	history []anthropicMessage
+	tools   []anthropicTool
+}
+
+var _ Chat = &AnthropicChat{}
+
+// SetFunctionDefinitions converts the function definitions to Anthropic tools.
+func (c *AnthropicChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
+	c.tools = nil
+	for _, definition := range functionDefinitions {
+		inputSchema := json.RawMessage(`{"type": "object", "properties": {}}`)
+		if definition.Parameters != nil {
+			schema, err := definition.Parameters.ToRawSchema()
+			if err != nil {
+				return fmt.Errorf("converting schema of function %s: %w", definition.Name, err)
+			}
+			inputSchema = schema
+		}
+		c.tools = append(c.tools, anthropicTool{
+			Name:        definition.Name,
+			Description: definition.Description,
+			InputSchema: inputSchema,
+		})
+	}
+	return nil
+}
+
+// request returns the request with the contents added to the history.
+// The history itself is only updated once the request succeeded, so that retries don't repeat the contents.
+func (c *AnthropicChat) request(contents []any, stream bool) (*anthropicRequest, error) {
+	// Tool results must come first in the user message answering the tool calls.
+	var results, texts []anthropicContentBlock
+	for _, content := range contents {
+		switch v := content.(type) {
+		case string:
+			if v != "" {
+				texts = append(texts, anthropicContentBlock{Type: "text", Text: v})
+			}
+		case FunctionCallResult:
+			result, err := json.Marshal(v.Result)
+			if err != nil {
+				return nil, fmt.Errorf("marshalling function call result %q: %w", v.Name, err)
+			}
+			results = append(results, anthropicContentBlock{Type: "tool_result", ToolUseID: v.ID, Content: string(result)})
+		default:
+			return nil, fmt.Errorf("unsupported content type: %T", v)
+		}
+	}
+
+	messages := slices.Clip(c.history)
+	if blocks := append(results, texts...); len(blocks) > 0 {
+		messages = append(messages, anthropicMessage{Role: "user", Content: blocks})
+	}
+	req := &anthropicRequest{
+		Model:     c.model,
+		MaxTokens: anthropicMaxTokens,
+		System:    c.system,
+		Messages:  messages,
+		Tools:     c.tools,
+		Stream:    stream,
+	}
+	if budget := c.client.thinkingBudget; budget > 0 {
+		// The budget is part of the maximum number of tokens of the response.
+		req.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		req.MaxTokens += budget
+	}
+	return req, nil
+}
+
+func (c *AnthropicChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
+	req, err := c.request(contents, false)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.client.createMessage(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("Anthropic chat failed: %w", err)
+	}
+	klog.V(1).InfoS("Received response from Anthropic", "id", response.ID, "stop_reason", response.StopReason, "blocks", len(response.Content))
+
+	c.history = appendAssistantMessage(req.Messages, response.Content)
+	return &AnthropicChatResponse{blocks: response.Content, usage: response.Usage.normalize(response.Model)}, nil
+}
+
+// SendStreaming streams the response: thinking and text are streamed as they are received; tool calls,
+// and usage, come with the last response.
+func (c *AnthropicChat) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
+	req, err := c.request(contents, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.do(ctx, http.MethodPost, "/v1/messages", req)
+	if err != nil {
+		return nil, fmt.Errorf("Anthropic chat failed: %w", err)
+	}
+
+	return func(yield func(ChatResponse, error) bool) {
+		defer resp.Body.Close()
+
+		var blocks []anthropicContentBlock
+		var inputs []strings.Builder
+		var model string
+		var usage anthropicUsage
+		var stopped bool
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				// Event names are repeated in the data, and the other lines are blank or comments.
+				continue
+			}
+			var event anthropicStreamEvent
+			if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+				yield(nil, fmt.Errorf("decoding Anthropic stream event: %w", err))
+				return
+			}
+
+			switch event.Type {
+			case "message_start":
+				model = event.Message.Model
+				usage = event.Message.Usage
+			case "content_block_start":
+				for len(blocks) <= event.Index {
+					blocks = append(blocks, anthropicContentBlock{})
+					inputs = append(inputs, strings.Builder{})
+				}
+				blocks[event.Index] = event.ContentBlock
+			case "content_block_delta":
+				if event.Index >= len(blocks) {
+					yield(nil, fmt.Errorf("Anthropic stream: delta for unknown content block %d", event.Index))
+					return
+				}
+				block := &blocks[event.Index]
+				switch event.Delta.Type {
+				case "text_delta":
+					block.Text += event.Delta.Text
+					if !yield(&AnthropicChatResponse{blocks: []anthropicContentBlock{{Type: "text", Text: event.Delta.Text}}}, nil) {
+						return
+					}
+				case "input_json_delta":
+					inputs[event.Index].WriteString(event.Delta.PartialJSON)
+				case "thinking_delta":
+					block.Thinking += event.Delta.Thinking
+					if !yield(&AnthropicChatResponse{blocks: []anthropicContentBlock{{Type: "thinking", Thinking: event.Delta.Thinking}}}, nil) {
+						return
+					}
+				case "signature_delta":
+					block.Signature += event.Delta.Signature
+				}
+			case "content_block_stop":
+				if event.Index < len(blocks) && blocks[event.Index].Type == "tool_use" && inputs[event.Index].Len() > 0 {
+					blocks[event.Index].Input = json.RawMessage(inputs[event.Index].String())
+				}
+			case "message_delta":
+				// The usage of message_delta is cumulative.
+				if event.Usage.OutputTokens > 0 {
+					usage.OutputTokens = event.Usage.OutputTokens
+				}
+			case "message_stop":
+				stopped = true
+			case "error":
+				yield(nil, event.Error.apiError())
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			yield(nil, fmt.Errorf("reading Anthropic stream: %w", err))
+			return
+		}
+		if !stopped {
+			// The connection was closed before the end of the message.
+			yield(nil, fmt.Errorf("reading Anthropic stream: %w", io.ErrUnexpectedEOF))
+			return
+		}
+
+		c.history = appendAssistantMessage(req.Messages, blocks)
+
+		final := &AnthropicChatResponse{usage: usage.normalize(model)}
+		for _, block := range blocks {
+			if block.Type == "tool_use" {
+				final.blocks = append(final.blocks, block)
+			}
+		}
+		yield(final, nil)
+	}, nil
+}
+
+// appendAssistantMessage appends a response to the messages, without the blocks the API does not accept back.
+func appendAssistantMessage(messages []anthropicMessage, blocks []anthropicContentBlock) []anthropicMessage {
+	blocks = slices.DeleteFunc(slices.Clone(blocks), func(block anthropicContentBlock) bool {
+		return block.Type == "" || (block.Type == "text" && block.Text == "")
+	})
+	if len(blocks) == 0 {
+		return messages
+	}
+	return append(messages, anthropicMessage{Role: "assistant", Content: blocks})
+}
+
+// IsRetryableError returns true for rate limits, overloads and server errors.
+func (c *AnthropicChat) IsRetryableError(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == anthropicOverloaded {
+		return true
+	}
+	return DefaultIsRetryableError(err)
+}
+
+// AnthropicChatResponse is a response, or a chunk of a streamed response, of the Messages API.
+type AnthropicChatResponse struct {
+	blocks []anthropicContentBlock
+	usage  *Usage
+}
+
+var _ ChatResponse = &AnthropicChatResponse{}
+
+func (r *AnthropicChatResponse) UsageMetadata() *Usage {
+	return r.usage
+}
+
+func (r *AnthropicChatResponse) Candidates() []Candidate {
+	return []Candidate{&anthropicCandidate{blocks: r.blocks}}
+}
+
+type anthropicCandidate struct {
+	blocks []anthropicContentBlock
+}
+
+func (c *anthropicCandidate) String() string {
+	var sb strings.Builder
+	for _, block := range c.blocks {
+		sb.WriteString(block.Text)
+	}
+	return sb.String()
+}
+
+func (c *anthropicCandidate) Parts() []Part {
+	var parts []Part
+	var calls []FunctionCall
+	for _, block := range c.blocks {
+		switch block.Type {
+		case "thinking":
+			if block.Thinking != "" {
+				parts = append(parts, &anthropicPart{thinking: block.Thinking})
+			}
+		case "text":
+			if block.Text != "" {
+				parts = append(parts, &anthropicPart{text: block.Text})
+			}
+		case "tool_use":
+			args := map[string]any{}
+			if len(block.Input) > 0 {
+				if err := json.Unmarshal(block.Input, &args); err != nil {
+					klog.V(2).Infof("Error unmarshalling arguments of %s: %v", block.Name, err)
+				}
+			}
+			calls = append(calls, FunctionCall{ID: block.ID, Name: block.Name, Arguments: args})
+		}
+	}
+	if len(calls) > 0 {
+		parts = append(parts, &anthropicPart{functionCalls: calls})
+	}
+	return parts
+}
+
+type anthropicPart struct {
+	thinking      string
+	text          string
+	functionCalls []FunctionCall
+}
+
+func (p *anthropicPart) AsText() (string, bool) {
+	return p.text, p.text != ""
+}
+
+func (p *anthropicPart) AsFunctionCalls() ([]FunctionCall, bool) {
+	return p.functionCalls, len(p.functionCalls) > 0
+}
+
+func (p *anthropicPart) AsReasoning() (string, bool) {
+	return p.thinking, p.thinking != ""
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	Stream    bool               `json:"stream,omitempty"`
+	Thinking  *anthropicThinking `json:"thinking,omitempty"`
+}
+
+// anthropicThinking enables extended thinking.
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int    `json:"budget_tokens"`
+}
+
+type anthropicMessage struct {
+	Role    string                  `json:"role"`
+	Content []anthropicContentBlock `json:"content"`
+}
+
+// anthropicContentBlock is a block of a message: "text", "tool_use", "tool_result", "thinking"
+// or "redacted_thinking".
+type anthropicContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	// ID, Name and Input are set for "tool_use".
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// ToolUseID and Content are set for "tool_result".
+	ToolUseID string `json:"tool_use_id,omitempty"`
+	Content   string `json:"content,omitempty"`
+
+	// Thinking and Signature are set for "thinking", and Data for "redacted_thinking".
+	// Unlike the reasoning of other providers, they must be sent back unchanged.
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+type anthropicResponse struct {
+	ID         string                  `json:"id"`
+	Model      string                  `json:"model"`
+	Content    []anthropicContentBlock `json:"content"`
+	StopReason string                  `json:"stop_reason"`
+	Usage      anthropicUsage          `json:"usage"`
+}
+
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens,omitempty"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens,omitempty"`
+}
+
+// normalize returns the usage with the prompt tokens including the cached ones,
+// which the Messages API reports separately.
+func (u anthropicUsage) normalize(model string) *Usage {
+	return newUsage(Usage{
+		Model:            model,
+		PromptTokens:     u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CompletionTokens: u.OutputTokens,
+		CachedTokens:     u.CacheReadInputTokens,
+	})
+}
+
+type anthropicStreamEvent struct {
+	Type         string                `json:"type"`
+	Index        int                   `json:"index"`
+	Message      anthropicResponse     `json:"message"`
+	ContentBlock anthropicContentBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"`
+	Error anthropicError `json:"error"`
+}
+
+type anthropicErrorResponse struct {
+	Error anthropicError `json:"error"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// apiError returns an error received in a stream as an *APIError, with the status of the same error
+// when it is returned before streaming.
+func (e *anthropicError) apiError() *APIError {
+	status := http.StatusInternalServerError
+	switch e.Type {
+	case "overloaded_error":
+		status = anthropicOverloaded
+	case "rate_limit_error":
+		status = http.StatusTooManyRequests
+	case "invalid_request_error":
+		status = http.StatusBadRequest
+	}
+	return &APIError{StatusCode: status, Message: e.Type + ": " + e.Message}
+}
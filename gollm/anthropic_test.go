@@ -0,0 +1,260 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func newTestAnthropicChat(t *testing.T, server *testChatServer) Chat {
+	t.Helper()
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	client, err := NewClient(context.Background(), "anthropic://"+strings.TrimPrefix(server.URL, "http://")+"?scheme=http")
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	chat := client.StartChat("You are a test.", "deepseek-chat")
+	if err := chat.SetFunctionDefinitions([]*FunctionDefinition{{
+		Name:       "kubectl",
+		Parameters: &Schema{Type: TypeObject, Properties: map[string]*Schema{"command": {Type: TypeString}}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	return chat
+}
+
+func TestAnthropicChatSend(t *testing.T) {
+	server := newTestChatServer(t,
+		`{"id": "msg-1", "type": "message", "role": "assistant", "model": "claude-sonnet-4-20250514", "stop_reason": "tool_use",
+			"content": [{"type": "text", "text": "Let me check."},
+				{"type": "tool_use", "id": "toolu-1", "name": "kubectl", "input": {"command": "kubectl get pods"}}],
+			"usage": {"input_tokens": 20, "output_tokens": 10, "cache_read_input_tokens": 100}}`,
+		"error 529 Overloaded",
+		`{"id": "msg-2", "type": "message", "role": "assistant", "stop_reason": "end_turn",
+			"content": [{"type": "text", "text": "There is one pod."}], "usage": {"input_tokens": 40, "output_tokens": 5}}`,
+	)
+	chat := newTestAnthropicChat(t, server)
+	ctx := context.Background()
+
+	response, err := chat.Send(ctx, "list the pods")
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	parts := response.Candidates()[0].Parts()
+	if text, _ := parts[0].AsText(); text != "Let me check." {
+		t.Errorf("text = %q, want %q", text, "Let me check.")
+	}
+	calls, _ := parts[1].AsFunctionCalls()
+	if len(calls) != 1 || calls[0].ID != "toolu-1" || calls[0].Arguments["command"] != "kubectl get pods" {
+		t.Errorf("function calls = %+v, want kubectl get pods", calls)
+	}
+	wantUsage := Usage{Model: anthropicDefaultModel, PromptTokens: 120, CompletionTokens: 10, CachedTokens: 100, TotalTokens: 130}
+	if usage := response.UsageMetadata(); usage == nil || *usage != wantUsage {
+		t.Errorf("usage = %+v, want %+v", usage, wantUsage)
+	}
+
+	result := FunctionCallResult{ID: "toolu-1", Name: "kubectl", Result: map[string]any{"stdout": "web-1"}}
+	_, err = chat.Send(ctx, "anything else?", result)
+	if err == nil || !chat.IsRetryableError(err) {
+		t.Fatalf("Send() error = %v, want a retryable error", err)
+	}
+	if _, err := chat.Send(ctx, "anything else?", result); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	if got := server.headers[0].Get("x-api-key"); got != "test-key" {
+		t.Errorf("x-api-key = %q, want test-key", got)
+	}
+	request := server.requests[0]
+	if request["system"] != "You are a test." || request["model"] != anthropicDefaultModel {
+		t.Errorf("system = %v, model = %v", request["system"], request["model"])
+	}
+	tools, _ := json.Marshal(request["tools"])
+	if !strings.Contains(string(tools), `"input_schema":{"properties":{"command":{"type":"string"}},"type":"object"}`) {
+		t.Errorf("tools = %s", tools)
+	}
+
+	// The failed request is not repeated, and the tool result comes first in the user message.
+	messages, _ := json.Marshal(server.requests[2]["messages"])
+	want := `[{"content":[{"text":"list the pods","type":"text"}],"role":"user"},` +
+		`{"content":[{"text":"Let me check.","type":"text"},{"id":"toolu-1","input":{"command":"kubectl get pods"},"name":"kubectl","type":"tool_use"}],"role":"assistant"},` +
+		`{"content":[{"content":"{\"stdout\":\"web-1\"}","tool_use_id":"toolu-1","type":"tool_result"},{"text":"anything else?","type":"text"}],"role":"user"}]`
+	if string(messages) != want {
+		t.Errorf("messages =\n%s\nwant\n%s", messages, want)
+	}
+}
+
+func anthropicStream(events ...string) string {
+	var stream strings.Builder
+	for _, event := range events {
+		var typed struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal([]byte(event), &typed)
+		fmt.Fprintf(&stream, "event: %s\ndata: %s\n\n", typed.Type, event)
+	}
+	return stream.String()
+}
+
+func TestAnthropicChatSendStreaming(t *testing.T) {
+	server := newTestChatServer(t,
+		anthropicStream(
+			`{"type": "message_start", "message": {"id": "msg-1", "model": "claude-sonnet-4-20250514", "content": [], "usage": {"input_tokens": 20, "output_tokens": 1}}}`,
+			`{"type": "content_block_start", "index": 0, "content_block": {"type": "text", "text": ""}}`,
+			`{"type": "ping"}`,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "Let me "}}`,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "text_delta", "text": "check."}}`,
+			`{"type": "content_block_stop", "index": 0}`,
+			`{"type": "content_block_start", "index": 1, "content_block": {"type": "tool_use", "id": "toolu-1", "name": "kubectl", "input": {}}}`,
+			`{"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "{\"command\": "}}`,
+			`{"type": "content_block_delta", "index": 1, "delta": {"type": "input_json_delta", "partial_json": "\"kubectl get pods\"}"}}`,
+			`{"type": "content_block_stop", "index": 1}`,
+			`{"type": "message_delta", "delta": {"stop_reason": "tool_use"}, "usage": {"output_tokens": 15}}`,
+			`{"type": "message_stop"}`,
+		),
+		anthropicStream(
+			`{"type": "message_start", "message": {"id": "msg-2", "content": [], "usage": {"input_tokens": 40, "output_tokens": 1}}}`,
+			`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`,
+		),
+	)
+	chat := newTestAnthropicChat(t, server)
+
+	iterator, err := chat.SendStreaming(context.Background(), "list the pods")
+	if err != nil {
+		t.Fatalf("SendStreaming() error: %v", err)
+	}
+	var text strings.Builder
+	var calls []FunctionCall
+	var usage *Usage
+	for response, err := range iterator {
+		if err != nil {
+			t.Fatalf("streaming error: %v", err)
+		}
+		for _, part := range response.Candidates()[0].Parts() {
+			if s, ok := part.AsText(); ok {
+				text.WriteString(s)
+			}
+			if c, ok := part.AsFunctionCalls(); ok {
+				calls = append(calls, c...)
+			}
+		}
+		if u := response.UsageMetadata(); u != nil {
+			usage = u
+		}
+	}
+	if text.String() != "Let me check." {
+		t.Errorf("text = %q, want %q", text.String(), "Let me check.")
+	}
+	if len(calls) != 1 || calls[0].ID != "toolu-1" || calls[0].Arguments["command"] != "kubectl get pods" {
+		t.Errorf("function calls = %+v, want one kubectl get pods", calls)
+	}
+	if want := (Usage{Model: anthropicDefaultModel, PromptTokens: 20, CompletionTokens: 15, TotalTokens: 35}); usage == nil || *usage != want {
+		t.Errorf("usage = %+v, want %+v", usage, want)
+	}
+	if server.requests[0]["stream"] != true {
+		t.Errorf("stream = %v, want true", server.requests[0]["stream"])
+	}
+
+	iterator, err = chat.SendStreaming(context.Background(), FunctionCallResult{ID: "toolu-1", Name: "kubectl", Result: map[string]any{"stdout": "web-1"}})
+	if err != nil {
+		t.Fatalf("SendStreaming() error: %v", err)
+	}
+	for _, err := range iterator {
+		if err == nil || !chat.IsRetryableError(err) {
+			t.Errorf("streaming error = %v, want a retryable error", err)
+		}
+	}
+	messages, _ := json.Marshal(server.requests[1]["messages"])
+	if !strings.Contains(string(messages), `{"id":"toolu-1","input":{"command":"kubectl get pods"},"name":"kubectl","type":"tool_use"}`) {
+		t.Errorf("the tool call is missing from the history: %s", messages)
+	}
+}
+
+func TestAnthropicChatThinking(t *testing.T) {
+	server := newTestChatServer(t,
+		anthropicStream(
+			`{"type": "message_start", "message": {"id": "msg-1", "model": "claude-sonnet-4-20250514", "content": [], "usage": {"input_tokens": 20, "output_tokens": 1}}}`,
+			`{"type": "content_block_start", "index": 0, "content_block": {"type": "thinking", "thinking": ""}}`,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "thinking_delta", "thinking": "The user wants "}}`,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "thinking_delta", "thinking": "the pods."}}`,
+			`{"type": "content_block_delta", "index": 0, "delta": {"type": "signature_delta", "signature": "sig"}}`,
+			`{"type": "content_block_stop", "index": 0}`,
+			`{"type": "content_block_start", "index": 1, "content_block": {"type": "text", "text": ""}}`,
+			`{"type": "content_block_delta", "index": 1, "delta": {"type": "text_delta", "text": "Listing them."}}`,
+			`{"type": "content_block_stop", "index": 1}`,
+			`{"type": "message_stop"}`,
+		),
+		`{"id": "msg-2", "type": "message", "role": "assistant", "stop_reason": "end_turn",
+			"content": [{"type": "thinking", "thinking": "Nothing to add.", "signature": "sig-2"}, {"type": "text", "text": "Done."}],
+			"usage": {"input_tokens": 40, "output_tokens": 5}}`,
+	)
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	client, err := NewClient(context.Background(), "anthropic://"+strings.TrimPrefix(server.URL, "http://")+"?scheme=http&thinking_budget=1024")
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	chat := client.StartChat("You are a test.", "")
+
+	iterator, err := chat.SendStreaming(context.Background(), "list the pods")
+	if err != nil {
+		t.Fatalf("SendStreaming() error: %v", err)
+	}
+	var reasoning, text strings.Builder
+	for response, err := range iterator {
+		if err != nil {
+			t.Fatalf("streaming error: %v", err)
+		}
+		for _, part := range response.Candidates()[0].Parts() {
+			if s, ok := part.AsReasoning(); ok {
+				reasoning.WriteString(s)
+			}
+			if s, ok := part.AsText(); ok {
+				text.WriteString(s)
+			}
+		}
+	}
+	if reasoning.String() != "The user wants the pods." || text.String() != "Listing them." {
+		t.Errorf("reasoning = %q, text = %q", reasoning.String(), text.String())
+	}
+
+	response, err := chat.Send(context.Background(), "anything else?")
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	parts := response.Candidates()[0].Parts()
+	if s, _ := parts[0].AsReasoning(); s != "Nothing to add." {
+		t.Errorf("reasoning = %q, want %q", s, "Nothing to add.")
+	}
+	if _, ok := parts[0].AsText(); ok {
+		t.Errorf("thinking is returned as text")
+	}
+
+	thinking, _ := json.Marshal(server.requests[0]["thinking"])
+	if string(thinking) != `{"budget_tokens":1024,"type":"enabled"}` || server.requests[0]["max_tokens"] != float64(anthropicMaxTokens+1024) {
+		t.Errorf("thinking = %s, max_tokens = %v", thinking, server.requests[0]["max_tokens"])
+	}
+	// Signed thinking blocks must be sent back.
+	messages, _ := json.Marshal(server.requests[1]["messages"])
+	if !strings.Contains(string(messages), `{"signature":"sig","thinking":"The user wants the pods.","type":"thinking"}`) {
+		t.Errorf("the thinking block is missing from the history: %s", messages)
+	}
+}
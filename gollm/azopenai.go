@@ -20,6 +20,7 @@ package gollm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"slices"
@@ -123,7 +124,10 @@ func (c *AzureOpenAIClient) GenerateCompletion(ctx context.Context, request *Com
 		return nil, fmt.Errorf("invalid completion response: %v", resp)
 	}
 
-	return &AzureOpenAICompletionResponse{response: *resp.Choices[0].Message.Content}, nil
+	return &AzureOpenAICompletionResponse{
+		response: *resp.Choices[0].Message.Content,
+		usage:    azureOpenAIUsage(resp.Model, resp.Usage),
+	}, nil
 }
 
 func (c *AzureOpenAIClient) ListModels(ctx context.Context) ([]string, error) {
@@ -216,14 +220,15 @@ func (c *AzureOpenAIClient) StartChat(systemPrompt string, model string) Chat {
 
 type AzureOpenAICompletionResponse struct {
 	response string
+	usage    *Usage
 }
 
 func (r *AzureOpenAICompletionResponse) Response() string {
 	return r.response
 }
 
-func (r *AzureOpenAICompletionResponse) UsageMetadata() any {
-	return nil
+func (r *AzureOpenAICompletionResponse) UsageMetadata() *Usage {
+	return r.usage
 }
 
 type AzureOpenAIChat struct {
@@ -234,18 +239,20 @@ type AzureOpenAIChat struct {
 }
 
 func (c *AzureOpenAIChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
+	// The history is only updated if the request succeeds, so that it can be retried.
+	history := slices.Clip(c.history)
 	for _, content := range contents {
 		switch v := content.(type) {
 		case string:
 			message := azopenai.ChatRequestUserMessage{
 				Content: azopenai.NewChatRequestUserMessageContent(v),
 			}
-			c.history = append(c.history, &message)
+			history = append(history, &message)
 		case FunctionCallResult:
 			message := azopenai.ChatRequestUserMessage{
 				Content: azopenai.NewChatRequestUserMessageContent(fmt.Sprintf("Function call result: %s", v.Result)),
 			}
-			c.history = append(c.history, &message)
+			history = append(history, &message)
 		default:
 			return nil, fmt.Errorf("unsupported content type: %T", v)
 		}
@@ -253,7 +260,7 @@ func (c *AzureOpenAIChat) Send(ctx context.Context, contents ...any) (ChatRespon
 
 	resp, err := c.client.GetChatCompletions(ctx, azopenai.ChatCompletionsOptions{
 		DeploymentName: &c.model,
-		Messages:       c.history,
+		Messages:       history,
 		Tools:          c.tools,
 	}, nil)
 	if err != nil {
@@ -262,6 +269,7 @@ func (c *AzureOpenAIChat) Send(ctx context.Context, contents ...any) (ChatRespon
 	if len(resp.Choices) == 0 {
 		return nil, fmt.Errorf("no response from Azure OpenAI: %v", resp)
 	}
+	c.history = history
 
 	return &AzureOpenAIChatResponse{azureOpenAIResponse: resp}, nil
 }
@@ -271,6 +279,19 @@ func (c *AzureOpenAIChat) IsRetryableError(err error) bool {
 	return false
 }
 
+// azureAPIError converts the errors of the API to *APIError, with the delay the server asked to wait before retrying.
+func azureAPIError(err error) *APIError {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) {
+		return nil
+	}
+	converted := &APIError{StatusCode: respErr.StatusCode, Message: respErr.ErrorCode, Err: err}
+	if respErr.RawResponse != nil {
+		converted.RetryAfter = ParseRetryAfter(respErr.RawResponse.Header.Get("Retry-After"))
+	}
+	return converted
+}
+
 func (c *AzureOpenAIChat) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
 	// TODO: Implement streaming
 	response, err := c.Send(ctx, contents...)
@@ -297,8 +318,28 @@ func (r *AzureOpenAIChatResponse) String() string {
 	return fmt.Sprintf("AzureOpenAIChatResponse{candidates=%v}", r.azureOpenAIResponse.Choices)
 }
 
-func (r *AzureOpenAIChatResponse) UsageMetadata() any {
-	return r.azureOpenAIResponse.Usage
+func (r *AzureOpenAIChatResponse) UsageMetadata() *Usage {
+	return azureOpenAIUsage(r.azureOpenAIResponse.Model, r.azureOpenAIResponse.Usage)
+}
+
+// azureOpenAIUsage normalizes the usage of a chat completion.
+func azureOpenAIUsage(model *string, usage *azopenai.CompletionsUsage) *Usage {
+	if usage == nil {
+		return nil
+	}
+	normalized := Usage{
+		Model:            ptrValue(model),
+		PromptTokens:     int(ptrValue(usage.PromptTokens)),
+		CompletionTokens: int(ptrValue(usage.CompletionTokens)),
+		TotalTokens:      int(ptrValue(usage.TotalTokens)),
+	}
+	if details := usage.PromptTokensDetails; details != nil {
+		normalized.CachedTokens = int(ptrValue(details.CachedTokens))
+	}
+	if details := usage.CompletionTokensDetails; details != nil {
+		normalized.ReasoningTokens = int(ptrValue(details.ReasoningTokens))
+	}
+	return newUsage(normalized)
 }
 
 func (r *AzureOpenAIChatResponse) Candidates() []Candidate {
@@ -388,6 +429,11 @@ func (p *AzureOpenAIPart) AsFunctionCalls() ([]FunctionCall, bool) {
 	return nil, false
 }
 
+// AsReasoning returns false: the API does not return the reasoning separately.
+func (p *AzureOpenAIPart) AsReasoning() (string, bool) {
+	return "", false
+}
+
 func (c *AzureOpenAIChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
 	var tools []azopenai.ChatCompletionsToolDefinitionClassification
 	for _, functionDefinition := range functionDefinitions {
@@ -400,10 +446,7 @@ func (c *AzureOpenAIChat) SetFunctionDefinitions(functionDefinitions []*Function
 func fnDefToAzureOpenAITool(fnDef *FunctionDefinition) *azopenai.ChatCompletionsFunctionToolDefinitionFunction {
 	properties := make(map[string]any)
 	for paramName, param := range fnDef.Parameters.Properties {
-		properties[paramName] = map[string]any{
-			"type":        string(param.Type),
-			"description": param.Description,
-		}
+		properties[paramName] = param
 	}
 	parameters := map[string]any{
 		"type":       "object",
@@ -0,0 +1,489 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Kinds of recorded interactions.
+const (
+	InteractionChat       = "chat"
+	InteractionCompletion = "completion"
+	InteractionListModels = "listModels"
+)
+
+// Cassette is a recording of the requests sent to a language model and its responses.
+// It lets a session be replayed without the language model, e.g. to reproduce a bug.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Kind     string                    `json:"kind"`
+	Request  RecordRequest             `json:"request"`
+	Response RecordInteractionResponse `json:"response"`
+}
+
+// RecordRequest is a recorded request to a language model.
+type RecordRequest struct {
+	SystemPrompt        string                `json:"systemPrompt,omitempty"`
+	Model               string                `json:"model,omitempty"`
+	Prompt              string                `json:"prompt,omitempty"`
+	Contents            []RecordContent       `json:"contents,omitempty"`
+	FunctionDefinitions []*FunctionDefinition `json:"functionDefinitions,omitempty"`
+	Streaming           bool                  `json:"streaming,omitempty"`
+}
+
+// RecordContent is a recorded content of a chat message: text, or the result of a function call.
+type RecordContent struct {
+	Text               string              `json:"text,omitempty"`
+	FunctionCallResult *FunctionCallResult `json:"functionCallResult,omitempty"`
+}
+
+// RecordInteractionResponse is the recorded response to a request.
+type RecordInteractionResponse struct {
+	// Chunks are the chat responses, one per streamed chunk.
+	Chunks     []RecordChatResponse      `json:"chunks,omitempty"`
+	Completion *RecordCompletionResponse `json:"completion,omitempty"`
+	Models     []string                  `json:"models,omitempty"`
+
+	// Error is set if the request failed; StatusCode is set for API errors.
+	// For streams, the error was returned after the chunks.
+	Error      string `json:"error,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+}
+
+// LoadCassette reads a cassette file.
+func LoadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette: %w", err)
+	}
+	cassette := &Cassette{}
+	if err := json.Unmarshal(b, cassette); err != nil {
+		return nil, fmt.Errorf("parsing cassette %q: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// Save writes the cassette to a file.
+func (c *Cassette) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding cassette: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return fmt.Errorf("writing cassette: %w", err)
+	}
+	return nil
+}
+
+func recordContents(contents []any) ([]RecordContent, error) {
+	var recorded []RecordContent
+	for _, content := range contents {
+		switch v := content.(type) {
+		case string:
+			recorded = append(recorded, RecordContent{Text: v})
+		case FunctionCallResult:
+			recorded = append(recorded, RecordContent{FunctionCallResult: &v})
+		default:
+			return nil, fmt.Errorf("unsupported content type: %T", v)
+		}
+	}
+	return recorded, nil
+}
+
+func recordError(response *RecordInteractionResponse, err error) {
+	if err == nil {
+		return
+	}
+	response.Error = err.Error()
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		response.StatusCode = apiErr.StatusCode
+	}
+}
+
+func replayError(response *RecordInteractionResponse) error {
+	if response.Error == "" {
+		return nil
+	}
+	if response.StatusCode != 0 {
+		return &APIError{StatusCode: response.StatusCode, Message: response.Error}
+	}
+	return errors.New(response.Error)
+}
+
+// RecordingClient is a Client that records all the requests sent through it, and their responses,
+// to a cassette file. The file is rewritten after each interaction, so it survives crashes.
+type RecordingClient struct {
+	client Client
+	path   string
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+var _ Client = &RecordingClient{}
+
+// NewRecordingClient wraps a client to record its interactions to the cassette file at path.
+func NewRecordingClient(client Client, path string) *RecordingClient {
+	return &RecordingClient{client: client, path: path}
+}
+
+func (c *RecordingClient) record(interaction *Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cassette.Interactions = append(c.cassette.Interactions, interaction)
+	if err := c.cassette.Save(c.path); err != nil {
+		// Recording is a diagnostic aid, it must not break the session.
+		fmt.Fprintf(os.Stderr, "recording LLM interactions: %v\n", err)
+	}
+}
+
+func (c *RecordingClient) Close() error {
+	return c.client.Close()
+}
+
+func (c *RecordingClient) GenerateCompletion(ctx context.Context, req *CompletionRequest) (CompletionResponse, error) {
+	response, err := c.client.GenerateCompletion(ctx, req)
+
+	interaction := &Interaction{
+		Kind:    InteractionCompletion,
+		Request: RecordRequest{Model: req.Model, Prompt: req.Prompt},
+	}
+	if response != nil {
+		interaction.Response.Completion = &RecordCompletionResponse{Text: response.Response(), Usage: response.UsageMetadata()}
+	}
+	recordError(&interaction.Response, err)
+	c.record(interaction)
+	return response, err
+}
+
+func (c *RecordingClient) SetResponseSchema(schema *Schema) error {
+	return c.client.SetResponseSchema(schema)
+}
+
+func (c *RecordingClient) ListModels(ctx context.Context) ([]string, error) {
+	models, err := c.client.ListModels(ctx)
+
+	interaction := &Interaction{Kind: InteractionListModels}
+	interaction.Response.Models = models
+	recordError(&interaction.Response, err)
+	c.record(interaction)
+	return models, err
+}
+
+func (c *RecordingClient) StartChat(systemPrompt, model string) Chat {
+	return &recordingChat{
+		client:       c,
+		chat:         c.client.StartChat(systemPrompt, model),
+		systemPrompt: systemPrompt,
+		model:        model,
+	}
+}
+
+type recordingChat struct {
+	client       *RecordingClient
+	chat         Chat
+	systemPrompt string
+	model        string
+
+	functionDefinitions []*FunctionDefinition
+}
+
+func (c *recordingChat) newInteraction(contents []any, streaming bool) *Interaction {
+	recorded, err := recordContents(contents)
+	if err != nil {
+		// The underlying chat reports it.
+		recorded = nil
+	}
+	return &Interaction{
+		Kind: InteractionChat,
+		Request: RecordRequest{
+			SystemPrompt:        c.systemPrompt,
+			Model:               c.model,
+			Contents:            recorded,
+			FunctionDefinitions: c.functionDefinitions,
+			Streaming:           streaming,
+		},
+	}
+}
+
+func (c *recordingChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
+	interaction := c.newInteraction(contents, false)
+	response, err := c.chat.Send(ctx, contents...)
+	if response != nil {
+		interaction.Response.Chunks = append(interaction.Response.Chunks, NewRecordChatResponse(response))
+	}
+	recordError(&interaction.Response, err)
+	c.client.record(interaction)
+	return response, err
+}
+
+func (c *recordingChat) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
+	interaction := c.newInteraction(contents, true)
+	stream, err := c.chat.SendStreaming(ctx, contents...)
+	if err != nil {
+		recordError(&interaction.Response, err)
+		c.client.record(interaction)
+		return nil, err
+	}
+
+	return func(yield func(ChatResponse, error) bool) {
+		// Record what was received, even if the caller stops early.
+		defer c.client.record(interaction)
+		for response, err := range stream {
+			if err != nil {
+				recordError(&interaction.Response, err)
+			} else if response != nil {
+				interaction.Response.Chunks = append(interaction.Response.Chunks, NewRecordChatResponse(response))
+			}
+			if !yield(response, err) {
+				return
+			}
+		}
+	}, nil
+}
+
+func (c *recordingChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
+	c.functionDefinitions = functionDefinitions
+	return c.chat.SetFunctionDefinitions(functionDefinitions)
+}
+
+func (c *recordingChat) IsRetryableError(err error) bool {
+	return c.chat.IsRetryableError(err)
+}
+
+// ReplayClient is a Client that serves the responses recorded in a cassette, in order.
+// Each request must match the recorded one, otherwise it fails with an error describing the difference.
+// Function results are only matched by ID and name: they come from running tools again,
+// and their output depends on the state of the cluster. The system prompt is recorded but not
+// matched either, as it describes the environment the session ran in.
+type ReplayClient struct {
+	cassette *Cassette
+
+	mu   sync.Mutex
+	next int
+}
+
+var _ Client = &ReplayClient{}
+
+// NewReplayClient creates a client that replays the cassette file at path.
+func NewReplayClient(path string) (*ReplayClient, error) {
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &ReplayClient{cassette: cassette}, nil
+}
+
+// Done returns an error if some interactions of the cassette were not replayed.
+func (c *ReplayClient) Done() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if remaining := len(c.cassette.Interactions) - c.next; remaining > 0 {
+		return fmt.Errorf("replay: %d of %d recorded interactions were not replayed", remaining, len(c.cassette.Interactions))
+	}
+	return nil
+}
+
+// replay returns the next recorded interaction, if it matches the request.
+func (c *ReplayClient) replay(kind string, request RecordRequest) (*Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next >= len(c.cassette.Interactions) {
+		return nil, fmt.Errorf("replay: unexpected %s request %d, the cassette has %d interactions", kind, c.next+1, len(c.cassette.Interactions))
+	}
+	interaction := c.cassette.Interactions[c.next]
+	c.next++
+
+	if interaction.Kind != kind {
+		return nil, fmt.Errorf("replay: request %d is a %s request, but a %s request was recorded", c.next, kind, interaction.Kind)
+	}
+	if diff := diffRequests(&interaction.Request, &request); diff != "" {
+		return nil, fmt.Errorf("replay: request %d does not match the cassette: %s", c.next, diff)
+	}
+	return interaction, nil
+}
+
+// diffRequests describes the first difference between a recorded request and a new one, or returns "".
+func diffRequests(recorded, request *RecordRequest) string {
+	switch {
+	case recorded.Model != request.Model:
+		return fmt.Sprintf("model is %q, recorded %q", request.Model, recorded.Model)
+	case recorded.Prompt != request.Prompt:
+		return fmt.Sprintf("prompt is %q, recorded %q", request.Prompt, recorded.Prompt)
+	}
+
+	functions := func(definitions []*FunctionDefinition) []string {
+		var names []string
+		for _, definition := range definitions {
+			names = append(names, definition.Name)
+		}
+		return names
+	}
+	if got, want := functions(request.FunctionDefinitions), functions(recorded.FunctionDefinitions); !slices.Equal(got, want) {
+		return fmt.Sprintf("functions are %v, recorded %v", got, want)
+	}
+
+	if len(request.Contents) != len(recorded.Contents) {
+		return fmt.Sprintf("%d contents were sent, recorded %d", len(request.Contents), len(recorded.Contents))
+	}
+	for i, content := range request.Contents {
+		want := recorded.Contents[i]
+		switch {
+		case content.Text != want.Text:
+			return fmt.Sprintf("content %d is %q, recorded %q", i+1, content.Text, want.Text)
+		case (content.FunctionCallResult == nil) != (want.FunctionCallResult == nil):
+			return fmt.Sprintf("content %d is a different type than recorded", i+1)
+		case content.FunctionCallResult != nil &&
+			(content.FunctionCallResult.ID != want.FunctionCallResult.ID || content.FunctionCallResult.Name != want.FunctionCallResult.Name):
+			return fmt.Sprintf("content %d is the result of %s (%s), recorded %s (%s)", i+1,
+				content.FunctionCallResult.Name, content.FunctionCallResult.ID, want.FunctionCallResult.Name, want.FunctionCallResult.ID)
+		}
+	}
+	return ""
+}
+
+func (c *ReplayClient) Close() error {
+	return nil
+}
+
+func (c *ReplayClient) GenerateCompletion(ctx context.Context, req *CompletionRequest) (CompletionResponse, error) {
+	interaction, err := c.replay(InteractionCompletion, RecordRequest{Model: req.Model, Prompt: req.Prompt})
+	if err != nil {
+		return nil, err
+	}
+	if err := replayError(&interaction.Response); err != nil {
+		return nil, err
+	}
+	response := &staticCompletionResponse{}
+	if completion := interaction.Response.Completion; completion != nil {
+		response.text = completion.Text
+		response.usage = completion.Usage
+	}
+	return response, nil
+}
+
+func (c *ReplayClient) SetResponseSchema(schema *Schema) error {
+	return nil
+}
+
+func (c *ReplayClient) ListModels(ctx context.Context) ([]string, error) {
+	interaction, err := c.replay(InteractionListModels, RecordRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return interaction.Response.Models, replayError(&interaction.Response)
+}
+
+func (c *ReplayClient) StartChat(systemPrompt, model string) Chat {
+	return &replayChat{client: c, systemPrompt: systemPrompt, model: model}
+}
+
+type replayChat struct {
+	client       *ReplayClient
+	systemPrompt string
+	model        string
+
+	functionDefinitions []*FunctionDefinition
+}
+
+func (c *replayChat) replay(contents []any, streaming bool) (*Interaction, error) {
+	recorded, err := recordContents(contents)
+	if err != nil {
+		return nil, err
+	}
+	return c.client.replay(InteractionChat, RecordRequest{
+		SystemPrompt:        c.systemPrompt,
+		Model:               c.model,
+		Contents:            recorded,
+		FunctionDefinitions: c.functionDefinitions,
+		Streaming:           streaming,
+	})
+}
+
+func (c *replayChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
+	interaction, err := c.replay(contents, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := replayError(&interaction.Response); err != nil {
+		return nil, err
+	}
+	response := &staticChatResponse{}
+	for _, chunk := range interaction.Response.Chunks {
+		response.parts = append(response.parts, chunk.chatParts()...)
+		if chunk.Usage != nil {
+			response.usage = chunk.Usage
+		}
+	}
+	return response, nil
+}
+
+func (c *replayChat) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
+	interaction, err := c.replay(contents, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(interaction.Response.Chunks) == 0 {
+		if err := replayError(&interaction.Response); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(yield func(ChatResponse, error) bool) {
+		for _, chunk := range interaction.Response.Chunks {
+			if !yield(&staticChatResponse{parts: chunk.chatParts(), usage: chunk.Usage}, nil) {
+				return
+			}
+		}
+		if err := replayError(&interaction.Response); err != nil {
+			yield(nil, err)
+		}
+	}, nil
+}
+
+func (c *replayChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
+	c.functionDefinitions = functionDefinitions
+	return nil
+}
+
+func (c *replayChat) IsRetryableError(err error) bool {
+	return DefaultIsRetryableError(err)
+}
+
+// chatParts returns the recorded parts as the parts of a chat response.
+func (r *RecordChatResponse) chatParts() []Part {
+	var parts []Part
+	for _, part := range r.Parts {
+		parts = append(parts, &staticPart{reasoning: part.Reasoning, text: part.Text, functionCalls: part.FunctionCalls})
+	}
+	return parts
+}
@@ -0,0 +1,90 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runTestSession runs the session of testFakeScript on a chat, and returns the streamed text.
+func runTestSession(t *testing.T, client Client, result string) (string, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	chat := client.StartChat("system", "fake-model")
+	if err := chat.SetFunctionDefinitions([]*FunctionDefinition{{Name: "bash"}, {Name: "kubectl"}}); err != nil {
+		return "", err
+	}
+	var text strings.Builder
+	stream, err := chat.SendStreaming(ctx, "please list the pods")
+	if err != nil {
+		return "", err
+	}
+	for response, err := range stream {
+		if err != nil {
+			return "", err
+		}
+		text.WriteString(response.Candidates()[0].String())
+	}
+	response, err := chat.Send(ctx, FunctionCallResult{ID: "call-1", Name: "kubectl", Result: map[string]any{"stdout": result}})
+	if err != nil {
+		return "", err
+	}
+	text.WriteString(response.Candidates()[0].String())
+	return text.String(), nil
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	recording := NewRecordingClient(newTestFakeClient(t), path)
+	recorded, err := runTestSession(t, recording, "web-1 Running")
+	if err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+
+	replay, err := NewReplayClient(path)
+	if err != nil {
+		t.Fatalf("NewReplayClient() returned error: %v", err)
+	}
+	// Tool output depends on the cluster, so it does not need to match the recording.
+	replayed, err := runTestSession(t, replay, "web-2 Pending")
+	if err != nil {
+		t.Fatalf("replaying: %v", err)
+	}
+	if replayed != recorded {
+		t.Errorf("replayed %q, recorded %q", replayed, recorded)
+	}
+	if err := replay.Done(); err != nil {
+		t.Error(err)
+	}
+
+	replay, err = NewReplayClient(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chat := replay.StartChat("system", "fake-model")
+	chat.SetFunctionDefinitions([]*FunctionDefinition{{Name: "bash"}, {Name: "kubectl"}})
+	_, err = chat.Send(context.Background(), "something else")
+	if err == nil || !strings.Contains(err.Error(), `content 1 is "something else", recorded "please list the pods"`) {
+		t.Errorf("Send() with a different request = %v, want a mismatch error", err)
+	}
+}
@@ -22,13 +22,16 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand/v2"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"k8s.io/klog/v2"
@@ -144,6 +147,9 @@ type APIError struct {
 	StatusCode int
 	Message    string
 	Err        error
+
+	// RetryAfter is how long the provider asked to wait before retrying (the Retry-After header), if it did.
+	RetryAfter time.Duration
 }
 
 func (e *APIError) Error() string {
@@ -185,12 +191,55 @@ func DefaultIsRetryableError(err error) bool {
 		return true
 	}
 
+	// The connection was dropped, e.g. in the middle of a streamed response.
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
 	// Add other error checks specific to LLM clients if needed
 	// e.g., if errors.Is(err, specificLLMRateLimitError) { return true }
 
 	return false
 }
 
+// ParseRetryAfter parses the value of a Retry-After header: a number of seconds, or an HTTP date.
+// It returns 0 if the value is empty or invalid.
+func ParseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+	return 0
+}
+
+// retryAfter returns how long the provider asked to wait before retrying after the error, or 0.
+func retryAfter(err error) time.Duration {
+	if apiErr := asAPIError(err); apiErr != nil {
+		return apiErr.RetryAfter
+	}
+	return 0
+}
+
+// asAPIError returns the error as *APIError, converting the errors of the provider SDKs that
+// are not returned as *APIError, or nil if the error does not come from a response of the provider.
+func asAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	for _, convert := range []func(error) *APIError{geminiAPIError, azureAPIError, ollamaAPIError} {
+		if apiErr := convert(err); apiErr != nil {
+			return apiErr
+		}
+	}
+	return nil
+}
+
 // createCustomHTTPClient returns an *http.Client that optionally skips SSL certificate verification.
 // This is shared by all providers that need custom HTTP transport.
 func createCustomHTTPClient(skipVerify bool) *http.Client {
@@ -238,10 +287,10 @@ func Retry[T any](
 
 	log := klog.FromContext(ctx)
 
-	backoff := config.InitialBackoff
+	backoff := newRetryBackoff(config)
 
 	for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
-		log.V(2).Info("Retry attempt started", "attempt", attempt, "maxAttempts", config.MaxAttempts, "backoff", backoff)
+		log.V(2).Info("Retry attempt started", "attempt", attempt, "maxAttempts", config.MaxAttempts)
 		result, err := operation(ctx)
 
 		if err == nil {
@@ -271,27 +320,8 @@ func Retry[T any](
 			break
 		}
 
-		// Calculate wait time
-		waitTime := backoff
-		if config.Jitter {
-			waitTime += time.Duration(rand.Float64() * float64(backoff) / 2)
-		}
-
-		log.V(2).Info("Waiting before next retry attempt", "waitTime", waitTime, "nextAttempt", attempt+1, "maxAttempts", config.MaxAttempts)
-
-		// Wait or react to context cancellation
-		select {
-		case <-time.After(waitTime):
-			// Wait finished
-		case <-ctx.Done():
-			log.Info("Context cancelled while waiting for retry after attempt %d.", "attempt", attempt)
-			return zero, ctx.Err()
-		}
-
-		// Increase backoff
-		backoff = time.Duration(float64(backoff) * config.BackoffFactor)
-		if backoff > config.MaxBackoff {
-			backoff = config.MaxBackoff
+		if err := backoff.wait(ctx, lastErr, attempt); err != nil {
+			return zero, err
 		}
 	}
 
@@ -300,6 +330,66 @@ func Retry[T any](
 	return zero, errFinal
 }
 
+// retryBackoff computes the waits between the attempts of a retried operation.
+type retryBackoff struct {
+	config RetryConfig
+	next   time.Duration
+}
+
+func newRetryBackoff(config RetryConfig) *retryBackoff {
+	return &retryBackoff{config: config, next: config.InitialBackoff}
+}
+
+// wait waits before the attempt following a failed one: the backoff, or longer if the provider asked for it
+// with a Retry-After header. It returns the error of the context if it is cancelled while waiting.
+func (b *retryBackoff) wait(ctx context.Context, err error, attempt int) error {
+	log := klog.FromContext(ctx)
+
+	// Calculate wait time
+	waitTime := b.next
+	if b.config.Jitter {
+		waitTime += time.Duration(rand.Float64() * float64(b.next) / 2)
+	}
+	if after := retryAfter(err); after > waitTime {
+		waitTime = after
+	}
+
+	log.V(2).Info("Waiting before next retry attempt", "waitTime", waitTime, "nextAttempt", attempt+1, "maxAttempts", b.config.MaxAttempts)
+
+	// Wait or react to context cancellation
+	select {
+	case <-time.After(waitTime):
+		// Wait finished
+	case <-ctx.Done():
+		log.Info("Context cancelled while waiting for retry", "attempt", attempt)
+		return ctx.Err()
+	}
+
+	// Increase backoff
+	b.next = time.Duration(float64(b.next) * b.config.BackoffFactor)
+	if b.next > b.config.MaxBackoff {
+		b.next = b.config.MaxBackoff
+	}
+	return nil
+}
+
+// StreamRestartError is yielded by the stream of a retrying chat when the stream failed after some
+// responses were received, and the request is sent again. It is not the end of the stream:
+// the responses received so far must be discarded, and the responses of the new attempt follow.
+type StreamRestartError struct {
+	// Attempt is the attempt that failed.
+	Attempt int
+	Err     error
+}
+
+func (e *StreamRestartError) Error() string {
+	return fmt.Sprintf("streaming response interrupted on attempt %d, retrying: %v", e.Attempt, e.Err)
+}
+
+func (e *StreamRestartError) Unwrap() error {
+	return e.Err
+}
+
 // retryChat is a generic decorator that adds retry logic to any Chat implementation.
 type retryChat[C Chat] struct {
 	underlying  Chat // The actual client implementation being wrapped
@@ -331,9 +421,69 @@ func (rc *retryChat[C]) Send(ctx context.Context, contents ...any) (ChatResponse
 	return Retry[ChatResponse](ctx, rc.config, rc.underlying.IsRetryableError, operation)
 }
 
-// Embed implements the Client interface for the retryClient decorator.
+// SendStreaming retries the request if it fails with a retryable error before the first response.
+// If it fails after that, the request is sent again after a *StreamRestartError is yielded,
+// so that the consumer can discard the partial response.
+// This relies on the underlying chat not adding a failed request to its history.
 func (rc *retryChat[C]) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
-	return rc.underlying.SendStreaming(ctx, contents...)
+	return func(yield func(ChatResponse, error) bool) {
+		log := klog.FromContext(ctx)
+		backoff := newRetryBackoff(rc.config)
+
+		for attempt := 1; ; attempt++ {
+			received := false
+			stream, err := rc.underlying.SendStreaming(ctx, contents...)
+			if err == nil {
+				for response, streamErr := range stream {
+					var restart *StreamRestartError
+					if errors.As(streamErr, &restart) {
+						// The underlying chat restarted the response itself, e.g. with another provider.
+						received = false
+						if !yield(nil, streamErr) {
+							return
+						}
+						continue
+					}
+					if streamErr != nil {
+						err = streamErr
+						break
+					}
+					received = true
+					if !yield(response, nil) {
+						return
+					}
+				}
+				if err == nil {
+					return
+				}
+			}
+
+			if ctx.Err() != nil {
+				yield(nil, ctx.Err())
+				return
+			}
+			if !rc.underlying.IsRetryableError(err) {
+				log.Info("Streaming attempt failed with non-retryable error", "attempt", attempt, "error", err)
+				yield(nil, err)
+				return
+			}
+			if attempt >= rc.config.MaxAttempts {
+				yield(nil, fmt.Errorf("operation failed after %d attempts: %w", attempt, err))
+				return
+			}
+			log.Info("Streaming attempt failed with retryable error", "attempt", attempt, "received", received, "error", err)
+
+			if received {
+				if !yield(nil, &StreamRestartError{Attempt: attempt, Err: err}) {
+					return
+				}
+			}
+			if err := backoff.wait(ctx, err, attempt); err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}, nil
 }
 
 func (rc *retryChat[C]) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
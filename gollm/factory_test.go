@@ -0,0 +1,144 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fastRetryConfig = RetryConfig{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     time.Millisecond,
+	BackoffFactor:  2,
+}
+
+// collectStream returns the text of a stream, with the errors it yielded in brackets.
+func collectStream(t *testing.T, chat Chat, contents ...any) string {
+	t.Helper()
+	stream, err := chat.SendStreaming(context.Background(), contents...)
+	if err != nil {
+		t.Fatalf("SendStreaming() error: %v", err)
+	}
+	var sb strings.Builder
+	for response, err := range stream {
+		if err != nil {
+			var restart *StreamRestartError
+			if errors.As(err, &restart) {
+				sb.WriteString("[restart]")
+				continue
+			}
+			sb.WriteString("[" + err.Error() + "]")
+			continue
+		}
+		for _, part := range response.Candidates()[0].Parts() {
+			if text, ok := part.AsText(); ok {
+				sb.WriteString(text)
+			}
+		}
+	}
+	return sb.String()
+}
+
+func TestRetryChatSendStreaming(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		turns []FakeTurn
+		want  string
+	}{
+		{
+			name: "retried before the first chunk",
+			turns: []FakeTurn{
+				{Error: "rate limited", ErrorStatusCode: http.StatusTooManyRequests},
+				{Chunks: []FakeChunk{{Text: "There is "}, {Text: "one pod."}}},
+			},
+			want: "There is one pod.",
+		},
+		{
+			name: "replayed after a failure mid-stream",
+			turns: []FakeTurn{
+				{Chunks: []FakeChunk{{Text: "There "}, {Error: "connection reset", ErrorStatusCode: http.StatusBadGateway}}},
+				{Chunks: []FakeChunk{{Text: "There is "}, {Text: "one pod."}}},
+			},
+			want: "There [restart]There is one pod.",
+		},
+		{
+			name: "not retried after a non-retryable error",
+			turns: []FakeTurn{
+				{Chunks: []FakeChunk{{Text: "There "}, {Error: "context too long", ErrorStatusCode: http.StatusBadRequest}}},
+			},
+			want: "There [API Error: Status=400, Message='context too long']",
+		},
+		{
+			name: "gives up after the last attempt",
+			turns: []FakeTurn{
+				{Error: "overloaded", ErrorStatusCode: http.StatusServiceUnavailable},
+				{Error: "overloaded", ErrorStatusCode: http.StatusServiceUnavailable},
+				{Error: "overloaded", ErrorStatusCode: http.StatusServiceUnavailable},
+			},
+			want: "[operation failed after 3 attempts: API Error: Status=503, Message='overloaded']",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewFakeClient(&FakeScript{Turns: tc.turns})
+			chat := NewRetryChat(client.StartChat("", ""), fastRetryConfig)
+			if got := collectStream(t, chat, "list the pods"); got != tc.want {
+				t.Errorf("stream = %q, want %q", got, tc.want)
+			}
+			if err := client.Done(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffRespectsRetryAfter(t *testing.T) {
+	backoff := newRetryBackoff(fastRetryConfig)
+	err := &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 50 * time.Millisecond}
+	start := time.Now()
+	if err := backoff.wait(context.Background(), err, 1); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("waited %v, want at least the 50ms of Retry-After", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"":        0,
+		"2":       2 * time.Second,
+		"0.5":     500 * time.Millisecond,
+		"-1":      0,
+		"invalid": 0,
+		time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat): 0,
+	} {
+		if got := ParseRetryAfter(value); got != want {
+			t.Errorf("ParseRetryAfter(%q) = %v, want %v", value, got, want)
+		}
+	}
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got := ParseRetryAfter(date); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("ParseRetryAfter(%q) = %v, want about an hour", date, got)
+	}
+}
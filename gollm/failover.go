@@ -0,0 +1,358 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// FailoverTarget is one of the providers of a FailoverClient.
+type FailoverTarget struct {
+	// Name identifies the provider in errors, logs and the UI, e.g. "deepseek".
+	Name   string
+	Client Client
+	// Model is the model to use with the provider; if empty, the provider picks its default model.
+	Model string
+}
+
+// FailoverClient is a Client that uses a list of providers in order: when a request to a provider fails
+// (with a non-retryable error, or after its retries are exhausted), the request is sent to the next one.
+// The model passed to StartChat and GenerateCompletion is ignored: each target has its own.
+type FailoverClient struct {
+	targets []FailoverTarget
+	retry   RetryConfig
+}
+
+var _ Client = &FailoverClient{}
+
+// NewFailoverClient returns a client using the targets in order.
+// The requests to each target are retried with the retry config before failing over to the next one.
+func NewFailoverClient(retry RetryConfig, targets ...FailoverTarget) (*FailoverClient, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("failover client needs at least one provider")
+	}
+	return &FailoverClient{targets: targets, retry: retry}, nil
+}
+
+// Targets returns the providers of the client, in order.
+func (c *FailoverClient) Targets() []FailoverTarget {
+	return c.targets
+}
+
+func (c *FailoverClient) Close() error {
+	var errs []error
+	for _, target := range c.targets {
+		if err := target.Client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", target.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *FailoverClient) GenerateCompletion(ctx context.Context, req *CompletionRequest) (CompletionResponse, error) {
+	var errs []error
+	for _, target := range c.targets {
+		targetReq := *req
+		targetReq.Model = target.Model
+		response, err := Retry(ctx, c.retry, DefaultIsRetryableError, func(ctx context.Context) (CompletionResponse, error) {
+			return target.Client.GenerateCompletion(ctx, &targetReq)
+		})
+		if err == nil {
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		klog.FromContext(ctx).Info("LLM provider failed to generate a completion", "provider", target.Name, "error", err)
+		errs = append(errs, fmt.Errorf("%s: %w", target.Name, err))
+	}
+	return nil, c.exhausted(errs)
+}
+
+func (c *FailoverClient) SetResponseSchema(schema *Schema) error {
+	for _, target := range c.targets {
+		if err := target.Client.SetResponseSchema(schema); err != nil {
+			return fmt.Errorf("setting response schema of %s: %w", target.Name, err)
+		}
+	}
+	return nil
+}
+
+// ListModels lists the models of the first provider.
+func (c *FailoverClient) ListModels(ctx context.Context) ([]string, error) {
+	return c.targets[0].Client.ListModels(ctx)
+}
+
+func (c *FailoverClient) StartChat(systemPrompt, model string) Chat {
+	return &FailoverChat{
+		client:       c,
+		systemPrompt: systemPrompt,
+		chat:         NewRetryChat(c.targets[0].Client.StartChat(systemPrompt, c.targets[0].Model), c.retry),
+	}
+}
+
+// exhausted returns the error of a request that failed with every provider.
+func (c *FailoverClient) exhausted(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("all %d LLM providers failed: %w", len(errs), errors.Join(errs...))
+}
+
+// ProviderFailoverError records that a provider failed and the chat switched to the next one.
+// The stream of a FailoverChat yields it wrapped in a *StreamRestartError.
+type ProviderFailoverError struct {
+	// From and To are the names of the failed provider and of the provider the chat switched to.
+	From string
+	To   string
+	// Model is the model used with the new provider, empty for its default model.
+	Model string
+	Err   error
+}
+
+func (e *ProviderFailoverError) Error() string {
+	return fmt.Sprintf("LLM provider %s failed, switching to %s: %v", e.From, e.To, e.Err)
+}
+
+func (e *ProviderFailoverError) Unwrap() error {
+	return e.Err
+}
+
+// FailoverChat is a chat that switches to the next provider of its FailoverClient when a request fails.
+// Providers keep the chat history in their own format, so the conversation so far is handed off
+// to the new provider as a transcript in the first message sent to it.
+// Once switched, the chat stays with the new provider.
+type FailoverChat struct {
+	client              *FailoverClient
+	systemPrompt        string
+	functionDefinitions []*FunctionDefinition
+
+	// active is the index of the target in use, and chat its chat.
+	active int
+	chat   Chat
+	// handoff is set after switching to a target, until the transcript was sent to it.
+	handoff bool
+	// transcript is the conversation so far, to hand it off to the next target.
+	transcript []transcriptEntry
+	// errs are the errors of the targets that failed.
+	errs []error
+}
+
+var _ Chat = &FailoverChat{}
+
+// transcriptEntry is a message of the conversation: the contents sent by the user, or the response of the model.
+type transcriptEntry struct {
+	contents []any
+
+	fromModel     bool
+	text          string
+	functionCalls []FunctionCall
+}
+
+// Active returns the provider the chat currently uses.
+func (c *FailoverChat) Active() FailoverTarget {
+	return c.client.targets[c.active]
+}
+
+func (c *FailoverChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
+	for {
+		response, err := c.chat.Send(ctx, c.request(contents)...)
+		if err == nil {
+			c.record(contents, responseEntry(response))
+			return response, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if _, err := c.failover(ctx, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// SendStreaming switches to the next provider if the stream fails. The stream yields a *StreamRestartError
+// wrapping a *ProviderFailoverError when it does, and the responses of the new provider follow.
+func (c *FailoverChat) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
+	return func(yield func(ChatResponse, error) bool) {
+		for attempt := 1; ; attempt++ {
+			var entry transcriptEntry
+			stream, err := c.chat.SendStreaming(ctx, c.request(contents)...)
+			if err == nil {
+				for response, streamErr := range stream {
+					var restart *StreamRestartError
+					if errors.As(streamErr, &restart) {
+						// The provider retried the request itself.
+						entry = transcriptEntry{}
+						if !yield(nil, streamErr) {
+							return
+						}
+						continue
+					}
+					if streamErr != nil {
+						err = streamErr
+						break
+					}
+					entry.add(response)
+					if !yield(response, nil) {
+						c.record(contents, &entry)
+						return
+					}
+				}
+				if err == nil {
+					c.record(contents, &entry)
+					return
+				}
+			}
+
+			if ctx.Err() != nil {
+				yield(nil, err)
+				return
+			}
+			switched, err := c.failover(ctx, err)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(nil, &StreamRestartError{Attempt: attempt, Err: switched}) {
+				return
+			}
+		}
+	}, nil
+}
+
+// failover switches to the next provider that can be started, after the active one failed with err.
+// It returns an error if there is none left.
+func (c *FailoverChat) failover(ctx context.Context, err error) (*ProviderFailoverError, error) {
+	log := klog.FromContext(ctx)
+
+	from := c.Active()
+	c.errs = append(c.errs, fmt.Errorf("%s: %w", from.Name, err))
+	for c.active+1 < len(c.client.targets) {
+		c.active++
+		to := c.Active()
+		chat := NewRetryChat(to.Client.StartChat(c.systemPrompt, to.Model), c.client.retry)
+		if c.functionDefinitions != nil {
+			if err := chat.SetFunctionDefinitions(c.functionDefinitions); err != nil {
+				log.Info("LLM provider cannot be used", "provider", to.Name, "error", err)
+				c.errs = append(c.errs, fmt.Errorf("%s: setting function definitions: %w", to.Name, err))
+				continue
+			}
+		}
+		log.Info("LLM provider failed, switching to the next one", "from", from.Name, "to", to.Name, "error", err)
+		c.chat = chat
+		c.handoff = len(c.transcript) > 0
+		return &ProviderFailoverError{From: from.Name, To: to.Name, Model: to.Model, Err: err}, nil
+	}
+	if len(c.client.targets) == 1 {
+		return nil, err
+	}
+	return nil, c.client.exhausted(c.errs)
+}
+
+// request returns the contents to send to the active provider: with the transcript of the conversation
+// so far if the chat just switched to it.
+func (c *FailoverChat) request(contents []any) []any {
+	if !c.handoff {
+		return contents
+	}
+	return []any{renderHandoff(c.transcript, contents)}
+}
+
+// record adds a request that succeeded, and its response, to the transcript.
+func (c *FailoverChat) record(contents []any, response *transcriptEntry) {
+	c.handoff = false
+	c.transcript = append(c.transcript, transcriptEntry{contents: contents}, *response)
+}
+
+func (c *FailoverChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
+	c.functionDefinitions = functionDefinitions
+	return c.chat.SetFunctionDefinitions(functionDefinitions)
+}
+
+// IsRetryableError returns false: requests were already retried with each provider.
+func (c *FailoverChat) IsRetryableError(err error) bool {
+	return false
+}
+
+// responseEntry returns the transcript entry of a (complete) response.
+func responseEntry(response ChatResponse) *transcriptEntry {
+	entry := &transcriptEntry{}
+	entry.add(response)
+	return entry
+}
+
+// add adds the text and function calls of a response (or of a chunk of a streamed response) to the entry.
+// The reasoning is left out, like in the history of the chats.
+func (e *transcriptEntry) add(response ChatResponse) {
+	e.fromModel = true
+	if response == nil || len(response.Candidates()) == 0 {
+		return
+	}
+	for _, part := range response.Candidates()[0].Parts() {
+		if text, ok := part.AsText(); ok {
+			e.text += text
+		}
+		if calls, ok := part.AsFunctionCalls(); ok {
+			e.functionCalls = append(e.functionCalls, calls...)
+		}
+	}
+}
+
+func (e *transcriptEntry) render(sb *strings.Builder) {
+	if e.fromModel {
+		if e.text != "" {
+			fmt.Fprintf(sb, "Assistant:\n%s\n\n", e.text)
+		}
+		for _, call := range e.functionCalls {
+			arguments, _ := json.Marshal(call.Arguments)
+			fmt.Fprintf(sb, "Assistant called the function %s with %s\n\n", call.Name, arguments)
+		}
+		return
+	}
+	for _, content := range e.contents {
+		switch v := content.(type) {
+		case string:
+			fmt.Fprintf(sb, "User:\n%s\n\n", v)
+		case FunctionCallResult:
+			result, _ := json.Marshal(v.Result)
+			fmt.Fprintf(sb, "Result of the function %s:\n%s\n\n", v.Name, result)
+		default:
+			fmt.Fprintf(sb, "User:\n%v\n\n", v)
+		}
+	}
+}
+
+// renderHandoff renders the conversation so far and the new contents as one message, for a provider
+// that takes over a conversation held with another one.
+func renderHandoff(transcript []transcriptEntry, contents []any) string {
+	var sb strings.Builder
+	sb.WriteString("This conversation was held with another model, which is no longer available. " +
+		"Continue it from where it stopped. The conversation so far:\n\n")
+	for _, entry := range transcript {
+		entry.render(&sb)
+	}
+	sb.WriteString("The new message:\n\n")
+	(&transcriptEntry{contents: contents}).render(&sb)
+	return strings.TrimSpace(sb.String())
+}
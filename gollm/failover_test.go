@@ -0,0 +1,139 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func newTestFailoverClient(t *testing.T, scripts map[string][]FakeTurn, names ...string) (*FailoverClient, func()) {
+	t.Helper()
+	var targets []FailoverTarget
+	var fakes []*FakeClient
+	for _, name := range names {
+		fake := NewFakeClient(&FakeScript{Turns: scripts[name]})
+		fakes = append(fakes, fake)
+		targets = append(targets, FailoverTarget{Name: name, Client: fake})
+	}
+	client, err := NewFailoverClient(fastRetryConfig, targets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := func() {
+		for i, fake := range fakes {
+			if err := fake.Done(); err != nil {
+				t.Errorf("%s: %v", names[i], err)
+			}
+		}
+	}
+	return client, done
+}
+
+func TestFailoverChatSendStreaming(t *testing.T) {
+	client, done := newTestFailoverClient(t, map[string][]FakeTurn{
+		"deepseek": {
+			{
+				Expect: &FakeExpectation{Contains: []string{"list the pods"}},
+				Chunks: []FakeChunk{{
+					Text:          "Let me check.",
+					FunctionCalls: []FunctionCall{{ID: "call-1", Name: "kubectl", Arguments: map[string]any{"command": "kubectl get pods"}}},
+				}},
+			},
+			{Error: "invalid request", ErrorStatusCode: http.StatusBadRequest},
+		},
+		"qwen": {
+			{
+				// The conversation is handed off as a transcript.
+				Expect: &FakeExpectation{Contains: []string{
+					"User:\nlist the pods",
+					"Assistant:\nLet me check.",
+					`Assistant called the function kubectl with {"command":"kubectl get pods"}`,
+					"Result of the function kubectl:\n{\"stdout\":\"pod-1\"}",
+				}},
+				Chunks: []FakeChunk{{
+					FunctionCalls: []FunctionCall{{ID: "call-2", Name: "kubectl", Arguments: map[string]any{"command": "kubectl get pods -A"}}},
+				}},
+			},
+			{
+				// Then the chat continues natively.
+				Expect: &FakeExpectation{FunctionResults: []string{"kubectl"}},
+				Chunks: []FakeChunk{{Text: "There is one pod."}},
+			},
+		},
+	}, "deepseek", "qwen")
+
+	chat := client.StartChat("", "")
+	if got, want := collectStream(t, chat, "list the pods"), "Let me check."; got != want {
+		t.Errorf("first stream = %q, want %q", got, want)
+	}
+
+	stream, err := chat.SendStreaming(context.Background(), FunctionCallResult{ID: "call-1", Name: "kubectl", Result: map[string]any{"stdout": "pod-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failover *ProviderFailoverError
+	for _, err := range stream {
+		if err != nil && !errors.As(err, &failover) {
+			t.Fatalf("stream error: %v", err)
+		}
+	}
+	if failover == nil || failover.From != "deepseek" || failover.To != "qwen" {
+		t.Errorf("failover = %v, want from deepseek to qwen", failover)
+	}
+	if got := chat.(*FailoverChat).Active().Name; got != "qwen" {
+		t.Errorf("active provider = %q, want qwen", got)
+	}
+
+	if got, want := collectStream(t, chat, FunctionCallResult{ID: "call-2", Name: "kubectl", Result: map[string]any{"stdout": "pod-1"}}), "There is one pod."; got != want {
+		t.Errorf("last stream = %q, want %q", got, want)
+	}
+	done()
+}
+
+func TestFailoverChatAllProvidersFail(t *testing.T) {
+	client, done := newTestFailoverClient(t, map[string][]FakeTurn{
+		"deepseek": {{Error: "invalid request", ErrorStatusCode: http.StatusBadRequest}},
+		"qwen":     {{Error: "unauthorized", ErrorStatusCode: http.StatusUnauthorized}},
+	}, "deepseek", "qwen")
+
+	_, err := client.StartChat("", "").Send(context.Background(), "list the pods")
+	if err == nil || !strings.Contains(err.Error(), "all 2 LLM providers failed") || !strings.Contains(err.Error(), "qwen: API Error: Status=401") {
+		t.Errorf("Send() error = %v, want the errors of both providers", err)
+	}
+	done()
+}
+
+func TestFailoverClientGenerateCompletion(t *testing.T) {
+	client, done := newTestFailoverClient(t, map[string][]FakeTurn{
+		"deepseek": {{Error: "invalid request", ErrorStatusCode: http.StatusBadRequest}},
+		"qwen":     {{Chunks: []FakeChunk{{Text: "A summary."}}}},
+	}, "deepseek", "qwen")
+
+	response, err := client.GenerateCompletion(context.Background(), &CompletionRequest{Prompt: "summarize"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := response.Response(); got != "A summary." {
+		t.Errorf("Response() = %q, want %q", got, "A summary.")
+	}
+	done()
+}
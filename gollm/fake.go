@@ -0,0 +1,407 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+func init() {
+	if err := RegisterProvider("fake", fakeFactory); err != nil {
+		klog.Fatalf("Failed to register fake provider: %v", err)
+	}
+}
+
+// fakeFactory is the provider factory function for the scripted fake LLM.
+// The script is read from the path of the URL (e.g. "fake:///tmp/script.yaml" or
+// "fake://testdata/script.yaml"), or from the LLM_FAKE_SCRIPT environment variable.
+func fakeFactory(ctx context.Context, opts ClientOptions) (Client, error) {
+	path := os.Getenv("LLM_FAKE_SCRIPT")
+	if opts.URL != nil && opts.URL.Host+opts.URL.Path != "" {
+		path = opts.URL.Host + opts.URL.Path
+	}
+	if path == "" {
+		return nil, fmt.Errorf("fake provider needs a script, e.g. fake:///path/to/script.yaml or LLM_FAKE_SCRIPT")
+	}
+	script, err := LoadFakeScript(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewFakeClient(script), nil
+}
+
+// FakeScript is the script of a fake LLM: the requests it expects, in order, and its canned responses.
+// It lets the agent loop be tested deterministically, without a real LLM.
+type FakeScript struct {
+	// Models are returned by ListModels.
+	Models []string `json:"models,omitempty"`
+	// Functions, if set, are the names of the functions SetFunctionDefinitions must be called with.
+	Functions []string `json:"functions,omitempty"`
+	// Turns are the responses to the requests (chat messages and completions), in order.
+	Turns []FakeTurn `json:"turns"`
+}
+
+// FakeTurn is one request to the fake LLM and its response.
+type FakeTurn struct {
+	// Expect, if set, checks the request; a request that does not match fails with an error.
+	Expect *FakeExpectation `json:"expect,omitempty"`
+
+	// Chunks are the parts of the response; streaming requests receive one chunk at a time.
+	Chunks []FakeChunk `json:"chunks,omitempty"`
+
+	// Error, if set, fails the request instead of responding.
+	// With ErrorStatusCode it is returned as an *APIError, which may be retryable.
+	Error           string `json:"error,omitempty"`
+	ErrorStatusCode int    `json:"errorStatusCode,omitempty"`
+
+	// Usage is returned as the usage metadata of the response.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// usage returns the usage of the turn, with the total computed if the script leaves it out.
+func (t *FakeTurn) usage() *Usage {
+	if t.Usage == nil {
+		return nil
+	}
+	return newUsage(*t.Usage)
+}
+
+// FakeExpectation describes the request the fake LLM expects.
+type FakeExpectation struct {
+	// Contains are substrings of the text sent, including the JSON of function results.
+	Contains []string `json:"contains,omitempty"`
+	// FunctionResults are the names of the function results sent, in order.
+	FunctionResults []string `json:"functionResults,omitempty"`
+}
+
+// FakeChunk is a part of a response of the fake LLM.
+type FakeChunk struct {
+	// Reasoning is returned as a reasoning part, before the text.
+	Reasoning     string         `json:"reasoning,omitempty"`
+	Text          string         `json:"text,omitempty"`
+	FunctionCalls []FunctionCall `json:"functionCalls,omitempty"`
+	// Error, if set, fails the stream after the previous chunks were received.
+	// With ErrorStatusCode it is returned as an *APIError, which may be retryable.
+	Error           string `json:"error,omitempty"`
+	ErrorStatusCode int    `json:"errorStatusCode,omitempty"`
+}
+
+// err returns the error of the chunk, or nil.
+func (c *FakeChunk) err() error {
+	if c.Error == "" {
+		return nil
+	}
+	if c.ErrorStatusCode != 0 {
+		return &APIError{StatusCode: c.ErrorStatusCode, Message: c.Error}
+	}
+	return errors.New(c.Error)
+}
+
+// LoadFakeScript reads a fake LLM script from a YAML (or JSON) file.
+func LoadFakeScript(path string) (*FakeScript, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading fake LLM script: %w", err)
+	}
+	script := &FakeScript{}
+	if err := yaml.UnmarshalStrict(b, script); err != nil {
+		return nil, fmt.Errorf("parsing fake LLM script %q: %w", path, err)
+	}
+	return script, nil
+}
+
+// FakeClient is a Client that plays a FakeScript.
+// Chats share the script, so turns are consumed in order across all chats of the client.
+type FakeClient struct {
+	script *FakeScript
+
+	mu                  sync.Mutex
+	next                int
+	requests            []string
+	functionDefinitions []*FunctionDefinition
+}
+
+var _ Client = &FakeClient{}
+
+// NewFakeClient creates a client that plays the script.
+func NewFakeClient(script *FakeScript) *FakeClient {
+	return &FakeClient{script: script}
+}
+
+func (c *FakeClient) Close() error {
+	return nil
+}
+
+// Requests returns the text of the requests received so far.
+func (c *FakeClient) Requests() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.requests)
+}
+
+// FunctionDefinitions returns the function definitions last set on a chat.
+func (c *FakeClient) FunctionDefinitions() []*FunctionDefinition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.functionDefinitions
+}
+
+// Done returns an error if some turns of the script were not played.
+func (c *FakeClient) Done() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if remaining := len(c.script.Turns) - c.next; remaining > 0 {
+		return fmt.Errorf("fake LLM: %d of %d turns were not played", remaining, len(c.script.Turns))
+	}
+	return nil
+}
+
+// play checks a request against the next turn of the script, and returns the turn.
+func (c *FakeClient) play(text string, functionResults []string) (*FakeTurn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests = append(c.requests, text)
+	if c.next >= len(c.script.Turns) {
+		return nil, fmt.Errorf("fake LLM: unexpected request %d, the script has %d turns: %q", c.next+1, len(c.script.Turns), text)
+	}
+	turn := &c.script.Turns[c.next]
+	c.next++
+
+	if expect := turn.Expect; expect != nil {
+		for _, s := range expect.Contains {
+			if !strings.Contains(text, s) {
+				return nil, fmt.Errorf("fake LLM: request %d does not contain %q: %q", c.next, s, text)
+			}
+		}
+		if expect.FunctionResults != nil && !slices.Equal(expect.FunctionResults, functionResults) {
+			return nil, fmt.Errorf("fake LLM: request %d has function results %v, want %v", c.next, functionResults, expect.FunctionResults)
+		}
+	}
+
+	if turn.Error != "" {
+		if turn.ErrorStatusCode != 0 {
+			return nil, &APIError{StatusCode: turn.ErrorStatusCode, Message: turn.Error}
+		}
+		return nil, errors.New(turn.Error)
+	}
+	return turn, nil
+}
+
+func (c *FakeClient) GenerateCompletion(ctx context.Context, req *CompletionRequest) (CompletionResponse, error) {
+	turn, err := c.play(req.Prompt, nil)
+	if err != nil {
+		return nil, err
+	}
+	var text strings.Builder
+	for _, chunk := range turn.Chunks {
+		text.WriteString(chunk.Text)
+	}
+	return &staticCompletionResponse{text: text.String(), usage: turn.usage()}, nil
+}
+
+func (c *FakeClient) SetResponseSchema(schema *Schema) error {
+	return nil
+}
+
+func (c *FakeClient) ListModels(ctx context.Context) ([]string, error) {
+	return c.script.Models, nil
+}
+
+func (c *FakeClient) StartChat(systemPrompt, model string) Chat {
+	return &FakeChat{client: c}
+}
+
+// FakeChat is a chat with a FakeClient.
+type FakeChat struct {
+	client *FakeClient
+}
+
+var _ Chat = &FakeChat{}
+
+func (c *FakeChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
+	turn, err := c.request(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &staticChatResponse{usage: turn.usage()}
+	for _, chunk := range turn.Chunks {
+		if err := chunk.err(); err != nil {
+			return nil, err
+		}
+		response.parts = append(response.parts, chunkParts(chunk)...)
+	}
+	return response, nil
+}
+
+func (c *FakeChat) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
+	turn, err := c.request(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(ChatResponse, error) bool) {
+		for i, chunk := range turn.Chunks {
+			if err := chunk.err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			response := &staticChatResponse{parts: chunkParts(chunk)}
+			if i == len(turn.Chunks)-1 {
+				// Like real providers, usage comes with the last chunk.
+				response.usage = turn.usage()
+			}
+			if !yield(response, nil) {
+				return
+			}
+		}
+	}, nil
+}
+
+// request renders the contents of a request, and plays the next turn.
+func (c *FakeChat) request(contents []any) (*FakeTurn, error) {
+	var texts, functionResults []string
+	for _, content := range contents {
+		switch v := content.(type) {
+		case string:
+			texts = append(texts, v)
+		case FunctionCallResult:
+			functionResults = append(functionResults, v.Name)
+			result, err := json.Marshal(v.Result)
+			if err != nil {
+				return nil, fmt.Errorf("fake LLM: encoding result of %q: %w", v.Name, err)
+			}
+			texts = append(texts, fmt.Sprintf("%s: %s", v.Name, result))
+		default:
+			return nil, fmt.Errorf("unsupported content type: %T", v)
+		}
+	}
+	return c.client.play(strings.Join(texts, "\n"), functionResults)
+}
+
+func (c *FakeChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
+	if want := c.client.script.Functions; want != nil {
+		var names []string
+		for _, definition := range functionDefinitions {
+			names = append(names, definition.Name)
+		}
+		if !slices.Equal(names, want) {
+			return fmt.Errorf("fake LLM: function definitions %v, want %v", names, want)
+		}
+	}
+
+	c.client.mu.Lock()
+	defer c.client.mu.Unlock()
+	c.client.functionDefinitions = functionDefinitions
+	return nil
+}
+
+func (c *FakeChat) IsRetryableError(err error) bool {
+	return DefaultIsRetryableError(err)
+}
+
+func chunkParts(chunk FakeChunk) []Part {
+	var parts []Part
+	if chunk.Reasoning != "" {
+		parts = append(parts, &staticPart{reasoning: chunk.Reasoning})
+	}
+	if chunk.Text != "" {
+		parts = append(parts, &staticPart{text: chunk.Text})
+	}
+	if len(chunk.FunctionCalls) > 0 {
+		parts = append(parts, &staticPart{functionCalls: chunk.FunctionCalls})
+	}
+	return parts
+}
+
+// staticCompletionResponse and staticChatResponse are responses that were not received from a provider,
+// e.g. from a script or a cassette.
+type staticCompletionResponse struct {
+	text  string
+	usage *Usage
+}
+
+func (r *staticCompletionResponse) Response() string {
+	return r.text
+}
+
+func (r *staticCompletionResponse) UsageMetadata() *Usage {
+	return r.usage
+}
+
+type staticChatResponse struct {
+	parts []Part
+	usage *Usage
+}
+
+var _ ChatResponse = &staticChatResponse{}
+
+func (r *staticChatResponse) UsageMetadata() *Usage {
+	return r.usage
+}
+
+func (r *staticChatResponse) Candidates() []Candidate {
+	return []Candidate{&staticCandidate{parts: r.parts}}
+}
+
+type staticCandidate struct {
+	parts []Part
+}
+
+func (c *staticCandidate) String() string {
+	var sb strings.Builder
+	for _, part := range c.parts {
+		if text, ok := part.AsText(); ok {
+			sb.WriteString(text)
+		}
+	}
+	return sb.String()
+}
+
+func (c *staticCandidate) Parts() []Part {
+	return c.parts
+}
+
+type staticPart struct {
+	reasoning     string
+	text          string
+	functionCalls []FunctionCall
+}
+
+func (p *staticPart) AsText() (string, bool) {
+	return p.text, p.text != ""
+}
+
+func (p *staticPart) AsFunctionCalls() ([]FunctionCall, bool) {
+	return p.functionCalls, len(p.functionCalls) > 0
+}
+
+func (p *staticPart) AsReasoning() (string, bool) {
+	return p.reasoning, p.reasoning != ""
+}
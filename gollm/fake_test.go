@@ -0,0 +1,132 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testFakeScript = `
+models: [fake-model]
+functions: [bash, kubectl]
+turns:
+- expect:
+    contains: ["list the pods"]
+  chunks:
+  - text: "Let me "
+  - text: "check."
+    functionCalls:
+    - id: call-1
+      name: kubectl
+      arguments:
+        command: kubectl get pods
+  usage:
+    totalTokens: 42
+- expect:
+    functionResults: [kubectl]
+    contains: ["web-1"]
+  chunks:
+  - text: "There is one pod."
+- error: rate limited
+  errorStatusCode: 429
+`
+
+func newTestFakeClient(t *testing.T) *FakeClient {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "script.yaml")
+	if err := os.WriteFile(path, []byte(testFakeScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(context.Background(), "fake://"+path)
+	if err != nil {
+		t.Fatalf("NewClient() returned error: %v", err)
+	}
+	return client.(*FakeClient)
+}
+
+func TestFakeChat(t *testing.T) {
+	ctx := context.Background()
+	client := newTestFakeClient(t)
+
+	chat := client.StartChat("system", "fake-model")
+	if err := chat.SetFunctionDefinitions([]*FunctionDefinition{{Name: "kubectl"}}); err == nil {
+		t.Errorf("SetFunctionDefinitions() with unexpected functions did not return an error")
+	}
+	if err := chat.SetFunctionDefinitions([]*FunctionDefinition{{Name: "bash"}, {Name: "kubectl"}}); err != nil {
+		t.Fatalf("SetFunctionDefinitions() returned error: %v", err)
+	}
+
+	stream, err := chat.SendStreaming(ctx, "please list the pods")
+	if err != nil {
+		t.Fatalf("SendStreaming() returned error: %v", err)
+	}
+	var text strings.Builder
+	var calls []FunctionCall
+	var usage *Usage
+	for response, err := range stream {
+		if err != nil {
+			t.Fatalf("stream returned error: %v", err)
+		}
+		for _, part := range response.Candidates()[0].Parts() {
+			if s, ok := part.AsText(); ok {
+				text.WriteString(s)
+			}
+			if c, ok := part.AsFunctionCalls(); ok {
+				calls = append(calls, c...)
+			}
+		}
+		usage = response.UsageMetadata()
+	}
+	if text.String() != "Let me check." || len(calls) != 1 || calls[0].Arguments["command"] != "kubectl get pods" {
+		t.Errorf("streamed text %q and calls %v", text.String(), calls)
+	}
+	if usage == nil || usage.TotalTokens != 42 {
+		t.Errorf("usage %+v was not returned with the last chunk", usage)
+	}
+
+	response, err := chat.Send(ctx, FunctionCallResult{ID: "call-1", Name: "kubectl", Result: map[string]any{"stdout": "web-1 Running"}})
+	if err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+	if got := response.Candidates()[0].String(); got != "There is one pod." {
+		t.Errorf("Send() = %q", got)
+	}
+
+	_, err = chat.Send(ctx, "again")
+	if err == nil || !chat.IsRetryableError(err) {
+		t.Errorf("Send() = %v, want a retryable error", err)
+	}
+	if err := client.Done(); err != nil {
+		t.Errorf("Done() = %v", err)
+	}
+	if _, err := chat.Send(ctx, "one more"); err == nil {
+		t.Errorf("Send() after the end of the script did not return an error")
+	}
+}
+
+func TestFakeChatUnexpectedRequest(t *testing.T) {
+	client := newTestFakeClient(t)
+	chat := client.StartChat("system", "fake-model")
+	if _, err := chat.Send(context.Background(), "delete everything"); err == nil {
+		t.Errorf("Send() with an unexpected request did not return an error")
+	}
+}
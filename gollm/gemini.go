@@ -28,7 +28,9 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"time"
 
 	"google.golang.org/genai"
 
@@ -329,11 +331,53 @@ func (c *GeminiChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefin
 	return nil
 }
 
-// toGeminiSchema converts our generic Schema to a genai.Schema
+// toGeminiSchema converts our generic Schema to a genai.Schema.
+// Gemini only supports enums of strings, a few formats and no additionalProperties:
+// these constraints are described instead.
 func toGeminiSchema(schema *Schema) (*genai.Schema, error) {
+	return convertGeminiSchema(downgradeSchema(schema, func(keyword string, s *Schema) bool {
+		switch keyword {
+		case keywordEnum:
+			return s.Type == TypeString && s.isStringEnum()
+		case keywordFormat:
+			switch s.Type {
+			case TypeString:
+				return s.Format == "date-time" || s.Format == "enum"
+			case TypeNumber:
+				return s.Format == "float" || s.Format == "double"
+			case TypeInteger:
+				return s.Format == "int32" || s.Format == "int64"
+			}
+			return false
+		case keywordAdditionalProperties, keywordOneOf:
+			return false
+		}
+		return true
+	}))
+}
+
+func convertGeminiSchema(schema *Schema) (*genai.Schema, error) {
 	ret := &genai.Schema{
 		Description: schema.Description,
 		Required:    schema.Required,
+		Minimum:     schema.Minimum,
+		Maximum:     schema.Maximum,
+		MinLength:   toInt64(schema.MinLength),
+		MaxLength:   toInt64(schema.MaxLength),
+		MinItems:    toInt64(schema.MinItems),
+		MaxItems:    toInt64(schema.MaxItems),
+		Pattern:     schema.Pattern,
+		Format:      schema.Format,
+		Default:     schema.Default,
+	}
+	if schema.Nullable {
+		ret.Nullable = genai.Ptr(true)
+	}
+	for _, v := range schema.Enum {
+		ret.Enum = append(ret.Enum, v.(string))
+	}
+	if len(ret.Enum) > 0 && ret.Format == "" {
+		ret.Format = "enum"
 	}
 
 	switch schema.Type {
@@ -349,13 +393,17 @@ func toGeminiSchema(schema *Schema) (*genai.Schema, error) {
 		ret.Type = genai.TypeInteger
 	case TypeArray:
 		ret.Type = genai.TypeArray
+	case "":
+		if len(schema.AnyOf) == 0 {
+			return nil, fmt.Errorf("schema without type or alternatives not handled by genai.Schema")
+		}
 	default:
 		return nil, fmt.Errorf("type %q not handled by genai.Schema", schema.Type)
 	}
 	if schema.Properties != nil {
 		ret.Properties = make(map[string]*genai.Schema)
 		for k, v := range schema.Properties {
-			geminiValue, err := toGeminiSchema(v)
+			geminiValue, err := convertGeminiSchema(v)
 			if err != nil {
 				return nil, err
 			}
@@ -363,15 +411,36 @@ func toGeminiSchema(schema *Schema) (*genai.Schema, error) {
 		}
 	}
 	if schema.Items != nil {
-		geminiValue, err := toGeminiSchema(schema.Items)
+		geminiValue, err := convertGeminiSchema(schema.Items)
 		if err != nil {
 			return nil, err
 		}
 		ret.Items = geminiValue
 	}
+	for _, alt := range schema.AnyOf {
+		if alt.isNull() {
+			// Gemini has no null type, but nullable schemas
+			ret.Nullable = genai.Ptr(true)
+			continue
+		}
+		geminiValue, err := convertGeminiSchema(alt)
+		if err != nil {
+			return nil, err
+		}
+		ret.AnyOf = append(ret.AnyOf, geminiValue)
+	}
 	return ret, nil
 }
 
+// toInt64 converts an optional int.
+func toInt64(v *int) *int64 {
+	if v == nil {
+		return nil
+	}
+	i := int64(*v)
+	return &i
+}
+
 func (c *GeminiChat) partsToGemini(contents ...any) ([]*genai.Part, error) {
 	var parts []*genai.Part
 
@@ -410,15 +479,16 @@ func (c *GeminiChat) Send(ctx context.Context, contents ...any) (ChatResponse, e
 		Parts: parts,
 	}
 
-	c.history = append(c.history, genaiContent)
-	result, err := c.client.Models.GenerateContent(ctx, c.model, c.history, c.genConfig)
+	// The history is only updated if the request succeeds, so that it can be retried.
+	history := append(slices.Clip(c.history), genaiContent)
+	result, err := c.client.Models.GenerateContent(ctx, c.model, history, c.genConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate content: %w", err)
 	}
 	if result == nil || len(result.Candidates) == 0 {
 		return nil, fmt.Errorf("no response from Gemini")
 	}
-	c.history = append(c.history, result.Candidates[0].Content)
+	c.history = append(history, result.Candidates[0].Content)
 	geminiResponse := result
 	log.V(1).Info("got LLM response", "response", geminiResponse)
 	return &GeminiChatResponse{geminiResponse: geminiResponse}, nil
@@ -438,8 +508,9 @@ func (c *GeminiChat) SendStreaming(ctx context.Context, contents ...any) (ChatRe
 		Parts: parts,
 	}
 
-	c.history = append(c.history, genaiContent)
-	stream := c.client.Models.GenerateContentStream(ctx, c.model, c.history, c.genConfig)
+	// The history is only updated if the stream does not fail, so that the request can be retried.
+	history := append(slices.Clip(c.history), genaiContent)
+	stream := c.client.Models.GenerateContentStream(ctx, c.model, history, c.genConfig)
 
 	return func(yield func(ChatResponse, error) bool) {
 		next, stop := iter.Pull2(stream)
@@ -447,10 +518,14 @@ func (c *GeminiChat) SendStreaming(ctx context.Context, contents ...any) (ChatRe
 		for {
 			geminiResponse, err, ok := next()
 			if !ok {
+				break
+			}
+			if err != nil {
+				yield(nil, err)
 				return
 			}
 			if geminiResponse == nil || len(geminiResponse.Candidates) == 0 {
-				return
+				break
 			}
 
 			content := geminiResponse.Candidates[0].Content
@@ -458,14 +533,15 @@ func (c *GeminiChat) SendStreaming(ctx context.Context, contents ...any) (ChatRe
 				// This happens when there is empty content with the finish reason (STOP) to indicate that streaming response is finished.
 				// xref: https://github.com/st-lzh/kubelet-wuhrai/issues/306
 				log.V(1).Info("empty response probably with STOP finishedReason")
-				return
+				break
 			}
-			c.history = append(c.history, content)
+			history = append(history, content)
 			// yield only when we have a non-empty response
-			if !yield(&GeminiChatResponse{geminiResponse: geminiResponse}, err) {
-				return
+			if !yield(&GeminiChatResponse{geminiResponse: geminiResponse}, nil) {
+				break
 			}
 		}
+		c.history = history
 	}, nil
 }
 
@@ -490,8 +566,25 @@ func (r *GeminiChatResponse) String() string {
 }
 
 // UsageMetadata returns the usage metadata for the response.
-func (r *GeminiChatResponse) UsageMetadata() any {
-	return r.geminiResponse.UsageMetadata
+func (r *GeminiChatResponse) UsageMetadata() *Usage {
+	return geminiUsage(r.geminiResponse)
+}
+
+// geminiUsage normalizes the usage metadata of a response.
+// Gemini counts the thinking tokens separately from the candidates tokens.
+func geminiUsage(response *genai.GenerateContentResponse) *Usage {
+	if response == nil || response.UsageMetadata == nil {
+		return nil
+	}
+	metadata := response.UsageMetadata
+	return newUsage(Usage{
+		Model:            response.ModelVersion,
+		PromptTokens:     int(metadata.PromptTokenCount + metadata.ToolUsePromptTokenCount),
+		CompletionTokens: int(metadata.CandidatesTokenCount + metadata.ThoughtsTokenCount),
+		CachedTokens:     int(metadata.CachedContentTokenCount),
+		ReasoningTokens:  int(metadata.ThoughtsTokenCount),
+		TotalTokens:      int(metadata.TotalTokenCount),
+	})
 }
 
 // Candidates returns the candidates for the response.
@@ -553,7 +646,15 @@ type GeminiPart struct {
 
 // AsText returns the text of the part.
 func (p *GeminiPart) AsText() (string, bool) {
-	if p.part.Text != "" {
+	if p.part.Text != "" && !p.part.Thought {
+		return p.part.Text, true
+	}
+	return "", false
+}
+
+// AsReasoning returns the text of the part if it is a thought.
+func (p *GeminiPart) AsReasoning() (string, bool) {
+	if p.part.Text != "" && p.part.Thought {
 		return p.part.Text, true
 	}
 	return "", false
@@ -592,8 +693,8 @@ func (r *GeminiCompletionResponse) Response() string {
 	return r.text
 }
 
-func (r *GeminiCompletionResponse) UsageMetadata() any {
-	return r.geminiResponse.UsageMetadata
+func (r *GeminiCompletionResponse) UsageMetadata() *Usage {
+	return geminiUsage(r.geminiResponse)
 }
 
 func (r *GeminiCompletionResponse) String() string {
@@ -627,3 +728,27 @@ func (c *GeminiChat) IsRetryableError(err error) bool {
 
 	return false
 }
+
+// geminiAPIError converts the errors of the API to *APIError, with the retry delay of their RetryInfo details.
+func geminiAPIError(err error) *APIError {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		var apiErrPtr *genai.APIError
+		if !errors.As(err, &apiErrPtr) || apiErrPtr == nil {
+			return nil
+		}
+		apiErr = *apiErrPtr
+	}
+	converted := &APIError{StatusCode: apiErr.Code, Message: apiErr.Message, Err: err}
+	for _, detail := range apiErr.Details {
+		if detail["@type"] != "type.googleapis.com/google.rpc.RetryInfo" {
+			continue
+		}
+		if delay, ok := detail["retryDelay"].(string); ok {
+			if d, err := time.ParseDuration(delay); err == nil && d > 0 {
+				converted.RetryAfter = d
+			}
+		}
+	}
+	return converted
+}
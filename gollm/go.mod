@@ -14,6 +14,7 @@ require (
 	github.com/openai/openai-go v1.0.0
 	google.golang.org/genai v1.8.0
 	k8s.io/klog/v2 v2.130.1
+	sigs.k8s.io/yaml v1.4.0
 )
 
 require (
@@ -71,7 +71,9 @@ type CompletionRequest struct {
 // CompletionResponse is a response from the GenerateCompletion method.
 type CompletionResponse interface {
 	Response() string
-	UsageMetadata() any
+
+	// UsageMetadata returns the token usage of the request, or nil if the provider did not report it.
+	UsageMetadata() *Usage
 }
 
 // FunctionCall is a function call to a language model.
@@ -92,12 +94,43 @@ type FunctionDefinition struct {
 }
 
 // Schema is a schema for a function definition.
+// It is a subset of JSON Schema, and is marshaled to and from JSON Schema (see schema.go).
+// Providers that do not support some of the keywords downgrade them, usually by describing
+// the constraint in the description instead.
 type Schema struct {
 	Type        SchemaType         `json:"type,omitempty"`
 	Properties  map[string]*Schema `json:"properties,omitempty"`
 	Items       *Schema            `json:"items,omitempty"`
 	Description string             `json:"description,omitempty"`
 	Required    []string           `json:"required,omitempty"`
+
+	// Enum is the list of allowed values; "const" is read as a single-value enum.
+	Enum []any `json:"enum,omitempty"`
+	// Nullable allows null besides the values of Type, written as e.g. "type": ["string", "null"].
+	Nullable bool `json:"nullable,omitempty"`
+	// AnyOf lists alternative schemas, the value must match at least one.
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+	// OneOf lists alternative schemas, the value must match exactly one.
+	OneOf []*Schema `json:"oneOf,omitempty"`
+	// AdditionalProperties is the schema of the properties of an object not listed in Properties.
+	AdditionalProperties *Schema `json:"additionalProperties,omitempty"`
+	// NoAdditionalProperties forbids properties not listed in Properties ("additionalProperties": false).
+	NoAdditionalProperties bool `json:"-"`
+
+	// Numeric bounds, inclusive.
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// Length bounds of strings and arrays.
+	MinLength *int `json:"minLength,omitempty"`
+	MaxLength *int `json:"maxLength,omitempty"`
+	MinItems  *int `json:"minItems,omitempty"`
+	MaxItems  *int `json:"maxItems,omitempty"`
+	// Pattern is a regular expression strings must match.
+	Pattern string `json:"pattern,omitempty"`
+	// Format is the format of strings, e.g. "date-time" or "uri".
+	Format string `json:"format,omitempty"`
+	// Default is the value used when the property is not given.
+	Default any `json:"default,omitempty"`
 }
 
 // ToRawSchema converts a Schema to a json.RawMessage.
@@ -124,6 +157,9 @@ const (
 	TypeBoolean SchemaType = "boolean"
 	TypeNumber  SchemaType = "number"
 	TypeInteger SchemaType = "integer"
+
+	// TypeNull only appears in AnyOf; a nullable type is represented by Schema.Nullable.
+	TypeNull SchemaType = "null"
 )
 
 // FunctionCallResult is the result of a function call.
@@ -136,7 +172,10 @@ type FunctionCallResult struct {
 
 // ChatResponse is a generic chat response from the LLM.
 type ChatResponse interface {
-	UsageMetadata() any
+	// UsageMetadata returns the token usage of the request, or nil if the provider did not report it.
+	// When streaming, usage may be reported by several responses of the stream:
+	// the last one reported covers the whole request.
+	UsageMetadata() *Usage
 
 	// Candidates are a set of candidate responses from the LLM.
 	// The LLM may return multiple candidates, and we can choose the best one.
@@ -169,4 +208,9 @@ type Part interface {
 	// AsFunctionCalls returns the function calls of the part.
 	// if the part is not a function call, it returns (nil, false)
 	AsFunctionCalls() ([]FunctionCall, bool)
+
+	// AsReasoning returns the reasoning of the part: the text reasoning models produce before answering,
+	// which is not part of the answer. If the part is not reasoning, it returns ("", false).
+	// Reasoning is for display only: chats never send it back to providers that reject it.
+	AsReasoning() (string, bool)
 }
@@ -26,6 +26,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 
 	"k8s.io/klog/v2"
 )
@@ -45,7 +46,7 @@ func llamacppFactory(ctx context.Context, opts ClientOptions) (Client, error) {
 type LlamaCppClient struct {
 	baseURL        *url.URL
 	httpClient     *http.Client
-	responseSchema *llamacppSchema
+	responseSchema *Schema
 }
 
 type LlamaCppChat struct {
@@ -127,7 +128,11 @@ func (c *LlamaCppClient) doRequest(ctx context.Context, httpMethod, relativePath
 	}
 
 	if httpResponse.StatusCode != 200 {
-		return fmt.Errorf("unexpected http status: %q with response %q", httpResponse.Status, string(b))
+		return &APIError{
+			StatusCode: httpResponse.StatusCode,
+			Message:    fmt.Sprintf("unexpected http status: %q with response %q", httpResponse.Status, string(b)),
+			RetryAfter: ParseRetryAfter(httpResponse.Header.Get("Retry-After")),
+		}
 	}
 
 	if err := json.Unmarshal(b, response); err != nil {
@@ -184,12 +189,18 @@ func (r *LlamaCppCompletionResponse) Response() string {
 	return r.llamacppResponse.Content
 }
 
-func (r *LlamaCppCompletionResponse) UsageMetadata() any {
-	return nil
+func (r *LlamaCppCompletionResponse) UsageMetadata() *Usage {
+	return newUsage(Usage{
+		Model:            r.llamacppResponse.Model,
+		PromptTokens:     int(r.llamacppResponse.TokensEvaluated),
+		CompletionTokens: int(r.llamacppResponse.TokensPredicted),
+	})
 }
 
 func (c *LlamaCppChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
 	log := klog.FromContext(ctx)
+	// The history is only updated if the request succeeds, so that it can be retried.
+	history := slices.Clip(c.history)
 	for _, content := range contents {
 		switch v := content.(type) {
 		case string:
@@ -197,7 +208,7 @@ func (c *LlamaCppChat) Send(ctx context.Context, contents ...any) (ChatResponse,
 				Role:    "user",
 				Content: ptrTo(v),
 			}
-			c.history = append(c.history, message)
+			history = append(history, message)
 		case FunctionCallResult:
 			resultJSON, err := json.Marshal(v.Result)
 			if err != nil {
@@ -209,7 +220,7 @@ func (c *LlamaCppChat) Send(ctx context.Context, contents ...any) (ChatResponse,
 				// TODO: Do we need ToolCallID?  ToolCallID: toolCallId,
 				Content: ptrTo(string(resultJSON)),
 			}
-			c.history = append(c.history, message)
+			history = append(history, message)
 		default:
 			return nil, fmt.Errorf("unsupported content type: %T", v)
 		}
@@ -217,7 +228,7 @@ func (c *LlamaCppChat) Send(ctx context.Context, contents ...any) (ChatResponse,
 
 	req := &llamacppChatRequest{
 		Model:    c.model,
-		Messages: c.history,
+		Messages: history,
 		// Stream:   ptrTo(false),
 		Tools: c.tools,
 	}
@@ -274,11 +285,12 @@ func (c *LlamaCppChat) Send(ctx context.Context, contents ...any) (ChatResponse,
 					ToolCalls:  choice.Message.ToolCalls,
 					ToolCallID: choice.Message.ToolCallID,
 				}
-				c.history = append(c.history, msg)
+				history = append(history, msg)
 			}
 		}
 	}
 
+	c.history = history
 	return llmacppResponse, nil
 }
 
@@ -300,6 +312,15 @@ func ptrTo[T any](t T) *T {
 	return &t
 }
 
+// ptrValue returns the value pointed to by p, or the zero value if p is nil.
+func ptrValue[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
 type LlamaCppChatResponse struct {
 	candidates       []*LlamaCppCandidate
 	LlamaCppResponse llamacppChatResponse
@@ -329,8 +350,17 @@ func (r *LlamaCppChatResponse) String() string {
 // 	return sb.String()
 // }
 
-func (r *LlamaCppChatResponse) UsageMetadata() any {
-	return nil
+func (r *LlamaCppChatResponse) UsageMetadata() *Usage {
+	usage := r.LlamaCppResponse.Usage
+	if usage == nil {
+		return nil
+	}
+	return newUsage(Usage{
+		Model:            r.LlamaCppResponse.Model,
+		PromptTokens:     int(usage.PromptTokens),
+		CompletionTokens: int(usage.CompletionTokens),
+		TotalTokens:      int(usage.TotalTokens),
+	})
 }
 
 func (r *LlamaCppChatResponse) Candidates() []Candidate {
@@ -376,6 +406,11 @@ func (p *LlamaCppPart) AsFunctionCalls() ([]FunctionCall, bool) {
 	return nil, false
 }
 
+// AsReasoning returns false: the API does not return the reasoning separately.
+func (p *LlamaCppPart) AsReasoning() (string, bool) {
+	return "", false
+}
+
 func (c *LlamaCppChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
 	var tools []llamacppTool
 	for _, functionDefinition := range functionDefinitions {
@@ -403,26 +438,21 @@ func toLlamacppTool(fnDef *FunctionDefinition) llamacppTool {
 	return tool
 }
 
-func toLlamacppSchema(in *Schema) *llamacppSchema {
+// toLlamacppSchema converts a schema for the grammar generator of llama.cpp, which does not support
+// bounds of non-integer numbers nor most formats: these constraints are described instead.
+func toLlamacppSchema(in *Schema) *Schema {
 	if in == nil {
 		return nil
 	}
-
-	out := &llamacppSchema{
-		Type:        string(in.Type),
-		Items:       toLlamacppSchema(in.Items),
-		Description: in.Description,
-		Required:    in.Required,
-	}
-
-	if in.Properties != nil {
-		out.Properties = make(map[string]llamacppSchema, len(in.Properties))
-		for k, v := range in.Properties {
-			out.Properties[k] = *toLlamacppSchema(v)
+	return downgradeSchema(in, func(keyword string, s *Schema) bool {
+		switch keyword {
+		case keywordMinimum, keywordMaximum:
+			return s.Type == TypeInteger
+		case keywordFormat:
+			return slices.Contains([]string{"date", "time", "date-time", "uuid"}, s.Format)
 		}
-	}
-
-	return out
+		return true
+	})
 }
 
 type llamacppCompletionRequest struct {
@@ -430,7 +460,7 @@ type llamacppCompletionRequest struct {
 
 	Prompt string `json:"prompt,omitempty"`
 
-	JSONSchema *llamacppSchema `json:"json_schema,omitempty"`
+	JSONSchema *Schema `json:"json_schema,omitempty"`
 }
 
 type llamacppCompletionResponse struct {
@@ -530,16 +560,7 @@ type llamacppTool struct {
 }
 
 type llamacppFunction struct {
-	Description string          `json:"description,omitempty"`
-	Name        string          `json:"name,omitempty"`
-	Parameters  *llamacppSchema `json:"parameters,omitempty"`
-}
-
-type llamacppSchema struct {
-	Type        string                    `json:"type,omitempty"`
-	Required    []string                  `json:"required,omitempty"`
-	Items       *llamacppSchema           `json:"items,omitempty"`
-	Properties  map[string]llamacppSchema `json:"properties,omitempty"`
-	Description string                    `json:"description,omitempty"`
-	Enum        []string                  `json:"enum,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	Parameters  *Schema `json:"parameters,omitempty"`
 }
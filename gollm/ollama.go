@@ -20,7 +20,9 @@ package gollm
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/ollama/ollama/api"
 	"github.com/ollama/ollama/envconfig"
@@ -82,7 +84,10 @@ func (c *OllamaClient) GenerateCompletion(ctx context.Context, request *Completi
 	var ollamaResponse *OllamaCompletionResponse
 
 	respFunc := func(resp api.GenerateResponse) error {
-		ollamaResponse = &OllamaCompletionResponse{response: resp.Response}
+		ollamaResponse = &OllamaCompletionResponse{
+			response: resp.Response,
+			usage:    ollamaUsage(resp.Model, resp.Metrics),
+		}
 		return nil
 	}
 
@@ -127,18 +132,30 @@ func (c *OllamaClient) StartChat(systemPrompt, model string) Chat {
 
 type OllamaCompletionResponse struct {
 	response string
+	usage    *Usage
 }
 
 func (r *OllamaCompletionResponse) Response() string {
 	return r.response
 }
 
-func (r *OllamaCompletionResponse) UsageMetadata() any {
-	return nil
+func (r *OllamaCompletionResponse) UsageMetadata() *Usage {
+	return r.usage
+}
+
+// ollamaUsage normalizes the token counts of the metrics of a response.
+func ollamaUsage(model string, metrics api.Metrics) *Usage {
+	return newUsage(Usage{
+		Model:            model,
+		PromptTokens:     metrics.PromptEvalCount,
+		CompletionTokens: metrics.EvalCount,
+	})
 }
 
 func (c *OllamaChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
 	log := klog.FromContext(ctx)
+	// The history is only updated if the request succeeds, so that it can be retried.
+	history := slices.Clip(c.history)
 	for _, content := range contents {
 		switch v := content.(type) {
 		case string:
@@ -146,13 +163,13 @@ func (c *OllamaChat) Send(ctx context.Context, contents ...any) (ChatResponse, e
 				Role:    "user",
 				Content: v,
 			}
-			c.history = append(c.history, message)
+			history = append(history, message)
 		case FunctionCallResult:
 			message := api.Message{
 				Role:    "user",
 				Content: fmt.Sprintf("Function call result: %s", v.Result),
 			}
-			c.history = append(c.history, message)
+			history = append(history, message)
 		default:
 			return nil, fmt.Errorf("unsupported content type: %T", v)
 		}
@@ -160,7 +177,7 @@ func (c *OllamaChat) Send(ctx context.Context, contents ...any) (ChatResponse, e
 
 	req := &api.ChatRequest{
 		Model:    c.model,
-		Messages: c.history,
+		Messages: history,
 		// set streaming to false
 		Stream: new(bool),
 		Tools:  c.tools,
@@ -183,7 +200,7 @@ func (c *OllamaChat) Send(ctx context.Context, contents ...any) (ChatResponse, e
 				},
 			},
 		}
-		c.history = append(c.history, resp.Message)
+		history = append(history, resp.Message)
 		return nil
 	}
 
@@ -192,6 +209,7 @@ func (c *OllamaChat) Send(ctx context.Context, contents ...any) (ChatResponse, e
 		return nil, err
 	}
 
+	c.history = history
 	log.Info("ollama response", "parsed_response", ollamaResponse)
 	return ollamaResponse, nil
 }
@@ -201,6 +219,15 @@ func (c *OllamaChat) IsRetryableError(err error) bool {
 	return false
 }
 
+// ollamaAPIError converts the errors of the API to *APIError.
+func ollamaAPIError(err error) *APIError {
+	var statusErr api.StatusError
+	if !errors.As(err, &statusErr) {
+		return nil
+	}
+	return &APIError{StatusCode: statusErr.StatusCode, Message: statusErr.ErrorMessage, Err: err}
+}
+
 func (c *OllamaChat) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
 	// TODO: Implement streaming
 	response, err := c.Send(ctx, contents...)
@@ -228,8 +255,8 @@ func (r *OllamaChatResponse) String() string {
 	return fmt.Sprintf("OllamaChatResponse{candidates=%v}", r.candidates)
 }
 
-func (r *OllamaChatResponse) UsageMetadata() any {
-	return nil
+func (r *OllamaChatResponse) UsageMetadata() *Usage {
+	return ollamaUsage(r.ollamaResponse.Model, r.ollamaResponse.Metrics)
 }
 
 func (r *OllamaChatResponse) Candidates() []Candidate {
@@ -285,6 +312,11 @@ func (p *OllamaPart) AsFunctionCalls() ([]FunctionCall, bool) {
 	return nil, false
 }
 
+// AsReasoning returns false: the API does not return the reasoning separately.
+func (p *OllamaPart) AsReasoning() (string, bool) {
+	return "", false
+}
+
 func (c *OllamaChat) SetFunctionDefinitions(functionDefinitions []*FunctionDefinition) error {
 	var tools []api.Tool
 	for _, functionDefinition := range functionDefinitions {
@@ -320,7 +352,15 @@ func fnDefToOllamaTool(fnDef *FunctionDefinition) api.Tool {
 		},
 	}
 
+	// Properties only have a type, a description and an enum of strings: other constraints are described.
 	for paramName, param := range fnDef.Parameters.Properties {
+		param = downgradeSchema(param, func(keyword string, s *Schema) bool {
+			return keyword == keywordEnum && s.isStringEnum()
+		})
+		var enum []string
+		for _, v := range param.Enum {
+			enum = append(enum, v.(string))
+		}
 		tool.Function.Parameters.Properties[paramName] = struct {
 			Type        string   `json:"type"`
 			Description string   `json:"description"`
@@ -328,6 +368,7 @@ func fnDefToOllamaTool(fnDef *FunctionDefinition) api.Tool {
 		}{
 			Type:        string(param.Type),
 			Description: param.Description,
+			Enum:        enum,
 		}
 	}
 
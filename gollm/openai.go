@@ -20,583 +20,45 @@ package gollm
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"maps"
 	"os"
-	"strings"
+	"slices"
 
 	openai "github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
 	"k8s.io/klog/v2"
 )
 
-// Package-level env var storage (OpenAI env)
-var (
-	openAIAPIKey   string
-	openAIEndpoint string
-	openAIAPIBase  string
-	openAIModel    string
-)
-
-// init reads and caches OpenAI environment variables:
-//   - OPENAI_API_KEY, OPENAI_ENDPOINT, OPENAI_API_BASE, OPENAI_MODEL
-//
-// These serve as defaults; the model can be overridden by the Cobra --model flag.
-// After loading env values, it registers the OpenAI provider factory.
 func init() {
-	// Load environment variables
-	openAIAPIKey = os.Getenv("OPENAI_API_KEY")
-	openAIEndpoint = os.Getenv("OPENAI_ENDPOINT")
-	openAIAPIBase = os.Getenv("OPENAI_API_BASE")
-	openAIModel = os.Getenv("OPENAI_MODEL")
-
-	// Register "openai" as the provider ID
 	if err := RegisterProvider("openai", newOpenAIClientFactory); err != nil {
 		klog.Fatalf("Failed to register openai provider: %v", err)
 	}
-
-	// Also register with any aliases defined in config
-	aliases := []string{"openai-compatible", "vllm", "openai-api", "custom-openai"}
-	for _, alias := range aliases {
-		if err := RegisterProvider(alias, newOpenAIClientFactory); err != nil {
-			klog.Warningf("Failed to register openai provider alias %q: %v", alias, err)
-		}
-	}
-}
-
-// OpenAIClient implements the gollm.Client interface for OpenAI models.
-type OpenAIClient struct {
-	client openai.Client
-}
-
-// Ensure OpenAIClient implements the Client interface.
-var _ Client = &OpenAIClient{}
-
-// NewOpenAIClient creates a new client for interacting with OpenAI.
-// Supports custom HTTP client (e.g., for skipping SSL verification).
-func NewOpenAIClient(ctx context.Context, opts ClientOptions) (*OpenAIClient, error) {
-	// Get API key from loaded env var
-	apiKey := openAIAPIKey
-	if apiKey == "" {
-		return nil, errors.New("OpenAI API key not found. Set via OPENAI_API_KEY env var")
-	}
-
-	// Set options for client creation
-	options := []option.RequestOption{option.WithAPIKey(apiKey)}
-
-	// Check for custom endpoint or API base URL
-	// Priority: opts.URL > OPENAI_ENDPOINT > OPENAI_API_BASE
-	baseURL := ""
-	if opts.URL != nil && opts.URL.Host != "" {
-		baseURL = opts.URL.String()
-		klog.Infof("Using URL from ClientOptions: %s", baseURL)
-	} else {
-		baseURL = openAIEndpoint
-		if baseURL == "" {
-			baseURL = openAIAPIBase
-		}
-	}
-
-	if baseURL != "" {
-		klog.Infof("Using custom OpenAI base URL: %s", baseURL)
-		options = append(options, option.WithBaseURL(baseURL))
-	}
-
-	// Support custom HTTP client (e.g., skip SSL verification)
-	httpClient := createCustomHTTPClient(opts.SkipVerifySSL)
-	options = append(options, option.WithHTTPClient(httpClient))
-
-	return &OpenAIClient{
-		client: openai.NewClient(options...),
-	}, nil
-}
-
-// Close cleans up any resources used by the client.
-func (c *OpenAIClient) Close() error {
-	// No specific cleanup needed for the OpenAI client currently.
-	return nil
-}
-
-// StartChat starts a new chat session.
-func (c *OpenAIClient) StartChat(systemPrompt, model string) Chat {
-	// Get the model to use for this chat
-	selectedModel := getOpenAIModel(model)
-
-	klog.V(1).Infof("Starting new OpenAI chat session with model: %s", selectedModel)
-
-	// Initialize history with system prompt if provided
-	history := []openai.ChatCompletionMessageParamUnion{}
-	if systemPrompt != "" {
-		history = append(history, openai.SystemMessage(systemPrompt))
-	}
-
-	return &openAIChatSession{
-		client:  c.client,
-		history: history,
-		model:   selectedModel,
-		// functionDefinitions and tools will be set later via SetFunctionDefinitions
-	}
-}
-
-// simpleCompletionResponse is a basic implementation of CompletionResponse.
-type simpleCompletionResponse struct {
-	content string
-}
-
-// Response returns the completion content.
-func (r *simpleCompletionResponse) Response() string {
-	return r.content
-}
-
-// UsageMetadata returns nil for now.
-func (r *simpleCompletionResponse) UsageMetadata() any {
-	return nil
-}
-
-// GenerateCompletion sends a completion request to the OpenAI API.
-func (c *OpenAIClient) GenerateCompletion(ctx context.Context, req *CompletionRequest) (CompletionResponse, error) {
-	klog.Infof("OpenAI GenerateCompletion called with model: %s", req.Model)
-	klog.V(1).Infof("Prompt:\n%s", req.Prompt)
-
-	// Use the Chat Completions API with the new v1.0.0 API
-	completion, err := c.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Model: openai.ChatModel(req.Model),
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(req.Prompt),
-		},
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate OpenAI completion: %w", err)
-	}
-
-	// Check if there are choices and a message
-	if len(completion.Choices) == 0 || completion.Choices[0].Message.Content == "" {
-		return nil, errors.New("received an empty response from OpenAI")
-	}
-
-	// Return the content of the first choice
-	resp := &simpleCompletionResponse{
-		content: completion.Choices[0].Message.Content,
-	}
-
-	return resp, nil
-}
-
-// SetResponseSchema is not implemented yet.
-func (c *OpenAIClient) SetResponseSchema(schema *Schema) error {
-	klog.Warning("OpenAIClient.SetResponseSchema is not implemented yet")
-	return nil
-}
-
-// ListModels returns a slice of strings with model IDs.
-// Note: This may not work with all OpenAI-compatible providers if they don't fully implement
-// the Models.List endpoint or return data in a different format.
-func (c *OpenAIClient) ListModels(ctx context.Context) ([]string, error) {
-	res, err := c.client.Models.List(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("error listing models from OpenAI: %w", err)
-	}
-
-	modelIDs := make([]string, 0, len(res.Data))
-	for _, model := range res.Data {
-		modelIDs = append(modelIDs, model.ID)
-	}
-
-	return modelIDs, nil
-}
-
-// Chat Session Implementation
-
-type openAIChatSession struct {
-	client              openai.Client
-	history             []openai.ChatCompletionMessageParamUnion
-	model               string
-	functionDefinitions []*FunctionDefinition            // Stored in gollm format
-	tools               []openai.ChatCompletionToolParam // Stored in OpenAI format
-}
-
-// Ensure openAIChatSession implements the Chat interface.
-var _ Chat = (*openAIChatSession)(nil)
-
-// SetFunctionDefinitions stores the function definitions and converts them to OpenAI format.
-func (cs *openAIChatSession) SetFunctionDefinitions(defs []*FunctionDefinition) error {
-	cs.functionDefinitions = defs
-	cs.tools = nil // Clear previous tools
-	if len(defs) > 0 {
-		cs.tools = make([]openai.ChatCompletionToolParam, len(defs))
-		for i, gollmDef := range defs {
-			klog.Infof("Processing function definition: %s", gollmDef.Name)
-
-			// Process function parameters
-			params, err := cs.convertFunctionParameters(gollmDef)
-			if err != nil {
-				return fmt.Errorf("failed to process parameters for function %s: %w", gollmDef.Name, err)
-			}
-
-			cs.tools[i] = openai.ChatCompletionToolParam{
-				Function: openai.FunctionDefinitionParam{
-					Name:        gollmDef.Name,
-					Description: openai.String(gollmDef.Description),
-					Parameters:  params,
-				},
-			}
-		}
-	}
-	klog.V(1).Infof("Set %d function definitions for OpenAI chat session", len(cs.functionDefinitions))
-	return nil
-}
-
-// Send sends the user message(s), appends to history, and gets the LLM response.
-func (cs *openAIChatSession) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
-	klog.V(1).InfoS("openAIChatSession.Send called", "model", cs.model, "history_len", len(cs.history))
-
-	// Process and append messages to history
-	if err := cs.addContentsToHistory(contents); err != nil {
-		return nil, err
-	}
-
-	// Prepare and send API request
-	chatReq := openai.ChatCompletionNewParams{
-		Model:    openai.ChatModel(cs.model),
-		Messages: cs.history,
-	}
-	if len(cs.tools) > 0 {
-		chatReq.Tools = cs.tools
-	}
-
-	// Call the OpenAI API
-	klog.V(1).InfoS("Sending request to OpenAI Chat API", "model", cs.model, "messages", len(chatReq.Messages), "tools", len(chatReq.Tools))
-	completion, err := cs.client.Chat.Completions.New(ctx, chatReq)
-	if err != nil {
-		// TODO: Check if error is retryable using cs.IsRetryableError
-		klog.Errorf("OpenAI ChatCompletion API error: %v", err)
-		return nil, fmt.Errorf("OpenAI chat completion failed: %w", err)
-	}
-	klog.V(1).InfoS("Received response from OpenAI Chat API", "id", completion.ID, "choices", len(completion.Choices))
-
-	// Process the response
-	if len(completion.Choices) == 0 {
-		klog.Warning("Received response with no choices from OpenAI")
-		return nil, errors.New("received empty response from OpenAI (no choices)")
-	}
-
-	// Add assistant's response (first choice) to history
-	assistantMsg := completion.Choices[0].Message
-	// Convert to param type before appending to history
-	cs.history = append(cs.history, assistantMsg.ToParam())
-	klog.V(2).InfoS("Added assistant message to history", "content_present", assistantMsg.Content != "", "tool_calls", len(assistantMsg.ToolCalls))
-
-	// Wrap the response
-	resp := &openAIChatResponse{
-		openaiCompletion: completion,
-	}
-
-	return resp, nil
-}
-
-// SendStreaming sends the user message(s) and returns an iterator for the LLM response stream.
-func (cs *openAIChatSession) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
-	klog.V(1).InfoS("Starting OpenAI streaming request", "model", cs.model)
-
-	// Process and append messages to history
-	if err := cs.addContentsToHistory(contents); err != nil {
-		return nil, err
-	}
-
-	// Prepare and send API request
-	chatReq := openai.ChatCompletionNewParams{
-		Model:    openai.ChatModel(cs.model),
-		Messages: cs.history,
-	}
-	if len(cs.tools) > 0 {
-		chatReq.Tools = cs.tools
-	}
-
-	// Start the OpenAI streaming request
-	klog.V(1).InfoS("Sending streaming request to OpenAI API",
-		"model", cs.model,
-		"messageCount", len(chatReq.Messages),
-		"toolCount", len(chatReq.Tools))
-
-	stream := cs.client.Chat.Completions.NewStreaming(ctx, chatReq)
-
-	// Create an accumulator to track the full response
-	acc := openai.ChatCompletionAccumulator{}
-
-	// Create and return the stream iterator
-	return func(yield func(ChatResponse, error) bool) {
-		defer stream.Close()
-
-		var lastResponseChunk *openAIChatStreamResponse
-		var currentContent strings.Builder
-		var currentToolCalls []openai.ChatCompletionMessageToolCall
-		var processedToolCallIDs = make(map[string]bool) // Track processed tool call IDs
-
-		// Process stream chunks
-		for stream.Next() {
-			chunk := stream.Current()
-
-			// Update the accumulator with the new chunk
-			acc.AddChunk(chunk)
-
-			// Handle content completion
-			if _, ok := acc.JustFinishedContent(); ok {
-				klog.V(2).Info("Content stream finished")
-			}
-
-			// Handle refusal completion
-			if refusal, ok := acc.JustFinishedRefusal(); ok {
-				klog.V(2).Infof("Refusal stream finished: %v", refusal)
-				yield(nil, fmt.Errorf("model refused to respond: %v", refusal))
-				return
-			}
-
-			// Handle tool call completion
-			if tool, ok := acc.JustFinishedToolCall(); ok {
-				// Check if we've already processed this tool call ID to avoid duplicates
-				if !processedToolCallIDs[tool.ID] {
-					klog.V(2).Infof("Tool call finished: %s %s", tool.Name, tool.Arguments)
-					currentToolCalls = append(currentToolCalls, openai.ChatCompletionMessageToolCall{
-						ID: tool.ID,
-						Function: openai.ChatCompletionMessageToolCallFunction{
-							Name:      tool.Name,
-							Arguments: tool.Arguments,
-						},
-					})
-					processedToolCallIDs[tool.ID] = true
-				} else {
-					klog.V(2).Infof("Skipping duplicate tool call ID: %s", tool.ID)
-				}
-			}
-
-			// Create a streaming response with proper nil checks
-			streamResponse := &openAIChatStreamResponse{
-				streamChunk: chunk,
-				accumulator: acc,
-				content:     "", // Default to empty content
-				toolCalls:   currentToolCalls,
-			}
-
-			// Only process content if there are choices and a delta
-			if len(chunk.Choices) > 0 {
-				delta := chunk.Choices[0].Delta
-				if delta.Content != "" {
-					currentContent.WriteString(delta.Content)
-					streamResponse.content = delta.Content // Only set content if there's new content
-				}
-			}
-
-			// Keep track of the last response for history
-			lastResponseChunk = &openAIChatStreamResponse{
-				streamChunk: chunk,
-				accumulator: acc,
-				content:     currentContent.String(), // Full accumulated content for history
-				toolCalls:   currentToolCalls,
-			}
-
-			// Only yield if there's actual content or tool calls to report
-			// Also skip chunks with no choices (like usage-only chunks at the end)
-			if (streamResponse.content != "" || len(streamResponse.toolCalls) > 0) && len(chunk.Choices) > 0 {
-				if !yield(streamResponse, nil) {
-					return
-				}
-			}
-		}
-
-		// Check for errors after streaming completes
-		if err := stream.Err(); err != nil {
-			klog.Errorf("Error in OpenAI streaming: %v", err)
-			yield(nil, fmt.Errorf("OpenAI streaming error: %w", err))
-			return
-		}
-
-		// Update conversation history with the complete message
-		if lastResponseChunk != nil {
-			completeMessage := openai.ChatCompletionMessage{
-				Content:   currentContent.String(),
-				Role:      "assistant",
-				ToolCalls: currentToolCalls,
-			}
-
-			// Append the full assistant response to history
-			cs.history = append(cs.history, completeMessage.ToParam())
-			klog.V(2).InfoS("Added complete assistant message to history",
-				"content_present", completeMessage.Content != "",
-				"tool_calls", len(completeMessage.ToolCalls))
-		}
-	}, nil
-}
-
-// IsRetryableError determines if an error from the OpenAI API should be retried.
-func (cs *openAIChatSession) IsRetryableError(err error) bool {
-	if err == nil {
-		return false
-	}
-	return DefaultIsRetryableError(err)
-}
-
-// Helper structs for ChatResponse interface
-
-type openAIChatResponse struct {
-	openaiCompletion *openai.ChatCompletion
-}
-
-var _ ChatResponse = (*openAIChatResponse)(nil)
-
-func (r *openAIChatResponse) UsageMetadata() any {
-	// Check if the main completion object and Usage exist
-	if r.openaiCompletion != nil && r.openaiCompletion.Usage.TotalTokens > 0 { // Check a field within Usage
-		return r.openaiCompletion.Usage
-	}
-	return nil
-}
-
-func (r *openAIChatResponse) Candidates() []Candidate {
-	if r.openaiCompletion == nil {
-		return nil
-	}
-	candidates := make([]Candidate, len(r.openaiCompletion.Choices))
-	for i, choice := range r.openaiCompletion.Choices {
-		candidates[i] = &openAICandidate{openaiChoice: &choice}
-	}
-	return candidates
-}
-
-type openAICandidate struct {
-	openaiChoice *openai.ChatCompletionChoice
-}
-
-var _ Candidate = (*openAICandidate)(nil)
-
-func (c *openAICandidate) Parts() []Part {
-	// Check if the choice exists before accessing Message
-	if c.openaiChoice == nil {
-		return nil
-	}
-
-	// OpenAI message can have Content AND ToolCalls
-	var parts []Part
-	if c.openaiChoice.Message.Content != "" {
-		parts = append(parts, &openAIPart{content: c.openaiChoice.Message.Content})
-	}
-	if len(c.openaiChoice.Message.ToolCalls) > 0 {
-		parts = append(parts, &openAIPart{toolCalls: c.openaiChoice.Message.ToolCalls})
-	}
-	return parts
-}
-
-// String provides a simple string representation for logging/debugging.
-func (c *openAICandidate) String() string {
-	if c.openaiChoice == nil {
-		return "<nil candidate>"
-	}
-	content := "<no content>"
-	if c.openaiChoice.Message.Content != "" {
-		content = c.openaiChoice.Message.Content
-	}
-	toolCalls := len(c.openaiChoice.Message.ToolCalls)
-	finishReason := string(c.openaiChoice.FinishReason)
-	return fmt.Sprintf("Candidate(FinishReason: %s, ToolCalls: %d, Content: %q)", finishReason, toolCalls, content)
-}
-
-type openAIPart struct {
-	content   string
-	toolCalls []openai.ChatCompletionMessageToolCall // Correct type
-}
-
-var _ Part = (*openAIPart)(nil)
-
-func (p *openAIPart) AsText() (string, bool) {
-	return p.content, p.content != ""
-}
-
-func (p *openAIPart) AsFunctionCalls() ([]FunctionCall, bool) {
-	return convertToolCallsToFunctionCalls(p.toolCalls)
-}
-
-// Update openAIChatStreamResponse to include accumulated content
-type openAIChatStreamResponse struct {
-	streamChunk openai.ChatCompletionChunk
-	accumulator openai.ChatCompletionAccumulator
-	content     string
-	toolCalls   []openai.ChatCompletionMessageToolCall
-}
-
-// Update Candidates() to use accumulated content
-func (r *openAIChatStreamResponse) Candidates() []Candidate {
-	if len(r.streamChunk.Choices) == 0 {
-		return nil
-	}
-
-	candidates := make([]Candidate, len(r.streamChunk.Choices))
-	for i, choice := range r.streamChunk.Choices {
-		candidates[i] = &openAIStreamCandidate{
-			streamChoice: choice,
-			content:      r.content,
-			toolCalls:    r.toolCalls,
-		}
-	}
-	return candidates
 }
 
-// Update openAIStreamCandidate to handle delta content
-type openAIStreamCandidate struct {
-	streamChoice openai.ChatCompletionChunkChoice
-	content      string // This will now be just the delta content
-	toolCalls    []openai.ChatCompletionMessageToolCall
+// openAIConfig is the configuration of the OpenAI API.
+// OPENAI_MODEL sets the default model; the model can be overridden by the --model flag.
+var openAIConfig = OpenAICompatibleConfig{
+	Name:          "OpenAI",
+	BaseURL:       "https://api.openai.com/v1",
+	BaseURLEnv:    []string{"OPENAI_ENDPOINT", "OPENAI_API_BASE", "OPENAI_BASE_URL"},
+	APIKeyEnv:     []string{"OPENAI_API_KEY"},
+	RequireAPIKey: true,
+	DefaultModel:  "gpt-4.1",
+	StreamUsage:   true,
 }
 
-// Update Parts() to handle delta content
-func (c *openAIStreamCandidate) Parts() []Part {
-	var parts []Part
-
-	// Only include the delta content
-	if c.content != "" {
-		parts = append(parts, &openAIStreamPart{
-			content: c.content,
-		})
-	}
-
-	// Include accumulated tool calls
-	if len(c.toolCalls) > 0 {
-		parts = append(parts, &openAIStreamPart{
-			toolCalls: c.toolCalls,
-		})
-	}
-
-	return parts
+// newOpenAIClientFactory is the factory function for creating OpenAI clients.
+func newOpenAIClientFactory(ctx context.Context, opts ClientOptions) (Client, error) {
+	return NewOpenAIClient(ctx, opts)
 }
 
-// Add UsageMetadata implementation
-func (r *openAIChatStreamResponse) UsageMetadata() any {
-	if r.accumulator.Usage.TotalTokens > 0 {
-		return r.accumulator.Usage
+// NewOpenAIClient creates a new client for interacting with OpenAI.
+func NewOpenAIClient(ctx context.Context, opts ClientOptions) (*OpenAICompatibleClient, error) {
+	config := openAIConfig
+	if model := os.Getenv("OPENAI_MODEL"); model != "" {
+		config.DefaultModel = model
 	}
-	return nil
-}
-
-// Add String implementation
-func (c *openAIStreamCandidate) String() string {
-	return fmt.Sprintf("StreamingCandidate(Content: %q, ToolCalls: %d)",
-		c.content, len(c.toolCalls))
-}
-
-// Define openAIStreamPart
-type openAIStreamPart struct {
-	content   string
-	toolCalls []openai.ChatCompletionMessageToolCall
-}
-
-// Ensure openAIStreamPart implements Part interface
-var _ Part = (*openAIStreamPart)(nil)
-
-func (p *openAIStreamPart) AsText() (string, bool) {
-	return p.content, p.content != ""
-}
-
-func (p *openAIStreamPart) AsFunctionCalls() ([]FunctionCall, bool) {
-	return convertToolCallsToFunctionCalls(p.toolCalls)
+	return NewOpenAICompatibleClient(ctx, config, opts)
 }
 
 // convertSchemaForOpenAI converts and transforms a schema for OpenAI compatibility
@@ -610,12 +72,31 @@ func convertSchemaForOpenAI(schema *Schema) (*Schema, error) {
 		}, nil
 	}
 
-	// Create a deep copy to avoid modifying the original
-	validated := &Schema{
-		Description: schema.Description,
-		Required:    make([]string, len(schema.Required)),
+	// Create a deep copy to avoid modifying the original; the constraint keywords are kept as is
+	validated := schema.clone()
+	validated.Properties = nil
+	validated.Items = nil
+	if schema.AdditionalProperties != nil {
+		validatedAdditional, err := convertSchemaForOpenAI(schema.AdditionalProperties)
+		if err != nil {
+			return nil, fmt.Errorf("validating additional properties: %w", err)
+		}
+		validated.AdditionalProperties = validatedAdditional
+	}
+	for i, alt := range schema.AnyOf {
+		validatedAlt, err := convertSchemaForOpenAI(alt)
+		if err != nil {
+			return nil, fmt.Errorf("validating alternative %d: %w", i, err)
+		}
+		validated.AnyOf[i] = validatedAlt
+	}
+	for i, alt := range schema.OneOf {
+		validatedAlt, err := convertSchemaForOpenAI(alt)
+		if err != nil {
+			return nil, fmt.Errorf("validating alternative %d: %w", i, err)
+		}
+		validated.OneOf[i] = validatedAlt
 	}
-	copy(validated.Required, schema.Required)
 
 	// Handle type validation and normalization based on OpenAI requirements
 	switch schema.Type {
@@ -660,7 +141,14 @@ func convertSchemaForOpenAI(schema *Schema) (*Schema, error) {
 	case TypeBoolean:
 		validated.Type = TypeBoolean
 
+	case TypeNull:
+		validated.Type = TypeNull
+
 	case "":
+		if len(schema.AnyOf) > 0 || len(schema.OneOf) > 0 {
+			// The alternatives have the types
+			break
+		}
 		// If no type specified, default to object with empty properties
 		klog.Warningf("Schema has no type, defaulting to object")
 		validated.Type = TypeObject
@@ -683,6 +171,34 @@ func convertSchemaForOpenAI(schema *Schema) (*Schema, error) {
 	return validated, nil
 }
 
+// strictSchemaForOpenAI adapts a converted schema to the strict mode of function calling:
+// every property is required (optional ones become nullable instead), objects forbid additional
+// properties, and the keywords strict mode rejects are described instead.
+func strictSchemaForOpenAI(schema *Schema) *Schema {
+	strict := downgradeSchema(schema, func(keyword string, s *Schema) bool {
+		switch keyword {
+		case keywordMinLength, keywordMaxLength, keywordDefault, keywordOneOf:
+			return false
+		case keywordAdditionalProperties:
+			return s.NoAdditionalProperties
+		}
+		return true
+	})
+	strict.walk(func(s *Schema) {
+		if s.Type != TypeObject {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(s.Properties)) {
+			if !slices.Contains(s.Required, key) {
+				s.Properties[key].Nullable = true
+				s.Required = append(s.Required, key)
+			}
+		}
+		s.NoAdditionalProperties = true
+	})
+	return strict
+}
+
 // convertFunctionParameters handles the conversion of gollm parameters to OpenAI format
 func (cs *openAIChatSession) convertFunctionParameters(gollmDef *FunctionDefinition) (openai.FunctionParameters, error) {
 	var params openai.FunctionParameters
@@ -697,6 +213,9 @@ func (cs *openAIChatSession) convertFunctionParameters(gollmDef *FunctionDefinit
 	if err != nil {
 		return params, fmt.Errorf("schema conversion failed: %w", err)
 	}
+	if cs.config.Strict {
+		validatedSchema = strictSchemaForOpenAI(validatedSchema)
+	}
 	klog.V(2).Infof("Converted schema for function %s: %+v", gollmDef.Name, validatedSchema)
 
 	// Convert to raw schema bytes
@@ -720,38 +239,12 @@ type openAISchema struct {
 
 // MarshalJSON provides OpenAI-specific JSON marshaling that ensures object schemas have properties
 func (s openAISchema) MarshalJSON() ([]byte, error) {
-	// Create a map to build the JSON representation
-	result := make(map[string]interface{})
-
-	if s.Type != "" {
-		result["type"] = s.Type
-	}
-
-	if s.Description != "" {
-		result["description"] = s.Description
-	}
-
-	if len(s.Required) > 0 {
-		result["required"] = s.Required
-	}
-
+	schema := *s.Schema
 	// For object types, always include properties (even if empty) to satisfy OpenAI
-	if s.Type == TypeObject {
-		if s.Properties != nil {
-			result["properties"] = s.Properties
-		} else {
-			result["properties"] = make(map[string]*Schema)
-		}
-	} else if s.Properties != nil && len(s.Properties) > 0 {
-		// For non-object types, only include properties if they exist and are non-empty
-		result["properties"] = s.Properties
-	}
-
-	if s.Items != nil {
-		result["items"] = s.Items
+	if schema.Type == TypeObject && schema.Properties == nil {
+		schema.Properties = make(map[string]*Schema)
 	}
-
-	return json.Marshal(result)
+	return json.Marshal(schema)
 }
 
 // convertSchemaToBytes converts a validated schema to JSON bytes using OpenAI-specific marshaling
@@ -769,64 +262,6 @@ func (cs *openAIChatSession) convertSchemaToBytes(schema *Schema, functionName s
 	return bytes, nil
 }
 
-// newOpenAIClientFactory is the factory function for creating OpenAI clients.
-func newOpenAIClientFactory(ctx context.Context, opts ClientOptions) (Client, error) {
-	return NewOpenAIClient(ctx, opts)
-}
-
-// addContentsToHistory processes and appends user messages to chat history
-func (cs *openAIChatSession) addContentsToHistory(contents []any) error {
-	for _, content := range contents {
-		switch c := content.(type) {
-		case string:
-			klog.V(2).Infof("Adding user message to history: %s", c)
-			cs.history = append(cs.history, openai.UserMessage(c))
-		case FunctionCallResult:
-			klog.V(2).Infof("Adding tool call result to history: Name=%s, ID=%s", c.Name, c.ID)
-
-			// Check if this tool call ID already exists in history to avoid duplicates
-			toolCallExists := false
-			for i := len(cs.history) - 1; i >= 0; i-- {
-				// Convert to JSON to check the tool_call_id field
-				msgBytes, _ := json.Marshal(cs.history[i])
-				var msgMap map[string]interface{}
-				if json.Unmarshal(msgBytes, &msgMap) == nil {
-					if toolCallID, exists := msgMap["tool_call_id"]; exists && toolCallID == c.ID {
-						toolCallExists = true
-						klog.V(2).Infof("Skipping duplicate tool call result for ID: %s", c.ID)
-						break
-					}
-				}
-			}
-
-			if !toolCallExists {
-				// Create enhanced result that includes command information for AI context
-				enhancedResult := map[string]interface{}{
-					"tool_name": c.Name,
-					"result":    c.Result,
-				}
-
-				// Add command information if available in the result
-				if command, exists := c.Result["command"]; exists {
-					enhancedResult["executed_command"] = command
-				}
-
-				// Marshal the enhanced result map into a JSON string for the message content
-				resultJSON, err := json.Marshal(enhancedResult)
-				if err != nil {
-					klog.Errorf("Failed to marshal function call result: %v", err)
-					return fmt.Errorf("failed to marshal function call result %q: %w", c.Name, err)
-				}
-				cs.history = append(cs.history, openai.ToolMessage(string(resultJSON), c.ID))
-			}
-		default:
-			klog.Warningf("Unhandled content type: %T", content)
-			return fmt.Errorf("unhandled content type: %T", content)
-		}
-	}
-	return nil
-}
-
 // convertToolCallsToFunctionCalls converts OpenAI tool calls to gollm function calls
 func convertToolCallsToFunctionCalls(toolCalls []openai.ChatCompletionMessageToolCall) ([]FunctionCall, bool) {
 	if len(toolCalls) == 0 {
@@ -860,23 +295,3 @@ func convertToolCallsToFunctionCalls(toolCalls []openai.ChatCompletionMessageToo
 	}
 	return calls, len(calls) > 0
 }
-
-// getOpenAIModel returns the appropriate model based on configuration and explicitly provided model name
-func getOpenAIModel(model string) string {
-	// If explicit model is provided, use it
-	if model != "" {
-		klog.V(2).Infof("Using explicitly provided model: %s", model)
-		return model
-	}
-
-	// Check configuration
-	configModel := openAIModel
-	if configModel != "" {
-		klog.V(1).Infof("Using model from config: %s", configModel)
-		return configModel
-	}
-
-	// Default model as fallback
-	klog.V(2).Info("No model specified, defaulting to gpt-4.1")
-	return "gpt-4.1"
-}
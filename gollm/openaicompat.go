@@ -0,0 +1,673 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	openai "github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/respjson"
+	"k8s.io/klog/v2"
+)
+
+func init() {
+	// "openai-compatible" is any server implementing the OpenAI chat completions API,
+	// e.g. vLLM, an internal gateway or a SiliconFlow-style endpoint:
+	//   openai-compatible://host:8000/v1?model=qwen2.5-72b-instruct&scheme=http
+	for _, id := range []string{"openai-compatible", "vllm", "openai-api", "custom-openai"} {
+		if err := RegisterProvider(id, newOpenAICompatibleClientFactory); err != nil {
+			klog.Fatalf("Failed to register %s provider: %v", id, err)
+		}
+	}
+}
+
+// openAICompatibleConfig is the configuration of a generic OpenAI-compatible endpoint.
+// The endpoint comes from the URL, or from the OpenAI environment variables.
+var openAICompatibleConfig = OpenAICompatibleConfig{
+	Name:           "OpenAI-compatible",
+	BaseURLEnv:     []string{"OPENAI_ENDPOINT", "OPENAI_API_BASE"},
+	APIKeyEnv:      []string{"OPENAI_API_KEY"},
+	ReasoningField: "reasoning_content",
+}
+
+func newOpenAICompatibleClientFactory(ctx context.Context, opts ClientOptions) (Client, error) {
+	return NewOpenAICompatibleClient(ctx, openAICompatibleConfig, opts)
+}
+
+// OpenAICompatibleConfig describes a provider serving the OpenAI chat completions API, and its quirks.
+// Providers like DeepSeek, Qwen or Grok are presets of this configuration; the query of the
+// provider URL can override it (see ParseURL).
+type OpenAICompatibleConfig struct {
+	// Name is the name of the provider, used in logs and errors.
+	Name string
+
+	// BaseURL is the default endpoint, e.g. "https://api.deepseek.com".
+	// It is overridden by the first of BaseURLEnv that is set, and by the host and path of the provider URL.
+	BaseURL    string
+	BaseURLEnv []string
+
+	// APIKeyEnv are the environment variables holding the API key, in order of preference.
+	// The key is never read from the URL, which ends up in logs.
+	APIKeyEnv []string
+	// RequireAPIKey fails client creation without a key; self-hosted servers often do not need one.
+	RequireAPIKey bool
+	// AuthHeader is the header carrying the API key, e.g. "api-key" for some gateways.
+	// The default is "Authorization: Bearer <key>".
+	AuthHeader string
+
+	// DefaultModel is used when no model is given.
+	DefaultModel string
+	// Models is the list returned by ListModels; if nil, the models are listed by the API.
+	Models []string
+	// ModelAliases maps short names (e.g. "chat") to model names. Keys are lowercase.
+	ModelAliases map[string]string
+	// ModelPrefix, if set, is the prefix of all the models of the provider; other models fall back to DefaultModel.
+	ModelPrefix string
+
+	// ToolChoice is sent as "tool_choice" with function definitions ("auto", "required" or "none").
+	// When empty the field is not sent, for servers that reject it or do not support it.
+	ToolChoice string
+	// ReasoningField is the field of assistant messages holding the reasoning of reasoning models,
+	// e.g. "reasoning_content". It is never sent back: some providers reject requests that contain it.
+	ReasoningField string
+	// StreamUsage asks for token usage at the end of streamed responses ("stream_options.include_usage").
+	StreamUsage bool
+	// Strict sends function definitions in strict mode, so that calls always match their schema.
+	// Strict mode requires all properties and forbids some keywords: schemas are adapted to it,
+	// see strictSchemaForOpenAI.
+	Strict bool
+}
+
+// ParseURL applies a provider URL to the configuration: its host and path are the endpoint, and its query
+// overrides the quirks:
+//
+//	model            the model to use, whatever model the chat is started with
+//	scheme           "http" for plain-text endpoints (default "https")
+//	api_key_env      the environment variable holding the API key
+//	auth_header      the header carrying the API key
+//	tool_choice      the "tool_choice" to send, or "" not to send it
+//	reasoning_field  the field holding the reasoning of reasoning models
+//	stream_usage     whether to ask for token usage when streaming
+//	strict           whether to send function definitions in strict mode
+//
+// It returns the model pinned by the URL, if any.
+func (c *OpenAICompatibleConfig) ParseURL(u *url.URL) (string, error) {
+	if u == nil {
+		return "", nil
+	}
+	query := u.Query()
+	scheme := "https"
+	for key := range query {
+		value := query.Get(key)
+		switch key {
+		case "model":
+		case "scheme":
+			if value != "http" && value != "https" {
+				return "", fmt.Errorf("invalid scheme %q in provider URL, want http or https", value)
+			}
+			scheme = value
+		case "api_key_env":
+			c.APIKeyEnv = []string{value}
+			c.RequireAPIKey = true
+		case "auth_header":
+			c.AuthHeader = value
+		case "tool_choice":
+			if !slices.Contains([]string{"", "auto", "required", "none"}, value) {
+				return "", fmt.Errorf("invalid tool_choice %q in provider URL, want auto, required, none or empty", value)
+			}
+			c.ToolChoice = value
+		case "reasoning_field":
+			c.ReasoningField = value
+		case "stream_usage":
+			streamUsage, err := strconv.ParseBool(value)
+			if err != nil {
+				return "", fmt.Errorf("invalid stream_usage %q in provider URL: %w", value, err)
+			}
+			c.StreamUsage = streamUsage
+		case "strict":
+			strict, err := strconv.ParseBool(value)
+			if err != nil {
+				return "", fmt.Errorf("invalid strict %q in provider URL: %w", value, err)
+			}
+			c.Strict = strict
+		default:
+			return "", fmt.Errorf("unknown parameter %q in provider URL", key)
+		}
+	}
+	if u.Host != "" {
+		c.BaseURL = (&url.URL{Scheme: scheme, Host: u.Host, Path: u.Path}).String()
+		c.BaseURLEnv = nil
+	}
+	return query.Get("model"), nil
+}
+
+// resolveModel returns the model to use for the requested one.
+func (c *OpenAICompatibleConfig) resolveModel(model string) string {
+	if model == "" {
+		return c.DefaultModel
+	}
+	if alias, ok := c.ModelAliases[strings.ToLower(model)]; ok {
+		return alias
+	}
+	if c.ModelPrefix != "" && !strings.HasPrefix(model, c.ModelPrefix) {
+		klog.Warningf("%q is not a %s model, using %s", model, c.Name, c.DefaultModel)
+		return c.DefaultModel
+	}
+	return model
+}
+
+// OpenAICompatibleClient is a Client for providers serving the OpenAI chat completions API.
+type OpenAICompatibleClient struct {
+	config OpenAICompatibleConfig
+	client openai.Client
+	// model is the model pinned by the provider URL, if any.
+	model string
+}
+
+var _ Client = &OpenAICompatibleClient{}
+
+// NewOpenAICompatibleClient creates a client for an OpenAI-compatible provider.
+func NewOpenAICompatibleClient(ctx context.Context, config OpenAICompatibleConfig, opts ClientOptions) (*OpenAICompatibleClient, error) {
+	model, err := config.ParseURL(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := config.BaseURL
+	for _, env := range config.BaseURLEnv {
+		if v := os.Getenv(env); v != "" {
+			baseURL = v
+			break
+		}
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("%s needs an endpoint, e.g. openai-compatible://host:8000/v1?model=name", config.Name)
+	}
+
+	var apiKey string
+	for _, env := range config.APIKeyEnv {
+		if apiKey = os.Getenv(env); apiKey != "" {
+			break
+		}
+	}
+	if apiKey == "" && config.RequireAPIKey {
+		return nil, fmt.Errorf("%s API key not found. Set it via the %s environment variable", config.Name, strings.Join(config.APIKeyEnv, " or "))
+	}
+
+	klog.V(1).Infof("Using %s endpoint: %s", config.Name, baseURL)
+	options := []option.RequestOption{
+		option.WithBaseURL(baseURL),
+		option.WithHTTPClient(createCustomHTTPClient(opts.SkipVerifySSL)),
+	}
+	switch {
+	case apiKey != "" && config.AuthHeader == "":
+		options = append(options, option.WithAPIKey(apiKey))
+	case apiKey != "":
+		options = append(options, option.WithHeader(config.AuthHeader, apiKey), option.WithHeaderDel("authorization"))
+	default:
+		// The OpenAI SDK reads OPENAI_API_KEY by itself: don't send it to another provider.
+		options = append(options, option.WithHeaderDel("authorization"))
+	}
+
+	return &OpenAICompatibleClient{
+		config: config,
+		client: openai.NewClient(options...),
+		model:  model,
+	}, nil
+}
+
+// Close cleans up any resources used by the client.
+func (c *OpenAICompatibleClient) Close() error {
+	return nil
+}
+
+// resolveModel returns the model to use for the requested one, unless the provider URL pins it.
+func (c *OpenAICompatibleClient) resolveModel(model string) string {
+	if c.model != "" {
+		return c.model
+	}
+	return c.config.resolveModel(model)
+}
+
+// StartChat starts a new chat session.
+func (c *OpenAICompatibleClient) StartChat(systemPrompt, model string) Chat {
+	selectedModel := c.resolveModel(model)
+	klog.V(1).Infof("Starting new %s chat session with model: %s", c.config.Name, selectedModel)
+
+	history := []openai.ChatCompletionMessageParamUnion{}
+	if systemPrompt != "" {
+		history = append(history, openai.SystemMessage(systemPrompt))
+	}
+
+	return &openAIChatSession{
+		config:  &c.config,
+		client:  c.client,
+		history: history,
+		model:   selectedModel,
+	}
+}
+
+// GenerateCompletion sends a completion request to the chat completions API.
+func (c *OpenAICompatibleClient) GenerateCompletion(ctx context.Context, req *CompletionRequest) (CompletionResponse, error) {
+	model := c.resolveModel(req.Model)
+	klog.Infof("%s GenerateCompletion called with model: %s", c.config.Name, model)
+	klog.V(1).Infof("Prompt:\n%s", req.Prompt)
+
+	completion, err := c.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
+		Model: openai.ChatModel(model),
+		Messages: []openai.ChatCompletionMessageParamUnion{
+			openai.UserMessage(req.Prompt),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate %s completion: %w", c.config.Name, toAPIError(err))
+	}
+	if len(completion.Choices) == 0 || completion.Choices[0].Message.Content == "" {
+		return nil, fmt.Errorf("received an empty response from %s", c.config.Name)
+	}
+
+	return &openAICompletionResponse{
+		content: completion.Choices[0].Message.Content,
+		usage:   openAIUsage(completion.Model, completion.Usage),
+	}, nil
+}
+
+// SetResponseSchema is not implemented yet.
+func (c *OpenAICompatibleClient) SetResponseSchema(schema *Schema) error {
+	klog.Warningf("SetResponseSchema is not implemented yet for %s", c.config.Name)
+	return nil
+}
+
+// ListModels returns the models of the provider.
+// Note: not all OpenAI-compatible servers implement the models endpoint.
+func (c *OpenAICompatibleClient) ListModels(ctx context.Context) ([]string, error) {
+	if c.config.Models != nil {
+		return c.config.Models, nil
+	}
+	res, err := c.client.Models.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing models from %s: %w", c.config.Name, err)
+	}
+
+	modelIDs := make([]string, 0, len(res.Data))
+	for _, model := range res.Data {
+		modelIDs = append(modelIDs, model.ID)
+	}
+	return modelIDs, nil
+}
+
+type openAICompletionResponse struct {
+	content string
+	usage   *Usage
+}
+
+func (r *openAICompletionResponse) Response() string {
+	return r.content
+}
+
+func (r *openAICompletionResponse) UsageMetadata() *Usage {
+	return r.usage
+}
+
+// Chat Session Implementation
+
+type openAIChatSession struct {
+	config              *OpenAICompatibleConfig
+	client              openai.Client
+	history             []openai.ChatCompletionMessageParamUnion
+	model               string
+	functionDefinitions []*FunctionDefinition            // Stored in gollm format
+	tools               []openai.ChatCompletionToolParam // Stored in OpenAI format
+}
+
+// Ensure openAIChatSession implements the Chat interface.
+var _ Chat = (*openAIChatSession)(nil)
+
+// SetFunctionDefinitions stores the function definitions and converts them to OpenAI format.
+func (cs *openAIChatSession) SetFunctionDefinitions(defs []*FunctionDefinition) error {
+	cs.functionDefinitions = defs
+	cs.tools = nil // Clear previous tools
+	if len(defs) > 0 {
+		cs.tools = make([]openai.ChatCompletionToolParam, len(defs))
+		for i, gollmDef := range defs {
+			klog.V(2).Infof("Processing function definition: %s", gollmDef.Name)
+
+			params, err := cs.convertFunctionParameters(gollmDef)
+			if err != nil {
+				return fmt.Errorf("failed to process parameters for function %s: %w", gollmDef.Name, err)
+			}
+
+			cs.tools[i] = openai.ChatCompletionToolParam{
+				Function: openai.FunctionDefinitionParam{
+					Name:        gollmDef.Name,
+					Description: openai.String(gollmDef.Description),
+					Parameters:  params,
+				},
+			}
+			if cs.config.Strict {
+				cs.tools[i].Function.Strict = openai.Bool(true)
+			}
+		}
+	}
+	klog.V(1).Infof("Set %d function definitions for %s chat session", len(cs.functionDefinitions), cs.config.Name)
+	return nil
+}
+
+// newParams returns the parameters of a request with the given messages.
+func (cs *openAIChatSession) newParams(messages []openai.ChatCompletionMessageParamUnion) openai.ChatCompletionNewParams {
+	params := openai.ChatCompletionNewParams{
+		Model:    openai.ChatModel(cs.model),
+		Messages: messages,
+	}
+	if len(cs.tools) > 0 {
+		params.Tools = cs.tools
+		if cs.config.ToolChoice != "" {
+			params.ToolChoice = openai.ChatCompletionToolChoiceOptionUnionParam{OfAuto: openai.String(cs.config.ToolChoice)}
+		}
+	}
+	return params
+}
+
+// Send sends the user message(s), appends to history, and gets the LLM response.
+func (cs *openAIChatSession) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
+	klog.V(1).InfoS("openAIChatSession.Send called", "provider", cs.config.Name, "model", cs.model, "history_len", len(cs.history))
+
+	// The history is only updated once the request succeeded, so that retries don't repeat the contents.
+	messages, err := cs.appendContents(contents)
+	if err != nil {
+		return nil, err
+	}
+	params := cs.newParams(messages)
+
+	klog.V(1).InfoS("Sending request to chat completions API", "provider", cs.config.Name, "model", cs.model, "messages", len(params.Messages), "tools", len(params.Tools))
+	completion, err := cs.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		klog.Errorf("%s chat completion API error: %v", cs.config.Name, err)
+		return nil, fmt.Errorf("%s chat completion failed: %w", cs.config.Name, toAPIError(err))
+	}
+	klog.V(1).InfoS("Received response from chat completions API", "provider", cs.config.Name, "id", completion.ID, "choices", len(completion.Choices))
+
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("received empty response from %s (no choices)", cs.config.Name)
+	}
+
+	message := completion.Choices[0].Message
+	reasoning := cs.reasoning(message.JSON.ExtraFields)
+	cs.logReasoning(reasoning)
+	cs.history = append(messages, assistantMessage(message.Content, message.ToolCalls))
+
+	return &openAIChatResponse{
+		reasoning: reasoning,
+		content:   message.Content,
+		toolCalls: message.ToolCalls,
+		usage:     openAIUsage(completion.Model, completion.Usage),
+	}, nil
+}
+
+// SendStreaming sends the user message(s) and returns an iterator for the LLM response stream.
+// Reasoning and text are streamed as they are received; function calls, and usage, come with the last response.
+func (cs *openAIChatSession) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
+	klog.V(1).InfoS("Starting streaming request", "provider", cs.config.Name, "model", cs.model)
+
+	messages, err := cs.appendContents(contents)
+	if err != nil {
+		return nil, err
+	}
+	params := cs.newParams(messages)
+	if cs.config.StreamUsage {
+		params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	}
+
+	klog.V(1).InfoS("Sending streaming request to chat completions API",
+		"provider", cs.config.Name,
+		"model", cs.model,
+		"messageCount", len(params.Messages),
+		"toolCount", len(params.Tools))
+	stream := cs.client.Chat.Completions.NewStreaming(ctx, params)
+
+	return func(yield func(ChatResponse, error) bool) {
+		defer stream.Close()
+
+		// The SDK's accumulator drops chunks whose ID changes and sums usage over chunks,
+		// which some compatible servers report cumulatively, so the response is accumulated here.
+		var content, refusal, reasoning strings.Builder
+		var toolCalls []openai.ChatCompletionMessageToolCall
+		var usage *Usage
+
+		for stream.Next() {
+			chunk := stream.Current()
+			if chunkUsage := openAIUsage(chunk.Model, chunk.Usage); chunkUsage != nil {
+				usage = chunkUsage
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			delta := chunk.Choices[0].Delta
+			if deltaReasoning := cs.reasoning(delta.JSON.ExtraFields); deltaReasoning != "" {
+				reasoning.WriteString(deltaReasoning)
+				if !yield(&openAIChatResponse{reasoning: deltaReasoning}, nil) {
+					return
+				}
+			}
+			refusal.WriteString(delta.Refusal)
+			for _, tc := range delta.ToolCalls {
+				for int(tc.Index) >= len(toolCalls) {
+					toolCalls = append(toolCalls, openai.ChatCompletionMessageToolCall{})
+				}
+				toolCall := &toolCalls[tc.Index]
+				if tc.ID != "" {
+					toolCall.ID = tc.ID
+				}
+				toolCall.Function.Name += tc.Function.Name
+				toolCall.Function.Arguments += tc.Function.Arguments
+			}
+			if delta.Content != "" {
+				content.WriteString(delta.Content)
+				if !yield(&openAIChatResponse{content: delta.Content}, nil) {
+					return
+				}
+			}
+		}
+
+		if err := stream.Err(); err != nil {
+			klog.Errorf("Error in %s streaming: %v", cs.config.Name, err)
+			yield(nil, fmt.Errorf("%s streaming error: %w", cs.config.Name, toAPIError(err)))
+			return
+		}
+		if refusal.Len() > 0 {
+			yield(nil, fmt.Errorf("model refused to respond: %v", refusal.String()))
+			return
+		}
+
+		cs.logReasoning(reasoning.String())
+		cs.history = append(messages, assistantMessage(content.String(), toolCalls))
+		klog.V(2).InfoS("Added complete assistant message to history",
+			"content_present", content.Len() > 0,
+			"tool_calls", len(toolCalls))
+
+		if len(toolCalls) > 0 || usage != nil {
+			yield(&openAIChatResponse{toolCalls: toolCalls, usage: usage}, nil)
+		}
+	}, nil
+}
+
+// IsRetryableError determines if an error from the API should be retried.
+func (cs *openAIChatSession) IsRetryableError(err error) bool {
+	return DefaultIsRetryableError(toAPIError(err))
+}
+
+// toAPIError converts the errors of the API to *APIError, with the delay the server asked to wait before retrying.
+func toAPIError(err error) error {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	converted := &APIError{StatusCode: apiErr.StatusCode, Message: apiErr.Message, Err: err}
+	if apiErr.Response != nil {
+		converted.RetryAfter = ParseRetryAfter(apiErr.Response.Header.Get("Retry-After"))
+	}
+	return converted
+}
+
+// appendContents returns the history followed by the messages of the contents.
+func (cs *openAIChatSession) appendContents(contents []any) ([]openai.ChatCompletionMessageParamUnion, error) {
+	messages := slices.Clip(cs.history)
+	for _, content := range contents {
+		switch c := content.(type) {
+		case string:
+			klog.V(2).Infof("Adding user message to history: %s", c)
+			messages = append(messages, openai.UserMessage(c))
+		case FunctionCallResult:
+			klog.V(2).Infof("Adding tool call result to history: Name=%s, ID=%s", c.Name, c.ID)
+			resultJSON, err := json.Marshal(c.Result)
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal function call result %q: %w", c.Name, err)
+			}
+			messages = append(messages, openai.ToolMessage(string(resultJSON), c.ID))
+		default:
+			return nil, fmt.Errorf("unhandled content type: %T", content)
+		}
+	}
+	return messages, nil
+}
+
+// reasoning returns the reasoning of a message, or of a chunk of a message.
+func (cs *openAIChatSession) reasoning(fields map[string]respjson.Field) string {
+	if cs.config.ReasoningField == "" {
+		return ""
+	}
+	field, ok := fields[cs.config.ReasoningField]
+	if !ok {
+		return ""
+	}
+	var reasoning string
+	if err := json.Unmarshal([]byte(field.Raw()), &reasoning); err != nil {
+		return ""
+	}
+	return reasoning
+}
+
+func (cs *openAIChatSession) logReasoning(reasoning string) {
+	if reasoning != "" {
+		klog.V(2).InfoS("Model reasoning", "provider", cs.config.Name, "reasoning", reasoning)
+	}
+}
+
+// openAIUsage normalizes the usage of a completion, or of a chunk of a streamed completion.
+// DeepSeek reports the cached prompt tokens as "prompt_cache_hit_tokens" instead of in the details.
+func openAIUsage(model string, usage openai.CompletionUsage) *Usage {
+	cachedTokens := usage.PromptTokensDetails.CachedTokens
+	if field, ok := usage.JSON.ExtraFields["prompt_cache_hit_tokens"]; ok && cachedTokens == 0 {
+		json.Unmarshal([]byte(field.Raw()), &cachedTokens)
+	}
+	return newUsage(Usage{
+		Model:            model,
+		PromptTokens:     int(usage.PromptTokens),
+		CompletionTokens: int(usage.CompletionTokens),
+		CachedTokens:     int(cachedTokens),
+		ReasoningTokens:  int(usage.CompletionTokensDetails.ReasoningTokens),
+		TotalTokens:      int(usage.TotalTokens),
+	})
+}
+
+// assistantMessage returns the history entry of an assistant message.
+// It is built from the content and tool calls only, leaving out fields like the reasoning.
+func assistantMessage(content string, toolCalls []openai.ChatCompletionMessageToolCall) openai.ChatCompletionMessageParamUnion {
+	message := openai.ChatCompletionMessage{
+		Role:      "assistant",
+		Content:   content,
+		ToolCalls: toolCalls,
+	}
+	return message.ToParam()
+}
+
+// Helper structs for ChatResponse interface
+
+// openAIChatResponse is a response, or a chunk of a streamed response.
+type openAIChatResponse struct {
+	reasoning string
+	content   string
+	toolCalls []openai.ChatCompletionMessageToolCall
+	usage     *Usage
+}
+
+var _ ChatResponse = (*openAIChatResponse)(nil)
+
+func (r *openAIChatResponse) UsageMetadata() *Usage {
+	return r.usage
+}
+
+func (r *openAIChatResponse) Candidates() []Candidate {
+	return []Candidate{&openAICandidate{reasoning: r.reasoning, content: r.content, toolCalls: r.toolCalls}}
+}
+
+type openAICandidate struct {
+	reasoning string
+	content   string
+	toolCalls []openai.ChatCompletionMessageToolCall
+}
+
+var _ Candidate = (*openAICandidate)(nil)
+
+func (c *openAICandidate) Parts() []Part {
+	var parts []Part
+	if c.reasoning != "" {
+		parts = append(parts, &openAIPart{reasoning: c.reasoning})
+	}
+	if c.content != "" {
+		parts = append(parts, &openAIPart{content: c.content})
+	}
+	if len(c.toolCalls) > 0 {
+		parts = append(parts, &openAIPart{toolCalls: c.toolCalls})
+	}
+	return parts
+}
+
+// String provides a simple string representation for logging/debugging.
+func (c *openAICandidate) String() string {
+	return fmt.Sprintf("Candidate(ToolCalls: %d, Content: %q)", len(c.toolCalls), c.content)
+}
+
+type openAIPart struct {
+	reasoning string
+	content   string
+	toolCalls []openai.ChatCompletionMessageToolCall
+}
+
+var _ Part = (*openAIPart)(nil)
+
+func (p *openAIPart) AsText() (string, bool) {
+	return p.content, p.content != ""
+}
+
+func (p *openAIPart) AsFunctionCalls() ([]FunctionCall, bool) {
+	return convertToolCallsToFunctionCalls(p.toolCalls)
+}
+
+func (p *openAIPart) AsReasoning() (string, bool) {
+	return p.reasoning, p.reasoning != ""
+}
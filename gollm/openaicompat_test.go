@@ -0,0 +1,257 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestOpenAICompatibleConfigParseURL(t *testing.T) {
+	config := openAICompatibleConfig
+	u, _ := url.Parse("openai-compatible://gateway:8443/v1?model=qwen2.5-72b&auth_header=api-key&tool_choice=auto&stream_usage=true&reasoning_field=reasoning&strict=true")
+	model, err := config.ParseURL(u)
+	if err != nil {
+		t.Fatalf("ParseURL() error: %v", err)
+	}
+	if model != "qwen2.5-72b" {
+		t.Errorf("model = %q, want qwen2.5-72b", model)
+	}
+	if config.BaseURL != "https://gateway:8443/v1" || config.BaseURLEnv != nil {
+		t.Errorf("BaseURL = %q (env %v), want https://gateway:8443/v1", config.BaseURL, config.BaseURLEnv)
+	}
+	if config.AuthHeader != "api-key" || config.ToolChoice != "auto" || !config.StreamUsage || config.ReasoningField != "reasoning" || !config.Strict {
+		t.Errorf("quirks not applied: %+v", config)
+	}
+	if openAICompatibleConfig.BaseURLEnv == nil {
+		t.Errorf("ParseURL() modified the preset")
+	}
+
+	for _, rawURL := range []string{
+		"openai-compatible://host/v1?api_key=secret",
+		"openai-compatible://host/v1?scheme=ftp",
+		"openai-compatible://host/v1?tool_choice=always",
+		"openai-compatible://host/v1?stream_usage=maybe",
+		"openai-compatible://host/v1?strict=sometimes",
+	} {
+		config := openAICompatibleConfig
+		u, _ := url.Parse(rawURL)
+		if _, err := config.ParseURL(u); err == nil {
+			t.Errorf("ParseURL(%q) succeeded, want an error", rawURL)
+		}
+	}
+}
+
+func TestOpenAICompatibleResolveModel(t *testing.T) {
+	for model, want := range map[string]string{
+		"":                  "deepseek-chat",
+		"Reasoner":          "deepseek-reasoner",
+		"deepseek-reasoner": "deepseek-reasoner",
+		"gpt-4.1":           "deepseek-chat",
+	} {
+		if got := deepSeekConfig.resolveModel(model); got != want {
+			t.Errorf("resolveModel(%q) = %q, want %q", model, got, want)
+		}
+	}
+}
+
+// testChatServer serves canned responses to chat requests, and records the requests.
+// Responses starting with "data: " are streamed, and "error <status> <message>" fails the request.
+type testChatServer struct {
+	*httptest.Server
+	responses []string
+	requests  []map[string]any
+	headers   []http.Header
+}
+
+func newTestChatServer(t *testing.T, responses ...string) *testChatServer {
+	s := &testChatServer{responses: responses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		s.requests = append(s.requests, request)
+		s.headers = append(s.headers, r.Header)
+
+		response := s.responses[0]
+		s.responses = s.responses[1:]
+		switch {
+		case strings.HasPrefix(response, "error "):
+			// "error <status> <message>"
+			var status int
+			var message string
+			fmt.Sscanf(response, "error %d", &status)
+			_, message, _ = strings.Cut(strings.TrimPrefix(response, "error "), " ")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"type": "error", "error": {"type": "api_error", "message": %q}}`, message)
+		case strings.HasPrefix(response, "data: "):
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, response)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, response)
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testChatServer) client(t *testing.T, query string) *OpenAICompatibleClient {
+	t.Helper()
+	client, err := NewClient(context.Background(), "openai-compatible://"+strings.TrimPrefix(s.URL, "http://")+"/v1?scheme=http&"+query)
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	return client.(*OpenAICompatibleClient)
+}
+
+func TestOpenAICompatibleChatSend(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "openai-key")
+	t.Setenv("TEST_GATEWAY_KEY", "gateway-key")
+	server := newTestChatServer(t,
+		"error 400 context too long",
+		`{"id": "1", "choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": "",
+			"reasoning_content": "I should list the pods.",
+			"tool_calls": [{"id": "call-1", "type": "function", "function": {"name": "kubectl", "arguments": "{\"command\": \"kubectl get pods\"}"}}]}}],
+			"usage": {"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}}`,
+		`{"id": "2", "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "There is one pod."}}]}`,
+	)
+	client := server.client(t, "model=test-model&api_key_env=TEST_GATEWAY_KEY&auth_header=X-Api-Key&tool_choice=auto")
+
+	chat := client.StartChat("You are a test.", "deepseek-chat")
+	if err := chat.SetFunctionDefinitions([]*FunctionDefinition{{Name: "kubectl", Parameters: &Schema{Type: TypeObject}}}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := chat.Send(ctx, "list the pods"); err == nil || chat.IsRetryableError(err) {
+		t.Fatalf("Send() error = %v, want a non-retryable error", err)
+	}
+	response, err := chat.Send(ctx, "list the pods")
+	if err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+	parts := response.Candidates()[0].Parts()
+	if reasoning, ok := parts[0].AsReasoning(); !ok || reasoning != "I should list the pods." {
+		t.Errorf("reasoning = %q, want it as the first part", reasoning)
+	}
+	calls, ok := parts[len(parts)-1].AsFunctionCalls()
+	if !ok || len(calls) != 1 || calls[0].Arguments["command"] != "kubectl get pods" {
+		t.Errorf("function calls = %+v, want kubectl get pods", calls)
+	}
+	if response.UsageMetadata() == nil {
+		t.Errorf("usage is missing")
+	}
+	if _, err := chat.Send(ctx, FunctionCallResult{ID: "call-1", Name: "kubectl", Result: map[string]any{"stdout": "web-1"}}); err != nil {
+		t.Fatalf("Send() error: %v", err)
+	}
+
+	request := server.requests[1]
+	if request["model"] != "test-model" || request["tool_choice"] != "auto" {
+		t.Errorf("request model = %v, tool_choice = %v, want test-model and auto", request["model"], request["tool_choice"])
+	}
+	if got := server.headers[1].Get("X-Api-Key"); got != "gateway-key" {
+		t.Errorf("X-Api-Key = %q, want gateway-key", got)
+	}
+	if got := server.headers[1].Get("Authorization"); got != "" {
+		t.Errorf("Authorization = %q, want none", got)
+	}
+	// The failed request is not repeated in the history, and the reasoning is not sent back.
+	messages, _ := json.Marshal(server.requests[2]["messages"])
+	if n := strings.Count(string(messages), "list the pods"); n != 1 {
+		t.Errorf("the user message was sent %d times: %s", n, messages)
+	}
+	if strings.Contains(string(messages), "reasoning_content") || !strings.Contains(string(messages), `"tool_call_id":"call-1"`) {
+		t.Errorf("unexpected history: %s", messages)
+	}
+}
+
+func TestOpenAICompatibleChatSendStreaming(t *testing.T) {
+	chunks := []string{
+		`{"id": "a", "model": "test-model", "choices": [{"index": 0, "delta": {"role": "assistant", "reasoning_content": "Thinking."}}]}`,
+		`{"id": "a", "choices": [{"index": 0, "delta": {"content": "Let me "}}], "usage": {"prompt_tokens": 10, "completion_tokens": 1, "total_tokens": 11}}`,
+		// Some servers change the ID of the chunks, and report usage cumulatively.
+		`{"id": "b", "choices": [{"index": 0, "delta": {"content": "check."}}], "usage": {"prompt_tokens": 10, "completion_tokens": 2, "total_tokens": 12}}`,
+		`{"id": "b", "choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "id": "call-1", "type": "function", "function": {"name": "kubectl", "arguments": "{\"command\": "}}]}}]}`,
+		`{"id": "b", "choices": [{"index": 0, "delta": {"tool_calls": [{"index": 0, "function": {"arguments": "\"kubectl get pods\"}"}}]}, "finish_reason": "tool_calls"}]}`,
+		`{"id": "b", "model": "test-model", "choices": [], "usage": {"prompt_tokens": 10, "completion_tokens": 8, "total_tokens": 18,
+			"prompt_cache_hit_tokens": 6, "completion_tokens_details": {"reasoning_tokens": 3}}}`,
+	}
+	var stream strings.Builder
+	for _, chunk := range chunks {
+		fmt.Fprintf(&stream, "data: %s\n\n", strings.ReplaceAll(chunk, "\n", ""))
+	}
+	stream.WriteString("data: [DONE]\n\n")
+	server := newTestChatServer(t, stream.String())
+	client := server.client(t, "model=test-model&stream_usage=true")
+
+	chat := client.StartChat("", "")
+	iterator, err := chat.SendStreaming(context.Background(), "list the pods")
+	if err != nil {
+		t.Fatalf("SendStreaming() error: %v", err)
+	}
+	var reasoning, text strings.Builder
+	var calls []FunctionCall
+	var usage *Usage
+	for response, err := range iterator {
+		if err != nil {
+			t.Fatalf("streaming error: %v", err)
+		}
+		for _, part := range response.Candidates()[0].Parts() {
+			if s, ok := part.AsReasoning(); ok {
+				reasoning.WriteString(s)
+			}
+			if s, ok := part.AsText(); ok {
+				text.WriteString(s)
+			}
+			if c, ok := part.AsFunctionCalls(); ok {
+				calls = append(calls, c...)
+			}
+		}
+		if u := response.UsageMetadata(); u != nil {
+			usage = u
+		}
+	}
+
+	if reasoning.String() != "Thinking." {
+		t.Errorf("reasoning = %q, want %q", reasoning.String(), "Thinking.")
+	}
+	if text.String() != "Let me check." {
+		t.Errorf("text = %q, want %q", text.String(), "Let me check.")
+	}
+	if len(calls) != 1 || calls[0].ID != "call-1" || calls[0].Arguments["command"] != "kubectl get pods" {
+		t.Errorf("function calls = %+v, want one kubectl get pods", calls)
+	}
+	wantUsage := Usage{Model: "test-model", PromptTokens: 10, CompletionTokens: 8, CachedTokens: 6, ReasoningTokens: 3, TotalTokens: 18}
+	if usage == nil || *usage != wantUsage {
+		t.Errorf("usage = %+v, want %+v", usage, wantUsage)
+	}
+	if options, _ := server.requests[0]["stream_options"].(map[string]any); options["include_usage"] != true {
+		t.Errorf("stream_options = %v, want include_usage", server.requests[0]["stream_options"])
+	}
+	if history := chat.(*openAIChatSession).history; len(history) != 2 {
+		t.Errorf("history has %d messages, want 2", len(history))
+	}
+}
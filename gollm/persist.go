@@ -21,11 +21,48 @@ package gollm
 // This lets us store the history of the conversation for later analysis.
 
 type RecordCompletionResponse struct {
-	Text string `json:"text"`
-	Raw  any    `json:"raw"`
+	Text  string `json:"text"`
+	Raw   any    `json:"raw,omitempty"`
+	Usage *Usage `json:"usage,omitempty"`
 }
 
 type RecordChatResponse struct {
-	// TODO: Structured data?
-	Raw any `json:"raw"`
+	// Raw is the response of the provider, in its own format.
+	Raw any `json:"raw,omitempty"`
+
+	// Parts and Usage are the response in a provider-independent format, so it can be replayed.
+	Parts []RecordPart `json:"parts,omitempty"`
+	Usage *Usage       `json:"usage,omitempty"`
+}
+
+// RecordPart is a part of a recorded chat response: reasoning, text, or function calls.
+type RecordPart struct {
+	Reasoning     string         `json:"reasoning,omitempty"`
+	Text          string         `json:"text,omitempty"`
+	FunctionCalls []FunctionCall `json:"functionCalls,omitempty"`
+}
+
+// NewRecordChatResponse records the parts of the first candidate of a response, and its usage.
+func NewRecordChatResponse(response ChatResponse) RecordChatResponse {
+	record := RecordChatResponse{Usage: response.UsageMetadata()}
+	candidates := response.Candidates()
+	if len(candidates) == 0 {
+		return record
+	}
+	for _, part := range candidates[0].Parts() {
+		var recorded RecordPart
+		if reasoning, ok := part.AsReasoning(); ok {
+			recorded.Reasoning = reasoning
+		}
+		if text, ok := part.AsText(); ok {
+			recorded.Text = text
+		}
+		if calls, ok := part.AsFunctionCalls(); ok {
+			recorded.FunctionCalls = calls
+		}
+		if recorded.Reasoning != "" || recorded.Text != "" || len(recorded.FunctionCalls) > 0 {
+			record.Parts = append(record.Parts, recorded)
+		}
+	}
+	return record
 }
@@ -0,0 +1,402 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// RateLimit limits the requests sent to a provider. Zero values are unlimited.
+type RateLimit struct {
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+	// TokensPerMinute limits the tokens of the requests of the last minute, as reported by the provider:
+	// requests wait until the tokens of the requests of the last minute are below the limit.
+	TokensPerMinute int `json:"tokensPerMinute,omitempty"`
+	// MaxInFlight is the number of requests that may be sent at the same time.
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+}
+
+// IsZero returns true if the limit does not limit anything.
+func (l RateLimit) IsZero() bool {
+	return l == RateLimit{}
+}
+
+// RateLimits are rate limits keyed by provider ("deepseek") or by provider and model ("deepseek/deepseek-chat").
+// The key "*" applies to the providers that have no limit of their own.
+type RateLimits map[string]RateLimit
+
+// limiterFor returns the limiter of the requests of a model of a provider, shared within the process,
+// or nil if the requests are not limited.
+// Limits keyed by provider apply to all its models together; the "*" limit applies to each provider.
+func (l RateLimits) limiterFor(provider, model string) *RateLimiter {
+	keys := []string{provider}
+	if model != "" {
+		keys = []string{provider + "/" + model, provider}
+	}
+	for _, key := range keys {
+		if limit, ok := l[key]; ok {
+			if limit.IsZero() {
+				return nil
+			}
+			return SharedRateLimiter(key, limit)
+		}
+	}
+	if limit, ok := l["*"]; ok && !limit.IsZero() {
+		return SharedRateLimiter(provider, limit)
+	}
+	return nil
+}
+
+// RateLimiter makes requests wait until they are within a RateLimit. When the provider responds
+// with 429 Too Many Requests, it pauses all requests (respecting Retry-After) and halves the requests
+// per minute it lets through; the rate increases again with each successful request.
+type RateLimiter struct {
+	name     string
+	limit    RateLimit
+	inFlight chan struct{}
+
+	mu sync.Mutex
+	// requests are the start times of the requests of the last minute.
+	requests []time.Time
+	// tokens are the tokens of the requests of the last minute.
+	tokens []tokenCount
+	// rateFactor is the fraction of the requests per minute currently let through.
+	rateFactor  float64
+	backoff     time.Duration
+	pausedUntil time.Time
+	stats       RateLimiterStats
+}
+
+type tokenCount struct {
+	time   time.Time
+	tokens int
+}
+
+// RateLimiterStats are the metrics of a RateLimiter.
+type RateLimiterStats struct {
+	Name string `json:"name"`
+	// Requests are the requests let through, Waited the ones that had to wait, for WaitTime in total.
+	Requests int64         `json:"requests"`
+	Waited   int64         `json:"waited"`
+	WaitTime time.Duration `json:"waitTime"`
+	// RateLimited are the requests the provider responded to with 429 Too Many Requests.
+	RateLimited        int64 `json:"rateLimited"`
+	InFlight           int   `json:"inFlight"`
+	RequestsLastMinute int   `json:"requestsLastMinute"`
+	TokensLastMinute   int   `json:"tokensLastMinute"`
+	// RateFactor is the fraction of the requests per minute currently let through, lowered after 429 responses.
+	RateFactor float64 `json:"rateFactor"`
+}
+
+func (s RateLimiterStats) String() string {
+	return fmt.Sprintf("%s: %d requests (%d waited %v), %d rate limited, %d in flight, %d requests and %d tokens in the last minute, rate %.0f%%",
+		s.Name, s.Requests, s.Waited, s.WaitTime.Round(time.Millisecond), s.RateLimited, s.InFlight,
+		s.RequestsLastMinute, s.TokensLastMinute, s.RateFactor*100)
+}
+
+const (
+	minRateFactor       = 1.0 / 16
+	rateFactorIncrease  = 0.1
+	minRateLimitBackoff = time.Second
+	maxRateLimitBackoff = time.Minute
+)
+
+// NewRateLimiter returns a limiter; most callers want a SharedRateLimiter.
+func NewRateLimiter(name string, limit RateLimit) *RateLimiter {
+	l := &RateLimiter{name: name, limit: limit, rateFactor: 1}
+	if limit.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, limit.MaxInFlight)
+	}
+	return l
+}
+
+var sharedRateLimiters = struct {
+	sync.Mutex
+	limiters map[string]*RateLimiter
+}{limiters: map[string]*RateLimiter{}}
+
+// SharedRateLimiter returns the limiter of a name, shared by all clients of the process.
+// The limit is the one of the first call for the name.
+func SharedRateLimiter(name string, limit RateLimit) *RateLimiter {
+	sharedRateLimiters.Lock()
+	defer sharedRateLimiters.Unlock()
+	if l, ok := sharedRateLimiters.limiters[name]; ok {
+		return l
+	}
+	l := NewRateLimiter(name, limit)
+	sharedRateLimiters.limiters[name] = l
+	return l
+}
+
+// RateLimiterMetrics returns the metrics of the shared limiters, sorted by name.
+func RateLimiterMetrics() []RateLimiterStats {
+	sharedRateLimiters.Lock()
+	defer sharedRateLimiters.Unlock()
+	var stats []RateLimiterStats
+	for _, name := range slices.Sorted(maps.Keys(sharedRateLimiters.limiters)) {
+		stats = append(stats, sharedRateLimiters.limiters[name].Stats())
+	}
+	return stats
+}
+
+// Stats returns the metrics of the limiter.
+func (l *RateLimiter) Stats() RateLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(time.Now())
+	stats := l.stats
+	stats.Name = l.name
+	stats.InFlight = len(l.inFlight)
+	stats.RequestsLastMinute = len(l.requests)
+	for _, t := range l.tokens {
+		stats.TokensLastMinute += t.tokens
+	}
+	stats.RateFactor = l.rateFactor
+	return stats
+}
+
+// Acquire waits until a request may be sent, or the context is cancelled.
+// The returned function must be called when the request completes, with its usage (if any) and error.
+func (l *RateLimiter) Acquire(ctx context.Context) (func(usage *Usage, err error), error) {
+	start := time.Now()
+	waited := false
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		default:
+			waited = true
+			select {
+			case l.inFlight <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		wait := l.wait(now)
+		if wait <= 0 {
+			l.requests = append(l.requests, now)
+			l.stats.Requests++
+			if waited {
+				l.stats.Waited++
+				l.stats.WaitTime += now.Sub(start)
+			}
+			l.mu.Unlock()
+			break
+		}
+		l.mu.Unlock()
+
+		waited = true
+		klog.FromContext(ctx).V(2).Info("Waiting for LLM rate limit", "limiter", l.name, "wait", wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			if l.inFlight != nil {
+				<-l.inFlight
+			}
+			return nil, ctx.Err()
+		}
+	}
+
+	return func(usage *Usage, err error) {
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+		l.done(usage, err)
+	}, nil
+}
+
+// wait returns how long a request must wait before it may be sent; l.mu must be held.
+func (l *RateLimiter) wait(now time.Time) time.Duration {
+	l.prune(now)
+	wait := l.pausedUntil.Sub(now)
+	if rpm := l.limit.RequestsPerMinute; rpm > 0 {
+		allowed := max(1, int(float64(rpm)*l.rateFactor))
+		if len(l.requests) >= allowed {
+			wait = max(wait, l.requests[len(l.requests)-allowed].Add(time.Minute).Sub(now))
+		}
+	}
+	if tpm := l.limit.TokensPerMinute; tpm > 0 {
+		total := 0
+		for _, t := range l.tokens {
+			total += t.tokens
+		}
+		// Wait until enough of the tokens of the last minute expire.
+		for _, t := range l.tokens {
+			if total < tpm {
+				break
+			}
+			total -= t.tokens
+			wait = max(wait, t.time.Add(time.Minute).Sub(now))
+		}
+	}
+	return wait
+}
+
+// prune forgets the requests and tokens older than a minute; l.mu must be held.
+func (l *RateLimiter) prune(now time.Time) {
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(l.requests) && !l.requests[i].After(cutoff) {
+		i++
+	}
+	l.requests = l.requests[i:]
+	i = 0
+	for i < len(l.tokens) && !l.tokens[i].time.After(cutoff) {
+		i++
+	}
+	l.tokens = l.tokens[i:]
+}
+
+// done records the outcome of a request.
+func (l *RateLimiter) done(usage *Usage, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if usage != nil && usage.TotalTokens > 0 {
+		l.tokens = append(l.tokens, tokenCount{time: now, tokens: usage.TotalTokens})
+	}
+
+	if apiErr := asAPIError(err); apiErr != nil && apiErr.StatusCode == http.StatusTooManyRequests {
+		l.stats.RateLimited++
+		l.backoff = min(max(2*l.backoff, minRateLimitBackoff), maxRateLimitBackoff)
+		pause := max(l.backoff, apiErr.RetryAfter)
+		l.pausedUntil = now.Add(pause)
+		l.rateFactor = max(l.rateFactor/2, minRateFactor)
+		klog.Infof("LLM rate limited by %s, pausing requests for %v and lowering the rate to %.0f%%", l.name, pause, l.rateFactor*100)
+		return
+	}
+	if err == nil {
+		l.backoff = 0
+		l.rateFactor = min(l.rateFactor+rateFactorIncrease, 1)
+	}
+}
+
+// NewRateLimitedClient wraps a client of a provider, so that its requests wait for the rate limits of the
+// provider and model. Limiters are shared within the process, by all the clients of a provider.
+func NewRateLimitedClient(client Client, provider string, limits RateLimits) Client {
+	return &rateLimitedClient{Client: client, provider: provider, limits: limits}
+}
+
+type rateLimitedClient struct {
+	Client
+	provider string
+	limits   RateLimits
+}
+
+func (c *rateLimitedClient) GenerateCompletion(ctx context.Context, req *CompletionRequest) (CompletionResponse, error) {
+	limiter := c.limits.limiterFor(c.provider, req.Model)
+	if limiter == nil {
+		return c.Client.GenerateCompletion(ctx, req)
+	}
+	done, err := limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.Client.GenerateCompletion(ctx, req)
+	var usage *Usage
+	if response != nil {
+		usage = response.UsageMetadata()
+	}
+	done(usage, err)
+	return response, err
+}
+
+func (c *rateLimitedClient) StartChat(systemPrompt, model string) Chat {
+	chat := c.Client.StartChat(systemPrompt, model)
+	limiter := c.limits.limiterFor(c.provider, model)
+	if limiter == nil {
+		return chat
+	}
+	return &rateLimitedChat{Chat: chat, limiter: limiter}
+}
+
+type rateLimitedChat struct {
+	Chat
+	limiter *RateLimiter
+}
+
+func (c *rateLimitedChat) Send(ctx context.Context, contents ...any) (ChatResponse, error) {
+	done, err := c.limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.Chat.Send(ctx, contents...)
+	var usage *Usage
+	if response != nil {
+		usage = response.UsageMetadata()
+	}
+	done(usage, err)
+	return response, err
+}
+
+// SendStreaming waits for the rate limit when the stream is iterated; the request is in flight until
+// the stream ends or the consumer stops.
+func (c *rateLimitedChat) SendStreaming(ctx context.Context, contents ...any) (ChatResponseIterator, error) {
+	return func(yield func(ChatResponse, error) bool) {
+		done, err := c.limiter.Acquire(ctx)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		var usage *Usage
+		stream, err := c.Chat.SendStreaming(ctx, contents...)
+		if err != nil {
+			done(nil, err)
+			yield(nil, err)
+			return
+		}
+		for response, err := range stream {
+			if err != nil {
+				done(usage, err)
+				yield(nil, err)
+				return
+			}
+			if u := response.UsageMetadata(); u != nil {
+				usage = u
+			}
+			if !yield(response, nil) {
+				done(usage, nil)
+				return
+			}
+		}
+		done(usage, nil)
+	}, nil
+}
+
+// String describes the limits, for logs.
+func (l RateLimits) String() string {
+	var parts []string
+	for _, key := range slices.Sorted(maps.Keys(l)) {
+		limit := l[key]
+		parts = append(parts, fmt.Sprintf("%s: %d rpm, %d tpm, %d in flight", key, limit.RequestsPerMinute, limit.TokensPerMinute, limit.MaxInFlight))
+	}
+	return strings.Join(parts, "; ")
+}
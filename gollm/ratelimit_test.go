@@ -0,0 +1,185 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/ollama/ollama/api"
+	"google.golang.org/genai"
+)
+
+// acquireWithin tries to acquire the limiter within a short time, and returns the release function or nil.
+func acquireWithin(t *testing.T, l *RateLimiter) func(*Usage, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done, err := l.Acquire(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Acquire() error: %v", err)
+	}
+	return done
+}
+
+func TestRateLimiterMaxInFlight(t *testing.T) {
+	l := NewRateLimiter("test", RateLimit{MaxInFlight: 1})
+	done := acquireWithin(t, l)
+	if done == nil {
+		t.Fatal("first request had to wait")
+	}
+	if acquireWithin(t, l) != nil {
+		t.Fatal("second request was let through while the first one is in flight")
+	}
+	if got := l.Stats().InFlight; got != 1 {
+		t.Errorf("InFlight = %d, want 1", got)
+	}
+	done(nil, nil)
+	if acquireWithin(t, l) == nil {
+		t.Error("second request had to wait after the first one completed")
+	}
+}
+
+func TestRateLimiterRequestsPerMinute(t *testing.T) {
+	l := NewRateLimiter("test", RateLimit{RequestsPerMinute: 2})
+	for i := 0; i < 2; i++ {
+		done := acquireWithin(t, l)
+		if done == nil {
+			t.Fatalf("request %d had to wait", i+1)
+		}
+		done(nil, nil)
+	}
+	if acquireWithin(t, l) != nil {
+		t.Error("third request of the minute was let through")
+	}
+	if stats := l.Stats(); stats.Requests != 2 || stats.RequestsLastMinute != 2 {
+		t.Errorf("stats = %s, want 2 requests", stats)
+	}
+}
+
+func TestRateLimiterTokensPerMinute(t *testing.T) {
+	l := NewRateLimiter("test", RateLimit{TokensPerMinute: 100})
+	done := acquireWithin(t, l)
+	done(&Usage{TotalTokens: 150}, nil)
+	if acquireWithin(t, l) != nil {
+		t.Error("request was let through over the tokens per minute")
+	}
+	if got := l.Stats().TokensLastMinute; got != 150 {
+		t.Errorf("TokensLastMinute = %d, want 150", got)
+	}
+}
+
+func TestRateLimiterBacksOffOnTooManyRequests(t *testing.T) {
+	l := NewRateLimiter("test", RateLimit{RequestsPerMinute: 60})
+	done := acquireWithin(t, l)
+	done(nil, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second})
+
+	if acquireWithin(t, l) != nil {
+		t.Error("request was let through while paused after a 429 response")
+	}
+	stats := l.Stats()
+	if stats.RateLimited != 1 || stats.RateFactor != 0.5 {
+		t.Errorf("stats = %s, want 1 rate limited and the rate halved", stats)
+	}
+
+	l.done(nil, nil)
+	if got := l.Stats().RateFactor; got != 0.6 {
+		t.Errorf("RateFactor after a success = %v, want 0.6", got)
+	}
+}
+
+func TestRateLimiterBacksOffOnProviderTooManyRequests(t *testing.T) {
+	retryInfo := map[string]any{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "30s"}
+	for _, err := range []error{
+		genai.APIError{Code: http.StatusTooManyRequests, Details: []map[string]any{retryInfo}},
+		&azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+		api.StatusError{StatusCode: http.StatusTooManyRequests},
+	} {
+		l := NewRateLimiter("test", RateLimit{RequestsPerMinute: 60})
+		done := acquireWithin(t, l)
+		done(nil, fmt.Errorf("chat failed: %w", err))
+
+		if acquireWithin(t, l) != nil {
+			t.Errorf("%T: request was let through while paused after a 429 response", err)
+		}
+		if stats := l.Stats(); stats.RateLimited != 1 || stats.RateFactor != 0.5 {
+			t.Errorf("%T: stats = %s, want 1 rate limited and the rate halved", err, stats)
+		}
+	}
+
+	if got := retryAfter(genai.APIError{Code: http.StatusTooManyRequests, Details: []map[string]any{retryInfo}}); got != 30*time.Second {
+		t.Errorf("retryAfter() of a Gemini error = %v, want the 30s of its RetryInfo", got)
+	}
+}
+
+func TestRateLimitsLimiterFor(t *testing.T) {
+	limits := RateLimits{
+		"limits-deepseek/deepseek-chat": {RequestsPerMinute: 10},
+		"limits-deepseek":               {RequestsPerMinute: 20},
+		"limits-ollama":                 {},
+		"*":                             {MaxInFlight: 2},
+	}
+	for _, tc := range []struct {
+		provider, model string
+		want            string
+	}{
+		{"limits-deepseek", "deepseek-chat", "limits-deepseek/deepseek-chat"},
+		{"limits-deepseek", "deepseek-reasoner", "limits-deepseek"},
+		{"limits-deepseek", "", "limits-deepseek"},
+		{"limits-qwen", "qwen-plus", "limits-qwen"},
+		{"limits-ollama", "gemma3", ""},
+	} {
+		limiter := limits.limiterFor(tc.provider, tc.model)
+		var got string
+		if limiter != nil {
+			got = limiter.name
+		}
+		if got != tc.want {
+			t.Errorf("limiterFor(%q, %q) = %q, want %q", tc.provider, tc.model, got, tc.want)
+		}
+	}
+	if limits.limiterFor("limits-deepseek", "deepseek-chat") != limits.limiterFor("limits-deepseek", "deepseek-chat") {
+		t.Error("limiters are not shared")
+	}
+}
+
+func TestRateLimitedChatCountsStreamedTokens(t *testing.T) {
+	fake := NewFakeClient(&FakeScript{Turns: []FakeTurn{
+		{Chunks: []FakeChunk{{Text: "There is "}, {Text: "one pod."}}, Usage: &Usage{PromptTokens: 30, CompletionTokens: 12}},
+	}})
+	client := NewRateLimitedClient(fake, "limits-fake", RateLimits{"limits-fake": {TokensPerMinute: 1000, MaxInFlight: 1}})
+	chat := client.StartChat("", "fake-model")
+	if got, want := collectStream(t, chat, "list the pods"), "There is one pod."; got != want {
+		t.Errorf("stream = %q, want %q", got, want)
+	}
+	stats := SharedRateLimiter("limits-fake", RateLimit{}).Stats()
+	if stats.Requests != 1 || stats.InFlight != 0 || stats.TokensLastMinute != 42 {
+		t.Errorf("stats = %s, want 1 request, none in flight and 42 tokens", stats)
+	}
+	if err := fake.Done(); err != nil {
+		t.Error(err)
+	}
+}
@@ -16,3 +16,320 @@
 // https://github.com/GoogleCloudPlatform/kubectl-ai
 
 package gollm
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// schemaJSON is Schema without its JSON methods.
+type schemaJSON Schema
+
+// MarshalJSON writes the schema as JSON Schema: a nullable type is written as a list of types,
+// and NoAdditionalProperties as "additionalProperties": false.
+func (s Schema) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Type                 any       `json:"type,omitempty"`
+		Properties           any       `json:"properties,omitempty"`
+		Enum                 []any     `json:"enum,omitempty"`
+		Nullable             *bool     `json:"nullable,omitempty"`
+		AnyOf                []*Schema `json:"anyOf,omitempty"`
+		OneOf                []*Schema `json:"oneOf,omitempty"`
+		AdditionalProperties any       `json:"additionalProperties,omitempty"`
+		*schemaJSON
+	}{
+		Enum:       s.Enum,
+		AnyOf:      s.AnyOf,
+		OneOf:      s.OneOf,
+		schemaJSON: (*schemaJSON)(&s),
+	}
+	if s.Type != "" {
+		out.Type = s.Type
+	}
+	if s.Properties != nil {
+		// Objects keep an empty properties map, which OpenAI requires.
+		out.Properties = s.Properties
+	}
+	if s.Nullable {
+		switch {
+		case s.Type != "":
+			out.Type = []SchemaType{s.Type, TypeNull}
+		case len(s.AnyOf) > 0:
+			out.AnyOf = append(slices.Clip(s.AnyOf), &Schema{Type: TypeNull})
+		case len(s.OneOf) > 0:
+			out.OneOf = append(slices.Clip(s.OneOf), &Schema{Type: TypeNull})
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, nil) {
+			out.Enum = append(slices.Clip(s.Enum), nil)
+		}
+	}
+	if s.NoAdditionalProperties {
+		out.AdditionalProperties = false
+	} else if s.AdditionalProperties != nil {
+		out.AdditionalProperties = s.AdditionalProperties
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON reads a JSON Schema. Besides the fields of Schema, it understands lists of types,
+// "nullable" (OpenAPI), "const" (read as a single-value enum),
+// boolean schemas and boolean additionalProperties. Other keywords are ignored.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	*s = Schema{}
+	switch string(data) {
+	case "true", "false", "null":
+		// Boolean schemas accept anything (or nothing); there is nothing to describe.
+		return nil
+	}
+	in := struct {
+		Type                 json.RawMessage `json:"type"`
+		AdditionalProperties json.RawMessage `json:"additionalProperties"`
+		Const                json.RawMessage `json:"const"`
+		*schemaJSON
+	}{
+		schemaJSON: (*schemaJSON)(s),
+	}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	if len(in.Type) > 0 && string(in.Type) != "null" {
+		var types []SchemaType
+		if in.Type[0] == '[' {
+			if err := json.Unmarshal(in.Type, &types); err != nil {
+				return fmt.Errorf("reading schema type: %w", err)
+			}
+		} else {
+			var t SchemaType
+			if err := json.Unmarshal(in.Type, &t); err != nil {
+				return fmt.Errorf("reading schema type: %w", err)
+			}
+			types = []SchemaType{t}
+		}
+		if slices.Contains(types, TypeNull) && len(types) > 1 {
+			s.Nullable = true
+			types = slices.DeleteFunc(types, func(t SchemaType) bool { return t == TypeNull })
+		}
+		if len(types) == 1 {
+			s.Type = types[0]
+		} else {
+			for _, t := range types {
+				s.AnyOf = append(s.AnyOf, &Schema{Type: t})
+			}
+		}
+	}
+
+	// A null alternative makes the schema nullable.
+	isNull := func(alt *Schema) bool { return alt.isNull() }
+	for _, alts := range []*[]*Schema{&s.AnyOf, &s.OneOf} {
+		if len(*alts) > 1 && slices.ContainsFunc(*alts, isNull) {
+			s.Nullable = true
+			*alts = slices.DeleteFunc(*alts, isNull)
+		}
+	}
+
+	if len(in.Const) > 0 {
+		var v any
+		if err := json.Unmarshal(in.Const, &v); err != nil {
+			return fmt.Errorf("reading schema const: %w", err)
+		}
+		s.Enum = []any{v}
+	}
+	if slices.Contains(s.Enum, nil) {
+		s.Nullable = true
+		s.Enum = slices.DeleteFunc(s.Enum, func(v any) bool { return v == nil })
+	}
+
+	switch string(in.AdditionalProperties) {
+	case "", "true", "null":
+	case "false":
+		s.NoAdditionalProperties = true
+	default:
+		s.AdditionalProperties = &Schema{}
+		if err := json.Unmarshal(in.AdditionalProperties, s.AdditionalProperties); err != nil {
+			return fmt.Errorf("reading schema additionalProperties: %w", err)
+		}
+	}
+	return nil
+}
+
+// isNull returns whether the schema only accepts null.
+func (s *Schema) isNull() bool {
+	return s.Type == TypeNull && len(s.Properties) == 0 && s.Items == nil && len(s.AnyOf) == 0 && len(s.OneOf) == 0
+}
+
+// isStringEnum returns whether all the values of the enum are strings.
+func (s *Schema) isStringEnum() bool {
+	return !slices.ContainsFunc(s.Enum, func(v any) bool {
+		_, ok := v.(string)
+		return !ok
+	})
+}
+
+// clone returns a deep copy of the schema.
+func (s *Schema) clone() *Schema {
+	if s == nil {
+		return nil
+	}
+	out := *s
+	out.Required = slices.Clone(s.Required)
+	out.Enum = slices.Clone(s.Enum)
+	if s.Properties != nil {
+		out.Properties = make(map[string]*Schema, len(s.Properties))
+		for k, v := range s.Properties {
+			out.Properties[k] = v.clone()
+		}
+	}
+	out.Items = s.Items.clone()
+	out.AdditionalProperties = s.AdditionalProperties.clone()
+	if s.AnyOf != nil {
+		out.AnyOf = make([]*Schema, len(s.AnyOf))
+		for i, alt := range s.AnyOf {
+			out.AnyOf[i] = alt.clone()
+		}
+	}
+	if s.OneOf != nil {
+		out.OneOf = make([]*Schema, len(s.OneOf))
+		for i, alt := range s.OneOf {
+			out.OneOf[i] = alt.clone()
+		}
+	}
+	return &out
+}
+
+// walk calls fn on the schema and all the schemas it contains, parents first.
+func (s *Schema) walk(fn func(*Schema)) {
+	if s == nil {
+		return
+	}
+	fn(s)
+	for _, k := range slices.Sorted(maps.Keys(s.Properties)) {
+		s.Properties[k].walk(fn)
+	}
+	s.Items.walk(fn)
+	s.AdditionalProperties.walk(fn)
+	for _, alt := range s.AnyOf {
+		alt.walk(fn)
+	}
+	for _, alt := range s.OneOf {
+		alt.walk(fn)
+	}
+}
+
+// Constraint keywords that providers may not support, see downgradeSchema.
+const (
+	keywordEnum                 = "enum"
+	keywordMinimum              = "minimum"
+	keywordMaximum              = "maximum"
+	keywordMinLength            = "minLength"
+	keywordMaxLength            = "maxLength"
+	keywordMinItems             = "minItems"
+	keywordMaxItems             = "maxItems"
+	keywordPattern              = "pattern"
+	keywordFormat               = "format"
+	keywordDefault              = "default"
+	keywordAdditionalProperties = "additionalProperties"
+	keywordOneOf                = "oneOf"
+)
+
+// downgradeSchema returns a copy of the schema without the constraint keywords that supported
+// does not accept, at any depth. The constraints are described at the end of the description instead,
+// so that the model still knows about them.
+func downgradeSchema(schema *Schema, supported func(keyword string, s *Schema) bool) *Schema {
+	out := schema.clone()
+	out.walk(func(s *Schema) {
+		var notes []string
+		drop := func(keyword string, isSet bool, note string) bool {
+			if !isSet || supported(keyword, s) {
+				return false
+			}
+			if note != "" {
+				notes = append(notes, note)
+			}
+			return true
+		}
+		if drop(keywordEnum, len(s.Enum) > 0, "one of "+jsonList(s.Enum)) {
+			s.Enum = nil
+		}
+		if drop(keywordMinimum, s.Minimum != nil, fmt.Sprintf("at least %v", deref(s.Minimum))) {
+			s.Minimum = nil
+		}
+		if drop(keywordMaximum, s.Maximum != nil, fmt.Sprintf("at most %v", deref(s.Maximum))) {
+			s.Maximum = nil
+		}
+		if drop(keywordMinLength, s.MinLength != nil, fmt.Sprintf("length at least %d", deref(s.MinLength))) {
+			s.MinLength = nil
+		}
+		if drop(keywordMaxLength, s.MaxLength != nil, fmt.Sprintf("length at most %d", deref(s.MaxLength))) {
+			s.MaxLength = nil
+		}
+		if drop(keywordMinItems, s.MinItems != nil, fmt.Sprintf("number of items at least %d", deref(s.MinItems))) {
+			s.MinItems = nil
+		}
+		if drop(keywordMaxItems, s.MaxItems != nil, fmt.Sprintf("number of items at most %d", deref(s.MaxItems))) {
+			s.MaxItems = nil
+		}
+		if drop(keywordPattern, s.Pattern != "", "matching the regular expression "+s.Pattern) {
+			s.Pattern = ""
+		}
+		if drop(keywordFormat, s.Format != "", "in the "+s.Format+" format") {
+			s.Format = ""
+		}
+		if drop(keywordDefault, s.Default != nil, "defaults to "+jsonList([]any{s.Default})) {
+			s.Default = nil
+		}
+		if drop(keywordOneOf, len(s.OneOf) > 0, "matches exactly one of the alternatives") {
+			// anyOf is the closest keyword: the value must match at least one of the alternatives
+			s.AnyOf = append(s.AnyOf, s.OneOf...)
+			s.OneOf = nil
+		}
+		if drop(keywordAdditionalProperties, s.NoAdditionalProperties, "no other properties") {
+			s.NoAdditionalProperties = false
+		}
+		var note string
+		if s.AdditionalProperties != nil && s.AdditionalProperties.Type != "" {
+			note = fmt.Sprintf("other properties are of type %s", s.AdditionalProperties.Type)
+		}
+		if drop(keywordAdditionalProperties, s.AdditionalProperties != nil, note) {
+			s.AdditionalProperties = nil
+		}
+		if len(notes) > 0 {
+			s.Description = describeConstraints(s.Description, notes)
+		}
+	})
+	return out
+}
+
+// describeConstraints appends constraints to a description.
+func describeConstraints(description string, notes []string) string {
+	constraints := "Constraints: " + strings.Join(notes, "; ") + "."
+	description = strings.TrimRight(description, "\n ")
+	if description == "" {
+		return constraints
+	}
+	return description + "\n" + constraints
+}
+
+// jsonList formats values as a comma-separated list of JSON values.
+func jsonList(values []any) string {
+	var items []string
+	for _, v := range values {
+		b, err := json.Marshal(v)
+		if err != nil {
+			b = []byte(fmt.Sprint(v))
+		}
+		items = append(items, string(b))
+	}
+	return strings.Join(items, ", ")
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
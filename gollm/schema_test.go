@@ -0,0 +1,275 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// canonicalJSON re-encodes JSON with sorted keys, for comparisons.
+func canonicalJSON(t *testing.T, s string) string {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("invalid JSON %s: %v", s, err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func parseSchema(t *testing.T, s string) *Schema {
+	t.Helper()
+	schema := &Schema{}
+	if err := json.Unmarshal([]byte(s), schema); err != nil {
+		t.Fatalf("unmarshaling schema %s: %v", s, err)
+	}
+	return schema
+}
+
+func TestSchemaJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		// want is the marshaled schema, if different from in
+		want string
+	}{
+		{
+			name: "all keywords",
+			in: `{"type": "object", "description": "args", "required": ["name"], "additionalProperties": false, "properties": {
+				"name": {"type": "string", "minLength": 1, "maxLength": 63, "pattern": "^[a-z-]+$"},
+				"replicas": {"type": "integer", "minimum": 0, "maximum": 10, "default": 1},
+				"mode": {"type": "string", "enum": ["fast", "safe"], "format": "enum"},
+				"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+				"ports": {"type": "array", "items": {"type": "integer"}, "minItems": 1, "maxItems": 3},
+				"empty": {"type": "object", "properties": {}}
+			}}`,
+		},
+		{
+			name: "nullable type",
+			in:   `{"type": ["string", "null"], "enum": ["a", "b", null]}`,
+		},
+		{
+			name: "nullable alternatives",
+			in:   `{"anyOf": [{"type": "string"}, {"type": "integer"}, {"type": "null"}]}`,
+		},
+		{
+			name: "list of types",
+			in:   `{"type": ["string", "number"]}`,
+			want: `{"anyOf": [{"type": "string"}, {"type": "number"}]}`,
+		},
+		{
+			name: "openapi nullable",
+			in:   `{"type": "string", "nullable": true}`,
+			want: `{"type": ["string", "null"]}`,
+		},
+		{
+			name: "oneOf and const",
+			in:   `{"oneOf": [{"const": "all"}, {"type": "integer", "minimum": 1}]}`,
+			want: `{"oneOf": [{"enum": ["all"]}, {"type": "integer", "minimum": 1}]}`,
+		},
+		{
+			name: "nullable oneOf",
+			in:   `{"oneOf": [{"type": "string"}, {"type": "integer"}, {"type": "null"}]}`,
+		},
+		{
+			name: "boolean schemas and unknown keywords",
+			in:   `{"type": "array", "items": true, "additionalProperties": true, "$schema": "http://json-schema.org/draft-07/schema#", "title": "x"}`,
+			want: `{"type": "array", "items": {}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := parseSchema(t, tt.in)
+			b, err := json.Marshal(schema)
+			if err != nil {
+				t.Fatalf("marshaling schema: %v", err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.in
+			}
+			if got, want := canonicalJSON(t, string(b)), canonicalJSON(t, want); got != want {
+				t.Errorf("marshaled schema:\n got %s\nwant %s", got, want)
+			}
+
+			// Marshaling is stable from then on.
+			again, err := json.Marshal(parseSchema(t, string(b)))
+			if err != nil {
+				t.Fatalf("marshaling schema again: %v", err)
+			}
+			if string(again) != string(b) {
+				t.Errorf("schema changed on second round trip:\n got %s\nwant %s", again, b)
+			}
+		})
+	}
+}
+
+func TestSchemaUnmarshalFields(t *testing.T) {
+	schema := parseSchema(t, `{"type": "object", "additionalProperties": false, "properties": {
+		"size": {"type": ["integer", "null"], "minimum": 1},
+		"choice": {"anyOf": [{"type": "string"}, {"type": "null"}]},
+		"env": {"type": "object", "additionalProperties": {"type": "string"}}
+	}}`)
+	if !schema.NoAdditionalProperties || schema.AdditionalProperties != nil {
+		t.Errorf("additionalProperties false not read: %+v", schema)
+	}
+	size := schema.Properties["size"]
+	if size.Type != TypeInteger || !size.Nullable || size.Minimum == nil || *size.Minimum != 1 {
+		t.Errorf("size = %+v, want nullable integer with minimum 1", size)
+	}
+	choice := schema.Properties["choice"]
+	if !choice.Nullable || len(choice.AnyOf) != 1 || choice.AnyOf[0].Type != TypeString {
+		t.Errorf("choice = %+v, want nullable with a single string alternative", choice)
+	}
+	env := schema.Properties["env"]
+	if env.NoAdditionalProperties || env.AdditionalProperties == nil || env.AdditionalProperties.Type != TypeString {
+		t.Errorf("env = %+v, want string additional properties", env)
+	}
+}
+
+func TestDowngradeSchema(t *testing.T) {
+	minimum := 1.0
+	schema := &Schema{
+		Type: TypeObject,
+		Properties: map[string]*Schema{
+			"count": {Type: TypeInteger, Description: "How many.\n", Minimum: &minimum, Enum: []any{1, 2}},
+		},
+		NoAdditionalProperties: true,
+	}
+	out := downgradeSchema(schema, func(keyword string, s *Schema) bool { return keyword == keywordEnum })
+
+	count := out.Properties["count"]
+	if count.Minimum != nil || len(count.Enum) != 2 {
+		t.Errorf("count = %+v, want the enum kept and the minimum dropped", count)
+	}
+	if want := "How many.\nConstraints: at least 1."; count.Description != want {
+		t.Errorf("count description = %q, want %q", count.Description, want)
+	}
+	if out.NoAdditionalProperties || out.Description != "Constraints: no other properties." {
+		t.Errorf("additionalProperties not described: %+v", out)
+	}
+	if schema.Properties["count"].Minimum == nil || !schema.NoAdditionalProperties {
+		t.Errorf("downgradeSchema modified its input")
+	}
+
+	// oneOf is kept where supported, and becomes a described anyOf elsewhere
+	schema = parseSchema(t, `{"oneOf": [{"type": "string", "minLength": 1}, {"type": "integer"}]}`)
+	if out := downgradeSchema(schema, func(string, *Schema) bool { return true }); len(out.OneOf) != 2 || len(out.AnyOf) != 0 {
+		t.Errorf("oneOf not kept: %+v", out)
+	}
+	out = downgradeSchema(schema, func(keyword string, s *Schema) bool { return keyword != keywordOneOf && keyword != keywordMinLength })
+	if len(out.OneOf) != 0 || len(out.AnyOf) != 2 || out.Description != "Constraints: matches exactly one of the alternatives." {
+		t.Errorf("oneOf not downgraded to anyOf: %+v", out)
+	}
+	if alt := out.AnyOf[0]; alt.MinLength != nil || alt.Description != "Constraints: length at least 1." {
+		t.Errorf("alternative moved to anyOf not downgraded: %+v", alt)
+	}
+	if len(schema.OneOf) != 2 || schema.OneOf[0].MinLength == nil {
+		t.Errorf("downgradeSchema modified its input")
+	}
+}
+
+func TestToGeminiSchema(t *testing.T) {
+	schema := parseSchema(t, `{"type": "object", "additionalProperties": {"type": "string"}, "properties": {
+		"mode": {"type": "string", "enum": ["fast", "safe"]},
+		"level": {"type": "integer", "enum": [1, 2], "minimum": 1},
+		"when": {"type": "string", "format": "date-time"},
+		"url": {"type": "string", "format": "uri", "maxLength": 100},
+		"value": {"anyOf": [{"type": "string"}, {"type": "number"}, {"type": "null"}]},
+		"target": {"oneOf": [{"type": "string"}, {"type": "integer"}]}
+	}}`)
+	got, err := toGeminiSchema(schema)
+	if err != nil {
+		t.Fatalf("toGeminiSchema: %v", err)
+	}
+	if got.Description != "Constraints: other properties are of type string." {
+		t.Errorf("additionalProperties not described: %q", got.Description)
+	}
+	if mode := got.Properties["mode"]; len(mode.Enum) != 2 || mode.Format != "enum" {
+		t.Errorf("mode = %+v, want a string enum", mode)
+	}
+	if level := got.Properties["level"]; len(level.Enum) != 0 || level.Minimum == nil || level.Description != "Constraints: one of 1, 2." {
+		t.Errorf("level = %+v, want the integer enum described and the minimum kept", level)
+	}
+	if when := got.Properties["when"]; when.Format != "date-time" {
+		t.Errorf("when format = %q, want date-time", when.Format)
+	}
+	if url := got.Properties["url"]; url.Format != "" || url.MaxLength == nil || *url.MaxLength != 100 || url.Description != "Constraints: in the uri format." {
+		t.Errorf("url = %+v, want the format described and maxLength kept", url)
+	}
+	value := got.Properties["value"]
+	if value.Type != "" || len(value.AnyOf) != 2 || value.Nullable == nil || !*value.Nullable {
+		t.Errorf("value = %+v, want two nullable alternatives", value)
+	}
+	target := got.Properties["target"]
+	if len(target.AnyOf) != 2 || target.Description != "Constraints: matches exactly one of the alternatives." {
+		t.Errorf("target = %+v, want oneOf sent as described anyOf", target)
+	}
+}
+
+func TestStrictSchemaForOpenAI(t *testing.T) {
+	schema := parseSchema(t, `{"type": "object", "required": ["name"], "properties": {
+		"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+		"mode": {"type": "string", "enum": ["fast", "safe"], "default": "safe"},
+		"labels": {"type": "object", "additionalProperties": {"type": "string"}, "properties": {}}
+	}}`)
+	converted, err := convertSchemaForOpenAI(schema)
+	if err != nil {
+		t.Fatalf("convertSchemaForOpenAI: %v", err)
+	}
+	b, err := json.Marshal(openAISchema{Schema: strictSchemaForOpenAI(converted)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"type": "object", "required": ["name", "labels", "mode"], "additionalProperties": false, "properties": {
+		"name": {"type": "string", "pattern": "^[a-z]+$", "description": "Constraints: length at least 1."},
+		"mode": {"type": ["string", "null"], "enum": ["fast", "safe", null], "description": "Constraints: defaults to \"safe\"."},
+		"labels": {"type": ["object", "null"], "properties": {}, "additionalProperties": false,
+			"description": "Constraints: other properties are of type string."}
+	}}`
+	if got, want := canonicalJSON(t, string(b)), canonicalJSON(t, want); got != want {
+		t.Errorf("strict schema:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestToLlamacppSchema(t *testing.T) {
+	schema := parseSchema(t, `{"type": "object", "properties": {
+		"replicas": {"type": "integer", "minimum": 0},
+		"ratio": {"type": "number", "maximum": 1},
+		"id": {"type": "string", "format": "uuid"},
+		"host": {"type": "string", "format": "hostname"}
+	}}`)
+	got := toLlamacppSchema(schema)
+	if got.Properties["replicas"].Minimum == nil {
+		t.Errorf("integer minimum dropped")
+	}
+	if ratio := got.Properties["ratio"]; ratio.Maximum != nil || ratio.Description != "Constraints: at most 1." {
+		t.Errorf("ratio = %+v, want the maximum described", ratio)
+	}
+	if got.Properties["id"].Format != "uuid" {
+		t.Errorf("uuid format dropped")
+	}
+	if host := got.Properties["host"]; host.Format != "" || !strings.Contains(host.Description, "hostname") {
+		t.Errorf("host = %+v, want the format described", host)
+	}
+}
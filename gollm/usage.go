@@ -0,0 +1,135 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Usage is the token usage of one LLM request, normalized across providers.
+type Usage struct {
+	// Model is the model that served the request, as reported by the provider.
+	Model string `json:"model,omitempty"`
+
+	// PromptTokens are the input tokens, including the cached ones.
+	PromptTokens int `json:"promptTokens,omitempty"`
+	// CompletionTokens are the output tokens, including the reasoning ones.
+	CompletionTokens int `json:"completionTokens,omitempty"`
+	// CachedTokens are the prompt tokens read from the provider's prompt cache.
+	CachedTokens int `json:"cachedTokens,omitempty"`
+	// ReasoningTokens are the completion tokens spent on reasoning ("thinking").
+	ReasoningTokens int `json:"reasoningTokens,omitempty"`
+	// TotalTokens are the tokens billed for the request.
+	TotalTokens int `json:"totalTokens,omitempty"`
+}
+
+// newUsage returns the usage of a request, or nil if the provider reported no tokens.
+// The total is computed if the provider does not report it.
+func newUsage(usage Usage) *Usage {
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if usage.TotalTokens == 0 {
+		return nil
+	}
+	return &usage
+}
+
+// add adds the tokens of other to u.
+func (u *Usage) add(other *Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.CachedTokens += other.CachedTokens
+	u.ReasoningTokens += other.ReasoningTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+func (u *Usage) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d prompt tokens", u.PromptTokens)
+	if u.CachedTokens > 0 {
+		fmt.Fprintf(&sb, " (%d cached)", u.CachedTokens)
+	}
+	fmt.Fprintf(&sb, ", %d completion tokens", u.CompletionTokens)
+	if u.ReasoningTokens > 0 {
+		fmt.Fprintf(&sb, " (%d reasoning)", u.ReasoningTokens)
+	}
+	fmt.Fprintf(&sb, ", %d total", u.TotalTokens)
+	return sb.String()
+}
+
+// UsageTotals aggregates the usage of several LLM requests, overall and per model.
+// The zero value is ready to use; it is not safe for concurrent use.
+type UsageTotals struct {
+	Requests int               `json:"requests"`
+	Total    Usage             `json:"total"`
+	ByModel  map[string]*Usage `json:"byModel,omitempty"`
+}
+
+// Add adds the usage of a request; nil (no usage reported) is ignored.
+func (t *UsageTotals) Add(usage *Usage) {
+	if usage == nil {
+		return
+	}
+	t.Requests++
+	t.Total.add(usage)
+
+	model := usage.Model
+	if model == "" {
+		model = "unknown"
+	}
+	if t.ByModel == nil {
+		t.ByModel = make(map[string]*Usage)
+	}
+	byModel, ok := t.ByModel[model]
+	if !ok {
+		byModel = &Usage{Model: model}
+		t.ByModel[model] = byModel
+	}
+	byModel.add(usage)
+}
+
+// Merge adds the totals of other to t.
+func (t *UsageTotals) Merge(other *UsageTotals) {
+	t.Requests += other.Requests
+	t.Total.add(&other.Total)
+	for model, usage := range other.ByModel {
+		if t.ByModel == nil {
+			t.ByModel = make(map[string]*Usage)
+		}
+		if _, ok := t.ByModel[model]; !ok {
+			t.ByModel[model] = &Usage{Model: model}
+		}
+		t.ByModel[model].add(usage)
+	}
+}
+
+// String summarizes the totals, with one line per model if several models were used.
+func (t *UsageTotals) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d requests: %s", t.Requests, t.Total.String())
+	if len(t.ByModel) > 1 {
+		for _, model := range slices.Sorted(maps.Keys(t.ByModel)) {
+			fmt.Fprintf(&sb, "\n  %s: %s", model, t.ByModel[model].String())
+		}
+	}
+	return sb.String()
+}
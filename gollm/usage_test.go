@@ -0,0 +1,50 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package gollm
+
+import "testing"
+
+func TestUsageTotals(t *testing.T) {
+	var totals UsageTotals
+	totals.Add(newUsage(Usage{Model: "deepseek-chat", PromptTokens: 100, CompletionTokens: 20, CachedTokens: 60}))
+	totals.Add(nil)
+	totals.Add(newUsage(Usage{Model: "deepseek-reasoner", PromptTokens: 200, CompletionTokens: 50, ReasoningTokens: 30, TotalTokens: 250}))
+	totals.Add(newUsage(Usage{Model: "deepseek-chat", PromptTokens: 10, CompletionTokens: 5}))
+
+	want := Usage{PromptTokens: 310, CompletionTokens: 75, CachedTokens: 60, ReasoningTokens: 30, TotalTokens: 385}
+	if totals.Requests != 3 || totals.Total != want {
+		t.Errorf("totals = %d requests, %+v; want 3 requests, %+v", totals.Requests, totals.Total, want)
+	}
+	if got := totals.ByModel["deepseek-chat"]; got.TotalTokens != 135 || got.CachedTokens != 60 {
+		t.Errorf("deepseek-chat usage = %+v, want 135 total and 60 cached tokens", got)
+	}
+
+	var merged UsageTotals
+	merged.Merge(&totals)
+	merged.Merge(&totals)
+	if merged.Requests != 6 || merged.ByModel["deepseek-reasoner"].ReasoningTokens != 60 {
+		t.Errorf("merged = %+v", merged)
+	}
+	if totals.ByModel["deepseek-reasoner"].ReasoningTokens != 30 {
+		t.Errorf("Merge() modified its argument")
+	}
+
+	if newUsage(Usage{Model: "gpt-4.1"}) != nil {
+		t.Errorf("newUsage() of a response without tokens is not nil")
+	}
+}
@@ -26,10 +26,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/st-lzh/kubelet-wuhrai/gollm"
 	"github.com/st-lzh/kubelet-wuhrai/k8s-bench/pkg/model"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/journal"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/yaml"
 )
@@ -211,6 +214,7 @@ func evaluateTask(ctx context.Context, config EvalConfig, taskID string, task Ta
 		task:          &task,
 		taskID:        taskID,
 		taskOutputDir: taskOutputDir,
+		rateLimitArgs: agentRateLimitArgs(config),
 	}
 
 	taskDir := filepath.Join(config.TasksDir, taskID)
@@ -264,6 +268,21 @@ func evaluateTask(ctx context.Context, config EvalConfig, taskID string, task Ta
 	return result
 }
 
+// agentRateLimitArgs returns the flags giving each agent its share of the rate limits of the evaluation.
+// Each agent is a separate process with its own limiter, so the limits are split evenly between
+// the agents that may run at the same time.
+func agentRateLimitArgs(config EvalConfig) []string {
+	agents := max(config.Concurrency, 1)
+	var args []string
+	if config.RequestsPerMinute > 0 {
+		args = append(args, "--llm-requests-per-minute", strconv.Itoa(max(config.RequestsPerMinute/agents, 1)))
+	}
+	if config.TokensPerMinute > 0 {
+		args = append(args, "--llm-tokens-per-minute", strconv.Itoa(max(config.TokensPerMinute/agents, 1)))
+	}
+	return args
+}
+
 type TaskExecution struct {
 	// kubeConfig is the path to the kubeconfig file we should use.
 	// It will be created in IsolationModeCluster
@@ -282,6 +301,9 @@ type TaskExecution struct {
 	// taskOutputDir is where we can create artifacts or write logs while executing the task
 	taskOutputDir string
 
+	// rateLimitArgs are the flags limiting the LLM requests of the agent
+	rateLimitArgs []string
+
 	// cleanupFunctions are a set of cleanupFunctions we run to undo anything we ran
 	cleanupFunctions []func() error
 }
@@ -375,6 +397,7 @@ func (x *TaskExecution) runAgent(ctx context.Context) error {
 		"--trace-path", tracePath,
 		"--skip-permissions",
 	}
+	args = append(args, x.rateLimitArgs...)
 
 	stdinReader, stdinWriter := io.Pipe()
 
@@ -405,6 +428,12 @@ func (x *TaskExecution) runAgent(ctx context.Context) error {
 		return err
 	}
 
+	if usage, err := readUsage(tracePath); err != nil {
+		fmt.Printf("Warning: reading token usage for task %s: %v\n", x.taskID, err)
+	} else {
+		x.result.Usage = usage
+	}
+
 	// check any expectations
 	for _, expect := range x.task.Expect {
 		if expect.Contains != "" {
@@ -428,6 +457,19 @@ func (x *TaskExecution) runAgent(ctx context.Context) error {
 	return nil
 }
 
+// readUsage sums the token usage recorded in the trace of the agent.
+func readUsage(tracePath string) (*gollm.UsageTotals, error) {
+	events, err := journal.ParseEventsFromFile(tracePath)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := journal.SumUsage(events)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
 func (x *TaskExecution) runCommand(cmd *exec.Cmd) error {
 	fmt.Printf("\nRunning command: %s\n", strings.Join(cmd.Args, " "))
 	cmd.Stdout = os.Stdout
@@ -453,5 +495,8 @@ func printResults(allResults []model.TaskResult) {
 		if result.Error != "" {
 			fmt.Printf("    Error: %s\n", result.Error)
 		}
+		if result.Usage != nil && result.Usage.Requests > 0 {
+			fmt.Printf("    Usage: %s\n", result.Usage)
+		}
 	}
 }
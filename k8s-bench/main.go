@@ -28,6 +28,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/st-lzh/kubelet-wuhrai/gollm"
 	"github.com/st-lzh/kubelet-wuhrai/k8s-bench/pkg/model"
 	"sigs.k8s.io/yaml"
 )
@@ -71,6 +72,11 @@ type EvalConfig struct {
 	AgentBin    string
 	Concurrency int
 
+	// RequestsPerMinute and TokensPerMinute are the LLM rate limits of the whole evaluation,
+	// split between the agents running concurrently (0 is unlimited).
+	RequestsPerMinute int
+	TokensPerMinute   int
+
 	OutputDir string
 }
 
@@ -176,6 +182,8 @@ func runEvals(ctx context.Context) error {
 	flag.BoolVar(&quiet, "quiet", quiet, "Quiet mode (non-interactive mode)")
 	flag.IntVar(&config.Concurrency, "concurrency", 0, "Number of tasks to run concurrently (0 = auto, 1 = sequential)")
 	flag.StringVar(&config.OutputDir, "output-dir", config.OutputDir, "Directory to write results to")
+	flag.IntVar(&config.RequestsPerMinute, "llm-requests-per-minute", 0, "LLM requests per minute for the whole evaluation, split between concurrent tasks (0 = unlimited)")
+	flag.IntVar(&config.TokensPerMinute, "llm-tokens-per-minute", 0, "LLM tokens per minute for the whole evaluation, split between concurrent tasks (0 = unlimited)")
 	flag.Parse()
 
 	if config.KubeConfig == "" {
@@ -460,6 +468,32 @@ func printMarkdownResults(config AnalyzeConfig, results []model.TaskResult, resu
 	buffer.WriteString(fmt.Sprintf("- Overall Success: %d (%d%%)\n", overallSuccessCount, calculatePercentage(overallSuccessCount, totalCount)))
 	buffer.WriteString(fmt.Sprintf("- Overall Fail: %d (%d%%)\n\n", overallFailCount, calculatePercentage(overallFailCount, totalCount)))
 
+	// --- Token Usage ---
+	usageByModel := make(map[string]*gollm.UsageTotals)
+	for _, result := range results {
+		if result.Usage == nil {
+			continue
+		}
+		if usageByModel[result.LLMConfig.ModelID] == nil {
+			usageByModel[result.LLMConfig.ModelID] = &gollm.UsageTotals{}
+		}
+		usageByModel[result.LLMConfig.ModelID].Merge(result.Usage)
+	}
+	if len(usageByModel) > 0 {
+		buffer.WriteString("## Token Usage\n\n")
+		buffer.WriteString("| Model | Requests | Prompt | Cached | Completion | Reasoning | Total |\n")
+		buffer.WriteString("|-------|----------|--------|--------|------------|-----------|-------|\n")
+		for _, model := range models {
+			usage, ok := usageByModel[model]
+			if !ok {
+				continue
+			}
+			buffer.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %d | %d | %d |\n", model, usage.Requests,
+				usage.Total.PromptTokens, usage.Total.CachedTokens, usage.Total.CompletionTokens, usage.Total.ReasoningTokens, usage.Total.TotalTokens))
+		}
+		buffer.WriteString("\n")
+	}
+
 	// --- Detailed Results ---
 	if config.IgnoreToolUseShim {
 		// Group results by model for detailed view
@@ -17,7 +17,11 @@
 
 package model
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/st-lzh/kubelet-wuhrai/gollm"
+)
 
 type TaskResult struct {
 	Task      string    `json:"name"`
@@ -31,6 +35,9 @@ type TaskResult struct {
 	// Error contains the error message, if there was an unexpected error during the execution of the test.
 	// This normally indicates an infrastructure failure, rather than a test failure.
 	Error string `json:"error"`
+
+	// Usage is the token usage of the LLM requests of the agent, read from its trace.
+	Usage *gollm.UsageTotals `json:"usage,omitempty"`
 }
 
 type Failure struct {
@@ -91,6 +91,14 @@ func (a *unstructuredToCELAdapter) NativeToValue(value any) ref.Val {
 		return celtypes.Int(value)
 	case int64:
 		return celtypes.Int(value)
+	case float64:
+		return celtypes.Double(value)
+	case bool:
+		return celtypes.Bool(value)
+	case nil:
+		return celtypes.NullValue
+	case []any:
+		return celtypes.NewDynamicList(a, value)
 	case map[string]any:
 		return celtypes.NewDynamicMap(a, value)
 	default:
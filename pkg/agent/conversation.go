@@ -21,16 +21,25 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
+	"maps"
 	"os"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/st-lzh/kubelet-wuhrai/gollm"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/audit"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/journal"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/policy"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/redact"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/sandbox"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/tools"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/ui"
 	"k8s.io/klog/v2"
@@ -39,6 +48,15 @@ import (
 //go:embed systemprompt_template_default.txt
 var defaultSystemPromptTemplate string
 
+// LLMRetryConfig is how failed LLM requests are retried, with each provider when the LLM fails over.
+var LLMRetryConfig = gollm.RetryConfig{
+	MaxAttempts:    3,
+	InitialBackoff: 10 * time.Second,
+	MaxBackoff:     60 * time.Second,
+	BackoffFactor:  2,
+	Jitter:         true,
+}
+
 type Conversation struct {
 	LLM gollm.Client
 
@@ -49,6 +67,10 @@ type Conversation struct {
 	ExtraPromptPaths []string
 	Model            string
 
+	// Provider is the name of the LLM provider, shown in the UI.
+	// The active provider and model change if the LLM fails over to another provider.
+	Provider string
+
 	RemoveWorkDir bool
 
 	MaxIterations int
@@ -58,16 +80,51 @@ type Conversation struct {
 
 	SkipPermissions bool
 
-	Tools tools.Tools
+	// ReadOnly refuses every tool call that is not known to be read-only.
+	ReadOnly bool
+
+	// ContextPin, if set, refuses tool calls that would act on other clusters or switch the kubeconfig context.
+	ContextPin *tools.ContextPin
+
+	// Permissions, if set, lists what the identity commands run as may do ("kubectl auth can-i --list"),
+	// so that the LLM avoids commands that will be forbidden.
+	Permissions string
+
+	// RiskConfig tunes the risk assessment of kubectl commands.
+	RiskConfig tools.RiskConfig
+
+	// BlockCriticalRisk refuses critical-risk operations instead of asking for confirmation.
+	BlockCriticalRisk bool
+
+	// Audit, if set, records every tool call that runs or is refused.
+	Audit *audit.Logger
+
+	// Redactor, if set, replaces secrets in tool results before they reach the LLM or the trace.
+	Redactor *redact.Redactor
+
+	// Policy, if set, allows, denies or requires confirmation for tool calls.
+	Policy *policy.Policy
+
+	Tools *tools.Tools
+
+	// Sandbox, if set, runs the shell commands of the tools selected by its policy.
+	Sandbox *sandbox.Sandbox
 
 	EnableToolUseShim bool
 
+	// ShowReasoning expands the reasoning of reasoning models in the UI, instead of only showing that
+	// the model is thinking. The reasoning is never sent back to the LLM.
+	ShowReasoning bool
+
 	// MCPClientEnabled indicates whether MCP client mode is enabled
 	MCPClientEnabled bool
 
 	// Recorder captures events for diagnostics
 	Recorder journal.Recorder
 
+	// Approvals are the tool calls the user chose not to be asked about again; they only apply below high risk.
+	Approvals *tools.Approvals
+
 	// doc is the document which renders the conversation
 	doc *ui.Document
 
@@ -77,6 +134,28 @@ type Conversation struct {
 
 	// commandHistory tracks executed commands to prevent repetition
 	commandHistory map[string]int // command -> execution count
+
+	// kubeContext is the current context of the kubeconfig, used to assess risk.
+	kubeContext string
+
+	// osUser is the OS user running the agent, recorded in the audit log.
+	osUser string
+
+	// suspectedInjection holds why tool output since the user's last query looked like a prompt injection.
+	// Until the user's next query, or until the user confirms a change, changes always need confirmation.
+	suspectedInjection []string
+
+	// toolsChanged is set when the tool set changes at runtime,
+	// so we re-send the function definitions before the next LLM call.
+	toolsChanged atomic.Bool
+
+	// usage is the token usage of the LLM requests of the session.
+	usageMu sync.Mutex
+	usage   gollm.UsageTotals
+
+	// activeProvider and activeModel are the LLM provider and model in use.
+	activeProvider string
+	activeModel    string
 }
 
 func (s *Conversation) Init(ctx context.Context, doc *ui.Document) error {
@@ -91,8 +170,15 @@ func (s *Conversation) Init(ctx context.Context, doc *ui.Document) error {
 
 	log.Info("Created temporary working directory", "workDir", workDir)
 
+	s.kubeContext = tools.CurrentKubeContext(s.Kubeconfig)
+	s.osUser = audit.CurrentUser()
+
 	systemPrompt, err := s.generatePrompt(ctx, defaultSystemPromptTemplate, PromptData{
 		Tools:             s.Tools,
+		ReadOnly:          s.ReadOnly,
+		RedactSecrets:     s.Redactor != nil,
+		ContextPin:        s.ContextPin,
+		Permissions:       s.Permissions,
 		EnableToolUseShim: s.EnableToolUseShim,
 	})
 	if err != nil {
@@ -100,39 +186,106 @@ func (s *Conversation) Init(ctx context.Context, doc *ui.Document) error {
 	}
 
 	// Start a new chat session
+	s.activeProvider = s.Provider
+	s.activeModel = s.Model
 	s.llmChat = gollm.NewRetryChat(
 		s.LLM.StartChat(systemPrompt, s.Model),
-		gollm.RetryConfig{
-			MaxAttempts:    3,
-			InitialBackoff: 10 * time.Second,
-			MaxBackoff:     60 * time.Second,
-			BackoffFactor:  2,
-			Jitter:         true,
-		},
+		LLMRetryConfig,
 	)
 
 	// Initialize command history tracking
 	s.commandHistory = make(map[string]int)
+	if s.Approvals == nil {
+		s.Approvals = &tools.Approvals{}
+	}
 
-	if !s.EnableToolUseShim {
-		var functionDefinitions []*gollm.FunctionDefinition
-		for _, tool := range s.Tools.AllTools() {
-			functionDefinitions = append(functionDefinitions, tool.FunctionDefinition())
-		}
-		// Sort function definitions to help KV cache reuse
-		sort.Slice(functionDefinitions, func(i, j int) bool {
-			return functionDefinitions[i].Name < functionDefinitions[j].Name
-		})
-		if err := s.llmChat.SetFunctionDefinitions(functionDefinitions); err != nil {
-			return fmt.Errorf("setting function definitions: %w", err)
-		}
+	if err := s.updateFunctionDefinitions(); err != nil {
+		return err
 	}
+	s.toolsChanged.Store(false)
+
 	s.workDir = workDir
 	s.doc = doc
 
 	return nil
 }
 
+// updateFunctionDefinitions sends the definitions of the currently enabled tools to the LLM.
+func (s *Conversation) updateFunctionDefinitions() error {
+	if s.EnableToolUseShim {
+		// With the shim, tools are described in the system prompt; they are picked up on reset.
+		return nil
+	}
+
+	var functionDefinitions []*gollm.FunctionDefinition
+	for _, tool := range s.Tools.AllTools() {
+		functionDefinitions = append(functionDefinitions, tool.FunctionDefinition())
+	}
+	// Sort function definitions to help KV cache reuse
+	sort.Slice(functionDefinitions, func(i, j int) bool {
+		return functionDefinitions[i].Name < functionDefinitions[j].Name
+	})
+	if err := s.llmChat.SetFunctionDefinitions(functionDefinitions); err != nil {
+		return fmt.Errorf("setting function definitions: %w", err)
+	}
+	return nil
+}
+
+// ToolsChanged notifies the conversation that tools were added, removed, enabled or disabled.
+// The new function definitions are sent to the LLM before its next request.
+// It is safe to call from any goroutine.
+func (s *Conversation) ToolsChanged() {
+	s.toolsChanged.Store(true)
+}
+
+// ActiveModel returns the LLM provider and model in use, which change if the LLM failed over to another provider.
+func (s *Conversation) ActiveModel() (provider, model string) {
+	return s.activeProvider, s.activeModel
+}
+
+// Usage returns the token usage of the LLM requests of the session so far.
+// It is safe to call from any goroutine.
+func (s *Conversation) Usage() gollm.UsageTotals {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	var usage gollm.UsageTotals
+	usage.Merge(&s.usage)
+	return usage
+}
+
+// recordUsage adds the usage of an LLM request to the totals of the session, and to the journal.
+func (s *Conversation) recordUsage(ctx context.Context, usage *gollm.Usage) {
+	if usage == nil {
+		return
+	}
+	s.usageMu.Lock()
+	s.usage.Add(usage)
+	s.usageMu.Unlock()
+
+	s.Recorder.Write(ctx, &journal.Event{
+		Timestamp: time.Now(),
+		Action:    journal.ActionLLMUsage,
+		Payload:   usage,
+	})
+}
+
+// providerFailedOver records that the LLM provider failed and the conversation continues with the next one.
+func (s *Conversation) providerFailedOver(ctx context.Context, failover *gollm.ProviderFailoverError) {
+	s.activeProvider = failover.To
+	s.activeModel = failover.Model
+	s.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  The LLM provider %s failed (%v), switching to %s...\n", failover.From, failover.Err, failover.To)))
+	s.Recorder.Write(ctx, &journal.Event{
+		Timestamp: time.Now(),
+		Action:    journal.ActionLLMFailover,
+		Payload: map[string]any{
+			"from":  failover.From,
+			"to":    failover.To,
+			"model": failover.Model,
+			"error": failover.Err.Error(),
+		},
+	})
+}
+
 func (c *Conversation) Close() error {
 	if c.workDir != "" {
 		if c.RemoveWorkDir {
@@ -156,12 +309,21 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 	// Set the initial message to start the conversation
 	currChatContent = []any{query}
 
+	// The user has seen the output that looked like a prompt injection, and asked something new.
+	a.suspectedInjection = nil
+
 	currentIteration := 0
 	maxIterations := a.MaxIterations
 
 	for currentIteration < maxIterations {
 		log.Info("Starting iteration", "iteration", currentIteration)
 
+		if a.toolsChanged.Swap(false) {
+			if err := a.updateFunctionDefinitions(); err != nil {
+				return err
+			}
+		}
+
 		a.Recorder.Write(ctx, &journal.Event{
 			Timestamp: time.Now(),
 			Action:    "llm-chat",
@@ -169,6 +331,7 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 		})
 
 		var agentTextBlock *ui.AgentTextBlock
+		var reasoningBlock *ui.ReasoningBlock
 
 		// We create the agent text block here; this lets renderers render a "thinking" state
 		// before the first response arrives.
@@ -194,8 +357,36 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 
 		// Process each part of the response
 		var functionCalls []gollm.FunctionCall
+		// The last usage reported by the stream covers the whole request.
+		var usage *gollm.Usage
 
 		for response, err := range stream {
+			var restart *gollm.StreamRestartError
+			if errors.As(err, &restart) {
+				// The response was interrupted and the request is sent again: discard what we received.
+				log.Info("streaming LLM response interrupted, retrying", "error", err)
+				functionCalls = nil
+				usage = nil
+				if reasoningBlock != nil {
+					reasoningBlock.SetText("")
+					reasoningBlock.SetStreaming(false)
+					reasoningBlock = nil
+				}
+				if agentTextBlock != nil {
+					agentTextBlock.SetText("")
+					agentTextBlock.SetStreaming(false)
+				}
+				var failover *gollm.ProviderFailoverError
+				if errors.As(restart.Err, &failover) {
+					a.providerFailedOver(ctx, failover)
+				} else {
+					a.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  The response was interrupted (%v), retrying...\n", restart.Err)))
+				}
+				agentTextBlock = ui.NewAgentTextBlock()
+				agentTextBlock.SetStreaming(true)
+				a.doc.AddBlock(agentTextBlock)
+				continue
+			}
 			if err != nil {
 				log.Error(err, "error reading streaming LLM response")
 				return fmt.Errorf("reading streaming LLM response: %w", err)
@@ -210,6 +401,9 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 				Action:    "llm-response",
 				Payload:   response,
 			})
+			if u := response.UsageMetadata(); u != nil {
+				usage = u
+			}
 
 			if len(response.Candidates()) == 0 {
 				log.Error(nil, "No candidates in response")
@@ -219,9 +413,28 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 			candidate := response.Candidates()[0]
 
 			for _, part := range candidate.Parts() {
+				// Reasoning comes before the answer, in a block of its own.
+				if reasoning, ok := part.AsReasoning(); ok {
+					if reasoningBlock == nil || !reasoningBlock.Streaming() {
+						// The text that follows goes to a new block, after the reasoning.
+						if agentTextBlock != nil {
+							agentTextBlock.SetStreaming(false)
+							agentTextBlock = nil
+						}
+						reasoningBlock = ui.NewReasoningBlock()
+						reasoningBlock.SetExpanded(a.ShowReasoning)
+						reasoningBlock.SetStreaming(true)
+						a.doc.AddBlock(reasoningBlock)
+					}
+					reasoningBlock.AppendText(reasoning)
+				}
+
 				// Check if it's a text response
 				if text, ok := part.AsText(); ok {
 					log.Info("text response", "text", text)
+					if reasoningBlock != nil && reasoningBlock.Streaming() {
+						reasoningBlock.SetStreaming(false)
+					}
 					if agentTextBlock == nil {
 						agentTextBlock = ui.NewAgentTextBlock()
 						agentTextBlock.SetStreaming(true)
@@ -238,9 +451,13 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 			}
 		}
 
+		if reasoningBlock != nil && reasoningBlock.Streaming() {
+			reasoningBlock.SetStreaming(false)
+		}
 		if agentTextBlock != nil {
 			agentTextBlock.SetStreaming(false)
 		}
+		a.recordUsage(ctx, usage)
 
 		// TODO(droot): Run all function calls in parallel
 		// (may have to specify in the prompt to make these function calls independent)
@@ -248,7 +465,16 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 		// Suggestion: Use goroutines and sync.WaitGroup to parallelize execution if tool calls are independent.
 		// Be careful with shared state and UI updates if running in parallel.
 
-		for _, call := range functionCalls {
+		// The calls the user edited before running are queued again with the edited command,
+		// so that it goes through the same checks; edits are indexed by position in functionCalls.
+		edits := map[int]*commandEdit{}
+		// callResultsStart[i] is where the results of functionCalls[i] start in currChatContent.
+		var callResultsStart []int
+		for i := 0; i < len(functionCalls); i++ {
+			call := functionCalls[i]
+			edit := edits[i]
+			callResultsStart = append(callResultsStart, len(currChatContent))
+
 			toolCall, err := a.Tools.ParseToolInvocation(ctx, call.Name, call.Arguments)
 			if err != nil {
 				return fmt.Errorf("building tool call: %w", err)
@@ -314,9 +540,50 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 			functionCallRequestBlock := ui.NewFunctionCallRequestBlock().SetDescription(toolDescription)
 			a.doc.AddBlock(functionCallRequestBlock)
 
+			auditEntry := a.newAuditEntry(toolCall, call.Arguments)
+
+			// In read-only mode, refuse anything that is not known to be read-only, whatever the LLM says about it.
+			if a.ReadOnly {
+				if err := tools.CheckReadOnly(toolCall.GetTool(), call.Arguments); err != nil {
+					reason := fmt.Sprintf("This session is read-only and the operation was not run: %v. Only use commands that read cluster state, and suggest to the user the commands they can run themselves to make changes.", err)
+					a.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  %s\n", reason)))
+					a.recordAudit(ctx, auditEntry, audit.DecisionRefused, err.Error())
+					currChatContent = append(currChatContent, gollm.FunctionCallResult{
+						ID:   call.ID,
+						Name: call.Name,
+						Result: map[string]any{
+							"error":     reason,
+							"status":    "refused",
+							"retryable": false,
+						},
+					})
+					continue
+				}
+			}
+
+			// Keep the session on the pinned cluster, whatever the LLM asks for.
+			if err := a.ContextPin.Check(toolCall.GetTool(), call.Arguments); err != nil {
+				reason := fmt.Sprintf("The operation was not run: %v. Do not try to switch clusters or edit the kubeconfig; if the user needs another cluster, tell them to start a session for it.", err)
+				a.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  %s\n", reason)))
+				a.recordAudit(ctx, auditEntry, audit.DecisionRefused, err.Error())
+				currChatContent = append(currChatContent, gollm.FunctionCallResult{
+					ID:   call.ID,
+					Name: call.Name,
+					Result: map[string]any{
+						"error":     reason,
+						"status":    "refused",
+						"retryable": false,
+					},
+				})
+				continue
+			}
+
 			// Ask for confirmation only if SkipPermissions is false AND the tool modifies resources.
 			// Use the tool's CheckModifiesResource method to determine if the command modifies resources
 			modifiesResourceStr := toolCall.GetTool().CheckModifiesResource(call.Arguments)
+			// The injection step-up only trusts our own detection ("unknown" counts as a change):
+			// the LLM's assessment is exactly what an injected instruction would make it get wrong.
+			detectedModifies := modifiesResourceStr
 
 			// If our code detection returned "unknown", fall back to the LLM's assessment if available
 			if modifiesResourceStr == "unknown" {
@@ -325,32 +592,121 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 					modifiesResourceStr = llmModifies
 				}
 			}
+			auditEntry.ModifiesResource = modifiesResourceStr
 
-			if !a.SkipPermissions && modifiesResourceStr != "no" {
-				confirmationPrompt := `  Do you want to proceed ?`
+			// Apply the policy rules before anything else: denied calls are never offered for confirmation.
+			var decision policy.Decision
+			if a.Policy != nil {
+				decision, err = a.Policy.Evaluate(ctx, policy.NewRequests(toolCall, call.Arguments, a.kubeContext, a.contextNamespace))
+				if err != nil {
+					// Fail closed: a rule we cannot evaluate might have denied the call.
+					log.Error(err, "evaluating policy")
+					decision = policy.Decision{
+						Action: policy.ActionDeny,
+						Rule:   &policy.Rule{Name: "error", Reason: fmt.Sprintf("the policy could not be evaluated: %v", err)},
+					}
+				}
+			}
+			if decision.Action == policy.ActionDeny {
+				reason := fmt.Sprintf("This operation is denied by policy: %s. Do not retry it or work around the policy; tell the user instead.", decision.Reason())
+				a.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  %s\n", reason)))
+				a.recordAudit(ctx, auditEntry, audit.DecisionDenied, decision.Reason())
+				currChatContent = append(currChatContent, gollm.FunctionCallResult{
+					ID:   call.ID,
+					Name: call.Name,
+					Result: map[string]any{
+						"error":     reason,
+						"status":    "denied",
+						"retryable": false,
+					},
+				})
+				continue
+			}
 
-				optionsBlock := ui.NewInputOptionBlock().SetPrompt(confirmationPrompt)
-				optionsBlock.AddOption("yes", "Yes", "yes", "y")
-				optionsBlock.AddOption("yes_and_dont_ask_me_again", "Yes, and don't ask me again")
-				optionsBlock.AddOption("no", "No", "no", "n")
-				a.doc.AddBlock(optionsBlock)
+			// Grade kubectl calls, so that riskier operations need a stronger confirmation.
+			risk, hasRisk := tools.AssessKubectlCommandRisk(toolCall.KubectlInvocations(), a.RiskConfig, a.kubeContext, a.contextNamespace)
+			if hasRisk {
+				auditEntry.Risk = risk.Tier.String()
+			}
+			if hasRisk && risk.Tier == tools.RiskCritical && a.BlockCriticalRisk {
+				reason := fmt.Sprintf("This operation was blocked because it is critical risk (%s), and critical-risk operations are disabled by configuration. If it is really needed, the user must run it themselves.", strings.Join(risk.Reasons, "; "))
+				a.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  %s\n", reason)))
+				a.recordAudit(ctx, auditEntry, audit.DecisionBlocked, strings.Join(risk.Reasons, "; "))
+				currChatContent = append(currChatContent, gollm.FunctionCallResult{
+					ID:   call.ID,
+					Name: call.Name,
+					Result: map[string]any{
+						"error":     reason,
+						"status":    "blocked",
+						"retryable": false,
+					},
+				})
+				continue
+			}
+			highRisk := hasRisk && risk.Tier >= tools.RiskHigh
 
-				selectedChoice, err := optionsBlock.Selection().Wait()
+			// Approvals only cover low and medium risk operations
+			var approval *tools.Approval
+			if !highRisk {
+				approval = a.Approvals.Match(toolCall, a.kubeContext)
+			}
+			needsConfirmation := !a.SkipPermissions && modifiesResourceStr != "no" && approval == nil
+			switch decision.Action {
+			case policy.ActionAsk:
+				needsConfirmation = true
+				a.doc.AddBlock(ui.NewAgentTextBlock().WithText(fmt.Sprintf("Confirmation required by %s.", decision.Reason())))
+			case policy.ActionAllow:
+				needsConfirmation = false
+			}
+			// Changes proposed after tool output that looked like a prompt injection are always confirmed.
+			steppedUp := len(a.suspectedInjection) > 0 && detectedModifies != "no"
+			if steppedUp {
+				a.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Earlier tool output contained instruction-like text (%s), so this change needs your confirmation.\n", strings.Join(a.suspectedInjection, "; "))))
+				if !needsConfirmation {
+					needsConfirmation = true
+					auditEntry.ApprovedBy = auditEntry.User + " (confirmed after suspected prompt injection)"
+				}
+			}
+			// The user wrote the edited command themselves, which stands for the usual confirmation.
+			// High risk, policy rules that ask and suspected prompt injection still need it again.
+			if edit != nil && needsConfirmation && !highRisk && decision.Action != policy.ActionAsk && !steppedUp {
+				needsConfirmation = false
+				auditEntry.ApprovedBy = auditEntry.User + " (edited)"
+			}
+			switch {
+			case auditEntry.ApprovedBy != "":
+			case needsConfirmation && highRisk:
+				auditEntry.ApprovedBy = auditEntry.User + " (typed confirmation)"
+			case needsConfirmation:
+				auditEntry.ApprovedBy = auditEntry.User + " (confirmed)"
+			case decision.Action == policy.ActionAllow:
+				auditEntry.ApprovedBy = decision.Reason()
+			case a.SkipPermissions:
+				auditEntry.ApprovedBy = "--skip-permissions"
+			case modifiesResourceStr == "no":
+				auditEntry.ApprovedBy = "not required (read-only)"
+			default:
+				auditEntry.ApprovedBy = fmt.Sprintf("%s (approval #%d: %s)", auditEntry.User, approval.ID, approval)
+			}
+			if needsConfirmation {
+				var approved bool
+				var editedCommand string
+				if highRisk {
+					approved, err = a.confirmByTyping(toolCall, risk)
+				} else {
+					approved, editedCommand, err = a.confirmByOption(toolCall, risk, hasRisk)
+				}
 				if err != nil {
 					if err == io.EOF {
 						return nil
 					}
-					return fmt.Errorf("reading input: %w", err)
+					return err
 				}
 
-				// Normalize the input
-				switch selectedChoice {
-				case "yes":
-					// Proceed with the operation
-				case "yes_and_dont_ask_me_again":
-					a.SkipPermissions = true
-				case "no":
+				if !approved {
 					a.doc.AddBlock(ui.NewAgentTextBlock().WithText("Operation was skipped. User declined to run this operation."))
+					auditEntry.ApprovedBy = ""
+					a.recordAudit(ctx, auditEntry, audit.DecisionDeclined, "declined by "+auditEntry.User)
 					currChatContent = append(currChatContent, gollm.FunctionCallResult{
 						ID:   call.ID,
 						Name: call.Name,
@@ -361,12 +717,26 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 						},
 					})
 					continue
-				default:
-					// This case should technically not be reachable due to AskForConfirmation loop
-					err := fmt.Errorf("invalid confirmation choice: %q", selectedChoice)
-					log.Error(err, "Invalid choice received from AskForConfirmation")
-					a.doc.AddBlock(ui.NewErrorBlock().SetText("Invalid choice received. Cancelling operation."))
-					return err
+				}
+
+				if editedCommand != "" {
+					auditEntry.ApprovedBy = ""
+					a.recordAudit(ctx, auditEntry, audit.DecisionEdited, fmt.Sprintf("replaced by %s with %q", auditEntry.User, editedCommand))
+					original, _ := call.Arguments["command"].(string)
+					if edit != nil {
+						original = edit.original
+					}
+					args := maps.Clone(call.Arguments)
+					args["command"] = editedCommand
+					functionCallRequestBlock.SetDescription(fmt.Sprintf("%s (edited by the user)", toolDescription))
+					edits[len(functionCalls)] = &commandEdit{original: original, edited: editedCommand}
+					functionCalls = append(functionCalls, gollm.FunctionCall{ID: call.ID, Name: call.Name, Arguments: args})
+					continue
+				}
+
+				// The user reviewed a change and confirmed it, so the agent is back under their control.
+				if detectedModifies != "no" {
+					a.suspectedInjection = nil
 				}
 			}
 
@@ -374,7 +744,11 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 			output, err := toolCall.InvokeTool(ctx, tools.InvokeToolOptions{
 				Kubeconfig: a.Kubeconfig,
 				WorkDir:    a.workDir,
+				Sandbox:    a.Sandbox,
+				Redactor:   a.Redactor,
 			})
+			auditEntry.SetResult(output, err)
+			a.recordAudit(ctx, auditEntry, audit.DecisionApproved, "")
 			if err != nil {
 				log.Error(err, "error executing action", "output", output)
 				return fmt.Errorf("executing action: %w", err)
@@ -386,9 +760,13 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 			}
 
 			// Add the tool call result to maintain conversation flow
+			// Tool output is data read from the cluster or external tools, and must not be taken for instructions.
+			var suspected []string
 			if a.EnableToolUseShim {
 				// If shim is enabled, format the result as a text observation
-				observation := fmt.Sprintf("Result of running %q:\n%v", call.Name, output)
+				var wrapped string
+				wrapped, suspected = tools.WrapUntrustedText(fmt.Sprintf("%v", output))
+				observation := fmt.Sprintf("Result of running %q:\n%s", call.Name, wrapped)
 				currChatContent = append(currChatContent, observation)
 			} else {
 				functionCallRequestBlock.SetResult(output)
@@ -399,6 +777,7 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 					log.Error(err, "error converting tool result to map", "output", output)
 					return err
 				}
+				result, suspected = tools.WrapUntrusted(result)
 
 				currChatContent = append(currChatContent, gollm.FunctionCallResult{
 					ID:     call.ID,
@@ -406,6 +785,24 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 					Result: result,
 				})
 			}
+			if len(suspected) > 0 {
+				log.Info("tool output looks like a prompt injection", "tool", call.Name, "reasons", suspected)
+				a.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Warning: the output of this command contains instruction-like text (%s). Changes proposed next will need your confirmation.\n", strings.Join(suspected, "; "))))
+				for _, reason := range suspected {
+					if !slices.Contains(a.suspectedInjection, reason) {
+						a.suspectedInjection = append(a.suspectedInjection, reason)
+					}
+				}
+			}
+		}
+
+		// Tell the LLM which commands the user changed, so it does not assume its own ran.
+		for i, edit := range edits {
+			end := len(currChatContent)
+			if i+1 < len(callResultsStart) {
+				end = callResultsStart[i+1]
+			}
+			edit.annotate(currChatContent[callResultsStart[i]:end])
 		}
 
 		// If no function calls were made, we're done
@@ -424,6 +821,205 @@ func (a *Conversation) RunOneRound(ctx context.Context, query string) error {
 	return fmt.Errorf("max iterations reached")
 }
 
+// newAuditEntry starts the audit entry of a tool call.
+func (a *Conversation) newAuditEntry(toolCall *tools.ToolCall, args map[string]any) *audit.Entry {
+	entry := &audit.Entry{
+		User:      a.osUser,
+		Context:   a.kubeContext,
+		Tool:      toolCall.GetTool().Name(),
+		Arguments: args,
+	}
+	if command, ok := args["command"].(string); ok {
+		entry.Command = command
+	}
+	return entry
+}
+
+// recordAudit completes the audit entry with the decision, and appends it to the audit log.
+func (a *Conversation) recordAudit(ctx context.Context, entry *audit.Entry, decision audit.Decision, reason string) {
+	if a.Audit == nil {
+		return
+	}
+	entry.Decision = decision
+	entry.Reason = reason
+	if err := a.Audit.Append(entry); err != nil {
+		klog.FromContext(ctx).Error(err, "writing audit log")
+		a.doc.AddBlock(ui.NewErrorBlock().SetText(fmt.Sprintf("  Failed to write the audit log: %v\n", err)))
+	}
+}
+
+// confirmByOption asks the user to approve a tool call by choosing an option.
+// If the user chose to edit the command first, it returns the edited command.
+func (a *Conversation) confirmByOption(toolCall *tools.ToolCall, risk tools.RiskAssessment, hasRisk bool) (bool, string, error) {
+	confirmationPrompt := `  Do you want to proceed ?`
+	if hasRisk {
+		confirmationPrompt = fmt.Sprintf("  Risk: %s (%s)\n", risk.Tier, strings.Join(risk.Reasons, "; ")) + confirmationPrompt
+	}
+	if summary := describeChanges(toolCall); summary != "" {
+		confirmationPrompt = summary + confirmationPrompt
+	}
+	confirmationPrompt = a.describeCluster(toolCall) + confirmationPrompt
+
+	exact := tools.ExactApproval(toolCall)
+	scoped := tools.ScopedApprovals(toolCall, a.kubeContext)
+
+	optionsBlock := ui.NewInputOptionBlock().SetPrompt(confirmationPrompt)
+	optionsBlock.AddOption("yes", "Yes", "yes", "y")
+	optionsBlock.AddOption("yes_and_approve_command", "Yes, and don't ask again for this exact command")
+	if len(scoped) > 0 {
+		var grants []string
+		for _, approval := range scoped {
+			grants = append(grants, approval.String())
+		}
+		optionsBlock.AddOption("yes_and_approve_scope", fmt.Sprintf("Yes, and don't ask again for %s", strings.Join(grants, " and ")))
+	}
+	command, editable := toolCall.Arguments()["command"].(string)
+	if editable {
+		optionsBlock.AddOption("edit", "Edit the command first", "edit", "e")
+	}
+	optionsBlock.AddOption("no", "No", "no", "n")
+	a.doc.AddBlock(optionsBlock)
+
+	selectedChoice, err := optionsBlock.Selection().Wait()
+	if err != nil {
+		if err == io.EOF {
+			return false, "", err
+		}
+		return false, "", fmt.Errorf("reading input: %w", err)
+	}
+
+	// Normalize the input
+	switch selectedChoice {
+	case "yes":
+		return true, "", nil
+	case "yes_and_approve_command":
+		a.Approvals.Add(exact)
+		a.doc.AddBlock(ui.NewAgentTextBlock().WithText("Approved for this session; use `approvals` to review or revoke approvals.\n"))
+		return true, "", nil
+	case "yes_and_approve_scope":
+		a.Approvals.Add(scoped...)
+		a.doc.AddBlock(ui.NewAgentTextBlock().WithText("Approved for this session; use `approvals` to review or revoke approvals.\n"))
+		return true, "", nil
+	case "edit":
+		edited, err := a.editCommand(command)
+		if err != nil {
+			return false, "", err
+		}
+		if edited == "" {
+			return false, "", nil
+		}
+		if edited == command {
+			return true, "", nil
+		}
+		return true, edited, nil
+	case "no":
+		return false, "", nil
+	default:
+		// This case should technically not be reachable due to AskForConfirmation loop
+		err := fmt.Errorf("invalid confirmation choice: %q", selectedChoice)
+		klog.Error(err, "Invalid choice received from AskForConfirmation")
+		a.doc.AddBlock(ui.NewErrorBlock().SetText("Invalid choice received. Cancelling operation."))
+		return false, "", err
+	}
+}
+
+// editCommand lets the user edit a command before it runs. It returns "" if the user cleared it.
+func (a *Conversation) editCommand(command string) (string, error) {
+	input := ui.NewInputEditBlock(command).SetPrompt("  Edit the command (clear it to cancel): ")
+	a.doc.AddBlock(input)
+
+	text, err := input.Observable().Wait()
+	if err != nil {
+		if err == io.EOF {
+			return "", err
+		}
+		return "", fmt.Errorf("reading input: %w", err)
+	}
+	input.SetEditable(false)
+	return strings.TrimSpace(text), nil
+}
+
+// commandEdit is a change the user made to the command of a tool call before it ran.
+type commandEdit struct {
+	original string
+	edited   string
+}
+
+// annotate adds a note about the edit to the results of the edited tool call.
+func (e *commandEdit) annotate(results []any) {
+	note := fmt.Sprintf("The user edited the command before running it: %q was replaced with %q. The result is for the user's command.", e.original, e.edited)
+	for i, result := range results {
+		switch result := result.(type) {
+		case gollm.FunctionCallResult:
+			if result.Result == nil {
+				result.Result = map[string]any{}
+			}
+			result.Result["user_edited_command"] = e.edited
+			result.Result["note"] = note
+			results[i] = result
+		case string:
+			results[i] = note + "\n" + result
+		}
+	}
+}
+
+// confirmByTyping asks the user to approve a high-risk tool call by typing the name of the target resource.
+func (a *Conversation) confirmByTyping(toolCall *tools.ToolCall, risk tools.RiskAssessment) (bool, error) {
+	warning := fmt.Sprintf("  This is a %s risk operation: %s.\n", strings.ToUpper(risk.Tier.String()), strings.Join(risk.Reasons, "; "))
+	a.doc.AddBlock(ui.NewErrorBlock().SetText(a.describeCluster(toolCall) + describeChanges(toolCall) + warning))
+
+	token := risk.ConfirmationToken()
+	input := ui.NewInputTextBlock().SetPrompt(fmt.Sprintf("  Type %q to proceed (anything else cancels): ", token))
+	input.SetEditable(true)
+	a.doc.AddBlock(input)
+
+	text, err := input.Observable().Wait()
+	if err != nil {
+		if err == io.EOF {
+			return false, err
+		}
+		return false, fmt.Errorf("reading input: %w", err)
+	}
+	input.SetEditable(false)
+	return strings.TrimSpace(text) == token, nil
+}
+
+// contextNamespace returns the namespace kubectl calls act on in a context when they do not pass -n.
+func (a *Conversation) contextNamespace(kubeContext string) string {
+	return tools.KubeContextNamespace(a.Kubeconfig, kubeContext)
+}
+
+// describeCluster names the cluster(s) a tool call acts on, so the user always knows where they are approving it.
+func (a *Conversation) describeCluster(toolCall *tools.ToolCall) string {
+	var clusters []string
+	for _, kubeContext := range toolCall.TargetContexts(a.kubeContext) {
+		if server := tools.KubeContextServer(a.Kubeconfig, kubeContext); server != "" {
+			kubeContext = fmt.Sprintf("%s (%s)", kubeContext, server)
+		}
+		clusters = append(clusters, kubeContext)
+	}
+	if len(clusters) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("  Cluster: %s\n", strings.Join(clusters, ", "))
+}
+
+// describeChanges summarizes the kubectl calls of a tool call that may modify resources,
+// so the user can see what they are approving. It returns "" if there are none.
+func describeChanges(toolCall *tools.ToolCall) string {
+	var sb strings.Builder
+	for _, invocation := range toolCall.KubectlInvocations() {
+		if invocation.ModifiesResource() == "no" {
+			continue
+		}
+		fmt.Fprintf(&sb, "  - %s\n", invocation)
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "  This will:\n" + sb.String()
+}
+
 // generateFromTemplate generates a prompt for LLM. It uses the prompt from the provides template file or default.
 func (a *Conversation) generatePrompt(_ context.Context, defaultPromptTemplate string, data PromptData) (string, error) {
 	promptTemplate := defaultPromptTemplate
@@ -459,7 +1055,19 @@ func (a *Conversation) generatePrompt(_ context.Context, defaultPromptTemplate s
 // PromptData represents the structure of the data to be filled into the template.
 type PromptData struct {
 	Query string
-	Tools tools.Tools
+	Tools *tools.Tools
+
+	// ReadOnly tells the LLM that tool calls that could modify resources will be refused.
+	ReadOnly bool
+
+	// RedactSecrets tells the LLM that secrets in tool results are replaced with placeholders.
+	RedactSecrets bool
+
+	// ContextPin, if set, tells the LLM which kubeconfig contexts it may use.
+	ContextPin *tools.ContextPin
+
+	// Permissions, if set, tells the LLM what the identity commands run as may do.
+	Permissions string
 
 	EnableToolUseShim bool
 }
@@ -544,11 +1152,25 @@ func toMap(v any) (map[string]any, error) {
 func candidateToShimCandidate(iterator gollm.ChatResponseIterator) (gollm.ChatResponseIterator, error) {
 	return func(yield func(gollm.ChatResponse, error) bool) {
 		buffer := ""
+		var usage *gollm.Usage
 		for response, err := range iterator {
+			var restart *gollm.StreamRestartError
+			if errors.As(err, &restart) {
+				// The request is sent again: discard the partial response, and let the caller know.
+				buffer = ""
+				usage = nil
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
 			if err != nil {
 				yield(nil, err)
 				return
 			}
+			if u := response.UsageMetadata(); u != nil {
+				usage = u
+			}
 
 			if len(response.Candidates()) == 0 {
 				yield(nil, fmt.Errorf("no candidates in LLM response"))
@@ -558,7 +1180,12 @@ func candidateToShimCandidate(iterator gollm.ChatResponseIterator) (gollm.ChatRe
 			candidate := response.Candidates()[0]
 
 			for _, part := range candidate.Parts() {
-				if text, ok := part.AsText(); ok {
+				if reasoning, ok := part.AsReasoning(); ok {
+					// The reasoning is not part of the ReAct response: pass it through as it streams.
+					if !yield(&ShimResponse{reasoning: reasoning}, nil) {
+						return
+					}
+				} else if text, ok := part.AsText(); ok {
 					buffer += text
 
 				} else {
@@ -579,32 +1206,44 @@ func candidateToShimCandidate(iterator gollm.ChatResponseIterator) (gollm.ChatRe
 			return
 		}
 		buffer = ""
-		yield(&ShimResponse{candidate: parsedReActResp}, nil)
+		yield(&ShimResponse{candidate: parsedReActResp, usage: usage}, nil)
 	}, nil
 }
 
 type ShimResponse struct {
 	candidate *ReActResponse
+	reasoning string
+	usage     *gollm.Usage
 }
 
-func (r *ShimResponse) UsageMetadata() any {
-	return nil
+func (r *ShimResponse) UsageMetadata() *gollm.Usage {
+	return r.usage
 }
 
 func (r *ShimResponse) Candidates() []gollm.Candidate {
-	return []gollm.Candidate{&ShimCandidate{candidate: r.candidate}}
+	return []gollm.Candidate{&ShimCandidate{candidate: r.candidate, reasoning: r.reasoning}}
 }
 
 type ShimCandidate struct {
 	candidate *ReActResponse
+	reasoning string
 }
 
 func (c *ShimCandidate) String() string {
+	if c.candidate == nil {
+		return fmt.Sprintf("Reasoning: %s", c.reasoning)
+	}
 	return fmt.Sprintf("Thought: %s\nAnswer: %s\nAction: %s", c.candidate.Thought, c.candidate.Answer, c.candidate.Action)
 }
 
 func (c *ShimCandidate) Parts() []gollm.Part {
 	var parts []gollm.Part
+	if c.reasoning != "" {
+		parts = append(parts, &ShimPart{reasoning: c.reasoning})
+	}
+	if c.candidate == nil {
+		return parts
+	}
 	if c.candidate.Thought != "" {
 		parts = append(parts, &ShimPart{text: c.candidate.Thought})
 	}
@@ -618,14 +1257,19 @@ func (c *ShimCandidate) Parts() []gollm.Part {
 }
 
 type ShimPart struct {
-	text   string
-	action *Action
+	reasoning string
+	text      string
+	action    *Action
 }
 
 func (p *ShimPart) AsText() (string, bool) {
 	return p.text, p.text != ""
 }
 
+func (p *ShimPart) AsReasoning() (string, bool) {
+	return p.reasoning, p.reasoning != ""
+}
+
 func (p *ShimPart) AsFunctionCalls() ([]gollm.FunctionCall, bool) {
 	if p.action != nil {
 		functionCallArgs, err := toMap(p.action)
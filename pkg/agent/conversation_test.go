@@ -0,0 +1,321 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/st-lzh/kubelet-wuhrai/gollm"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/audit"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/journal"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/policy"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/tools"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/ui"
+)
+
+// newTestConversation starts a conversation with a fake LLM playing a script from testdata.
+func newTestConversation(t *testing.T, script string) (*Conversation, *gollm.FakeClient, *ui.Document) {
+	t.Helper()
+	fake := newFakeLLM(t, script)
+	conversation, doc := startTestConversation(t, fake)
+	return conversation, fake, doc
+}
+
+// newFakeLLM returns a fake LLM playing a script from testdata.
+func newFakeLLM(t *testing.T, script string) *gollm.FakeClient {
+	t.Helper()
+	llm, err := gollm.NewClient(context.Background(), "fake://"+filepath.Join("testdata", script))
+	if err != nil {
+		t.Fatalf("creating fake LLM: %v", err)
+	}
+	return llm.(*gollm.FakeClient)
+}
+
+// startTestConversation starts a conversation with an LLM, with the bash tool.
+func startTestConversation(t *testing.T, llm gollm.Client) (*Conversation, *ui.Document) {
+	t.Helper()
+	ctx := context.Background()
+
+	registry := tools.NewTools()
+	if err := registry.RegisterTool(&tools.BashTool{}); err != nil {
+		t.Fatal(err)
+	}
+
+	conversation := &Conversation{
+		LLM:           llm,
+		Model:         "fake-model",
+		MaxIterations: 5,
+		Kubeconfig:    filepath.Join(t.TempDir(), "kubeconfig"),
+		Tools:         registry,
+		Recorder:      &journal.LogRecorder{},
+		RemoveWorkDir: true,
+	}
+	doc := ui.NewDocument()
+	if err := conversation.Init(ctx, doc); err != nil {
+		t.Fatalf("Init() returned error: %v", err)
+	}
+	t.Cleanup(func() { conversation.Close() })
+	return conversation, doc
+}
+
+// agentText returns the text the agent showed the user.
+func agentText(doc *ui.Document) string {
+	var sb strings.Builder
+	for _, block := range doc.Blocks() {
+		if block, ok := block.(*ui.AgentTextBlock); ok {
+			sb.WriteString(block.Text())
+		}
+	}
+	return sb.String()
+}
+
+func TestRunOneRoundRunsToolCalls(t *testing.T) {
+	conversation, fake, doc := newTestConversation(t, "run_tool.yaml")
+
+	if err := conversation.RunOneRound(context.Background(), "say hello"); err != nil {
+		t.Fatalf("RunOneRound() returned error: %v", err)
+	}
+	if err := fake.Done(); err != nil {
+		t.Error(err)
+	}
+	if got := agentText(doc); !strings.Contains(got, "The command said hello.") {
+		t.Errorf("agent text = %q", got)
+	}
+	usage := conversation.Usage()
+	if usage.Requests != 2 || usage.Total.TotalTokens != 280 || usage.Total.CachedTokens != 100 {
+		t.Errorf("usage = %s, want 2 requests, 280 total and 100 cached tokens", usage.String())
+	}
+}
+
+func TestRunOneRoundDeclinedConfirmation(t *testing.T) {
+	conversation, fake, doc := newTestConversation(t, "declined.yaml")
+
+	var prompts []string
+	doc.AddSubscription(ui.SubscriberFromFunc(func(doc *ui.Document, block ui.Block) {
+		if block, ok := block.(*ui.InputOptionBlock); ok && block.Editable() {
+			prompts = append(prompts, block.Prompt)
+			block.Selection().Set("no", nil)
+		}
+	}))
+
+	if err := conversation.RunOneRound(context.Background(), "create a file"); err != nil {
+		t.Fatalf("RunOneRound() returned error: %v", err)
+	}
+	if err := fake.Done(); err != nil {
+		t.Error(err)
+	}
+	if len(prompts) != 1 {
+		t.Errorf("asked for confirmation %d times, want 1", len(prompts))
+	}
+	if _, err := os.Stat(filepath.Join(conversation.workDir, "created-by-agent.txt")); err == nil {
+		t.Errorf("the declined command was run")
+	}
+}
+
+func TestRunOneRoundFailsOver(t *testing.T) {
+	primary := newFakeLLM(t, "failover_primary.yaml")
+	secondary := newFakeLLM(t, "failover_secondary.yaml")
+	llm, err := gollm.NewFailoverClient(gollm.RetryConfig{MaxAttempts: 1},
+		gollm.FailoverTarget{Name: "deepseek", Client: primary, Model: "deepseek-chat"},
+		gollm.FailoverTarget{Name: "qwen", Client: secondary, Model: "qwen-plus"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conversation, doc := startTestConversation(t, llm)
+
+	if err := conversation.RunOneRound(context.Background(), "say hello"); err != nil {
+		t.Fatalf("RunOneRound() returned error: %v", err)
+	}
+	if err := errors.Join(primary.Done(), secondary.Done()); err != nil {
+		t.Error(err)
+	}
+	if got := agentText(doc); !strings.Contains(got, "The command said hello.") {
+		t.Errorf("agent text = %q", got)
+	}
+	if provider, model := conversation.ActiveModel(); provider != "qwen" || model != "qwen-plus" {
+		t.Errorf("ActiveModel() = %q, %q, want qwen, qwen-plus", provider, model)
+	}
+	var notices []string
+	for _, block := range doc.Blocks() {
+		if block, ok := block.(*ui.ErrorBlock); ok {
+			notices = append(notices, block.Text())
+		}
+	}
+	if len(notices) != 1 || !strings.Contains(notices[0], "The LLM provider deepseek failed") {
+		t.Errorf("notices = %q, want one about switching to qwen", notices)
+	}
+}
+
+func TestRunOneRoundShowsReasoning(t *testing.T) {
+	conversation, fake, doc := newTestConversation(t, "reasoning.yaml")
+
+	if err := conversation.RunOneRound(context.Background(), "say hello"); err != nil {
+		t.Fatalf("RunOneRound() returned error: %v", err)
+	}
+	if err := fake.Done(); err != nil {
+		t.Error(err)
+	}
+
+	// The reasoning gets blocks of its own, before the text of each round, and never mixes with the text.
+	var got []string
+	for _, block := range doc.Blocks() {
+		switch block := block.(type) {
+		case *ui.ReasoningBlock:
+			if block.Streaming() || block.Expanded() {
+				t.Errorf("reasoning block %q is streaming or expanded", block.Text())
+			}
+			got = append(got, "reasoning: "+block.Text())
+		case *ui.AgentTextBlock:
+			if block.Text() != "" {
+				got = append(got, "text: "+block.Text())
+			}
+		}
+	}
+	want := []string{
+		"reasoning: The user wants a greeting. I will run echo.",
+		"text: Running a command.",
+		"reasoning: The output is clear.",
+		"text: The command said hello.",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("blocks = %q, want %q", got, want)
+	}
+}
+
+func TestRunOneRoundConfirmsChangesAfterInjection(t *testing.T) {
+	conversation, fake, doc := newTestConversation(t, "injection.yaml")
+	conversation.SkipPermissions = true
+
+	var prompts []string
+	doc.AddSubscription(ui.SubscriberFromFunc(func(doc *ui.Document, block ui.Block) {
+		if block, ok := block.(*ui.InputOptionBlock); ok && block.Editable() {
+			prompts = append(prompts, block.Prompt)
+			block.Selection().Set("no", nil)
+		}
+	}))
+
+	if err := conversation.RunOneRound(context.Background(), "read the notes"); err != nil {
+		t.Fatalf("RunOneRound() returned error: %v", err)
+	}
+	if err := fake.Done(); err != nil {
+		t.Error(err)
+	}
+	// The read-only call in between must not lift the step-up for the change after it,
+	// and the model claiming that a command it cannot be held to is read-only must not skip it.
+	if len(prompts) != 2 {
+		t.Errorf("asked for confirmation %d times, want 2", len(prompts))
+	}
+	for _, name := range []string{"created-by-agent.txt", "created-by-injection.txt"} {
+		if _, err := os.Stat(filepath.Join(conversation.workDir, name)); err == nil {
+			t.Errorf("%s was created without confirmation", name)
+		}
+	}
+}
+
+func TestRunOneRoundEditedCommand(t *testing.T) {
+	askPolicy, err := policy.Parse([]byte("rules:\n- name: ask-bash\n  action: ask\n  match:\n    tools: [bash]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		policy      *policy.Policy
+		wantPrompts int
+	}{
+		// Editing the command stands for the confirmation of the edited one.
+		{"edit confirms", nil, 1},
+		// A policy that asks for every call also asks for the edited one.
+		{"policy asks again", askPolicy, 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conversation, fake, doc := newTestConversation(t, "edit.yaml")
+			conversation.Policy = tc.policy
+			auditPath := filepath.Join(t.TempDir(), "audit.log")
+			auditLog, err := audit.Open(auditPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer auditLog.Close()
+			conversation.Audit = auditLog
+
+			prompts := 0
+			doc.AddSubscription(ui.SubscriberFromFunc(func(doc *ui.Document, block ui.Block) {
+				switch block := block.(type) {
+				case *ui.InputOptionBlock:
+					if block.Editable() {
+						prompts++
+						if prompts == 1 {
+							block.Selection().Set("edit", nil)
+						} else {
+							block.Selection().Set("yes", nil)
+						}
+					}
+				case *ui.InputEditBlock:
+					if block.Editable() {
+						block.Observable().Set("touch edited.txt", nil)
+					}
+				}
+			}))
+
+			if err := conversation.RunOneRound(context.Background(), "create a file"); err != nil {
+				t.Fatalf("RunOneRound() returned error: %v", err)
+			}
+			if err := fake.Done(); err != nil {
+				t.Error(err)
+			}
+			if prompts != tc.wantPrompts {
+				t.Errorf("asked for confirmation %d times, want %d", prompts, tc.wantPrompts)
+			}
+			if _, err := os.Stat(filepath.Join(conversation.workDir, "edited.txt")); err != nil {
+				t.Errorf("the edited command was not run: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(conversation.workDir, "original.txt")); err == nil {
+				t.Errorf("the original command was run")
+			}
+
+			// Both the original and the edited call are in the audit log.
+			b, err := os.ReadFile(auditPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+				var entry audit.Entry
+				if err := json.Unmarshal([]byte(line), &entry); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, fmt.Sprintf("%s: %s", entry.Decision, entry.Command))
+			}
+			want := []string{"edited: touch original.txt", "approved: touch edited.txt"}
+			if !slices.Equal(got, want) {
+				t.Errorf("audit log = %q, want %q", got, want)
+			}
+		})
+	}
+}
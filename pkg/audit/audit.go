@@ -0,0 +1,263 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+// Package audit writes a tamper-evident, append-only log of the actions the agent
+// runs or is refused. Each entry is a JSON line that includes the hash of the
+// previous entry, so that changing or removing an entry breaks the chain.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// Decision is what happened to a tool call.
+type Decision string
+
+const (
+	// DecisionApproved means the tool call ran.
+	DecisionApproved Decision = "approved"
+	// DecisionDeclined means the user declined to run the tool call.
+	DecisionDeclined Decision = "declined"
+	// DecisionDenied means a policy rule denied the tool call.
+	DecisionDenied Decision = "denied"
+	// DecisionBlocked means the tool call was blocked because of its risk.
+	DecisionBlocked Decision = "blocked"
+	// DecisionRefused means the tool call was refused in read-only mode.
+	DecisionRefused Decision = "refused"
+	// DecisionEdited means the user replaced the command of the tool call before running it;
+	// the edited command gets an entry of its own.
+	DecisionEdited Decision = "edited"
+)
+
+// Entry is a single audit record.
+type Entry struct {
+	// Seq numbers the entries of a log from 1.
+	Seq       int64     `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	// User is the OS user running the agent.
+	User string `json:"user"`
+	// Context is the kubeconfig context the agent runs against.
+	Context string `json:"context,omitempty"`
+
+	Tool string `json:"tool"`
+	// Command is the full command, for shell-based tools.
+	Command string `json:"command,omitempty"`
+	// Arguments are the arguments of the tool call.
+	Arguments map[string]any `json:"arguments,omitempty"`
+
+	// ModifiesResource is the classification of the call: "yes", "no" or "unknown".
+	ModifiesResource string `json:"modifiesResource,omitempty"`
+	// Risk is the risk tier of kubectl calls.
+	Risk string `json:"risk,omitempty"`
+
+	Decision Decision `json:"decision"`
+	// ApprovedBy says who or what approved the call, e.g. the user who confirmed it or a policy rule.
+	ApprovedBy string `json:"approvedBy,omitempty"`
+	// Reason explains a decision other than approved.
+	Reason string `json:"reason,omitempty"`
+
+	// ExitCode is the exit code of commands that ran.
+	ExitCode *int `json:"exitCode,omitempty"`
+	// ResultDigest is the SHA-256 digest of the result of the call.
+	ResultDigest string `json:"resultDigest,omitempty"`
+	// Error is the error returned when running the call, if any.
+	Error string `json:"error,omitempty"`
+
+	// PrevHash is the hash of the previous entry, empty for the first one.
+	PrevHash string `json:"prevHash"`
+	// Hash is the SHA-256 of the entry (with an empty Hash) and PrevHash.
+	Hash string `json:"hash"`
+}
+
+// computeHash returns the hash of the entry, ignoring its Hash field.
+func (e *Entry) computeHash() (string, error) {
+	c := *e
+	c.Hash = ""
+	b, err := json.Marshal(&c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SetResult records the outcome of running the tool call: its error, the digest of its result,
+// and, for commands (results with an ExitStatus() int method), the exit code.
+func (e *Entry) SetResult(result any, err error) {
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if result == nil {
+		return
+	}
+	e.ResultDigest = Digest(result)
+	if command, ok := result.(interface{ ExitStatus() int }); ok {
+		exitCode := command.ExitStatus()
+		e.ExitCode = &exitCode
+	}
+}
+
+// Digest returns the digest of a tool call result, for Entry.ResultDigest.
+func Digest(result any) string {
+	b, err := json.Marshal(result)
+	if err != nil {
+		b = []byte(fmt.Sprintf("%v", result))
+	}
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// CurrentUser returns the name of the OS user, for Entry.User.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// Logger appends entries to an audit log file.
+type Logger struct {
+	mutex sync.Mutex
+	f     *os.File
+
+	// seq and lastHash describe the last entry in the file.
+	seq      int64
+	lastHash string
+}
+
+// Open opens the audit log at path for appending, creating it if needed.
+// It fails if the existing log is not a valid chain, so that new entries are never chained to a tampered log.
+func Open(path string) (*Logger, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	result, err := Verify(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("audit log %q: %w", path, err)
+	}
+	return &Logger{f: f, seq: result.Entries, lastHash: result.LastHash}, nil
+}
+
+// Append completes the entry (sequence number, timestamp, hashes) and writes it to the log.
+func (l *Logger) Append(entry *Entry) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	entry.Seq = l.seq + 1
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+	entry.PrevHash = l.lastHash
+	hash, err := entry.computeHash()
+	if err != nil {
+		return fmt.Errorf("hashing audit entry: %w", err)
+	}
+	entry.Hash = hash
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encoding audit entry: %w", err)
+	}
+	b = append(b, '\n')
+	if _, err := l.f.Write(b); err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("writing audit entry: %w", err)
+	}
+
+	l.seq = entry.Seq
+	l.lastHash = entry.Hash
+	return nil
+}
+
+// Close closes the log file.
+func (l *Logger) Close() error {
+	return l.f.Close()
+}
+
+// VerifyResult summarizes a verified audit log.
+type VerifyResult struct {
+	// Entries is the number of entries.
+	Entries int64
+	// LastHash is the hash of the last entry; keeping a copy elsewhere
+	// makes it possible to detect that entries were removed from the end.
+	LastHash string
+}
+
+// ErrChainBroken is returned when an audit log has been modified.
+var ErrChainBroken = errors.New("audit chain broken")
+
+// Verify checks the hash chain of an audit log.
+func Verify(r io.Reader) (*VerifyResult, error) {
+	result := &VerifyResult{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			return nil, fmt.Errorf("%w: line %d is empty", ErrChainBroken, line)
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%w: line %d is not a valid entry: %v", ErrChainBroken, line, err)
+		}
+		if entry.Seq != result.Entries+1 {
+			return nil, fmt.Errorf("%w: line %d has sequence number %d, expected %d", ErrChainBroken, line, entry.Seq, result.Entries+1)
+		}
+		if entry.PrevHash != result.LastHash {
+			return nil, fmt.Errorf("%w: line %d does not follow the previous entry", ErrChainBroken, line)
+		}
+		hash, err := entry.computeHash()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if hash != entry.Hash {
+			return nil, fmt.Errorf("%w: line %d has been modified", ErrChainBroken, line)
+		}
+		result.Entries = entry.Seq
+		result.LastHash = entry.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading audit log: %w", err)
+	}
+	return result, nil
+}
+
+// VerifyFile checks the hash chain of the audit log at path.
+func VerifyFile(path string) (*VerifyResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+	defer f.Close()
+	return Verify(f)
+}
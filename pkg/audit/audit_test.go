@@ -0,0 +1,127 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeCommandResult struct {
+	Stdout   string `json:"stdout"`
+	ExitCode int    `json:"exit_code"`
+}
+
+func (r *fakeCommandResult) ExitStatus() int {
+	return r.ExitCode
+}
+
+func writeTestLog(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() returned error: %v", err)
+	}
+	approved := &Entry{User: "alice", Context: "prod", Tool: "kubectl", Command: "kubectl scale deploy web --replicas=3", Decision: DecisionApproved, ApprovedBy: "alice (confirmed)"}
+	approved.SetResult(&fakeCommandResult{Stdout: "scaled", ExitCode: 0}, nil)
+	if err := l.Append(approved); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(&Entry{User: "alice", Tool: "kubectl", Command: "kubectl delete ns prod", Decision: DecisionDeclined}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopening continues the chain
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopening the log returned error: %v", err)
+	}
+	defer l.Close()
+	if err := l.Append(&Entry{User: "alice", Tool: "bash", Command: "rm -rf /", Decision: DecisionRefused, Arguments: map[string]any{"command": "rm -rf /", "n": 3}}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLogger(t *testing.T) {
+	path := writeTestLog(t)
+
+	result, err := VerifyFile(path)
+	if err != nil {
+		t.Fatalf("VerifyFile() returned error: %v", err)
+	}
+	if result.Entries != 3 {
+		t.Errorf("VerifyFile() found %d entries, want 3", result.Entries)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if !strings.Contains(lines[0], `"exitCode":0`) || !strings.Contains(lines[0], `"resultDigest":"sha256:`) {
+		t.Errorf("first entry does not record the result: %s", lines[0])
+	}
+	if !strings.HasSuffix(lines[2], `"hash":"`+result.LastHash+`"}`) {
+		t.Errorf("LastHash %q is not the hash of the last entry", result.LastHash)
+	}
+}
+
+func TestVerify_Tampering(t *testing.T) {
+	path := writeTestLog(t)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(strings.TrimSpace(string(b)), "\n")
+
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{"modified entry", strings.Replace(string(b), `"decision":"declined"`, `"decision":"approved"`, 1)},
+		{"removed entry", lines[0] + lines[2]},
+		{"reordered entries", lines[1] + lines[0] + lines[2]},
+		{"invalid line", string(b) + "garbage\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Verify(bytes.NewReader([]byte(tc.log)))
+			if !errors.Is(err, ErrChainBroken) {
+				t.Errorf("Verify() = %v, want ErrChainBroken", err)
+			}
+		})
+	}
+
+	// Appending to a tampered log is refused
+	if err := os.WriteFile(path, []byte(tests[0].log), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("Open() of a tampered log = %v, want ErrChainBroken", err)
+	}
+}
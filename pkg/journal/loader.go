@@ -16,3 +16,63 @@
 // https://github.com/GoogleCloudPlatform/kubectl-ai
 
 package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/st-lzh/kubelet-wuhrai/gollm"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ParseEventsFromFile reads the events written to a file by a FileRecorder.
+func ParseEventsFromFile(path string) ([]*Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening journal: %w", err)
+	}
+	defer f.Close()
+	return ParseEvents(f)
+}
+
+// ParseEvents reads the events written by a FileRecorder.
+func ParseEvents(r io.Reader) ([]*Event, error) {
+	var events []*Event
+	decoder := yaml.NewYAMLOrJSONDecoder(r, 4096)
+	for {
+		event := &Event{}
+		if err := decoder.Decode(event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return events, nil
+			}
+			return nil, fmt.Errorf("parsing journal event %d: %w", len(events)+1, err)
+		}
+		if event.Action != "" {
+			events = append(events, event)
+		}
+	}
+}
+
+// SumUsage adds up the token usage of the LLM requests recorded in the events.
+func SumUsage(events []*Event) (gollm.UsageTotals, error) {
+	var totals gollm.UsageTotals
+	for _, event := range events {
+		if event.Action != ActionLLMUsage {
+			continue
+		}
+		// The payload was written as YAML, so it is decoded again into a Usage.
+		b, err := json.Marshal(event.Payload)
+		if err != nil {
+			return totals, fmt.Errorf("encoding usage: %w", err)
+		}
+		usage := &gollm.Usage{}
+		if err := json.Unmarshal(b, usage); err != nil {
+			return totals, fmt.Errorf("decoding usage: %w", err)
+		}
+		totals.Add(usage)
+	}
+	return totals, nil
+}
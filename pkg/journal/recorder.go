@@ -82,6 +82,12 @@ type Event struct {
 // ActionUIRender is for an event that indicates we wrote output to the UI
 const ActionUIRender = "ui.render"
 
+// ActionLLMUsage is for an event that records the token usage (a gollm.Usage) of an LLM request
+const ActionLLMUsage = "llm.usage"
+
+// ActionLLMFailover is for an event that records that the LLM provider failed and the next one took over
+const ActionLLMFailover = "llm.failover"
+
 // GetString is a helper to get a string value from the Payload
 func (e *Event) GetString(key string) (string, bool) {
 	if e.Payload == nil {
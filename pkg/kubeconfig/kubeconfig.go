@@ -0,0 +1,291 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+// Package kubeconfig reads kubeconfig files and writes derived copies of them,
+// e.g. with an impersonated identity, for the commands run by the agent.
+package kubeconfig
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is a kubeconfig file, kept as a generic object so that fields
+// we do not know about survive a rewrite.
+type Config struct {
+	// path is the file the config was loaded from, if any.
+	path string
+	// baseDir is the directory relative file references are resolved against.
+	baseDir string
+	raw     map[string]any
+}
+
+// Load reads a kubeconfig file.
+// Like kubectl, it uses the first file of a KUBECONFIG-style list.
+func Load(path string) (*Config, error) {
+	if paths := filepath.SplitList(path); len(paths) > 0 {
+		path = paths[0]
+	}
+	if path == "" {
+		return nil, fmt.Errorf("no kubeconfig path given")
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading kubeconfig: %w", err)
+	}
+	c, err := Parse(b, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig %q: %w", path, err)
+	}
+	c.path = path
+	return c, nil
+}
+
+// Parse parses a kubeconfig; relative file references in it are relative to baseDir.
+func Parse(b []byte, baseDir string) (*Config, error) {
+	raw := map[string]any{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig: %w", err)
+	}
+	return &Config{baseDir: baseDir, raw: raw}, nil
+}
+
+// Path returns the path of the file the config was loaded from.
+func (c *Config) Path() string {
+	return c.path
+}
+
+// CurrentContext returns the name of the current context, or "" if there is none.
+func (c *Config) CurrentContext() string {
+	name, _ := c.raw["current-context"].(string)
+	return name
+}
+
+// SetCurrentContext makes name the current context.
+func (c *Config) SetCurrentContext(name string) error {
+	if !c.HasContext(name) {
+		return fmt.Errorf("context %q not found in kubeconfig", name)
+	}
+	c.raw["current-context"] = name
+	return nil
+}
+
+// HasContext returns true if the kubeconfig defines the context.
+func (c *Config) HasContext(name string) bool {
+	return findNamed(c.raw["contexts"], name, "context") != nil
+}
+
+// Server returns the server URL of the cluster of the current context.
+func (c *Config) Server() (string, error) {
+	return c.ContextServer(c.CurrentContext())
+}
+
+// ContextServer returns the server URL of the cluster of a context.
+func (c *Config) ContextServer(contextName string) (string, error) {
+	cluster, err := c.contextEntry(contextName, "cluster", "clusters")
+	if err != nil {
+		return "", err
+	}
+	server, _ := cluster["server"].(string)
+	return server, nil
+}
+
+// ContextNamespace returns the namespace of a context, or "" if the context does not set one.
+func (c *Config) ContextNamespace(contextName string) (string, error) {
+	if contextName == "" {
+		return "", fmt.Errorf("kubeconfig has no current context")
+	}
+	kubeContext := findNamed(c.raw["contexts"], contextName, "context")
+	if kubeContext == nil {
+		return "", fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	namespace, _ := kubeContext["namespace"].(string)
+	return namespace, nil
+}
+
+// SetServer points the cluster of the current context at server.
+// If tlsServerName is set, it is used to verify the server certificate, unless the cluster already sets one.
+func (c *Config) SetServer(server string, tlsServerName string) error {
+	cluster, err := c.currentEntry("cluster", "clusters")
+	if err != nil {
+		return err
+	}
+	cluster["server"] = server
+	if _, ok := cluster["tls-server-name"]; !ok && tlsServerName != "" {
+		cluster["tls-server-name"] = tlsServerName
+	}
+	return nil
+}
+
+// SetImpersonation makes the user of the current context impersonate the given user and groups,
+// as kubectl --as/--as-group would.
+func (c *Config) SetImpersonation(user string, groups []string) error {
+	authInfo, err := c.currentEntry("user", "users")
+	if err != nil {
+		return err
+	}
+	if user != "" {
+		authInfo["as"] = user
+	}
+	if len(groups) > 0 {
+		list := make([]any, len(groups))
+		for i, group := range groups {
+			list[i] = group
+		}
+		authInfo["as-groups"] = list
+	}
+	return nil
+}
+
+// UseCredentialsOf makes the current context use the credentials of the current user of other,
+// e.g. a kubeconfig of a dedicated service account. The credentials are added as a new user named userName.
+func (c *Config) UseCredentialsOf(other *Config, userName string) error {
+	authInfo, err := other.currentEntry("user", "users")
+	if err != nil {
+		return fmt.Errorf("reading credentials: %w", err)
+	}
+	authInfo = maps.Clone(authInfo)
+	absolutize(authInfo, other.baseDir, "client-certificate", "client-key", "tokenFile")
+
+	contextName := c.CurrentContext()
+	kubeContext := findNamed(c.raw["contexts"], contextName, "context")
+	if kubeContext == nil {
+		return fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	users, _ := c.raw["users"].([]any)
+	c.raw["users"] = append(users, map[string]any{"name": userName, "user": authInfo})
+	kubeContext["user"] = userName
+	return nil
+}
+
+// Minify drops every context, cluster and user but the current context and the ones it uses,
+// as "kubectl config view --minify" does, so that the config holds no other credentials.
+func (c *Config) Minify() error {
+	contextName := c.CurrentContext()
+	kubeContext := findNamed(c.raw["contexts"], contextName, "context")
+	if kubeContext == nil {
+		return fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	clusterName, _ := kubeContext["cluster"].(string)
+	userName, _ := kubeContext["user"].(string)
+	c.raw["contexts"] = keepNamed(c.raw["contexts"], contextName)
+	c.raw["clusters"] = keepNamed(c.raw["clusters"], clusterName)
+	c.raw["users"] = keepNamed(c.raw["users"], userName)
+	return nil
+}
+
+// currentEntry returns the cluster or user entry of the current context;
+// key is "cluster" or "user", and list the name of the list holding the entries.
+func (c *Config) currentEntry(key string, list string) (map[string]any, error) {
+	return c.contextEntry(c.CurrentContext(), key, list)
+}
+
+// contextEntry returns the cluster or user entry of a context (see currentEntry).
+func (c *Config) contextEntry(contextName string, key string, list string) (map[string]any, error) {
+	if contextName == "" {
+		return nil, fmt.Errorf("kubeconfig has no current context")
+	}
+	kubeContext := findNamed(c.raw["contexts"], contextName, "context")
+	if kubeContext == nil {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	name, _ := kubeContext[key].(string)
+	entry := findNamed(c.raw[list], name, key)
+	if entry == nil {
+		return nil, fmt.Errorf("%s %q not found in kubeconfig", key, name)
+	}
+	return entry, nil
+}
+
+// Marshal returns the config as YAML. File references that were relative to the
+// original kubeconfig are made absolute, so that they still resolve from a new location.
+func (c *Config) Marshal() ([]byte, error) {
+	for _, cluster := range namedEntries(c.raw["clusters"], "cluster") {
+		absolutize(cluster, c.baseDir, "certificate-authority")
+	}
+	for _, authInfo := range namedEntries(c.raw["users"], "user") {
+		absolutize(authInfo, c.baseDir, "client-certificate", "client-key", "tokenFile")
+	}
+	b, err := yaml.Marshal(c.raw)
+	if err != nil {
+		return nil, fmt.Errorf("writing kubeconfig: %w", err)
+	}
+	return b, nil
+}
+
+// WriteFile writes the config to path (see Marshal).
+func (c *Config) WriteFile(path string) error {
+	b, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return fmt.Errorf("writing kubeconfig: %w", err)
+	}
+	return nil
+}
+
+// namedEntries returns the inner objects of a kubeconfig list like
+// "clusters: [{name: ..., cluster: {...}}]".
+func namedEntries(list any, key string) []map[string]any {
+	items, _ := list.([]any)
+	var entries []map[string]any
+	for _, item := range items {
+		m, _ := item.(map[string]any)
+		if entry, ok := m[key].(map[string]any); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func findNamed(list any, name string, key string) map[string]any {
+	items, _ := list.([]any)
+	for _, item := range items {
+		m, _ := item.(map[string]any)
+		if n, _ := m["name"].(string); n == name {
+			entry, _ := m[key].(map[string]any)
+			return entry
+		}
+	}
+	return nil
+}
+
+// keepNamed returns the items of a kubeconfig list that are named name.
+func keepNamed(list any, name string) []any {
+	items, _ := list.([]any)
+	kept := []any{}
+	for _, item := range items {
+		m, _ := item.(map[string]any)
+		if n, _ := m["name"].(string); n == name {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+func absolutize(m map[string]any, baseDir string, keys ...string) {
+	for _, key := range keys {
+		if p, ok := m[key].(string); ok && p != "" && !filepath.IsAbs(p) {
+			m[key] = filepath.Join(baseDir, p)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package kubeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+current-context: prod
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev-admin}
+- name: prod
+  context: {cluster: prod, user: prod-admin, namespace: web}
+clusters:
+- name: dev
+  cluster: {server: "https://dev.example.com"}
+- name: prod
+  cluster: {server: "https://prod.example.com:6443", certificate-authority: certs/ca.crt}
+users:
+- name: dev-admin
+  user: {token: dev-token}
+- name: prod-admin
+  user: {client-certificate: certs/admin.crt, client-key: /abs/admin.key}
+`
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if err := os.WriteFile(path, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Load(path + string(filepath.ListSeparator) + filepath.Join(dir, "other"))
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if got := config.CurrentContext(); got != "prod" {
+		t.Errorf("CurrentContext() = %q, want prod", got)
+	}
+	if got, err := config.Server(); err != nil || got != "https://prod.example.com:6443" {
+		t.Errorf("Server() = %q, %v", got, err)
+	}
+
+	if err := config.SetImpersonation("viewer", []string{"readers"}); err != nil {
+		t.Fatalf("SetImpersonation() returned error: %v", err)
+	}
+	out := filepath.Join(t.TempDir(), "config")
+	if err := config.WriteFile(out); err != nil {
+		t.Fatalf("WriteFile() returned error: %v", err)
+	}
+
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Clusters []struct {
+			Cluster map[string]string
+		}
+		Users []struct {
+			Name string
+			User map[string]any
+		}
+	}
+	if err := yaml.Unmarshal(b, &written); err != nil {
+		t.Fatal(err)
+	}
+	if got := written.Clusters[1].Cluster["certificate-authority"]; got != filepath.Join(dir, "certs/ca.crt") {
+		t.Errorf("certificate-authority = %q, want it relative to the original kubeconfig", got)
+	}
+	dev, prod := written.Users[0].User, written.Users[1].User
+	if _, ok := dev["as"]; ok {
+		t.Errorf("user of another context impersonates: %v", dev)
+	}
+	if prod["as"] != "viewer" || len(prod["as-groups"].([]any)) != 1 {
+		t.Errorf("user of the current context does not impersonate: %v", prod)
+	}
+	if prod["client-key"] != "/abs/admin.key" || prod["client-certificate"] != filepath.Join(dir, "certs/admin.crt") {
+		t.Errorf("unexpected file references: %v", prod)
+	}
+}
+
+func TestConfig_NoCurrentContext(t *testing.T) {
+	config, err := Parse([]byte("apiVersion: v1\nkind: Config\n"), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.SetImpersonation("viewer", nil); err == nil {
+		t.Errorf("expected an error without a current context")
+	}
+}
+
+func TestConfig_SetCurrentContext(t *testing.T) {
+	config, err := Parse([]byte(testKubeconfig), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.ContextServer("dev"); err != nil || got != "https://dev.example.com" {
+		t.Errorf("ContextServer(dev) = %q, %v", got, err)
+	}
+	if err := config.SetCurrentContext("staging"); err == nil {
+		t.Errorf("SetCurrentContext() of an unknown context did not return an error")
+	}
+	if err := config.SetCurrentContext("dev"); err != nil {
+		t.Fatalf("SetCurrentContext() returned error: %v", err)
+	}
+	if got, err := config.Server(); err != nil || got != "https://dev.example.com" {
+		t.Errorf("Server() after SetCurrentContext(dev) = %q, %v", got, err)
+	}
+}
+
+func TestConfig_UseCredentialsOf(t *testing.T) {
+	config, err := Parse([]byte(testKubeconfig), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceAccount, err := Parse([]byte(`apiVersion: v1
+kind: Config
+current-context: sa
+contexts:
+- name: sa
+  context: {cluster: prod, user: agent}
+users:
+- name: agent
+  user: {tokenFile: token}
+`), "/etc/agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := config.UseCredentialsOf(serviceAccount, "kubelet-wuhrai-agent"); err != nil {
+		t.Fatalf("UseCredentialsOf() returned error: %v", err)
+	}
+	authInfo, err := config.currentEntry("user", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := authInfo["tokenFile"]; got != filepath.Join("/etc/agent", "token") {
+		t.Errorf("tokenFile = %v, want it relative to the service account kubeconfig", got)
+	}
+	if _, ok := authInfo["client-certificate"]; ok {
+		t.Errorf("current context still uses the original credentials: %v", authInfo)
+	}
+
+	// The identity's copy of the kubeconfig must not hold the original credentials at all.
+	if err := config.Minify(); err != nil {
+		t.Fatalf("Minify() returned error: %v", err)
+	}
+	users := namedEntries(config.raw["users"], "user")
+	if len(users) != 1 || users[0]["tokenFile"] == nil {
+		t.Errorf("users after Minify() = %v, want only the agent's credentials", users)
+	}
+}
+
+func TestConfig_Minify(t *testing.T) {
+	config, err := Parse([]byte(testKubeconfig), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Minify(); err != nil {
+		t.Fatalf("Minify() returned error: %v", err)
+	}
+	b, err := config.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Contexts []struct{ Name string } `json:"contexts"`
+		Clusters []struct{ Name string } `json:"clusters"`
+		Users    []struct{ Name string } `json:"users"`
+	}
+	if err := yaml.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Contexts) != 1 || got.Contexts[0].Name != "prod" ||
+		len(got.Clusters) != 1 || got.Clusters[0].Name != "prod" ||
+		len(got.Users) != 1 || got.Users[0].Name != "prod-admin" {
+		t.Errorf("Minify() kept %+v, want only the prod context, cluster and user", got)
+	}
+	if server, err := config.Server(); err != nil || server != "https://prod.example.com:6443" {
+		t.Errorf("Server() after Minify() = %q, %v", server, err)
+	}
+}
+
+func TestConfig_ContextNamespace(t *testing.T) {
+	config, err := Parse([]byte(testKubeconfig), "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for context, want := range map[string]string{"prod": "web", "dev": ""} {
+		if got, err := config.ContextNamespace(context); err != nil || got != want {
+			t.Errorf("ContextNamespace(%q) = %q, %v, want %q", context, got, err, want)
+		}
+	}
+	if _, err := config.ContextNamespace("missing"); err == nil {
+		t.Error("ContextNamespace(missing) returned no error")
+	}
+}
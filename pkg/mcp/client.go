@@ -19,6 +19,7 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 
@@ -190,115 +191,40 @@ func convertMCPToolsToTools(mcpTools []mcp.Tool) ([]Tool, error) {
 		}
 		// TODO: Annotations (give hints about e.g. read-only, destructive, idempotent, open-world)
 
-		if mcpTool.InputSchema.Type != "" {
-			schema, err := convertMCPInputSchema(&mcpTool.InputSchema)
-			if err != nil {
-				return nil, fmt.Errorf("converting MCP input schema to tool input schema: %w", err)
-			}
-			tool.InputSchema = schema
-		} else {
-			// TODO: Use RawInputSchema if available
-			// klog.Warningf("no input schema for tool %s", mcpTool.Name)
-			return nil, fmt.Errorf("no input schema for tool %s", mcpTool.Name)
+		schema, err := convertMCPInputSchema(&mcpTool)
+		if err != nil {
+			return nil, fmt.Errorf("converting MCP input schema of tool %s: %w", mcpTool.Name, err)
 		}
+		tool.InputSchema = schema
 
 		tools = append(tools, tool)
 	}
 	return tools, nil
 }
 
-func convertMCPInputSchema(mcpInputSchema *mcp.ToolInputSchema) (*gollm.Schema, error) {
-	gollmSchema := &gollm.Schema{}
-	switch mcpInputSchema.Type {
-	case "string":
-		gollmSchema.Type = gollm.TypeString
-	// case "number":
-	// 	gollmSchema.Type = gollm.TypeNumber
-	case "boolean":
-		gollmSchema.Type = gollm.TypeBoolean
-	case "object":
-		gollmSchema.Type = gollm.TypeObject
-	default:
-		return nil, fmt.Errorf("unexpected MCP input schema type: %s", mcpInputSchema.Type)
-	}
-	if mcpInputSchema.Properties != nil {
-		gollmSchema.Properties = make(map[string]*gollm.Schema)
-		for key, value := range mcpInputSchema.Properties {
-			if valueSchema, ok := value.(mcp.ToolInputSchema); ok {
-				gollmValue, err := convertMCPInputSchema(&valueSchema)
-				if err != nil {
-					return nil, fmt.Errorf("converting MCP input schema to tool input schema: %w", err)
-				}
-				gollmSchema.Properties[key] = gollmValue
-			} else if valueMap, ok := value.(map[string]interface{}); ok {
-				gollmValue, err := convertMCPMapSchema(key, valueMap)
-				if err != nil {
-					return nil, fmt.Errorf("converting MCP input schema to tool input schema: %w", err)
-				}
-				gollmSchema.Properties[key] = gollmValue
-			} else {
-				return nil, fmt.Errorf("unexpected input schema type for %q: %T %+v", key, value, value)
-			}
+// convertMCPInputSchema converts the input schema of an MCP tool through its JSON form,
+// so that enums, bounds, alternatives and the other keywords gollm.Schema knows are kept.
+func convertMCPInputSchema(mcpTool *mcp.Tool) (*gollm.Schema, error) {
+	raw := mcpTool.RawInputSchema
+	if raw == nil {
+		if mcpTool.InputSchema.Type == "" {
+			return nil, fmt.Errorf("no input schema")
 		}
-	}
-	gollmSchema.Required = mcpInputSchema.Required
-	return gollmSchema, nil
-}
-
-func convertMCPMapSchema(key string, schemaMap map[string]interface{}) (*gollm.Schema, error) {
-	gollmSchema := &gollm.Schema{}
-
-	if descriptionObj, ok := schemaMap["description"]; ok {
-		description, ok := descriptionObj.(string)
-		if !ok {
-			return nil, fmt.Errorf("unexpected description for key %q: %+v", key, schemaMap)
+		b, err := json.Marshal(mcpTool.InputSchema)
+		if err != nil {
+			return nil, err
 		}
-		gollmSchema.Description = description
+		raw = b
 	}
-
-	mcpType, ok := schemaMap["type"].(string)
-	if !ok {
-		// Fallback: treat any unrecognized schema as generic object
-		klog.V(2).InfoS("Unrecognized schema format, treating as object", "key", key)
-		gollmSchema.Type = gollm.TypeObject
-		return gollmSchema, nil
+	schema := &gollm.Schema{}
+	if err := json.Unmarshal(raw, schema); err != nil {
+		return nil, err
 	}
-	switch mcpType {
-	case "string":
-		gollmSchema.Type = gollm.TypeString
-	case "number":
-		gollmSchema.Type = gollm.TypeNumber
-	case "integer":
-		gollmSchema.Type = gollm.TypeNumber
-	case "boolean":
-		gollmSchema.Type = gollm.TypeBoolean
-	case "array":
-		items, ok := schemaMap["items"].(map[string]interface{})
-		if !ok {
-			return nil, fmt.Errorf("did not find items for array: key %q: %+v", key, schemaMap)
-		}
-		itemsSchema, err := convertMCPMapSchema(key+".items", items)
-		if err != nil {
-			return nil, fmt.Errorf("converting MCP input schema to tool input schema: %w", err)
-		}
-		gollmSchema.Type = gollm.TypeArray
-		gollmSchema.Items = itemsSchema
-
-	case "object":
-		gollmSchema.Type = gollm.TypeObject
-		gollmSchema.Properties = make(map[string]*gollm.Schema)
-		for key, value := range schemaMap["properties"].(map[string]interface{}) {
-			propertySchema, err := convertMCPMapSchema(key, value.(map[string]interface{}))
-			if err != nil {
-				return nil, fmt.Errorf("converting MCP input schema to tool input schema: %w", err)
-			}
-			gollmSchema.Properties[key] = propertySchema
-		}
-	default:
-		return nil, fmt.Errorf("unexpected input schema type %q for key %q: %+v", mcpType, key, schemaMap)
+	if schema.Type == "" && len(schema.AnyOf) == 0 && len(schema.OneOf) == 0 {
+		klog.V(2).InfoS("MCP input schema has no type, treating as object", "tool", mcpTool.Name)
+		schema.Type = gollm.TypeObject
 	}
-
-	return gollmSchema, nil
+	return schema, nil
 }
 
 // ===================================================================
@@ -0,0 +1,359 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+// Package policy evaluates organization-wide rules that allow, deny or require
+// confirmation for tool calls made by the agent.
+package policy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	celtypes "github.com/google/cel-go/common/types"
+	"github.com/st-lzh/kubelet-wuhrai/kubectl-utils/pkg/kel"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/tools"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// Action is what a rule decides for a matching tool call.
+type Action string
+
+const (
+	// ActionAllow runs the tool call without asking for confirmation.
+	ActionAllow Action = "allow"
+	// ActionDeny refuses the tool call; the reason is returned to the LLM.
+	ActionDeny Action = "deny"
+	// ActionAsk always asks the user for confirmation, even if permissions are skipped.
+	ActionAsk Action = "ask"
+)
+
+// Match selects the tool calls a rule applies to.
+// Each field holds glob patterns; an empty field matches anything, and all non-empty fields must match.
+type Match struct {
+	// Tools are tool names, e.g. "bash" or "github_*".
+	Tools []string `json:"tools,omitempty"`
+	// Verbs are kubectl verbs, e.g. "delete". Sub-commands are written "rollout undo".
+	Verbs []string `json:"verbs,omitempty"`
+	// Resources are kubectl resource types as written in the command, e.g. "deploy" or "namespaces".
+	Resources []string `json:"resources,omitempty"`
+	// Namespaces are the namespaces kubectl calls act on: the one passed with -n/--namespace,
+	// or else the namespace of the context. Calls with -A/--all-namespaces match any namespace
+	// patterns of deny and ask rules, but never those of allow rules.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Contexts are kubeconfig context names; --context takes precedence over the current context.
+	Contexts []string `json:"contexts,omitempty"`
+	// MCPServers are the names of the MCP servers providing the tool.
+	MCPServers []string `json:"mcpServers,omitempty"`
+}
+
+// Rule is a single policy rule.
+type Rule struct {
+	// Name identifies the rule in messages.
+	Name string `json:"name"`
+	// Action is allow, deny or ask.
+	Action Action `json:"action"`
+	// Reason explains the rule to the user and the LLM.
+	Reason string `json:"reason,omitempty"`
+	// Match selects the tool calls the rule applies to.
+	Match Match `json:"match,omitempty"`
+	// Condition is an optional CEL expression over the call, available as "self"
+	// (see Request for the fields); the rule only applies if it evaluates to true.
+	Condition string `json:"condition,omitempty"`
+
+	condition *kel.Expression
+}
+
+// Policy is an ordered list of rules; the first matching rule decides.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadFile reads and validates a policy file.
+func LoadFile(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+	p, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("loading policy file %q: %w", path, err)
+	}
+	return p, nil
+}
+
+// Parse parses and validates a policy document (YAML or JSON).
+func Parse(b []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, fmt.Errorf("parsing policy: %w", err)
+	}
+
+	env, err := kel.NewEnv()
+	if err != nil {
+		return nil, fmt.Errorf("creating CEL environment: %w", err)
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule #%d", i+1)
+		}
+		switch rule.Action {
+		case ActionAllow, ActionDeny, ActionAsk:
+		default:
+			return nil, fmt.Errorf("%s: invalid action %q (expected allow, deny or ask)", rule.Name, rule.Action)
+		}
+		if rule.Condition != "" {
+			expr, err := kel.NewExpression(env, rule.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", rule.Name, err)
+			}
+			if t := expr.AST.OutputType(); t != cel.BoolType && t != cel.DynType && t != cel.AnyType {
+				return nil, fmt.Errorf("%s: condition must evaluate to a bool, not %s", rule.Name, t)
+			}
+			rule.condition = expr
+		}
+	}
+	return p, nil
+}
+
+// Request describes a tool call, or one kubectl call within it, for policy evaluation.
+type Request struct {
+	// Tool is the name of the tool.
+	Tool string
+	// MCPServer is the MCP server providing the tool, if any.
+	MCPServer string
+	// Command is the command line of shell-based tools.
+	Command string
+	// ModifiesResource is "yes", "no" or "unknown", as reported by the tool.
+	ModifiesResource string
+
+	// The following are set for kubectl calls.
+	Verb      string
+	Resources []string
+	Names     []string
+	// Namespace is the namespace passed with -n/--namespace, or else the namespace of the context.
+	Namespace     string
+	AllNamespaces bool
+	Context       string
+	DryRun        bool
+}
+
+// NewRequests builds the requests to evaluate for a tool call: one per kubectl call it makes,
+// or a single request if it makes none. kubeContext is the current kubeconfig context, and
+// contextNamespace returns the namespace of a context, used for kubectl calls without -n.
+func NewRequests(call *tools.ToolCall, arguments map[string]any, kubeContext string, contextNamespace func(kubeContext string) string) []Request {
+	base := Request{
+		Tool:             call.GetTool().Name(),
+		ModifiesResource: call.GetTool().CheckModifiesResource(arguments),
+		Context:          kubeContext,
+	}
+	if mcpTool, ok := call.GetTool().(*tools.MCPTool); ok {
+		base.MCPServer = mcpTool.ServerName()
+	}
+	if command, ok := arguments["command"].(string); ok {
+		base.Command = command
+	}
+
+	invocations := call.KubectlInvocations()
+	if len(invocations) == 0 {
+		return []Request{base}
+	}
+	requests := make([]Request, 0, len(invocations))
+	for _, inv := range invocations {
+		r := base
+		r.Verb = inv.Verb
+		if inv.SubVerb != "" {
+			r.Verb += " " + inv.SubVerb
+		}
+		r.Resources = inv.Resources
+		r.Names = inv.Names
+		if inv.Context != "" {
+			r.Context = inv.Context
+		}
+		r.Namespace = inv.Namespace
+		r.AllNamespaces = inv.AllNamespaces
+		if r.Namespace == "" && !r.AllNamespaces && contextNamespace != nil {
+			r.Namespace = contextNamespace(r.Context)
+		}
+		r.DryRun = inv.IsDryRun()
+		requests = append(requests, r)
+	}
+	return requests
+}
+
+// object returns the request as the "self" object of CEL conditions.
+func (r *Request) object() map[string]any {
+	return map[string]any{
+		"tool":             r.Tool,
+		"mcpServer":        r.MCPServer,
+		"command":          r.Command,
+		"modifiesResource": r.ModifiesResource,
+		"verb":             r.Verb,
+		"resources":        toList(r.Resources),
+		"names":            toList(r.Names),
+		"namespace":        r.Namespace,
+		"allNamespaces":    r.AllNamespaces,
+		"context":          r.Context,
+		"dryRun":           r.DryRun,
+	}
+}
+
+func toList(values []string) []any {
+	list := make([]any, len(values))
+	for i, v := range values {
+		list[i] = v
+	}
+	return list
+}
+
+// Decision is the outcome of evaluating a policy.
+type Decision struct {
+	// Action is the decided action, or "" if no rule matched.
+	Action Action
+	// Rule is the rule that decided.
+	Rule *Rule
+}
+
+// Reason describes the decision for the user and the LLM.
+func (d Decision) Reason() string {
+	if d.Rule == nil {
+		return ""
+	}
+	if d.Rule.Reason != "" {
+		return fmt.Sprintf("%s (policy rule %q)", d.Rule.Reason, d.Rule.Name)
+	}
+	return fmt.Sprintf("policy rule %q", d.Rule.Name)
+}
+
+// Evaluate decides on a tool call made of the given requests.
+// Each request is decided by the first rule that matches it; across requests,
+// deny takes precedence over ask, and ask over allow. A tool call is only allowed
+// if every request is allowed, otherwise no rule applies to the call as a whole.
+func (p *Policy) Evaluate(ctx context.Context, requests []Request) (Decision, error) {
+	var decision Decision
+	allowed := 0
+	for i := range requests {
+		rule, err := p.firstMatch(ctx, &requests[i])
+		if err != nil {
+			return Decision{}, err
+		}
+		if rule == nil {
+			continue
+		}
+		switch rule.Action {
+		case ActionDeny:
+			return Decision{Action: ActionDeny, Rule: rule}, nil
+		case ActionAsk:
+			if decision.Action != ActionAsk {
+				decision = Decision{Action: ActionAsk, Rule: rule}
+			}
+		case ActionAllow:
+			allowed++
+			if decision.Action == "" {
+				decision = Decision{Action: ActionAllow, Rule: rule}
+			}
+		}
+	}
+	if decision.Action == ActionAllow && allowed < len(requests) {
+		return Decision{}, nil
+	}
+	return decision, nil
+}
+
+func (p *Policy) firstMatch(ctx context.Context, r *Request) (*Rule, error) {
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if !rule.Match.matches(r, rule.Action) {
+			continue
+		}
+		if rule.condition != nil {
+			ok, err := evalCondition(ctx, rule.condition, r)
+			if err != nil {
+				return nil, fmt.Errorf("policy rule %q: %w", rule.Name, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		return rule, nil
+	}
+	return nil, nil
+}
+
+func evalCondition(ctx context.Context, expr *kel.Expression, r *Request) (bool, error) {
+	out, err := expr.Eval(ctx, &unstructured.Unstructured{Object: r.object()})
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.(celtypes.Bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q returned %v, not a bool", expr.CELText, out)
+	}
+	return bool(b), nil
+}
+
+func (m *Match) matches(r *Request, action Action) bool {
+	return matchesOne(m.Tools, r.Tool) &&
+		matchesNamespace(m.Namespaces, r, action) &&
+		matchesOne(m.Verbs, r.Verb) &&
+		matchesOne(m.Contexts, r.Context) &&
+		matchesOne(m.MCPServers, r.MCPServer) &&
+		matchesSome(m.Resources, r.Resources)
+}
+
+// matchesNamespace matches the namespace of a request. A request for all namespaces matches every
+// namespace pattern of deny and ask rules, but none of allow rules, so that -A fails closed.
+func matchesNamespace(patterns []string, r *Request, action Action) bool {
+	if r.AllNamespaces && len(patterns) > 0 {
+		return action != ActionAllow
+	}
+	return matchesOne(patterns, r.Namespace)
+}
+
+// matchesOne returns true if patterns is empty, or value is set and matches one of them.
+func matchesOne(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	if value == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSome returns true if patterns is empty, or any of values matches one of them.
+func matchesSome(patterns []string, values []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if matchesOne(patterns, strings.ToLower(value)) {
+			return true
+		}
+	}
+	return false
+}
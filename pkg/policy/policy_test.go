@@ -0,0 +1,256 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/tools"
+)
+
+const testPolicy = `
+rules:
+- name: no-delete-in-prod
+  action: deny
+  reason: never delete in production namespaces
+  match:
+    verbs: ["delete"]
+    namespaces: ["prod-*"]
+- name: bash-read-only
+  action: deny
+  match:
+    tools: ["bash"]
+  condition: self.modifiesResource != "no"
+- name: ask-apply-in-prod
+  action: ask
+  match:
+    verbs: ["apply"]
+    contexts: ["*prod*"]
+  condition: "!self.dryRun"
+- name: crds
+  action: ask
+  match:
+    resources: ["crd", "customresourcedefinition*"]
+- name: github
+  action: deny
+  match:
+    mcpServers: ["github"]
+  condition: self.tool.endsWith("_delete_repo")
+- name: read-only-kubectl
+  action: allow
+  match:
+    tools: ["kubectl"]
+  condition: self.modifiesResource == "no"
+`
+
+func TestEvaluate(t *testing.T) {
+	p, err := Parse([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		requests []Request
+		want     Action
+		wantRule string
+	}{
+		{
+			name:     "delete in prod namespace",
+			requests: []Request{{Tool: "kubectl", ModifiesResource: "yes", Verb: "delete", Resources: []string{"pod"}, Namespace: "prod-eu"}},
+			want:     ActionDeny,
+			wantRule: "no-delete-in-prod",
+		},
+		{
+			name:     "delete in dev namespace",
+			requests: []Request{{Tool: "kubectl", ModifiesResource: "yes", Verb: "delete", Resources: []string{"pod"}, Namespace: "dev"}},
+			want:     "",
+		},
+		{
+			name:     "bash writes",
+			requests: []Request{{Tool: "bash", ModifiesResource: "unknown", Command: "rm -rf /tmp/x"}},
+			want:     ActionDeny,
+			wantRule: "bash-read-only",
+		},
+		{
+			name:     "apply in prod context",
+			requests: []Request{{Tool: "kubectl", ModifiesResource: "yes", Verb: "apply", Context: "gke-prod"}},
+			want:     ActionAsk,
+			wantRule: "ask-apply-in-prod",
+		},
+		{
+			name:     "apply dry run in prod context",
+			requests: []Request{{Tool: "kubectl", ModifiesResource: "no", Verb: "apply", Context: "gke-prod", DryRun: true}},
+			want:     ActionAllow,
+			wantRule: "read-only-kubectl",
+		},
+		{
+			name:     "resource glob",
+			requests: []Request{{Tool: "kubectl", ModifiesResource: "yes", Verb: "edit", Resources: []string{"CustomResourceDefinitions"}}},
+			want:     ActionAsk,
+			wantRule: "crds",
+		},
+		{
+			name:     "mcp server",
+			requests: []Request{{Tool: "github_delete_repo", MCPServer: "github", ModifiesResource: "unknown"}},
+			want:     ActionDeny,
+			wantRule: "github",
+		},
+		{
+			name: "deny wins across kubectl calls",
+			requests: []Request{
+				{Tool: "kubectl", ModifiesResource: "yes", Verb: "get", Namespace: "prod-eu"},
+				{Tool: "kubectl", ModifiesResource: "yes", Verb: "delete", Namespace: "prod-eu"},
+			},
+			want:     ActionDeny,
+			wantRule: "no-delete-in-prod",
+		},
+		{
+			name: "allow requires every call to be allowed",
+			requests: []Request{
+				{Tool: "kubectl", ModifiesResource: "no", Verb: "get"},
+				{Tool: "kubectl", ModifiesResource: "yes", Verb: "scale"},
+			},
+			want: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			decision, err := p.Evaluate(context.Background(), tc.requests)
+			if err != nil {
+				t.Fatalf("Evaluate() returned error: %v", err)
+			}
+			if decision.Action != tc.want {
+				t.Errorf("Evaluate() action = %q, want %q", decision.Action, tc.want)
+			}
+			if tc.wantRule != "" && (decision.Rule == nil || decision.Rule.Name != tc.wantRule) {
+				t.Errorf("Evaluate() rule = %+v, want %q", decision.Rule, tc.wantRule)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{"unknown action", "rules:\n- name: x\n  action: maybe\n", "invalid action"},
+		{"invalid condition", "rules:\n- name: x\n  action: deny\n  condition: 'self.verb =='\n", "invalid expression"},
+		{"unknown field", "rules:\n- name: x\n  action: deny\n  match:\n    verb: [delete]\n", "unknown field"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.policy))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Parse() error = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewRequests(t *testing.T) {
+	registry := tools.NewTools()
+	if err := registry.RegisterTool(&tools.BashTool{}); err != nil {
+		t.Fatal(err)
+	}
+	args := map[string]any{"command": "kubectl --context prod -n web delete deploy/api && kubectl get pods"}
+	call, err := registry.ParseToolInvocation(context.Background(), "bash", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := NewRequests(call, args, "dev", func(kubeContext string) string { return kubeContext + "-ns" })
+	if len(requests) != 2 {
+		t.Fatalf("NewRequests() returned %d requests, want 2", len(requests))
+	}
+	got := requests[0]
+	if got.Tool != "bash" || got.Verb != "delete" || got.Namespace != "web" || got.Context != "prod" || got.ModifiesResource != "yes" {
+		t.Errorf("NewRequests()[0] = %+v", got)
+	}
+	if requests[1].Context != "dev" || requests[1].Verb != "get" || requests[1].Namespace != "dev-ns" {
+		t.Errorf("NewRequests()[1] = %+v", requests[1])
+	}
+}
+
+func TestEvaluate_ContextNamespace(t *testing.T) {
+	p, err := Parse([]byte(testPolicy + `
+- name: allow-dev
+  action: allow
+  match:
+    namespaces: ["dev-*"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := tools.NewTools()
+	if err := registry.RegisterTool(&tools.Kubectl{}); err != nil {
+		t.Fatal(err)
+	}
+	contextNamespace := func(kubeContext string) string {
+		return map[string]string{"prod": "prod-x", "dev": "dev-1"}[kubeContext]
+	}
+
+	tests := []struct {
+		name     string
+		command  string
+		want     Action
+		wantRule string
+	}{
+		{"default namespace of context", "kubectl delete deploy web", ActionDeny, "no-delete-in-prod"},
+		{"explicit namespace", "kubectl delete deploy web -n dev-1", ActionAllow, "allow-dev"},
+		{"namespace of --context", "kubectl --context dev delete deploy web", ActionAllow, "allow-dev"},
+		{"all namespaces", "kubectl --context dev delete pods --all -A", ActionDeny, "no-delete-in-prod"},
+		{"all namespaces never allowed by namespace", "kubectl --context dev rollout restart deploy -A", "", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			args := map[string]any{"command": tc.command}
+			call, err := registry.ParseToolInvocation(context.Background(), "kubectl", args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decision, err := p.Evaluate(context.Background(), NewRequests(call, args, "prod", contextNamespace))
+			if err != nil {
+				t.Fatalf("Evaluate() returned error: %v", err)
+			}
+			if decision.Action != tc.want {
+				t.Errorf("Evaluate(%q) action = %q, want %q", tc.command, decision.Action, tc.want)
+			}
+			if tc.wantRule != "" && (decision.Rule == nil || decision.Rule.Name != tc.wantRule) {
+				t.Errorf("Evaluate(%q) rule = %+v, want %q", tc.command, decision.Rule, tc.wantRule)
+			}
+		})
+	}
+}
+
+func TestLoadFile_Example(t *testing.T) {
+	path := filepath.Join("..", "..", "examples", "policy.yaml")
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("example policy not found: %v", err)
+	}
+	if _, err := LoadFile(path); err != nil {
+		t.Errorf("LoadFile(%q) returned error: %v", path, err)
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+// Package redact removes secrets and credentials from tool results before they
+// are sent to the LLM or written to the trace.
+//
+// It understands Kubernetes objects (Secret data, sensitive env vars, kubeconfig
+// credentials, in YAML or JSON, including lists) and also matches common token
+// and key patterns in free text. Each distinct secret value is replaced with the
+// same placeholder every time, so that the LLM can still tell values apart.
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	// sensitiveKeys are object keys whose string values are credentials, e.g. in kubeconfigs.
+	sensitiveKeys = regexp.MustCompile(`(?i)^(token|password|passwd|secret|client-secret|client-key-data|access-token|id-token|refresh-token|api[-_]?key|private[-_]?key|auth)$`)
+
+	// sensitiveEnvNames are names of environment variables that usually hold credentials.
+	sensitiveEnvNames = regexp.MustCompile(`(?i)(password|passwd|secret|token|api[-_]?key|private[-_]?key|credential|auth)`)
+
+	// defaultPatterns match credentials in free text. If a pattern has a capture group
+	// named "secret", only that group is replaced.
+	defaultPatterns = []string{
+		// PEM private keys
+		`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+		// Authorization headers
+		`(?i)\b(?:bearer|basic)\s+(?P<secret>[A-Za-z0-9._~+/-]{8,}=*)`,
+		// JSON web tokens, e.g. service account tokens
+		`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`,
+		// AWS access keys
+		`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+		// GitHub and GitLab tokens
+		`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|glpat-[A-Za-z0-9_-]{20,})\b`,
+		// Slack tokens
+		`\bxox[abpors]-[A-Za-z0-9-]{10,}\b`,
+		// key: value and key=value pairs with sensitive keys
+		`(?i)\b(?:password|passwd|secret|token|api[-_]?key|client-key-data|access[-_]?key|secret[-_]?key)["']?\s*[:=]\s*["']?(?P<secret>[^\s"',;]{4,})`,
+		// kubectl create secret --from-literal=key=value
+		`--from-literal[= ](?:[^=\s]+)=(?P<secret>[^\s]+)`,
+	}
+)
+
+// Config configures a Redactor.
+type Config struct {
+	// Patterns are extra regular expressions to redact. If a pattern has a capture group
+	// named "secret", only that group is replaced, otherwise the whole match is.
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// Redactor replaces secrets with placeholders.
+// It is safe for concurrent use.
+type Redactor struct {
+	patterns []*regexp.Regexp
+
+	enabled atomic.Bool
+
+	mutex sync.Mutex
+	// placeholders maps each redacted value to its placeholder.
+	placeholders map[string]string
+}
+
+// New creates an enabled Redactor with the default patterns and the ones in config.
+func New(config Config) (*Redactor, error) {
+	r := &Redactor{placeholders: make(map[string]string)}
+	r.enabled.Store(true)
+	for _, pattern := range append(append([]string{}, defaultPatterns...), config.Patterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// SetEnabled turns redaction on or off, e.g. when the user explicitly asks to inspect secrets.
+func (r *Redactor) SetEnabled(enabled bool) {
+	r.enabled.Store(enabled)
+}
+
+// Enabled returns true if redaction is on. A nil Redactor is disabled.
+func (r *Redactor) Enabled() bool {
+	return r != nil && r.enabled.Load()
+}
+
+// Redact returns s with secrets replaced by placeholders.
+func (r *Redactor) Redact(s string) string {
+	if !r.Enabled() || s == "" {
+		return s
+	}
+	s = r.redactObjects(s)
+	return r.redactPatterns(s)
+}
+
+// RedactAll replaces s entirely with a placeholder, for output that is known to be secret
+// (e.g. a Secret's data printed with a jsonpath).
+func (r *Redactor) RedactAll(s string) string {
+	if !r.Enabled() || strings.TrimSpace(s) == "" {
+		return s
+	}
+	trailing := s[len(strings.TrimRight(s, "\n")):]
+	return r.placeholder(strings.TrimRight(s, "\n")) + trailing
+}
+
+// placeholder returns the placeholder of a secret value.
+func (r *Redactor) placeholder(value string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	p, ok := r.placeholders[value]
+	if !ok {
+		p = fmt.Sprintf("[REDACTED-%d]", len(r.placeholders)+1)
+		r.placeholders[value] = p
+	}
+	return p
+}
+
+func (r *Redactor) redactPatterns(s string) string {
+	for _, re := range r.patterns {
+		group := re.SubexpIndex("secret")
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			if isPlaceholder(match) {
+				return match
+			}
+			if group < 0 {
+				return r.placeholder(match)
+			}
+			// Replace only the secret group
+			loc := re.FindStringSubmatchIndex(match)
+			if loc == nil || loc[2*group] < 0 {
+				return match
+			}
+			secret := match[loc[2*group]:loc[2*group+1]]
+			if isPlaceholder(secret) {
+				return match
+			}
+			return match[:loc[2*group]] + r.placeholder(secret) + match[loc[2*group+1]:]
+		})
+	}
+	return s
+}
+
+var placeholderRE = regexp.MustCompile(`^\[REDACTED-\d+\]$`)
+
+func isPlaceholder(s string) bool {
+	return placeholderRE.MatchString(s)
+}
+
+// redactObjects redacts Kubernetes objects (or kubeconfigs) printed as JSON or YAML.
+// Output that cannot be parsed as such is returned unchanged.
+func (r *Redactor) redactObjects(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+
+	if strings.HasPrefix(trimmed, "{") {
+		var obj any
+		if err := json.Unmarshal([]byte(trimmed), &obj); err != nil {
+			return s
+		}
+		if !r.redactValue(obj) {
+			return s
+		}
+		var b bytes.Buffer
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(obj); err != nil {
+			return s
+		}
+		return b.String()
+	}
+
+	if !strings.Contains(s, "apiVersion:") && !strings.Contains(s, "kind:") && !strings.Contains(s, "users:") {
+		return s
+	}
+	docs := splitYAMLDocuments(s)
+	changed := false
+	for i, doc := range docs {
+		var obj any
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			return s
+		}
+		if _, ok := obj.(map[string]any); !ok || !r.redactValue(obj) {
+			continue
+		}
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return s
+		}
+		docs[i] = string(b)
+		changed = true
+	}
+	if !changed {
+		return s
+	}
+	return strings.Join(docs, "---\n")
+}
+
+// ParsesAsObjects returns true if s is made of Kubernetes objects (with a kind) printed as JSON or YAML,
+// the structure Redact relies on to find the values of Secrets.
+func ParsesAsObjects(s string) bool {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return false
+	}
+	isObject := func(obj map[string]any) bool {
+		kind, _ := obj["kind"].(string)
+		return kind != ""
+	}
+	if strings.HasPrefix(trimmed, "{") {
+		var obj map[string]any
+		return json.Unmarshal([]byte(trimmed), &obj) == nil && isObject(obj)
+	}
+	objects := 0
+	for _, doc := range splitYAMLDocuments(s) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var obj map[string]any
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil || !isObject(obj) {
+			return false
+		}
+		objects++
+	}
+	return objects > 0
+}
+
+// splitYAMLDocuments splits a multi-document YAML stream.
+func splitYAMLDocuments(s string) []string {
+	var docs []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if strings.TrimRight(line, "\r\n") == "---" {
+			docs = append(docs, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteString(line)
+	}
+	return append(docs, current.String())
+}
+
+// redactValue redacts secrets in a decoded JSON/YAML value in place, and returns true if it changed anything.
+func (r *Redactor) redactValue(v any) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]any:
+		if kind, _ := v["kind"].(string); kind == "Secret" {
+			changed = r.redactSecret(v) || changed
+		}
+		// env vars: {name: DB_PASSWORD, value: ...}
+		if name, ok := v["name"].(string); ok && sensitiveEnvNames.MatchString(name) {
+			if value, ok := v["value"].(string); ok && value != "" {
+				v["value"] = r.placeholder(value)
+				changed = true
+			}
+		}
+		for key, value := range v {
+			if s, ok := value.(string); ok {
+				if s != "" && sensitiveKeys.MatchString(key) && !isPlaceholder(s) {
+					v[key] = r.placeholder(s)
+					changed = true
+				}
+				continue
+			}
+			changed = r.redactValue(value) || changed
+		}
+	case []any:
+		for _, item := range v {
+			changed = r.redactValue(item) || changed
+		}
+	}
+	return changed
+}
+
+// redactSecret redacts the data of a Secret object.
+func (r *Redactor) redactSecret(secret map[string]any) bool {
+	changed := false
+	for _, field := range []string{"data", "stringData"} {
+		data, ok := secret[field].(map[string]any)
+		if !ok {
+			continue
+		}
+		for key, value := range data {
+			if s, ok := value.(string); ok && !isPlaceholder(s) {
+				data[key] = r.placeholder(s)
+				changed = true
+			}
+		}
+	}
+	// The last applied configuration holds a copy of the data.
+	if metadata, ok := secret["metadata"].(map[string]any); ok {
+		if annotations, ok := metadata["annotations"].(map[string]any); ok {
+			const lastApplied = "kubectl.kubernetes.io/last-applied-configuration"
+			if s, ok := annotations[lastApplied].(string); ok && !isPlaceholder(s) {
+				annotations[lastApplied] = r.placeholder(s)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
@@ -0,0 +1,240 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/kubeconfig"
+	"k8s.io/klog/v2"
+)
+
+// The sandbox has its own network namespace, so it cannot reach the API server directly.
+// Instead we listen on a unix socket in the (shared) state directory and relay connections
+// to the API server. Inside the sandbox, a forwarder (our own binary, see RunForwarder)
+// listens on relayListenAddress and passes connections on to that socket.
+// kubectl is given a kubeconfig whose server points at the forwarder; TLS still terminates
+// at the real API server, with tls-server-name set to its original host name.
+
+// relayListenAddress is the address the forwarder listens on inside the sandbox.
+const relayListenAddress = "127.0.0.1:6443"
+
+// ForwarderCommand is the (hidden) subcommand that runs RunForwarder.
+const ForwarderCommand = "sandbox-forward"
+
+type apiServerRelay struct {
+	// dir holds the socket and the rewritten kubeconfig.
+	dir string
+	// socket is the unix socket the forwarder connects to.
+	socket string
+	// kubeconfig is the path of the rewritten kubeconfig.
+	kubeconfig string
+	// target is the host:port of the API server.
+	target string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+func startAPIServerRelay(ctx context.Context, kubeconfigPath string, stateDir string) (*apiServerRelay, error) {
+	// Like kubectl, use the first file of a KUBECONFIG list.
+	if paths := filepath.SplitList(kubeconfigPath); len(paths) > 0 {
+		kubeconfigPath = paths[0]
+	}
+	b, err := os.ReadFile(kubeconfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading kubeconfig: %w", err)
+	}
+
+	rewritten, target, err := rewriteKubeconfig(b, filepath.Dir(kubeconfigPath), relayListenAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(stateDir, "relay-")
+	if err != nil {
+		return nil, fmt.Errorf("creating relay directory: %w", err)
+	}
+	r := &apiServerRelay{
+		dir:        dir,
+		socket:     filepath.Join(dir, "apiserver.sock"),
+		kubeconfig: filepath.Join(dir, "kubeconfig"),
+		target:     target,
+	}
+
+	if err := os.WriteFile(r.kubeconfig, rewritten, 0o600); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("writing sandbox kubeconfig: %w", err)
+	}
+
+	listener, err := net.Listen("unix", r.socket)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("listening on %s: %w", r.socket, err)
+	}
+	r.listener = listener
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.serve(ctx)
+	}()
+	return r, nil
+}
+
+func (r *apiServerRelay) serve(ctx context.Context) {
+	var dialer net.Dialer
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				klog.Warningf("sandbox relay: accept failed: %v", err)
+			}
+			return
+		}
+		go func() {
+			upstream, err := dialer.DialContext(ctx, "tcp", r.target)
+			if err != nil {
+				klog.Warningf("sandbox relay: connecting to API server %s: %v", r.target, err)
+				conn.Close()
+				return
+			}
+			pipe(conn, upstream)
+		}()
+	}
+}
+
+// forwarderCommand returns the shell commands that start the forwarder inside the sandbox,
+// and wait for it to be ready.
+func (r *apiServerRelay) forwarderCommand() string {
+	return fmt.Sprintf(`exec 3< <(%s %s --listen %s --socket %s 2>/dev/null) && read -r -u 3 _ || { echo "sandbox: failed to start the API server relay" >&2; exit 125; }`,
+		shellQuote(sandboxHelperBin), ForwarderCommand, relayListenAddress, shellQuote(r.socket))
+}
+
+// Close stops relaying connections and removes the relay files.
+func (r *apiServerRelay) Close() {
+	r.listener.Close()
+	r.wg.Wait()
+	os.RemoveAll(r.dir)
+}
+
+// RunForwarder listens on listenAddress and forwards every connection to the unix socket.
+// It writes a line to ready once it is listening, and runs until ctx is cancelled.
+func RunForwarder(ctx context.Context, listenAddress string, socket string, ready io.Writer) error {
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	if _, err := fmt.Fprintln(ready, "ready"); err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go func() {
+			upstream, err := dialer.DialContext(ctx, "unix", socket)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			pipe(conn, upstream)
+		}()
+	}
+}
+
+// pipe copies data in both directions until either side is done, then closes both connections.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(a, b)
+		a.Close()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(b, a)
+		b.Close()
+	}()
+	wg.Wait()
+}
+
+// rewriteKubeconfig points the cluster of the current context at relayAddress, keeping the original
+// host name for TLS verification, and makes relative file references absolute (relative to baseDir).
+// It returns the new kubeconfig and the host:port of the original server.
+func rewriteKubeconfig(b []byte, baseDir string, relayAddress string) ([]byte, string, error) {
+	config, err := kubeconfig.Parse(b, baseDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	original, err := config.Server()
+	if err != nil {
+		return nil, "", err
+	}
+	u, err := url.Parse(original)
+	if err != nil || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid server %q in kubeconfig", original)
+	}
+	if u.Scheme != "https" {
+		return nil, "", fmt.Errorf("sandboxed API server access requires an https server, the current context uses %q", original)
+	}
+	target := u.Host
+	if u.Port() == "" {
+		target = net.JoinHostPort(u.Hostname(), "443")
+	}
+
+	serverURL := *u
+	serverURL.Host = relayAddress
+	if err := config.SetServer(serverURL.String(), u.Hostname()); err != nil {
+		return nil, "", err
+	}
+
+	rewritten, err := config.Marshal()
+	if err != nil {
+		return nil, "", err
+	}
+	return rewritten, target, nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
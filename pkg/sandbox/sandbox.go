@@ -0,0 +1,313 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+// Package sandbox runs shell commands issued by the agent in a restricted environment:
+// a read-only view of the root filesystem with only the work directory writable,
+// no network (or network limited to the Kubernetes API server), an allowlisted PATH
+// and resource limits.
+//
+// The PATH allowlist only steers the agent towards the expected commands: the whole
+// root filesystem is mounted read-only, so any installed program can be run by its
+// absolute path.
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+// NetworkMode controls the network access of sandboxed commands.
+type NetworkMode string
+
+const (
+	// NetworkNone gives sandboxed commands no network access at all.
+	NetworkNone NetworkMode = "none"
+	// NetworkAPIServer only allows connections to the Kubernetes API server of the current context.
+	NetworkAPIServer NetworkMode = "apiserver"
+	// NetworkHost shares the host network.
+	NetworkHost NetworkMode = "host"
+)
+
+// Implement pflag.Value for NetworkMode
+func (m *NetworkMode) Set(s string) error {
+	switch NetworkMode(s) {
+	case NetworkNone, NetworkAPIServer, NetworkHost:
+		*m = NetworkMode(s)
+		return nil
+	default:
+		return fmt.Errorf("invalid sandbox network mode %q (expected none, apiserver or host)", s)
+	}
+}
+
+func (m *NetworkMode) String() string {
+	return string(*m)
+}
+
+func (m *NetworkMode) Type() string {
+	return "NetworkMode"
+}
+
+// Limits are resource limits applied to sandboxed commands; zero values mean "no limit".
+type Limits struct {
+	// CPUSeconds is the maximum CPU time of each process.
+	CPUSeconds int `json:"cpuSeconds,omitempty"`
+	// MemoryMB is the maximum virtual memory of each process.
+	MemoryMB int `json:"memoryMB,omitempty"`
+	// MaxProcesses is the maximum number of processes.
+	// Note that the kernel counts all processes of the user, not only those in the sandbox.
+	MaxProcesses int `json:"maxProcesses,omitempty"`
+	// MaxFileSizeMB is the maximum size of a file written by the command.
+	MaxFileSizeMB int `json:"maxFileSizeMB,omitempty"`
+}
+
+// Policy decides which tools run sandboxed, and how.
+type Policy struct {
+	// Tools lists the tools (glob patterns, e.g. "bash" or "*") whose commands run sandboxed.
+	Tools []string `json:"tools,omitempty"`
+
+	// Network is the network access of sandboxed commands.
+	Network NetworkMode `json:"network,omitempty"`
+
+	// AllowedCommands are the only commands available on the PATH inside the sandbox.
+	// This is not a security boundary: the root filesystem is visible (read-only) in the sandbox,
+	// so other programs can still be run by their absolute path. It keeps the agent to the
+	// expected tools; the filesystem, network and resource restrictions are what confine it.
+	AllowedCommands []string `json:"allowedCommands,omitempty"`
+
+	// Limits are the resource limits of sandboxed commands.
+	Limits Limits `json:"limits,omitempty"`
+}
+
+// DefaultPolicy sandboxes the bash tool, allows network access only to the API server,
+// and exposes common read-only shell utilities alongside kubectl.
+func DefaultPolicy() Policy {
+	return Policy{
+		Tools:   []string{"bash"},
+		Network: NetworkAPIServer,
+		AllowedCommands: []string{
+			"kubectl", "helm", "bash", "sh", "cat", "echo", "grep", "egrep", "awk", "sed",
+			"head", "tail", "sort", "uniq", "wc", "cut", "tr", "jq", "yq", "base64",
+			"date", "sleep", "ls", "find", "xargs", "tee", "diff", "column", "printf", "env",
+		},
+		Limits: Limits{
+			CPUSeconds:    120,
+			MemoryMB:      2048,
+			MaxFileSizeMB: 512,
+		},
+	}
+}
+
+// Applies returns true if commands of the named tool must run sandboxed.
+func (p *Policy) Applies(toolName string) bool {
+	for _, pattern := range p.Tools {
+		if ok, err := path.Match(pattern, toolName); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUnavailable is returned when the sandbox cannot be used on this system.
+var ErrUnavailable = errors.New("sandbox unavailable")
+
+// Sandbox runs shell commands according to a Policy.
+type Sandbox struct {
+	policy Policy
+
+	// binDir holds symlinks to the allowed commands; it is the only entry on the sandboxed PATH.
+	binDir string
+
+	// helperBin is the path of our own executable, used to forward API server traffic inside the sandbox.
+	helperBin string
+}
+
+// New prepares a sandbox for the given policy.
+// It returns an error wrapping ErrUnavailable if the sandbox cannot be used on this system.
+func New(policy Policy) (*Sandbox, error) {
+	if err := checkAvailable(); err != nil {
+		return nil, err
+	}
+
+	binDir, err := os.MkdirTemp("", "kubelet-wuhrai-sandbox-bin-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating sandbox bin directory: %w", err)
+	}
+	for _, command := range policy.AllowedCommands {
+		target, err := exec.LookPath(command)
+		if err != nil {
+			klog.V(2).Infof("sandbox: allowed command %q not found on PATH, skipping", command)
+			continue
+		}
+		target, err = filepath.Abs(target)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Symlink(target, filepath.Join(binDir, command)); err != nil {
+			return nil, fmt.Errorf("linking %q into sandbox bin directory: %w", command, err)
+		}
+	}
+
+	helperBin, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("finding our own executable: %w", err)
+	}
+
+	return &Sandbox{
+		policy:    policy,
+		binDir:    binDir,
+		helperBin: helperBin,
+	}, nil
+}
+
+// Policy returns the sandbox policy.
+func (s *Sandbox) Policy() Policy {
+	return s.policy
+}
+
+// Close removes the files created for the sandbox.
+func (s *Sandbox) Close() error {
+	return os.RemoveAll(s.binDir)
+}
+
+// Command describes a shell command to run in the sandbox.
+type Command struct {
+	// Shell is the command line, run with bash -c.
+	Shell string
+	// WorkDir is the only writable directory; the command runs in it.
+	WorkDir string
+	// Kubeconfig is the path of the kubeconfig file the command should use.
+	Kubeconfig string
+}
+
+// Prepared is a command ready to be run in the sandbox.
+type Prepared struct {
+	Cmd *exec.Cmd
+
+	cleanup []func()
+}
+
+// Close releases the resources held for the command (e.g. the API server relay).
+// It must be called once the command has finished.
+func (p *Prepared) Close() {
+	for _, fn := range p.cleanup {
+		fn()
+	}
+}
+
+// Prepare builds the exec.Cmd that runs command in the sandbox.
+func (s *Sandbox) Prepare(ctx context.Context, command Command) (*Prepared, error) {
+	prepared := &Prepared{}
+
+	stateDir := filepath.Join(command.WorkDir, ".sandbox")
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating sandbox state directory: %w", err)
+	}
+
+	env := []string{
+		"PATH=" + sandboxBinDir,
+		"HOME=" + command.WorkDir,
+		"KUBECACHEDIR=" + filepath.Join(stateDir, "kube-cache"),
+	}
+	for _, key := range []string{"LANG", "LC_ALL", "TERM", "TZ"} {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+
+	var prelude []string
+	prelude = append(prelude, s.policy.Limits.ulimitCommands()...)
+
+	kubeconfig := command.Kubeconfig
+	if s.policy.Network == NetworkAPIServer && kubeconfig != "" {
+		relay, err := startAPIServerRelay(ctx, kubeconfig, stateDir)
+		if err != nil {
+			prepared.Close()
+			return nil, fmt.Errorf("setting up API server access: %w", err)
+		}
+		prepared.cleanup = append(prepared.cleanup, relay.Close)
+
+		kubeconfig = relay.kubeconfig
+		// Start the forwarder before applying the limits, so it is not subject to them.
+		prelude = append([]string{relay.forwarderCommand()}, prelude...)
+	}
+	if kubeconfig != "" {
+		env = append(env, "KUBECONFIG="+kubeconfig)
+	}
+
+	script := command.Shell
+	if len(prelude) > 0 {
+		script = strings.Join(prelude, "\n") + "\n" + command.Shell
+	}
+
+	cmd, err := s.command(ctx, command.WorkDir, env, script)
+	if err != nil {
+		prepared.Close()
+		return nil, err
+	}
+	prepared.Cmd = cmd
+	return prepared, nil
+}
+
+// Describe returns a short description of the sandbox restrictions, for reporting to the LLM.
+func (s *Sandbox) Describe() string {
+	var network string
+	switch s.policy.Network {
+	case NetworkNone:
+		network = "no network access"
+	case NetworkAPIServer:
+		network = "network access only to the Kubernetes API server"
+	default:
+		network = "host network access"
+	}
+	return fmt.Sprintf("the command ran in a sandbox: read-only filesystem except the working directory, %s, and only these commands on PATH: %s",
+		network, strings.Join(s.policy.AllowedCommands, ", "))
+}
+
+const (
+	// sandboxRoot is a directory on the sandbox's private /tmp, where we mount our own files.
+	sandboxRoot = "/tmp/.kubelet-wuhrai"
+	// sandboxBinDir is where the allowed commands are mounted inside the sandbox.
+	sandboxBinDir = sandboxRoot + "/bin"
+	// sandboxHelperBin is where our own executable is mounted inside the sandbox.
+	sandboxHelperBin = sandboxRoot + "/helper"
+)
+
+func (l Limits) ulimitCommands() []string {
+	var commands []string
+	if l.CPUSeconds > 0 {
+		commands = append(commands, fmt.Sprintf("ulimit -t %d", l.CPUSeconds))
+	}
+	if l.MemoryMB > 0 {
+		commands = append(commands, fmt.Sprintf("ulimit -v %d", l.MemoryMB*1024))
+	}
+	if l.MaxProcesses > 0 {
+		commands = append(commands, fmt.Sprintf("ulimit -u %d", l.MaxProcesses))
+	}
+	if l.MaxFileSizeMB > 0 {
+		// ulimit -f counts 1024-byte blocks in bash
+		commands = append(commands, fmt.Sprintf("ulimit -f %d", l.MaxFileSizeMB*1024))
+	}
+	return commands
+}
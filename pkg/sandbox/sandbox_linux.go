@@ -0,0 +1,83 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+//go:build linux
+
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// The Linux backend uses bubblewrap (bwrap) to run commands in fresh mount, PID, IPC, UTS
+// and (unless the policy allows host networking) network namespaces.
+
+func checkAvailable() error {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		return fmt.Errorf("%w: bubblewrap (bwrap) not found on PATH", ErrUnavailable)
+	}
+	return nil
+}
+
+func (s *Sandbox) command(ctx context.Context, workDir string, env []string, script string) (*exec.Cmd, error) {
+	bwrap, err := exec.LookPath("bwrap")
+	if err != nil {
+		return nil, fmt.Errorf("%w: bubblewrap (bwrap) not found on PATH", ErrUnavailable)
+	}
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return nil, fmt.Errorf("%w: bash not found on PATH", ErrUnavailable)
+	}
+
+	args := bwrapArgs(s.policy, workDir, s.binDir, s.helperBin)
+	args = append(args, "--", bash, "-c", script)
+
+	cmd := exec.CommandContext(ctx, bwrap, args...)
+	cmd.Dir = workDir
+	// bwrap passes its own environment on to the command
+	cmd.Env = env
+	return cmd, nil
+}
+
+// bwrapArgs returns the bubblewrap options that implement the policy.
+func bwrapArgs(policy Policy, workDir string, binDir string, helperBin string) []string {
+	args := []string{
+		// read-only view of the host
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		// the work directory is the only writable location (besides the private /tmp)
+		"--bind", workDir, workDir,
+		"--ro-bind", binDir, sandboxBinDir,
+		"--ro-bind", helperBin, sandboxHelperBin,
+		"--chdir", workDir,
+		"--unshare-pid",
+		"--unshare-ipc",
+		"--unshare-uts",
+		"--unshare-cgroup-try",
+		"--die-with-parent",
+		"--new-session",
+	}
+	if policy.Network != NetworkHost {
+		// API server access goes through the relay, see relay.go
+		args = append(args, "--unshare-net")
+	}
+	return args
+}
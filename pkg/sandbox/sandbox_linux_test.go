@@ -0,0 +1,112 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+//go:build linux
+
+package sandbox
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runInSandbox runs a shell command in the sandbox and returns its combined output.
+func runInSandbox(t *testing.T, sb *Sandbox, workDir string, shell string) (string, error) {
+	t.Helper()
+
+	prepared, err := sb.Prepare(context.Background(), Command{Shell: shell, WorkDir: workDir})
+	if err != nil {
+		t.Fatalf("Prepare(%q): %v", shell, err)
+	}
+	defer prepared.Close()
+
+	out, err := prepared.Cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestSandbox_Bwrap(t *testing.T) {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		t.Skip("bwrap not found on PATH")
+	}
+	ls, err := exec.LookPath("ls")
+	if err != nil {
+		t.Skip("ls not found on PATH")
+	}
+
+	sb, err := New(Policy{
+		Network:         NetworkNone,
+		AllowedCommands: []string{"cat"},
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer sb.Close()
+
+	workDir := t.TempDir()
+	// bwrap can be installed but unusable, e.g. in containers without user namespaces
+	if out, err := runInSandbox(t, sb, workDir, "true"); err != nil {
+		t.Skipf("bwrap cannot create a sandbox here: %v: %s", err, out)
+	}
+
+	t.Run("work directory is writable", func(t *testing.T) {
+		if out, err := runInSandbox(t, sb, workDir, "echo hello > out.txt && cat out.txt"); err != nil {
+			t.Fatalf("unexpected error: %v: %s", err, out)
+		}
+		b, err := os.ReadFile(filepath.Join(workDir, "out.txt"))
+		if err != nil {
+			t.Fatalf("reading file written in the sandbox: %v", err)
+		}
+		if string(b) != "hello\n" {
+			t.Errorf("file written in the sandbox = %q, want %q", b, "hello\n")
+		}
+	})
+
+	t.Run("rest of the filesystem is read-only", func(t *testing.T) {
+		outside := t.TempDir()
+		target := filepath.Join(outside, "out.txt")
+		if out, err := runInSandbox(t, sb, workDir, "echo hello > "+target); err == nil {
+			t.Errorf("writing outside the work directory succeeded: %s", out)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Errorf("file outside the work directory exists after the command (stat error: %v)", err)
+		}
+	})
+
+	t.Run("only allowed commands are on PATH", func(t *testing.T) {
+		out, err := runInSandbox(t, sb, workDir, "command -v cat")
+		if err != nil {
+			t.Fatalf("allowed command not found: %v: %s", err, out)
+		}
+		if got := strings.TrimSpace(out); got != sandboxBinDir+"/cat" {
+			t.Errorf("command -v cat = %q, want %q", got, sandboxBinDir+"/cat")
+		}
+		if out, err := runInSandbox(t, sb, workDir, "command -v ls"); err == nil {
+			t.Errorf("command not in the allowlist found on PATH: %s", out)
+		}
+	})
+
+	// The PATH allowlist is not a boundary: the root filesystem is visible, see Policy.AllowedCommands.
+	t.Run("absolute paths still resolve", func(t *testing.T) {
+		if out, err := runInSandbox(t, sb, workDir, ls+" /"); err != nil {
+			t.Errorf("running %s by absolute path failed: %v: %s", ls, err, out)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestPolicy_Applies(t *testing.T) {
+	policy := Policy{Tools: []string{"bash", "helm_*"}}
+
+	for name, expected := range map[string]bool{
+		"bash":         true,
+		"helm_install": true,
+		"kubectl":      false,
+		"helm":         false,
+	} {
+		if got := policy.Applies(name); got != expected {
+			t.Errorf("Applies(%q) = %v, want %v", name, got, expected)
+		}
+	}
+}
+
+const testKubeconfig = `
+apiVersion: v1
+kind: Config
+current-context: dev
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+    user: dev-user
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: dev-user
+clusters:
+- name: dev-cluster
+  cluster:
+    server: %s
+    certificate-authority: certs/ca.crt
+- name: prod-cluster
+  cluster:
+    server: https://prod.example.com
+users:
+- name: dev-user
+  user:
+    client-certificate: certs/client.crt
+    client-key: /etc/kube/client.key
+`
+
+func TestRewriteKubeconfig(t *testing.T) {
+	b, target, err := rewriteKubeconfig([]byte(fmt.Sprintf(testKubeconfig, "https://dev.example.com")), "/home/me/.kube", "127.0.0.1:6443")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target != "dev.example.com:443" {
+		t.Errorf("expected target dev.example.com:443, got %q", target)
+	}
+
+	var config struct {
+		Clusters []struct {
+			Name    string
+			Cluster map[string]string
+		}
+		Users []struct {
+			User map[string]string
+		}
+	}
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		t.Fatalf("parsing rewritten kubeconfig: %v", err)
+	}
+
+	dev, prod := config.Clusters[0].Cluster, config.Clusters[1].Cluster
+	if dev["server"] != "https://127.0.0.1:6443" {
+		t.Errorf("expected server to point at the relay, got %q", dev["server"])
+	}
+	if dev["tls-server-name"] != "dev.example.com" {
+		t.Errorf("expected tls-server-name dev.example.com, got %q", dev["tls-server-name"])
+	}
+	if dev["certificate-authority"] != "/home/me/.kube/certs/ca.crt" {
+		t.Errorf("expected absolute certificate-authority, got %q", dev["certificate-authority"])
+	}
+	if prod["server"] != "https://prod.example.com" {
+		t.Errorf("expected other clusters to be unchanged, got %q", prod["server"])
+	}
+
+	user := config.Users[0].User
+	if user["client-certificate"] != "/home/me/.kube/certs/client.crt" || user["client-key"] != "/etc/kube/client.key" {
+		t.Errorf("unexpected user file references: %v", user)
+	}
+
+	if _, _, err := rewriteKubeconfig([]byte(fmt.Sprintf(testKubeconfig, "http://dev.example.com")), "/", "127.0.0.1:6443"); err == nil {
+		t.Errorf("expected an error for a plain http server")
+	}
+}
+
+func TestAPIServerRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A fake API server that echoes a line back
+	apiServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer apiServer.Close()
+	go func() {
+		for {
+			conn, err := apiServer.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			conn.Write([]byte("echo: " + line))
+			conn.Close()
+		}
+	}()
+
+	dir := t.TempDir()
+	kubeconfigPath := filepath.Join(dir, "config")
+	if err := os.WriteFile(kubeconfigPath, []byte(fmt.Sprintf(testKubeconfig, "https://"+apiServer.Addr().String())), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	relay, err := startAPIServerRelay(ctx, kubeconfigPath, dir)
+	if err != nil {
+		t.Fatalf("starting relay: %v", err)
+	}
+
+	conn, err := net.Dial("unix", relay.socket)
+	if err != nil {
+		t.Fatalf("connecting to relay: %v", err)
+	}
+	conn.Write([]byte("hello\n"))
+	reply, _ := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+	if reply != "echo: hello\n" {
+		t.Errorf("unexpected reply through relay: %q", reply)
+	}
+
+	relay.Close()
+	if _, err := os.Stat(relay.dir); !os.IsNotExist(err) {
+		t.Errorf("expected relay directory to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// resourceAliases maps the short and singular names of common resource types to their plural name,
+// so that an approval for "deployments" also covers "kubectl scale deploy".
+var resourceAliases = map[string]string{
+	"po": "pods", "pod": "pods",
+	"deploy": "deployments", "deployment": "deployments",
+	"rs": "replicasets", "replicaset": "replicasets",
+	"sts": "statefulsets", "statefulset": "statefulsets",
+	"ds": "daemonsets", "daemonset": "daemonsets",
+	"job": "jobs",
+	"cj": "cronjobs", "cronjob": "cronjobs",
+	"svc": "services", "service": "services",
+	"ing": "ingresses", "ingress": "ingresses",
+	"cm": "configmaps", "configmap": "configmaps",
+	"secret": "secrets",
+	"ns": "namespaces", "namespace": "namespaces",
+	"no": "nodes", "node": "nodes",
+	"pvc": "persistentvolumeclaims", "persistentvolumeclaim": "persistentvolumeclaims",
+	"hpa": "horizontalpodautoscalers", "horizontalpodautoscaler": "horizontalpodautoscalers",
+	"sa": "serviceaccounts", "serviceaccount": "serviceaccounts",
+}
+
+// Approval lets matching tool calls run without asking the user again, for the rest of the session.
+// It either approves an exact tool call (Tool and Call), or a kubectl operation on a type of
+// resource in a namespace (Verb, Resource, Namespace and Context).
+type Approval struct {
+	ID int
+
+	// Tool is the name of the approved tool, and Call its command (or its arguments for tools without one).
+	Tool string
+	Call string
+
+	// Verb is the kubectl verb, including the sub-command if any (e.g. "scale" or "rollout restart").
+	Verb string
+	// Resource is the plural name of the resource type, e.g. "deployments".
+	Resource string
+	// Namespace is the namespace of the resources; "" is the default namespace of the context.
+	Namespace string
+	Context   string
+}
+
+// String describes the approval for humans.
+func (a *Approval) String() string {
+	if a.Tool != "" {
+		return fmt.Sprintf("%s `%s`", a.Tool, a.Call)
+	}
+	namespace := "the default namespace"
+	if a.Namespace != "" {
+		namespace = "namespace " + a.Namespace
+	}
+	s := fmt.Sprintf("`%s` on %s in %s", a.Verb, a.Resource, namespace)
+	if a.Context != "" {
+		s += fmt.Sprintf(" of context %s", a.Context)
+	}
+	return s
+}
+
+// sameGrant returns true if the approvals allow the same tool calls.
+func (a *Approval) sameGrant(other *Approval) bool {
+	return a.Tool == other.Tool && a.Call == other.Call &&
+		a.Verb == other.Verb && a.Resource == other.Resource &&
+		a.Namespace == other.Namespace && a.Context == other.Context
+}
+
+// ExactApproval returns the approval of exactly this tool call.
+func ExactApproval(t *ToolCall) *Approval {
+	call, ok := t.arguments["command"].(string)
+	if !ok {
+		// The LLM's own assessment does not change what the call does.
+		args := make(map[string]any, len(t.arguments))
+		for key, value := range t.arguments {
+			if key != "modifies_resource" {
+				args[key] = value
+			}
+		}
+		b, _ := json.Marshal(args) // map keys are sorted
+		call = string(b)
+	}
+	return &Approval{Tool: t.tool.Name(), Call: strings.TrimSpace(call)}
+}
+
+// ScopedApprovals returns the approvals of the kubectl operations of the tool call, by verb,
+// resource type and namespace. It returns nil if the tool call cannot be approved that way:
+// it must only run kubectl, and each call must act on a single type of resource in one namespace.
+func ScopedApprovals(t *ToolCall, defaultContext string) []*Approval {
+	switch t.tool.(type) {
+	case *Kubectl, *BashTool:
+	default:
+		return nil
+	}
+	command, _ := t.arguments["command"].(string)
+	if !OnlyRunsKubectl(command) {
+		return nil
+	}
+
+	var approvals []*Approval
+	for _, inv := range t.KubectlInvocations() {
+		if inv.Verb == "" || len(inv.Resources) != 1 || inv.AllNamespaces || len(inv.Filenames) > 0 {
+			return nil
+		}
+		verb := inv.Verb
+		if inv.SubVerb != "" && inv.SubVerb != inv.Resources[0] {
+			verb += " " + inv.SubVerb
+		}
+		context := inv.Context
+		if context == "" {
+			context = defaultContext
+		}
+		approval := &Approval{Verb: verb, Resource: canonicalResource(inv.Resources[0]), Namespace: inv.Namespace, Context: context}
+		if !slices.ContainsFunc(approvals, approval.sameGrant) {
+			approvals = append(approvals, approval)
+		}
+	}
+	return approvals
+}
+
+// canonicalResource returns the plural lowercase name of a resource type, e.g. "deployments" for "deploy".
+func canonicalResource(resource string) string {
+	resource = strings.ToLower(resource)
+	if name, ok := resourceAliases[resource]; ok {
+		return name
+	}
+	return resource
+}
+
+// Approvals is the table of the approvals the user granted in a session.
+// It is safe for concurrent use.
+type Approvals struct {
+	mu        sync.Mutex
+	lastID    int
+	approvals []*Approval
+}
+
+// Add adds approvals to the table, skipping the ones already granted.
+func (a *Approvals) Add(approvals ...*Approval) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, approval := range approvals {
+		if slices.ContainsFunc(a.approvals, approval.sameGrant) {
+			continue
+		}
+		a.lastID++
+		granted := *approval
+		granted.ID = a.lastID
+		a.approvals = append(a.approvals, &granted)
+	}
+}
+
+// List returns the approvals in the order they were granted.
+func (a *Approvals) List() []Approval {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var approvals []Approval
+	for _, approval := range a.approvals {
+		approvals = append(approvals, *approval)
+	}
+	return approvals
+}
+
+// Revoke removes an approval, and returns false if there is no approval with this ID.
+func (a *Approvals) Revoke(id int) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := len(a.approvals)
+	a.approvals = slices.DeleteFunc(a.approvals, func(approval *Approval) bool { return approval.ID == id })
+	return len(a.approvals) != n
+}
+
+// Clear removes all the approvals, and returns how many there were.
+func (a *Approvals) Clear() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	n := len(a.approvals)
+	a.approvals = nil
+	return n
+}
+
+// Match returns an approval covering the tool call, or nil if the user must be asked.
+// A nil Approvals approves nothing.
+func (a *Approvals) Match(t *ToolCall, defaultContext string) *Approval {
+	if a == nil {
+		return nil
+	}
+	exact := ExactApproval(t)
+	scoped := ScopedApprovals(t, defaultContext)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, approval := range a.approvals {
+		if approval.sameGrant(exact) {
+			return approval
+		}
+	}
+	if len(scoped) == 0 {
+		return nil
+	}
+	var matched *Approval
+	for _, want := range scoped {
+		i := slices.IndexFunc(a.approvals, want.sameGrant)
+		if i < 0 {
+			return nil
+		}
+		if matched == nil {
+			matched = a.approvals[i]
+		}
+	}
+	return matched
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import "testing"
+
+func kubectlCall(command string) *ToolCall {
+	return &ToolCall{tool: &Kubectl{}, name: "kubectl", arguments: map[string]any{"command": command}}
+}
+
+func TestScopedApprovals(t *testing.T) {
+	approvals := ScopedApprovals(kubectlCall("kubectl scale deploy web --replicas=3 -n shop"), "prod")
+	if len(approvals) != 1 {
+		t.Fatalf("ScopedApprovals() = %v, want 1 approval", approvals)
+	}
+	if got, want := approvals[0].String(), "`scale` on deployments in namespace shop of context prod"; got != want {
+		t.Errorf("approval = %q, want %q", got, want)
+	}
+
+	for _, command := range []string{
+		"kubectl scale deploy web --replicas=3 -n shop | tee out",
+		"kubectl apply -f web.yaml",
+		"kubectl delete pods --all-namespaces -l app=web",
+		"kubectl delete deploy,svc web -n shop",
+	} {
+		if approvals := ScopedApprovals(kubectlCall(command), "prod"); approvals != nil {
+			t.Errorf("ScopedApprovals(%q) = %v, want none", command, approvals)
+		}
+	}
+}
+
+func TestApprovalsMatch(t *testing.T) {
+	var table Approvals
+	scale := kubectlCall("kubectl scale deployment web --replicas=3 -n shop")
+	if table.Match(scale, "prod") != nil {
+		t.Fatalf("empty table matched a call")
+	}
+
+	table.Add(ScopedApprovals(scale, "prod")...)
+	for command, want := range map[string]bool{
+		"kubectl -n shop scale deploy api --replicas=1":               true,
+		"kubectl scale deployments api --replicas=1 --namespace=shop": true,
+		"kubectl scale deploy api --replicas=1 -n other":              false,
+		"kubectl scale deploy api --replicas=1 -n shop --context dev": false,
+		"kubectl delete deploy api -n shop":                           false,
+		"kubectl scale deploy api -n shop --replicas=1; rm -rf /tmp":  false,
+	} {
+		if got := table.Match(kubectlCall(command), "prod") != nil; got != want {
+			t.Errorf("Match(%q) = %v, want %v", command, got, want)
+		}
+	}
+
+	restart := kubectlCall("kubectl rollout restart deploy web -n shop")
+	table.Add(ExactApproval(restart), ExactApproval(restart))
+	if table.Match(restart, "prod") == nil {
+		t.Errorf("exact approval did not match its command")
+	}
+	if table.Match(kubectlCall("kubectl rollout restart deploy api -n shop"), "prod") != nil {
+		t.Errorf("exact approval matched another command")
+	}
+
+	list := table.List()
+	if len(list) != 2 {
+		t.Fatalf("List() = %v, want 2 approvals", list)
+	}
+	if !table.Revoke(list[0].ID) || table.Revoke(list[0].ID) {
+		t.Errorf("Revoke() should succeed once")
+	}
+	if table.Match(scale, "prod") != nil {
+		t.Errorf("revoked approval still matches")
+	}
+	if n := table.Clear(); n != 1 {
+		t.Errorf("Clear() = %d, want 1", n)
+	}
+
+	var nilTable *Approvals
+	if nilTable.Match(scale, "prod") != nil {
+		t.Errorf("nil table matched a call")
+	}
+}
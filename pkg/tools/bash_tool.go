@@ -36,7 +36,7 @@ import (
 )
 
 func init() {
-	RegisterTool(&BashTool{})
+	registerBuiltinTool(&BashTool{})
 }
 
 const (
@@ -91,6 +91,7 @@ func (t *BashTool) FunctionDefinition() *gollm.FunctionDefinition {
 				},
 				"modifies_resource": {
 					Type: gollm.TypeString,
+					Enum: []any{"yes", "no", "unknown"},
 					Description: `Whether the command modifies a kubernetes resource.
 Possible values:
 - "yes" if the command modifies a resource
@@ -115,6 +116,14 @@ func (t *BashTool) Run(ctx context.Context, args map[string]any) (any, error) {
 		return &ExecResult{Command: command, Error: "port-forwarding is not allowed because assistant is running in an unattended mode, please try some other alternative"}, nil
 	}
 
+	if sb := sandboxFor(ctx, t.Name()); sb != nil {
+		kubeconfig, err := expandShellVar(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return runSandboxed(ctx, sb, command, workDir, kubeconfig)
+	}
+
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
 		cmd = exec.CommandContext(ctx, os.Getenv("COMSPEC"), "/c", command)
@@ -143,6 +152,11 @@ type ExecResult struct {
 	StreamType string `json:"stream_type,omitempty"`
 }
 
+// ExitStatus returns the exit code of the command.
+func (e *ExecResult) ExitStatus() int {
+	return e.ExitCode
+}
+
 func (e *ExecResult) String() string {
 	return fmt.Sprintf("Command: %q\nError: %q\nStdout: %q\nStderr: %q\nExitCode: %d\nStreamType: %q}", e.Command, e.Error, e.Stdout, e.Stderr, e.ExitCode, e.StreamType)
 }
@@ -326,9 +340,34 @@ func (t *BashTool) CheckModifiesResource(args map[string]any) string {
 		return "unknown"
 	}
 
+	var results []string
 	if strings.Contains(command, "kubectl") {
-		return kubectlModifiesResource(command)
+		results = append(results, kubectlModifiesResource(command))
 	}
+	if strings.Contains(command, "helm") {
+		if result := analyzeHelmCommand(command); result != "" {
+			results = append(results, result)
+		}
+	}
+
+	return combineModifiesResource(results...)
+}
 
-	return "unknown"
+// combineModifiesResource merges the classifications of the parts of a command:
+// any "yes" wins, and the command is only read-only if every part is.
+func combineModifiesResource(results ...string) string {
+	if len(results) == 0 {
+		return "unknown"
+	}
+	combined := "no"
+	for _, result := range results {
+		switch result {
+		case "yes":
+			return "yes"
+		case "no":
+		default:
+			combined = "unknown"
+		}
+	}
+	return combined
 }
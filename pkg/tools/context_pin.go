@@ -0,0 +1,325 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/kubeconfig"
+	"k8s.io/klog/v2"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// ErrContextSwitch is returned for tool calls that would act on a cluster other than
+// the ones the session is pinned to, or change which cluster later calls act on.
+var ErrContextSwitch = errors.New("refused: the session is pinned to a kubeconfig context")
+
+// kubectlConfigReadOnly are the "kubectl config" sub-commands that do not rewrite the kubeconfig.
+var kubectlConfigReadOnly = stringSet("current-context", "get-clusters", "get-contexts", "get-users", "view")
+
+// kubectlTargetFlags select a cluster or kubeconfig without going through a context.
+var kubectlTargetFlags = []string{"kubeconfig", "cluster", "server"}
+
+// helmTargetFlags select a cluster or kubeconfig for helm.
+var helmTargetFlags = []string{"--kubeconfig", "--kube-apiserver"}
+
+// kubectlIdentityFlags and helmIdentityFlags select the identity commands run as.
+var (
+	kubectlIdentityFlags = []string{"as", "as-group", "as-uid", "user", "token", "username", "password", "client-certificate", "client-key"}
+	helmIdentityFlags    = []string{"--kube-as-user", "--kube-as-group", "--kube-token"}
+)
+
+// shells run the script given with -c; the context pin checks that script too.
+var shells = stringSet("sh", "bash", "zsh", "dash", "ksh")
+
+// contextSwitchers are programs whose only job is to switch the kubeconfig context or namespace.
+var contextSwitchers = stringSet("kubectx", "kubens")
+
+// ContextPin pins the tool calls of a session to a kubeconfig context.
+type ContextPin struct {
+	// Context is the context the session is pinned to; commands run against it by default.
+	Context string
+	// Allowed are glob patterns of other contexts that commands may select with --context.
+	Allowed []string
+	// Identity refuses flags that change the identity commands run as (e.g. --as or --token),
+	// for sessions that run commands as a dedicated least-privilege identity.
+	// Commands may then not reference kubeconfig files either, as they hold other credentials.
+	Identity bool
+	// CredentialFiles are kubeconfig files holding credentials other than the identity's,
+	// e.g. the user's own kubeconfig, which commands of an Identity session may not reference.
+	CredentialFiles []string
+}
+
+// Allows returns true if commands may target the context.
+func (p *ContextPin) Allows(context string) bool {
+	if context == p.Context {
+		return true
+	}
+	for _, pattern := range p.Allowed {
+		if ok, _ := path.Match(pattern, context); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error wrapping ErrContextSwitch if the tool call targets a context that is
+// not allowed, points kubectl or helm at another kubeconfig or cluster, or rewrites the kubeconfig.
+// A nil ContextPin allows everything.
+func (p *ContextPin) Check(tool Tool, args map[string]any) error {
+	if p == nil {
+		return nil
+	}
+	command, _ := args["command"].(string)
+	switch tool := tool.(type) {
+	case *Kubectl, *BashTool, *Helm:
+	case *CustomTool:
+		var err error
+		if command, err = tool.addCommandPrefix(command); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		// The tool will fail to run it too.
+		klog.V(2).Infof("checking kubeconfig context: cannot parse %q: %v", command, err)
+		return nil
+	}
+	return p.checkScript(file)
+}
+
+// checkScript checks every command of a parsed shell script.
+func (p *ContextPin) checkScript(file *syntax.File) error {
+	var problem error
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if problem != nil {
+			return false
+		}
+		switch node := node.(type) {
+		case *syntax.Assign:
+			if node.Name != nil && node.Name.Value == "KUBECONFIG" {
+				problem = fmt.Errorf("%w: setting KUBECONFIG is not allowed", ErrContextSwitch)
+			}
+		case *syntax.Redirect:
+			if node.Word != nil && isKubeconfigPath(wordValue(node.Word.Parts)) {
+				problem = fmt.Errorf("%w: writing to the kubeconfig is not allowed", ErrContextSwitch)
+			}
+		case *syntax.Word:
+			if p.Identity && p.referencesCredentials(wordValue(node.Parts)) {
+				problem = fmt.Errorf("%w: reading kubeconfig files is not allowed, commands run as the identity configured for the session", ErrContextSwitch)
+			}
+		case *syntax.CallExpr:
+			if len(node.Args) > 0 {
+				problem = p.checkCall(callArgs(node))
+			}
+		}
+		return true
+	})
+	return problem
+}
+
+func (p *ContextPin) checkCall(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	program := filepath.Base(args[0])
+
+	switch wrapper, isWrapper := wrapperPrograms[program]; {
+	case isWrapper:
+		return p.checkWrapper(program, wrapper, args)
+	case shells[program]:
+		for i, arg := range args[1:] {
+			if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "c") {
+				if i+2 >= len(args) {
+					return nil
+				}
+				return p.checkNestedScript(args[i+2])
+			}
+		}
+	case program == "eval":
+		return p.checkNestedScript(strings.Join(args[1:], " "))
+	case contextSwitchers[program]:
+		return fmt.Errorf("%w: %s rewrites the kubeconfig", ErrContextSwitch, program)
+	case isKubectlBinary(args[0]):
+		inv := ParseKubectlArgs(args[1:])
+		if inv.Verb == "config" && !kubectlConfigReadOnly[inv.SubVerb] {
+			return fmt.Errorf("%w: %q rewrites the kubeconfig", ErrContextSwitch, strings.Join(args, " "))
+		}
+		if inv.Context != "" && !p.Allows(inv.Context) {
+			return fmt.Errorf("%w: context %q is not allowed, only %s", ErrContextSwitch, inv.Context, p.describeAllowed())
+		}
+		for _, flag := range kubectlTargetFlags {
+			if _, ok := inv.Flags[flag]; ok {
+				return fmt.Errorf("%w: --%s is not allowed, use --context to select one of %s", ErrContextSwitch, flag, p.describeAllowed())
+			}
+		}
+		if p.Identity {
+			for _, flag := range kubectlIdentityFlags {
+				if _, ok := inv.Flags[flag]; ok {
+					return fmt.Errorf("%w: --%s is not allowed, commands run as the identity configured for the session", ErrContextSwitch, flag)
+				}
+			}
+		}
+	case program == "helm":
+		for i, arg := range args[1:] {
+			name, value, _ := strings.Cut(arg, "=")
+			if name == "--kube-context" {
+				if value == "" && i+2 < len(args) {
+					value = args[i+2]
+				}
+				if !p.Allows(value) {
+					return fmt.Errorf("%w: context %q is not allowed, only %s", ErrContextSwitch, value, p.describeAllowed())
+				}
+			}
+			for _, flag := range helmTargetFlags {
+				if name == flag {
+					return fmt.Errorf("%w: %s is not allowed, use --kube-context to select one of %s", ErrContextSwitch, flag, p.describeAllowed())
+				}
+			}
+			if p.Identity && slices.Contains(helmIdentityFlags, name) {
+				return fmt.Errorf("%w: %s is not allowed, commands run as the identity configured for the session", ErrContextSwitch, name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkWrapper checks a call of a wrapper program such as env, sudo or timeout:
+// the variables it sets, and the command it runs.
+func (p *ContextPin) checkWrapper(program string, wrapper wrapperProgram, args []string) error {
+	command := wrapper.command(args[1:])
+	for _, arg := range args[1 : len(args)-len(command)] {
+		switch {
+		case program == "env" && (arg == "-S" || strings.HasPrefix(arg, "--split-string")):
+			return fmt.Errorf("%w: cannot check the command run by %q", ErrContextSwitch, strings.Join(args, " "))
+		case strings.HasPrefix(arg, "KUBECONFIG="):
+			return fmt.Errorf("%w: setting KUBECONFIG is not allowed", ErrContextSwitch)
+		}
+	}
+	if program == "watch" && len(command) > 0 {
+		// watch runs its arguments with sh -c
+		return p.checkNestedScript(strings.Join(command, " "))
+	}
+	return p.checkCall(command)
+}
+
+// checkNestedScript checks a script run by a nested shell (e.g. "bash -c" or eval).
+// Scripts that are built at run time or cannot be parsed are refused, as they cannot be checked.
+func (p *ContextPin) checkNestedScript(script string) error {
+	if strings.ContainsAny(script, "$`") {
+		return fmt.Errorf("%w: cannot check the nested command %q, run it directly instead", ErrContextSwitch, script)
+	}
+	file, err := syntax.NewParser().Parse(strings.NewReader(script), "")
+	if err != nil {
+		return fmt.Errorf("%w: cannot check the nested command %q, run it directly instead", ErrContextSwitch, script)
+	}
+	return p.checkScript(file)
+}
+
+// referencesCredentials returns true if a word of a command refers to a kubeconfig file
+// holding credentials other than the identity's.
+func (p *ContextPin) referencesCredentials(word string) bool {
+	if strings.Contains(word, ".kube") {
+		return true
+	}
+	for _, file := range p.CredentialFiles {
+		if file != "" && strings.Contains(word, file) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ContextPin) describeAllowed() string {
+	allowed := []string{fmt.Sprintf("%q", p.Context)}
+	for _, pattern := range p.Allowed {
+		allowed = append(allowed, fmt.Sprintf("%q", pattern))
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// isKubeconfigPath returns true for paths that look like a kubeconfig file.
+func isKubeconfigPath(p string) bool {
+	return strings.Contains(p, ".kube/config") || strings.Contains(p, "KUBECONFIG")
+}
+
+// TargetContexts returns the contexts the kubectl calls of a tool call act on:
+// the ones given with --context, or defaultContext.
+func (t *ToolCall) TargetContexts(defaultContext string) []string {
+	var contexts []string
+	seen := map[string]bool{}
+	for _, inv := range t.KubectlInvocations() {
+		context := inv.Context
+		if context == "" {
+			context = defaultContext
+		}
+		if context != "" && !seen[context] {
+			seen[context] = true
+			contexts = append(contexts, context)
+		}
+	}
+	if len(contexts) == 0 && defaultContext != "" {
+		contexts = append(contexts, defaultContext)
+	}
+	return contexts
+}
+
+// KubeContextServer returns the API server URL of a context of a kubeconfig, or "" if it is not known.
+func KubeContextServer(path string, context string) string {
+	config, err := kubeconfig.Load(path)
+	if err != nil {
+		klog.V(2).Infof("reading kubeconfig: %v", err)
+		return ""
+	}
+	server, err := config.ContextServer(context)
+	if err != nil {
+		klog.V(2).Infof("reading server of context %q: %v", context, err)
+		return ""
+	}
+	return server
+}
+
+// KubeContextNamespace returns the namespace commands act on in a context of a kubeconfig when
+// they do not pass -n: the namespace of the context, or "default". It returns "" if it is not known.
+func KubeContextNamespace(path string, context string) string {
+	config, err := kubeconfig.Load(path)
+	if err != nil {
+		klog.V(2).Infof("reading kubeconfig: %v", err)
+		return ""
+	}
+	namespace, err := config.ContextNamespace(context)
+	if err != nil {
+		klog.V(2).Infof("reading namespace of context %q: %v", context, err)
+		return ""
+	}
+	if namespace == "" {
+		return "default"
+	}
+	return namespace
+}
@@ -0,0 +1,140 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestContextPinCheck(t *testing.T) {
+	pin := &ContextPin{Context: "prod-eu", Allowed: []string{"staging-*"}}
+
+	tests := []struct {
+		name    string
+		tool    Tool
+		command string
+		wantErr bool
+	}{
+		{"default context", &Kubectl{}, "kubectl get pods -n web", false},
+		{"pinned context", &Kubectl{}, "kubectl --context prod-eu get pods", false},
+		{"allowed context", &Kubectl{}, "kubectl get pods --context=staging-us", false},
+		{"other context", &Kubectl{}, "kubectl get pods --context=prod-us", true},
+		{"use-context", &Kubectl{}, "kubectl config use-context prod-us", true},
+		{"set-context", &BashTool{}, "kubectl config set-context --current --namespace=web", true},
+		{"view config", &BashTool{}, "kubectl config view --minify", false},
+		{"get contexts", &Kubectl{}, "kubectl config get-contexts", false},
+		{"kubeconfig flag", &Kubectl{}, "kubectl --kubeconfig /tmp/other get pods", true},
+		{"server flag", &Kubectl{}, "kubectl -s https://10.0.0.1:6443 get pods", true},
+		{"KUBECONFIG prefix", &BashTool{}, "KUBECONFIG=/tmp/other kubectl get pods", true},
+		{"export KUBECONFIG", &BashTool{}, "export KUBECONFIG=/tmp/other; kubectl get pods", true},
+		{"env KUBECONFIG", &BashTool{}, "env KUBECONFIG=/root/.kube/config kubectl delete ns x", true},
+		{"env other context", &BashTool{}, "env -i PATH=/usr/bin kubectl --context prod-us get pods", true},
+		{"env allowed", &BashTool{}, "env LANG=C kubectl get pods", false},
+		{"bash -c other context", &BashTool{}, "bash -c 'kubectl --context prod delete ns x'", true},
+		{"sh -c kubeconfig", &BashTool{}, `sh -ec "KUBECONFIG=/tmp/other kubectl get pods"`, true},
+		{"bash -c dynamic", &BashTool{}, `bash -c "$CMD"`, true},
+		{"bash -c allowed", &BashTool{}, "bash -c 'kubectl get pods | wc -l'", false},
+		{"eval other context", &BashTool{}, `eval "kubectl --context prod get pods"`, true},
+		{"write kubeconfig", &BashTool{}, "cat new.yaml > ~/.kube/config", true},
+		{"kubectx", &BashTool{}, "kubectx prod-us", true},
+		{"helm other context", &Helm{}, "helm list --kube-context prod-us", true},
+		{"helm allowed context", &Helm{}, "helm list --kube-context=staging-eu", false},
+		{"helm kubeconfig", &Helm{}, "helm list --kubeconfig /tmp/other", true},
+		{"pipeline", &BashTool{}, "kubectl get pods -o name | grep web | head -1", false},
+		{"env split string", &BashTool{}, "env -S 'kubectl --context prod get pods'", true},
+		{"command other context", &BashTool{}, "command kubectl --context prod delete ns x", true},
+		{"xargs other context", &BashTool{}, "echo x | xargs kubectl --context prod delete ns", true},
+		{"timeout other context", &BashTool{}, "timeout 5 kubectl --context prod get pods", true},
+		{"nested wrappers other context", &BashTool{}, "sudo -u admin nice -n 5 nohup kubectl --context prod get pods", true},
+		{"sudo KUBECONFIG", &BashTool{}, "sudo KUBECONFIG=/tmp/other kubectl get pods", true},
+		{"watch other context", &BashTool{}, "watch -n 5 'kubectl --context prod get pods'", true},
+		{"exec helm other context", &BashTool{}, "exec helm list --kube-context prod-us", true},
+		{"versioned kubectl other context", &BashTool{}, "kubectl.1.28 --context prod delete ns x", true},
+		{"wrapper allowed", &BashTool{}, "timeout 5 kubectl --context staging-us get pods", false},
+		{"watch allowed", &BashTool{}, "watch kubectl get pods", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := pin.Check(tc.tool, map[string]any{"command": tc.command})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Check(%q) = %v, wantErr %v", tc.command, err, tc.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrContextSwitch) {
+				t.Errorf("Check(%q) = %v, want it to wrap ErrContextSwitch", tc.command, err)
+			}
+		})
+	}
+
+	var unpinned *ContextPin
+	if err := unpinned.Check(&Kubectl{}, map[string]any{"command": "kubectl config use-context prod-us"}); err != nil {
+		t.Errorf("nil ContextPin Check() = %v, want nil", err)
+	}
+}
+
+func TestTargetContexts(t *testing.T) {
+	call := &ToolCall{tool: &BashTool{}, name: "bash", arguments: map[string]any{
+		"command": "kubectl get pods && kubectl --context staging-us get pods",
+	}}
+	got := call.TargetContexts("prod-eu")
+	if want := []string{"prod-eu", "staging-us"}; !slices.Equal(got, want) {
+		t.Errorf("TargetContexts() = %v, want %v", got, want)
+	}
+}
+
+func TestContextPinCheckIdentity(t *testing.T) {
+	pin := &ContextPin{Context: "prod", Identity: true}
+	for _, command := range []string{
+		"kubectl get secrets --as=system:admin",
+		"kubectl get pods --as-group system:masters",
+		"kubectl --token abc get pods",
+		"helm list --kube-as-user admin",
+	} {
+		if err := pin.Check(&BashTool{}, map[string]any{"command": command}); !errors.Is(err, ErrContextSwitch) {
+			t.Errorf("Check(%q) = %v, want ErrContextSwitch", command, err)
+		}
+	}
+	if err := pin.Check(&Kubectl{}, map[string]any{"command": "kubectl auth can-i --list"}); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+}
+
+func TestContextPinCheckIdentityCredentialFiles(t *testing.T) {
+	pin := &ContextPin{Context: "prod", Identity: true, CredentialFiles: []string{"/srv/admin.kubeconfig"}}
+	for _, command := range []string{
+		"cat ~/.kube/config",
+		"grep token $HOME/.kube/config",
+		"cd ~/.kube && cat config",
+		"cp /srv/admin.kubeconfig /tmp/x",
+		"bash -c 'cat /srv/admin.kubeconfig'",
+	} {
+		if err := pin.Check(&BashTool{}, map[string]any{"command": command}); !errors.Is(err, ErrContextSwitch) {
+			t.Errorf("Check(%q) = %v, want ErrContextSwitch", command, err)
+		}
+	}
+	if err := pin.Check(&BashTool{}, map[string]any{"command": "kubectl get pods -o yaml > pods.yaml"}); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+
+	// Without a dedicated identity, reading the kubeconfig is no escalation.
+	pin.Identity = false
+	if err := pin.Check(&BashTool{}, map[string]any{"command": "cat ~/.kube/config"}); err != nil {
+		t.Errorf("Check() without identity = %v, want nil", err)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/st-lzh/kubelet-wuhrai/gollm"
@@ -35,6 +36,8 @@ type CustomToolConfig struct {
 	Command       string `yaml:"command"`
 	CommandDesc   string `yaml:"command_desc"`
 	IsInteractive bool   `yaml:"is_interactive"`
+	// CommandChoices, if set, are the only commands the tool accepts; the model is given them as choices.
+	CommandChoices []string `yaml:"command_choices"`
 }
 
 // CustomTool implements the Tool interface for external commands.
@@ -66,6 +69,10 @@ func (t *CustomTool) Description() string {
 
 // FunctionDefinition returns the tool's function definition.
 func (t *CustomTool) FunctionDefinition() *gollm.FunctionDefinition {
+	var choices []any
+	for _, choice := range t.config.CommandChoices {
+		choices = append(choices, choice)
+	}
 	return &gollm.FunctionDefinition{
 		Name:        t.Name(),
 		Description: t.Description(),
@@ -75,9 +82,11 @@ func (t *CustomTool) FunctionDefinition() *gollm.FunctionDefinition {
 				"command": {
 					Type:        gollm.TypeString,
 					Description: t.config.CommandDesc,
+					Enum:        choices,
 				},
 				"modifies_resource": {
 					Type: gollm.TypeString,
+					Enum: []any{"yes", "no", "unknown"},
 					Description: `Whether the command modifies a resource.
 Possible values:
 - "yes" if the command modifies a resource
@@ -133,6 +142,9 @@ func (t *CustomTool) Run(ctx context.Context, args map[string]any) (any, error)
 		return nil, fmt.Errorf("command not found in args")
 	}
 	command = cmdVal.(string)
+	if len(t.config.CommandChoices) > 0 && !slices.Contains(t.config.CommandChoices, command) {
+		return nil, fmt.Errorf("command %q is not one of the choices of tool %s: %s", command, t.Name(), strings.Join(t.config.CommandChoices, ", "))
+	}
 
 	command, err := t.addCommandPrefix(command)
 	if err != nil {
@@ -141,6 +153,11 @@ func (t *CustomTool) Run(ctx context.Context, args map[string]any) (any, error)
 
 	workDir := ctx.Value(WorkDirKey).(string)
 
+	if sb := sandboxFor(ctx, t.Name()); sb != nil {
+		kubeconfig, _ := ctx.Value(KubeconfigKey).(string)
+		return runSandboxed(ctx, sb, command, workDir, kubeconfig)
+	}
+
 	cmd := exec.CommandContext(ctx, lookupBashBin(), "-c", command)
 	cmd.Dir = workDir
 	cmd.Env = os.Environ()
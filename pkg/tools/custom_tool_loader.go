@@ -0,0 +1,287 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// CustomToolLoader loads custom tools from config files and directories,
+// and re-registers them when the files change.
+type CustomToolLoader struct {
+	tools *Tools
+	paths []string
+
+	mutex sync.Mutex
+
+	// loaded maps each config file to the names of the tools it registered.
+	loaded map[string][]string
+
+	// modTimes holds the config files and their modification times as of the last scan.
+	modTimes map[string]time.Time
+}
+
+// NewCustomToolLoader creates a loader that registers custom tools from paths into tools.
+// Each path may be a YAML file or a directory of YAML files.
+func NewCustomToolLoader(tools *Tools, paths []string) *CustomToolLoader {
+	return &CustomToolLoader{
+		tools:    tools,
+		paths:    paths,
+		loaded:   make(map[string][]string),
+		modTimes: make(map[string]time.Time),
+	}
+}
+
+// ReloadResult describes the outcome of (re)loading custom tools.
+type ReloadResult struct {
+	Added   []string
+	Updated []string
+	Removed []string
+
+	// Errors holds one entry per file or tool that could not be loaded.
+	// Tools that previously loaded successfully are kept when their new definition is invalid.
+	Errors []error
+}
+
+// Changed returns true if any tool was added, updated or removed.
+func (r *ReloadResult) Changed() bool {
+	return len(r.Added) > 0 || len(r.Updated) > 0 || len(r.Removed) > 0
+}
+
+// Err returns the combined loading errors, or nil if there were none.
+func (r *ReloadResult) Err() error {
+	return errors.Join(r.Errors...)
+}
+
+func (r *ReloadResult) String() string {
+	var sb strings.Builder
+	if len(r.Added) > 0 {
+		fmt.Fprintf(&sb, "added: %s\n", strings.Join(r.Added, ", "))
+	}
+	if len(r.Updated) > 0 {
+		fmt.Fprintf(&sb, "updated: %s\n", strings.Join(r.Updated, ", "))
+	}
+	if len(r.Removed) > 0 {
+		fmt.Fprintf(&sb, "removed: %s\n", strings.Join(r.Removed, ", "))
+	}
+	if !r.Changed() {
+		sb.WriteString("no changes\n")
+	}
+	for _, err := range r.Errors {
+		fmt.Fprintf(&sb, "error: %v\n", err)
+	}
+	return sb.String()
+}
+
+// Reload reads all config files and brings the registered custom tools in line with them.
+func (l *CustomToolLoader) Reload() *ReloadResult {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	result := &ReloadResult{}
+
+	files, modTimes := l.scan()
+	l.modTimes = modTimes
+
+	// previous maps each tool name we registered to the file that defined it
+	previous := make(map[string]string)
+	for file, names := range l.loaded {
+		for _, name := range names {
+			previous[name] = file
+		}
+	}
+
+	loaded := make(map[string][]string)
+	// seen maps each tool name registered in this pass to the file that defined it
+	seen := make(map[string]string)
+
+	for _, file := range files {
+		configs, err := readCustomToolConfigs(file)
+		if err != nil {
+			// Keep whatever this file registered last time, rather than dropping working tools.
+			result.Errors = append(result.Errors, err)
+			for _, name := range l.loaded[file] {
+				seen[name] = file
+			}
+			loaded[file] = l.loaded[file]
+			continue
+		}
+
+		for _, config := range configs {
+			if other, ok := seen[config.Name]; ok {
+				result.Errors = append(result.Errors, fmt.Errorf("%s: tool %q already defined in %s, skipping", file, config.Name, other))
+				continue
+			}
+
+			_, ownedByUs := previous[config.Name]
+
+			tool, err := NewCustomTool(config)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("%s: failed to create tool %q: %w", file, config.Name, err))
+				if ownedByUs && config.Name != "" {
+					// keep the previous working definition
+					seen[config.Name] = file
+					loaded[file] = append(loaded[file], config.Name)
+				}
+				continue
+			}
+
+			existing := l.tools.registered(tool.Name())
+			if existing != nil && !ownedByUs {
+				result.Errors = append(result.Errors, fmt.Errorf("%s: tool %q already registered (possibly built-in), skipping custom definition", file, tool.Name()))
+				continue
+			}
+
+			if err := l.tools.ReplaceTool(tool); err != nil {
+				if errors.Is(err, ErrToolFiltered) {
+					klog.V(2).Infof("custom tool %q from %s is excluded by the tool filter", tool.Name(), file)
+				} else {
+					result.Errors = append(result.Errors, fmt.Errorf("%s: %w", file, err))
+				}
+				continue
+			}
+
+			switch {
+			case existing == nil:
+				result.Added = append(result.Added, tool.Name())
+			case !sameCustomTool(existing, tool):
+				result.Updated = append(result.Updated, tool.Name())
+			}
+
+			seen[tool.Name()] = file
+			loaded[file] = append(loaded[file], tool.Name())
+		}
+	}
+
+	for name := range previous {
+		if _, ok := seen[name]; !ok {
+			l.tools.UnregisterTool(name)
+			result.Removed = append(result.Removed, name)
+		}
+	}
+
+	l.loaded = loaded
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	sort.Strings(result.Removed)
+	return result
+}
+
+// Watch polls the config paths every interval, and reloads the custom tools when a file is
+// added, removed or modified. onReload is called after each reload that was triggered by a change.
+// Watch blocks until ctx is cancelled.
+func (l *CustomToolLoader) Watch(ctx context.Context, interval time.Duration, onReload func(*ReloadResult)) {
+	log := klog.FromContext(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		l.mutex.Lock()
+		_, modTimes := l.scan()
+		changed := !maps.Equal(modTimes, l.modTimes)
+		l.mutex.Unlock()
+
+		if !changed {
+			continue
+		}
+
+		log.Info("custom tool configuration changed, reloading")
+		result := l.Reload()
+		if onReload != nil {
+			onReload(result)
+		}
+	}
+}
+
+// scan lists the config files under the loader's paths, along with their modification times.
+func (l *CustomToolLoader) scan() ([]string, map[string]time.Time) {
+	modTimes := make(map[string]time.Time)
+	for _, path := range l.paths {
+		collectConfigFiles(path, modTimes)
+	}
+	files := slices.Sorted(maps.Keys(modTimes))
+	return files, modTimes
+}
+
+func collectConfigFiles(path string, into map[string]time.Time) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Warningf("failed to describe custom tools path %s: %v", path, err)
+		}
+		return
+	}
+
+	if !info.IsDir() {
+		into[path] = info.ModTime()
+		return
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		klog.Warningf("failed to read custom tools dir %s: %v", path, err)
+		return
+	}
+	for _, entry := range entries {
+		collectConfigFiles(filepath.Join(path, entry.Name()), into)
+	}
+}
+
+// readCustomToolConfigs parses a custom tool config file.
+func readCustomToolConfigs(path string) ([]CustomToolConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var configs []CustomToolConfig
+	if err := yaml.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML config file %s: %w", path, err)
+	}
+	return configs, nil
+}
+
+func sameCustomTool(existing Tool, tool *CustomTool) bool {
+	existingCustomTool, ok := existing.(*CustomTool)
+	if !ok {
+		return false
+	}
+	return reflect.DeepEqual(existingCustomTool.config, tool.config)
+}
@@ -0,0 +1,162 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func mustRegister(t *testing.T, registry *Tools, tool Tool) {
+	t.Helper()
+	if err := registry.RegisterTool(tool); err != nil {
+		t.Fatalf("registering %s: %v", tool.Name(), err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+func TestCustomToolLoader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "tools.yaml")
+
+	registry := NewTools()
+	mustRegister(t, registry, &BashTool{})
+
+	loader := NewCustomToolLoader(registry, []string{dir})
+
+	writeFile(t, configPath, `
+- name: gcloud
+  description: gcloud cli
+  command: gcloud
+- name: helm
+  description: helm cli
+  command: helm
+`)
+	result := loader.Reload()
+	if err := result.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(result.Added, []string{"gcloud", "helm"}) {
+		t.Errorf("expected gcloud and helm to be added, got %v", result.Added)
+	}
+
+	// Update one tool, drop another
+	writeFile(t, configPath, `
+- name: gcloud
+  description: Google Cloud CLI
+  command: gcloud
+`)
+	result = loader.Reload()
+	if !slices.Equal(result.Updated, []string{"gcloud"}) {
+		t.Errorf("expected gcloud to be updated, got %v", result.Updated)
+	}
+	if !slices.Equal(result.Removed, []string{"helm"}) {
+		t.Errorf("expected helm to be removed, got %v", result.Removed)
+	}
+	if got := registry.Lookup("gcloud").Description(); got != "Google Cloud CLI" {
+		t.Errorf("expected updated description, got %q", got)
+	}
+
+	// Invalid YAML must not drop the working tools
+	writeFile(t, configPath, "- name: [broken")
+	result = loader.Reload()
+	if result.Err() == nil {
+		t.Errorf("expected an error for invalid YAML")
+	}
+	if result.Changed() {
+		t.Errorf("expected no changes for invalid YAML, got %s", result)
+	}
+	if registry.Lookup("gcloud") == nil {
+		t.Errorf("expected gcloud to still be registered")
+	}
+
+	// An invalid tool is reported on its own, keeping its previous definition
+	writeFile(t, configPath, `
+- name: gcloud
+  description: no command
+- name: bash
+  description: shadows a built-in
+  command: bash
+- name: kubectx
+  description: switch contexts
+  command: kubectx
+`)
+	result = loader.Reload()
+	if len(result.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %v", result.Errors)
+	}
+	if !slices.Equal(result.Added, []string{"kubectx"}) {
+		t.Errorf("expected kubectx to be added, got %v", result.Added)
+	}
+	if got := registry.Lookup("gcloud").Description(); got != "Google Cloud CLI" {
+		t.Errorf("expected previous gcloud definition to be kept, got %q", got)
+	}
+	if _, ok := registry.Lookup("bash").(*BashTool); !ok {
+		t.Errorf("expected built-in bash tool to be kept")
+	}
+
+	// Removing the file unregisters its tools, but never built-ins
+	if err := os.Remove(configPath); err != nil {
+		t.Fatal(err)
+	}
+	result = loader.Reload()
+	if !slices.Equal(result.Removed, []string{"gcloud", "kubectx"}) {
+		t.Errorf("expected gcloud and kubectx to be removed, got %v", result.Removed)
+	}
+	if !slices.Equal(registry.Names(), []string{"bash"}) {
+		t.Errorf("expected only bash to remain, got %v", registry.Names())
+	}
+}
+
+func TestTools_SetEnabled(t *testing.T) {
+	registry := NewTools()
+	mustRegister(t, registry, &BashTool{})
+	mustRegister(t, registry, &Kubectl{})
+
+	if err := registry.SetEnabled("bash", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.Lookup("bash") != nil {
+		t.Errorf("expected disabled tool to be hidden from Lookup")
+	}
+	if !slices.Equal(registry.Names(), []string{"kubectl"}) {
+		t.Errorf("expected only kubectl to be enabled, got %v", registry.Names())
+	}
+	if !slices.Equal(registry.DisabledNames(), []string{"bash"}) {
+		t.Errorf("expected bash to be disabled, got %v", registry.DisabledNames())
+	}
+
+	if err := registry.SetEnabled("bash", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.Lookup("bash") == nil {
+		t.Errorf("expected re-enabled tool to be visible")
+	}
+
+	if err := registry.SetEnabled("nope", false); err == nil {
+		t.Errorf("expected an error for an unknown tool")
+	}
+}
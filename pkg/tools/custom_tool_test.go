@@ -18,6 +18,8 @@
 package tools
 
 import (
+	"context"
+	"slices"
 	"testing"
 )
 
@@ -114,3 +116,26 @@ func TestCustomTool_AddCommandPrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomTool_CommandChoices(t *testing.T) {
+	tool, err := NewCustomTool(CustomToolConfig{
+		Name:           "nodes",
+		Command:        "kubectl",
+		CommandChoices: []string{"get nodes", "top nodes"},
+	})
+	if err != nil {
+		t.Fatalf("NewCustomTool: %v", err)
+	}
+
+	params := tool.FunctionDefinition().Parameters
+	if got := params.Properties["command"].Enum; !slices.Equal(got, []any{"get nodes", "top nodes"}) {
+		t.Errorf("command enum = %v, want the command choices", got)
+	}
+	if got := params.Properties["modifies_resource"].Enum; len(got) != 3 {
+		t.Errorf("modifies_resource enum = %v, want yes, no and unknown", got)
+	}
+
+	if _, err := tool.Run(context.Background(), map[string]any{"command": "delete nodes --all"}); err == nil {
+		t.Errorf("Run accepted a command that is not one of the choices")
+	}
+}
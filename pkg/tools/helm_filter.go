@@ -0,0 +1,170 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"path/filepath"
+	"strings"
+
+	"k8s.io/klog/v2"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// Package-level constants for helm operations
+var (
+	helmReadOnlyOps = map[string]bool{
+		"list": true, "ls": true, "status": true, "get": true,
+		"template": true, "history": true, "hist": true, "show": true,
+		"inspect": true, "search": true, "lint": true, "version": true,
+		"env": true, "help": true, "verify": true, "completion": true,
+		// These only touch local files (charts, repository config), not the cluster.
+		"repo": true, "dependency": true, "dep": true, "dependencies": true,
+		"pull": true, "fetch": true, "package": true, "create": true,
+	}
+
+	helmWriteOps = map[string]bool{
+		"install": true, "upgrade": true, "rollback": true,
+		"uninstall": true, "delete": true, "del": true, "un": true,
+		// helm test runs the chart's test pods in the cluster.
+		"test": true,
+	}
+
+	// helmFlagsWithValue are the global helm flags that take a separate value,
+	// so we can skip over them to find the verb.
+	helmFlagsWithValue = map[string]bool{
+		"-n": true, "--namespace": true, "--kube-context": true, "--kubeconfig": true,
+		"--kube-apiserver": true, "--kube-as-user": true, "--kube-as-group": true,
+		"--kube-ca-file": true, "--kube-token": true, "--kube-tls-server-name": true,
+		"--registry-config": true, "--repository-cache": true, "--repository-config": true,
+		"--burst-limit": true, "--qps": true,
+	}
+)
+
+// helmModifiesResource analyzes a helm command to determine if it modifies resources
+func helmModifiesResource(command string) string {
+	result := analyzeHelmCommand(command)
+	if result == "" {
+		// no helm calls found
+		result = "unknown"
+	}
+	klog.Infof("helmModifiesResource result: %s for command: %q", result, command)
+	return result
+}
+
+// analyzeHelmCommand classifies the helm calls in a shell command.
+// It returns "" if the command contains no helm calls.
+func analyzeHelmCommand(command string) string {
+	parser := syntax.NewParser()
+	file, err := parser.Parse(strings.NewReader(command), "")
+	if err != nil {
+		klog.Errorf("Failed to parse helm command: %v, command: %q", err, command)
+		return "unknown"
+	}
+
+	foundHelm := false
+	foundWrite := false
+	foundUnknown := false
+
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok {
+			switch analyzeHelmCall(unwrapCommand(callArgs(call))) {
+			case "yes":
+				foundHelm = true
+				foundWrite = true
+				return false
+			case "no":
+				foundHelm = true
+			case "unknown":
+				foundHelm = true
+				foundUnknown = true
+			}
+		}
+		return true
+	})
+
+	switch {
+	case !foundHelm:
+		return ""
+	case foundWrite:
+		return "yes"
+	case foundUnknown:
+		return "unknown"
+	default:
+		return "no"
+	}
+}
+
+// analyzeHelmCall classifies a single call. Calls of other programs return "",
+// so that e.g. "helm list | grep foo" is read-only.
+func analyzeHelmCall(args []string) string {
+	if len(args) == 0 || filepath.Base(args[0]) != "helm" {
+		return ""
+	}
+
+	verb := helmVerb(args)
+	if verb == "" {
+		klog.Warningf("analyzeHelmCall: no verb found after helm in args: %v", args)
+		return "unknown"
+	}
+
+	hasDryRun := helmDryRun(args)
+
+	if helmWriteOps[verb] && !hasDryRun {
+		klog.V(1).Infof("analyzeHelmCall: write op for verb=%q", verb)
+		return "yes"
+	}
+	if helmReadOnlyOps[verb] || (helmWriteOps[verb] && hasDryRun) {
+		klog.V(1).Infof("analyzeHelmCall: read op for verb=%q (dry-run=%v)", verb, hasDryRun)
+		return "no"
+	}
+
+	klog.V(1).Infof("analyzeHelmCall: unknown op for verb=%q", verb)
+	return "unknown"
+}
+
+// helmDryRun returns true if the call only simulates its changes. Only a bare --dry-run and the
+// values true, client and server are dry runs; e.g. --dry-run=false or --dry-run=none really run.
+// As with other flags, the last occurrence wins.
+func helmDryRun(args []string) bool {
+	dryRun := false
+	for _, arg := range args[1:] {
+		if arg == "--" {
+			break
+		}
+		if arg == "--dry-run" {
+			dryRun = true
+		} else if value, ok := strings.CutPrefix(arg, "--dry-run="); ok {
+			dryRun = value == "true" || value == "client" || value == "server"
+		}
+	}
+	return dryRun
+}
+
+// helmVerb returns the helm subcommand, skipping global flags.
+func helmVerb(args []string) string {
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			return arg
+		}
+		if helmFlagsWithValue[arg] {
+			i++
+		}
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"testing"
+)
+
+func TestHelmModifiesResource(t *testing.T) {
+	testCases := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{"List", "helm list -A", "no"},
+		{"List alias", "helm ls -n kube-system", "no"},
+		{"Status", "helm status my-release", "no"},
+		{"Get values", "helm get values my-release -o yaml", "no"},
+		{"Template", "helm template my-release ./chart", "no"},
+		{"History", "helm history my-release", "no"},
+		{"Show chart", "helm show values bitnami/nginx", "no"},
+		{"Repo update", "helm repo update", "no"},
+		{"Global flags before verb", "helm -n prod --kube-context staging list", "no"},
+		{"List with pipe", "helm list -A | grep failed", "no"},
+
+		{"Install", "helm install my-release bitnami/nginx", "yes"},
+		{"Upgrade install", "helm upgrade --install my-release ./chart -f values.yaml", "yes"},
+		{"Rollback", "helm rollback my-release 3", "yes"},
+		{"Uninstall", "helm uninstall my-release", "yes"},
+		{"Delete alias", "helm delete my-release", "yes"},
+		{"Test", "helm test my-release", "yes"},
+		{"Global flags before write verb", "helm --namespace prod upgrade my-release ./chart", "yes"},
+		{"Read then write", "helm status my-release && helm uninstall my-release", "yes"},
+
+		{"Install dry-run", "helm install my-release ./chart --dry-run", "no"},
+		{"Upgrade server dry-run", "helm upgrade my-release ./chart --dry-run=server", "no"},
+		{"Uninstall dry-run", "helm uninstall my-release --dry-run", "no"},
+		{"Upgrade client dry-run", "helm upgrade my-release ./chart --dry-run=client", "no"},
+		{"Upgrade dry-run false", "helm upgrade rel chart --dry-run=false", "yes"},
+		{"Upgrade dry-run none", "helm upgrade rel chart --dry-run=none", "yes"},
+		{"Install dry-run overridden", "helm install rel chart --dry-run --dry-run=false", "yes"},
+
+		{"Plugin", "helm plugin install https://github.com/databus23/helm-diff", "unknown"},
+		{"No verb", "helm --debug", "unknown"},
+		{"Not helm", "ls -la", "unknown"},
+		{"Read and unknown", "helm list; helm plugin list", "unknown"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := helmModifiesResource(tc.command); got != tc.expected {
+				t.Errorf("helmModifiesResource(%q) = %q, want %q", tc.command, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBashToolCheckModifiesResource_Helm(t *testing.T) {
+	testCases := []struct {
+		command  string
+		expected string
+	}{
+		{"helm list -A", "no"},
+		{"kubectl get pods -l app=helm-controller", "no"},
+		{"kubectl get pods && helm uninstall my-release", "yes"},
+		{"helm list && kubectl delete pod nginx", "yes"},
+		{"kubectl get pods; helm plugin list", "unknown"},
+	}
+
+	tool := &BashTool{}
+	for _, tc := range testCases {
+		if got := tool.CheckModifiesResource(map[string]any{"command": tc.command}); got != tc.expected {
+			t.Errorf("CheckModifiesResource(%q) = %q, want %q", tc.command, got, tc.expected)
+		}
+	}
+}
+
+func TestHelmStructuredOutputKind(t *testing.T) {
+	testCases := []struct {
+		command  string
+		expected helmOutputKind
+	}{
+		{"helm list -A -o json", helmOutputList},
+		{"helm ls --output=json", helmOutputList},
+		{"helm list -ojson", helmOutputList},
+		{"helm list -A", helmOutputNone},
+		{"helm list -o json | jq .", helmOutputNone},
+		{"helm history my-release", helmOutputHistory},
+		{"helm history my-release -o json", helmOutputHistory},
+		{"helm history my-release -o yaml", helmOutputNone},
+		{"helm status my-release -o json", helmOutputNone},
+		{"kubectl get pods -o json", helmOutputNone},
+	}
+
+	for _, tc := range testCases {
+		if got := helmStructuredOutputKind(tc.command); got != tc.expected {
+			t.Errorf("helmStructuredOutputKind(%q) = %v, want %v", tc.command, got, tc.expected)
+		}
+	}
+}
+
+func TestWithHelmJSONOutput(t *testing.T) {
+	testCases := []struct {
+		command  string
+		expected string
+	}{
+		{"helm history my-release", "helm history my-release --output json"},
+		{"helm history my-release # the web app", "helm history my-release --output json"},
+		{"helm history \\\n  my-release", "helm history \\\n\tmy-release --output json"},
+		{"helm -n prod history 'my release'", "helm -n prod history 'my release' --output json"},
+	}
+
+	for _, tc := range testCases {
+		got, ok := withHelmJSONOutput(tc.command)
+		if !ok || got != tc.expected {
+			t.Errorf("withHelmJSONOutput(%q) = %q, %v, want %q", tc.command, got, ok, tc.expected)
+		}
+	}
+
+	if _, ok := withHelmJSONOutput("helm history my-release | head"); ok {
+		t.Errorf("withHelmJSONOutput() changed a pipeline")
+	}
+}
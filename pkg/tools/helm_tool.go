@@ -0,0 +1,304 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"strings"
+
+	"github.com/st-lzh/kubelet-wuhrai/gollm"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/ui"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+func init() {
+	registerBuiltinTool(&Helm{})
+}
+
+type Helm struct{}
+
+func (t *Helm) Name() string {
+	return "helm"
+}
+
+func (t *Helm) Description() string {
+	return `Executes a helm command against the user's Kubernetes cluster. Use this tool to inspect and manage Helm releases and charts.
+
+The output of 'helm list -o json' and 'helm history' is returned as structured data (the "releases" and "history" fields).`
+}
+
+func (t *Helm) FunctionDefinition() *gollm.FunctionDefinition {
+	return &gollm.FunctionDefinition{
+		Name:        t.Name(),
+		Description: t.Description(),
+		Parameters: &gollm.Schema{
+			Type: gollm.TypeObject,
+			Properties: map[string]*gollm.Schema{
+				"command": {
+					Type: gollm.TypeString,
+					Description: `The complete helm command to execute. Please include the helm prefix as well.
+
+Examples:
+user: what releases are installed?
+assistant: helm list -A -o json
+
+user: what changed in the last upgrades of my-release?
+assistant: helm history my-release -n my-namespace
+
+user: what would upgrading my-release to chart version 2.0.0 change?
+assistant: helm upgrade my-release repo/chart --version 2.0.0 --dry-run`,
+				},
+				"modifies_resource": {
+					Type: gollm.TypeString,
+					Enum: []any{"yes", "no", "unknown"},
+					Description: `Whether the command modifies a kubernetes resource.
+Possible values:
+- "yes" if the command modifies a resource
+- "no" if the command does not modify a resource
+- "unknown" if the command's effect on the resource is unknown`},
+			},
+		},
+	}
+}
+
+func (t *Helm) Run(ctx context.Context, args map[string]any) (any, error) {
+	kubeconfig := ctx.Value(KubeconfigKey).(string)
+	workDir := ctx.Value(WorkDirKey).(string)
+
+	commandVal, ok := args["command"]
+	if !ok || commandVal == nil {
+		return &ExecResult{Error: "helm command not provided or is nil"}, nil
+	}
+	command, ok := commandVal.(string)
+	if !ok {
+		return &ExecResult{Error: "helm command must be a string"}, nil
+	}
+
+	output := helmStructuredOutputKind(command)
+	if output == helmOutputHistory && !hasHelmOutputFlag(command) {
+		// ask for JSON, so we can return the history as structured data
+		if withJSON, ok := withHelmJSONOutput(command); ok {
+			command = withJSON
+		} else {
+			output = helmOutputNone
+		}
+	}
+
+	// runKubectlCommand runs any shell command, with the kubeconfig injected
+	result, err := runKubectlCommand(ctx, t.Name(), command, workDir, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	helmResult := &HelmResult{ExecResult: *result}
+	if result.ExitCode != 0 || result.Error != "" {
+		return helmResult, nil
+	}
+	switch output {
+	case helmOutputList:
+		if err := json.Unmarshal([]byte(result.Stdout), &helmResult.Releases); err == nil {
+			helmResult.Stdout = ""
+		}
+	case helmOutputHistory:
+		if err := json.Unmarshal([]byte(result.Stdout), &helmResult.History); err == nil {
+			helmResult.Stdout = ""
+		}
+	}
+	return helmResult, nil
+}
+
+func (t *Helm) IsInteractive(args map[string]any) (bool, error) {
+	return false, nil
+}
+
+// CheckModifiesResource determines if the command modifies kubernetes resources
+// This is used for permission checks before command execution
+// Returns "yes", "no", or "unknown"
+func (t *Helm) CheckModifiesResource(args map[string]any) string {
+	command, ok := args["command"].(string)
+	if !ok {
+		return "unknown"
+	}
+
+	return helmModifiesResource(command)
+}
+
+// HelmRelease is a release, as printed by "helm list -o json".
+type HelmRelease struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Revision   string `json:"revision"`
+	Updated    string `json:"updated"`
+	Status     string `json:"status"`
+	Chart      string `json:"chart"`
+	AppVersion string `json:"app_version"`
+}
+
+// HelmRevision is a revision of a release, as printed by "helm history -o json".
+type HelmRevision struct {
+	Revision    int    `json:"revision"`
+	Updated     string `json:"updated"`
+	Status      string `json:"status"`
+	Chart       string `json:"chart"`
+	AppVersion  string `json:"app_version"`
+	Description string `json:"description"`
+}
+
+// HelmResult is the result of a helm command.
+// Releases or History are set (and Stdout is cleared) when the output could be parsed.
+type HelmResult struct {
+	ExecResult
+
+	Releases []HelmRelease  `json:"releases,omitempty"`
+	History  []HelmRevision `json:"history,omitempty"`
+}
+
+var _ ui.CanFormatAsHTML = &HelmResult{}
+
+func (r *HelmResult) FormatAsHTML() template.HTML {
+	var sb strings.Builder
+	switch {
+	case r.Releases != nil:
+		sb.WriteString("<table><tr><th>NAME</th><th>NAMESPACE</th><th>REVISION</th><th>UPDATED</th><th>STATUS</th><th>CHART</th><th>APP VERSION</th></tr>")
+		for _, release := range r.Releases {
+			writeHTMLRow(&sb, release.Name, release.Namespace, release.Revision, release.Updated, release.Status, release.Chart, release.AppVersion)
+		}
+		sb.WriteString("</table>")
+	case r.History != nil:
+		sb.WriteString("<table><tr><th>REVISION</th><th>UPDATED</th><th>STATUS</th><th>CHART</th><th>APP VERSION</th><th>DESCRIPTION</th></tr>")
+		for _, revision := range r.History {
+			writeHTMLRow(&sb, fmt.Sprint(revision.Revision), revision.Updated, revision.Status, revision.Chart, revision.AppVersion, revision.Description)
+		}
+		sb.WriteString("</table>")
+	default:
+		return r.ExecResult.FormatAsHTML()
+	}
+	return template.HTML(sb.String())
+}
+
+func writeHTMLRow(sb *strings.Builder, cells ...string) {
+	sb.WriteString("<tr>")
+	for _, cell := range cells {
+		sb.WriteString("<td>" + template.HTMLEscapeString(cell) + "</td>")
+	}
+	sb.WriteString("</tr>")
+}
+
+type helmOutputKind int
+
+const (
+	helmOutputNone helmOutputKind = iota
+	helmOutputList
+	helmOutputHistory
+)
+
+// helmStructuredOutputKind returns which structured output we can return for the command.
+// Only simple commands (a single helm call without pipes or redirects) qualify, and
+// "helm list" only when JSON output was requested.
+func helmStructuredOutputKind(command string) helmOutputKind {
+	args, ok := simpleHelmCall(command)
+	if !ok {
+		return helmOutputNone
+	}
+	switch helmVerb(args) {
+	case "list", "ls":
+		if helmOutputFormat(args) == "json" {
+			return helmOutputList
+		}
+	case "history", "hist":
+		if format := helmOutputFormat(args); format == "" || format == "json" {
+			return helmOutputHistory
+		}
+	}
+	return helmOutputNone
+}
+
+func hasHelmOutputFlag(command string) bool {
+	args, _ := simpleHelmCall(command)
+	return helmOutputFormat(args) != ""
+}
+
+// simpleHelmCall returns the arguments of command if it is a single helm call.
+func simpleHelmCall(command string) ([]string, bool) {
+	_, call, ok := parseSimpleHelmCall(command)
+	if !ok {
+		return nil, false
+	}
+	return callArgs(call), true
+}
+
+// parseSimpleHelmCall parses command, and returns its call if it is a single helm call.
+func parseSimpleHelmCall(command string) (*syntax.File, *syntax.CallExpr, bool) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil || len(file.Stmts) != 1 {
+		return nil, nil, false
+	}
+	stmt := file.Stmts[0]
+	if stmt.Background || stmt.Coprocess || stmt.Negated || len(stmt.Redirs) > 0 {
+		return nil, nil, false
+	}
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Assigns) > 0 {
+		return nil, nil, false
+	}
+	args := callArgs(call)
+	if len(args) == 0 || filepath.Base(args[0]) != "helm" {
+		return nil, nil, false
+	}
+	return file, call, true
+}
+
+// withHelmJSONOutput returns command with "--output json" added to its helm call.
+// The call is printed back from the parsed command, so comments and line continuations do not get in the way.
+func withHelmJSONOutput(command string) (string, bool) {
+	file, call, ok := parseSimpleHelmCall(command)
+	if !ok {
+		return "", false
+	}
+	for _, arg := range []string{"--output", "json"} {
+		call.Args = append(call.Args, &syntax.Word{Parts: []syntax.WordPart{&syntax.Lit{Value: arg}}})
+	}
+	var sb strings.Builder
+	if err := syntax.NewPrinter().Print(&sb, file); err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(sb.String()), true
+}
+
+// helmOutputFormat returns the value of the -o/--output flag, or "" if it is not set.
+func helmOutputFormat(args []string) string {
+	for i, arg := range args {
+		switch {
+		case arg == "-o" || arg == "--output":
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		case strings.HasPrefix(arg, "--output="):
+			return strings.TrimPrefix(arg, "--output=")
+		case strings.HasPrefix(arg, "-o="):
+			return strings.TrimPrefix(arg, "-o=")
+		case strings.HasPrefix(arg, "-o") && !strings.HasPrefix(arg, "--"):
+			return strings.TrimPrefix(arg, "-o")
+		}
+	}
+	return ""
+}
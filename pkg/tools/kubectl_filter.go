@@ -100,19 +100,8 @@ func analyzeCall(call *syntax.CallExpr) string {
 		return "unknown"
 	}
 
-	// Extract command and arguments
-	var args []string
-	for _, arg := range call.Args {
-		lit := arg.Lit()
-		if lit == "" {
-			var sb strings.Builder
-			syntax.NewPrinter().Print(&sb, arg)
-			lit = strings.Trim(sb.String(), `"'`)
-		}
-		if lit != "" {
-			args = append(args, lit)
-		}
-	}
+	// Extract command and arguments, of the program run by wrappers such as xargs
+	args := unwrapCommand(callArgs(call))
 
 	if len(args) == 0 {
 		klog.Warning("analyzeCall: no arguments extracted from call")
@@ -121,49 +110,51 @@ func analyzeCall(call *syntax.CallExpr) string {
 
 	// Check if first argument is kubectl
 	firstArg := args[0]
-
-	// Reject quoted arguments (e.g., '"/path/kubectl"')
-	if (strings.HasPrefix(firstArg, "'") && strings.HasSuffix(firstArg, "'")) || (strings.HasPrefix(firstArg, "\"") && strings.HasSuffix(firstArg, "\"")) {
-		klog.V(2).Infof("analyzeCall: first arg is quoted: %q", firstArg)
-		return "unknown"
-	}
-
-	// Check if this is kubectl
-	if !strings.Contains(firstArg, "kubectl") {
-		klog.V(2).Infof("analyzeCall: first arg does not contain kubectl: %q", firstArg)
+	if !isKubectlBinary(firstArg) {
+		klog.V(2).Infof("analyzeCall: first arg is not kubectl: %q", firstArg)
 		return "unknown"
 	}
 
 	klog.V(2).Infof("analyzeCall: found kubectl: %q", firstArg)
 
-	// Get the verb (first non-flag argument after kubectl)
-	verbPos := 1 // Start after kubectl at position 0
-	for verbPos < len(args) && strings.HasPrefix(args[verbPos], "-") {
-		verbPos++
-	}
-
-	if verbPos >= len(args) {
+	inv := ParseKubectlArgs(args[1:])
+	if inv.Verb == "" {
 		klog.Warningf("analyzeCall: no verb found after kubectl in args: %v", args)
 		return "unknown"
 	}
 
-	verb := args[verbPos]
-	hasDryRun := hasDryRunFlag(strings.Join(args, " "))
+	result := inv.ModifiesResource()
+	klog.V(1).Infof("analyzeCall: %s for verb=%q sub-verb=%q (dry-run=%q)", result, inv.Verb, inv.SubVerb, inv.DryRun)
+	return result
+}
 
-	// Check standard operations - write operations first (prioritize immediate detection)
-	if writeOps[verb] && !hasDryRun {
-		klog.V(1).Infof("analyzeCall: write op for verb=%q", verb)
-		return "yes"
+// callArgs returns the words of a shell call, with quoting removed.
+// Parts that are only known at run time (variables, command substitutions) are kept as written.
+func callArgs(call *syntax.CallExpr) []string {
+	var args []string
+	for _, arg := range call.Args {
+		if lit := wordValue(arg.Parts); lit != "" {
+			args = append(args, lit)
+		}
 	}
+	return args
+}
 
-	// Check read-only operations or dry-run write operations
-	if readOnlyOps[verb] || (writeOps[verb] && hasDryRun) {
-		klog.V(1).Infof("analyzeCall: read op for verb=%q (dry-run=%v)", verb, hasDryRun)
-		return "no"
+func wordValue(parts []syntax.WordPart) string {
+	var sb strings.Builder
+	for _, part := range parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			sb.WriteString(wordValue(part.Parts))
+		default:
+			syntax.NewPrinter().Print(&sb, part)
+		}
 	}
-
-	klog.V(1).Infof("analyzeCall: unknown op for verb=%q", verb)
-	return "unknown"
+	return sb.String()
 }
 
 func hasDryRunFlag(command string) bool {
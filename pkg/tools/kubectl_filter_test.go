@@ -71,7 +71,7 @@ func TestKubectlModifiesResource(t *testing.T) {
 			{"Set image", "kubectl set image deployment/nginx nginx=nginx:latest", "yes"},
 			{"Taint node", "kubectl taint nodes node1 key=value:NoSchedule", "yes"},
 			{"Run pod", "kubectl run nginx --image=nginx", "yes"},
-			{"Config set-context", "kubectl config set-context my-context", "no"},
+			{"Config set-context", "kubectl config set-context my-context", "yes"},
 			{"Exec command", "kubectl exec nginx -- ls", "unknown"},
 			{"Cordon node", "kubectl cordon node1", "yes"},
 			{"Uncordon node", "kubectl uncordon node1", "yes"},
@@ -120,10 +120,13 @@ func TestKubectlModifiesResource(t *testing.T) {
 			{"Create service account", "kubectl create serviceaccount jenkins", "yes"},
 			{"Create role binding", "kubectl create rolebinding admin --clusterrole=admin --user=user1 --namespace=default", "yes"},
 			{"Versioned kubectl", "kubectl.1.24 get pods", "no"},
-			{"Config set credentials", "kubectl config set-credentials cluster-admin --token=secret", "no"},
+			{"Delete through command", "command kubectl delete ns x", "yes"},
+			{"Delete through xargs", "kubectl get pods -o name | xargs kubectl delete", "yes"},
+			{"Get through timeout", "timeout 5 kubectl get pods", "no"},
+			{"Config set credentials", "kubectl config set-credentials cluster-admin --token=secret", "yes"},
 			{"Config view with flatten", "kubectl config view --flatten", "no"},
 			{"Config view with output", "kubectl config view -o json", "no"},
-			{"Config use-context", "kubectl config use-context production", "no"},
+			{"Config use-context", "kubectl config use-context production", "yes"},
 			{"Label with special characters", "kubectl label pod nginx 'app.kubernetes.io/name=nginx-controller'", "yes"},
 			{"Jsonpath with quotes", "kubectl get pods -o jsonpath='{.items[0].metadata.name}'", "no"},
 			{"Command with grep", "kubectl get pods | grep -v Completed", "no"},
@@ -0,0 +1,614 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// KubectlInvocation is a parsed kubectl command line.
+type KubectlInvocation struct {
+	// Verb is the kubectl command, e.g. "get" or "rollout".
+	Verb string
+	// SubVerb is the sub-command for commands that have them, e.g. "restart" for "rollout restart"
+	// or "deployment" for "create deployment".
+	SubVerb string
+
+	// Resources are the resource types the command operates on, as written (e.g. "deploy", "pods").
+	Resources []string
+	// Names are the names of the resources the command operates on.
+	Names []string
+
+	Namespace     string
+	AllNamespaces bool
+	Context       string
+
+	// DryRun is "client", "server", "none" or "" (not set).
+	DryRun string
+	// Output is the output format (-o/--output).
+	Output string
+	// PipedOutput is set if the output goes to another program (through a pipe or a command substitution)
+	// rather than straight to the tool result.
+	PipedOutput bool
+
+	Filenames []string
+	Selector  string
+	// All is set by --all, e.g. "kubectl delete pods --all".
+	All bool
+
+	// Args are the positional arguments after the verb (and sub-verb).
+	Args []string
+	// Flags holds all flags by long name (without dashes); flags without a value are "true".
+	Flags map[string]string
+}
+
+var (
+	// kubectlShortFlags maps shorthand flags to their long names.
+	kubectlShortFlags = map[string]string{
+		"n": "namespace", "o": "output", "f": "filename", "l": "selector",
+		"A": "all-namespaces", "c": "container", "k": "kustomize", "p": "patch",
+		"s": "server", "v": "v", "L": "label-columns", "e": "env",
+		"i": "stdin", "t": "tty", "w": "watch", "R": "recursive", "q": "quiet",
+	}
+
+	// kubectlValueFlags are the flags that take a value, which may be given as a separate argument.
+	// Other flags are boolean, or only take a value with "=" (e.g. --dry-run, --cascade, --validate).
+	kubectlValueFlags = map[string]bool{
+		// global flags
+		"namespace": true, "context": true, "kubeconfig": true, "cluster": true, "user": true,
+		"as": true, "as-group": true, "as-uid": true, "token": true, "server": true,
+		"certificate-authority": true, "client-certificate": true, "client-key": true,
+		"tls-server-name": true, "request-timeout": true, "cache-dir": true,
+		"log-file": true, "log-dir": true, "vmodule": true, "v": true,
+		"username": true, "password": true, "profile": true, "profile-output": true,
+
+		// command flags
+		"output": true, "filename": true, "selector": true, "field-selector": true,
+		"container": true, "kustomize": true, "patch": true, "type": true,
+		"replicas": true, "current-replicas": true, "image": true, "port": true,
+		"target-port": true, "protocol": true, "name": true, "timeout": true,
+		"for": true, "grace-period": true, "sort-by": true, "template": true,
+		"label-columns": true, "revision": true, "to-revision": true,
+		"since": true, "since-time": true, "tail": true, "limit-bytes": true,
+		"field-manager": true, "from-literal": true, "from-file": true,
+		"from-env-file": true, "env": true, "labels": true, "overrides": true,
+		"restart": true, "serviceaccount": true, "clusterrole": true, "role": true,
+		"group": true, "verb": true, "resource": true, "resource-name": true,
+		"subresource": true, "min": true, "max": true, "cpu-percent": true,
+		"chunk-size": true, "pod-running-timeout": true, "max-log-requests": true,
+		"schedule": true, "from": true, "image-pull-policy": true,
+		"external-ip": true, "load-balancer-ip": true, "session-affinity": true,
+		"cluster-ip": true, "pod-selector": true, "skip-wait-for-delete-timeout": true,
+		"requests": true, "limits": true, "containers": true, "raw": true,
+		"api-group": true, "api-version": true, "output-version": true,
+		"show-kind": true, "subject": true, "prune-allowlist": true,
+	}
+
+	// kubectlSubVerbs lists the sub-commands of the kubectl commands that have them.
+	kubectlSubVerbs = map[string]map[string]bool{
+		"rollout": stringSet("history", "pause", "restart", "resume", "status", "undo"),
+		"config": stringSet("current-context", "delete-cluster", "delete-context", "delete-user",
+			"get-clusters", "get-contexts", "get-users", "rename-context", "set",
+			"set-cluster", "set-context", "set-credentials", "unset", "use-context", "use", "view"),
+		"auth":         stringSet("can-i", "reconcile", "whoami"),
+		"set":          stringSet("env", "image", "resources", "selector", "serviceaccount", "subject"),
+		"top":          stringSet("node", "nodes", "no", "pod", "pods", "po"),
+		"certificate":  stringSet("approve", "deny"),
+		"apply":        stringSet("edit-last-applied", "set-last-applied", "view-last-applied"),
+		"cluster-info": stringSet("dump"),
+		"plugin":       stringSet("list"),
+		"create": stringSet("clusterrole", "clusterrolebinding", "configmap", "cm", "cronjob", "cj",
+			"deployment", "deploy", "ingress", "ing", "job", "namespace", "ns",
+			"poddisruptionbudget", "pdb", "priorityclass", "pc", "quota", "resourcequota",
+			"role", "rolebinding", "secret", "service", "svc", "serviceaccount", "sa", "token"),
+	}
+
+	// kubectlSubVerbOps classifies sub-commands whose effect differs from their parent command
+	// (true if the sub-command modifies resources).
+	kubectlSubVerbOps = map[string]map[string]bool{
+		"rollout": {
+			"history": false, "status": false,
+			"pause": true, "restart": true, "resume": true, "undo": true,
+		},
+		"auth": {
+			"can-i": false, "whoami": false, "reconcile": true,
+		},
+		"apply": {
+			"view-last-applied": false, "edit-last-applied": true, "set-last-applied": true,
+		},
+		// config sub-commands change the kubeconfig, and with it the cluster later commands act on.
+		"config": {
+			"view": false, "current-context": false,
+			"get-clusters": false, "get-contexts": false, "get-users": false,
+			"delete-cluster": true, "delete-context": true, "delete-user": true, "rename-context": true,
+			"set": true, "set-cluster": true, "set-context": true, "set-credentials": true,
+			"unset": true, "use-context": true, "use": true,
+		},
+	}
+
+	// kubectlPodVerbs operate on a single pod, given as "name" or "type/name".
+	kubectlPodVerbs = stringSet("logs", "exec", "attach", "port-forward", "debug")
+
+	// kubectlNodeVerbs operate on nodes given by name.
+	kubectlNodeVerbs = stringSet("cordon", "uncordon", "drain")
+)
+
+// wrapperProgram describes a program that runs the command given in its arguments, e.g. "timeout 5 kubectl get pods".
+type wrapperProgram struct {
+	// valueFlags are the options that take a separate value.
+	valueFlags map[string]bool
+	// positional is the number of positional arguments before the command, e.g. the duration of timeout.
+	positional int
+	// assignments is set if NAME=VALUE arguments may come before the command.
+	assignments bool
+}
+
+// wrapperPrograms are the common programs that run another program.
+var wrapperPrograms = map[string]wrapperProgram{
+	"command": {},
+	"exec":    {valueFlags: stringSet("-a")},
+	"env":     {valueFlags: stringSet("-u", "--unset", "-C", "--chdir"), assignments: true},
+	"xargs": {valueFlags: stringSet("-a", "--arg-file", "-d", "--delimiter", "-E", "-I", "-L", "--max-lines",
+		"-n", "--max-args", "-P", "--max-procs", "-s", "--max-chars", "--process-slot-var")},
+	"timeout": {valueFlags: stringSet("-k", "--kill-after", "-s", "--signal"), positional: 1},
+	"nice":    {valueFlags: stringSet("-n", "--adjustment")},
+	"nohup":   {},
+	"sudo": {valueFlags: stringSet("-u", "--user", "-g", "--group", "-h", "--host", "-p", "--prompt",
+		"-C", "--close-from", "-D", "--chdir", "-r", "--role", "-t", "--type", "-T", "--command-timeout",
+		"-U", "--other-user", "-R", "--chroot"), assignments: true},
+	"watch": {valueFlags: stringSet("-n", "--interval")},
+}
+
+// unwrapCommand returns the arguments of the program a call really runs, looking through
+// wrapper programs, e.g. "kubectl delete ns x" for "sudo -u admin timeout 5 kubectl delete ns x".
+// It returns nil if a wrapper is not given a command.
+func unwrapCommand(args []string) []string {
+	for len(args) > 0 {
+		wrapper, ok := wrapperPrograms[filepath.Base(args[0])]
+		if !ok {
+			return args
+		}
+		args = wrapper.command(args[1:])
+	}
+	return args
+}
+
+// command returns the command in the arguments of the wrapper, or nil.
+func (w wrapperProgram) command(args []string) []string {
+	options, positional := true, w.positional
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case options && arg == "--":
+			options = false
+		case options && strings.HasPrefix(arg, "-") && arg != "-":
+			if w.valueFlags[arg] {
+				i++
+			}
+		case w.assignments && isAssignment(arg):
+		case positional > 0:
+			positional--
+		default:
+			return args[i:]
+		}
+	}
+	return nil
+}
+
+// isAssignment returns true if arg is a NAME=VALUE environment variable assignment.
+func isAssignment(arg string) bool {
+	name, _, ok := strings.Cut(arg, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func stringSet(items ...string) map[string]bool {
+	m := make(map[string]bool, len(items))
+	for _, item := range items {
+		m[item] = true
+	}
+	return m
+}
+
+// isKubectlBinary returns true if the first word of a call runs kubectl.
+func isKubectlBinary(arg string) bool {
+	// Reject quoted arguments (e.g., '"/path/kubectl"')
+	if (strings.HasPrefix(arg, "'") && strings.HasSuffix(arg, "'")) || (strings.HasPrefix(arg, "\"") && strings.HasSuffix(arg, "\"")) {
+		return false
+	}
+	return strings.Contains(arg, "kubectl")
+}
+
+// ParseKubectlCommand parses the kubectl calls in a shell command, including those run through
+// wrapper programs such as xargs or timeout. Calls of other programs are ignored.
+func ParseKubectlCommand(command string) ([]*KubectlInvocation, error) {
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return nil, fmt.Errorf("parsing command: %w", err)
+	}
+
+	// Parents are walked before their children, so calls are known to be piped when they are reached.
+	piped := map[*syntax.CallExpr]bool{}
+	markPiped := func(node syntax.Node) {
+		syntax.Walk(node, func(node syntax.Node) bool {
+			if call, ok := node.(*syntax.CallExpr); ok {
+				piped[call] = true
+			}
+			return true
+		})
+	}
+
+	var invocations []*KubectlInvocation
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.BinaryCmd:
+			if node.Op == syntax.Pipe || node.Op == syntax.PipeAll {
+				markPiped(node.X)
+			}
+		case *syntax.CmdSubst:
+			markPiped(node)
+		case *syntax.ProcSubst:
+			markPiped(node)
+		case *syntax.CallExpr:
+			args := unwrapCommand(callArgs(node))
+			if len(args) > 0 && isKubectlBinary(args[0]) {
+				inv := ParseKubectlArgs(args[1:])
+				inv.PipedOutput = piped[node]
+				invocations = append(invocations, inv)
+			}
+		}
+		return true
+	})
+	return invocations, nil
+}
+
+// OnlyRunsKubectl returns true if a shell command runs kubectl and nothing else: no other programs,
+// command substitutions, redirections or variable assignments.
+func OnlyRunsKubectl(command string) bool {
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return false
+	}
+
+	onlyKubectl, calls := true, 0
+	syntax.Walk(file, func(node syntax.Node) bool {
+		switch node := node.(type) {
+		case *syntax.CallExpr:
+			if len(node.Assigns) > 0 {
+				onlyKubectl = false
+			}
+			if len(node.Args) > 0 {
+				if program, ok := literalWord(node.Args[0]); !ok || filepath.Base(program) != "kubectl" {
+					onlyKubectl = false
+				}
+				calls++
+			}
+		case *syntax.Redirect, *syntax.CmdSubst, *syntax.ProcSubst, *syntax.DeclClause, *syntax.FuncDecl:
+			onlyKubectl = false
+		}
+		return onlyKubectl
+	})
+	return onlyKubectl && calls > 0
+}
+
+// ParseKubectlArgs parses the arguments of a kubectl call (without the kubectl binary itself).
+func ParseKubectlArgs(args []string) *KubectlInvocation {
+	inv := &KubectlInvocation{Flags: make(map[string]string)}
+
+	var positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			// everything after "--" belongs to the command run by exec/debug
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value, hasValue := splitFlag(arg, positional)
+		if !hasValue && kubectlValueFlags[name] && i+1 < len(args) {
+			i++
+			value, hasValue = args[i], true
+		}
+		if !hasValue {
+			value = "true"
+		}
+		inv.setFlag(name, value)
+	}
+
+	if len(positional) == 0 {
+		return inv
+	}
+	inv.Verb = positional[0]
+	positional = positional[1:]
+
+	if subVerbs, ok := kubectlSubVerbs[inv.Verb]; ok && len(positional) > 0 && subVerbs[positional[0]] {
+		inv.SubVerb = positional[0]
+		positional = positional[1:]
+	}
+	inv.Args = positional
+
+	inv.parseTargets(positional)
+	return inv
+}
+
+// splitFlag splits "--name=value", "-n=value" and "-nvalue" into name and value;
+// the name is always the long name. positional holds the positional arguments seen so far,
+// for shorthands whose meaning depends on the command.
+func splitFlag(arg string, positional []string) (name string, value string, hasValue bool) {
+	if strings.HasPrefix(arg, "--") {
+		name, value, hasValue = strings.Cut(arg[2:], "=")
+		return name, value, hasValue
+	}
+
+	name = shortFlagName(arg[1:2], positional)
+	rest := arg[2:]
+	switch {
+	case rest == "":
+		return name, "", false
+	case strings.HasPrefix(rest, "="):
+		return name, rest[1:], true
+	case kubectlValueFlags[name]:
+		// "-nprod", "-oyaml"
+		return name, rest, true
+	default:
+		// combined boolean shorthands, e.g. "-it"
+		return name, "", false
+	}
+}
+
+func shortFlagName(short string, positional []string) string {
+	if len(positional) > 0 && positional[0] == "logs" {
+		// "kubectl logs -f -p" are --follow and --previous
+		switch short {
+		case "f":
+			return "follow"
+		case "p":
+			return "previous"
+		}
+	}
+	if long, ok := kubectlShortFlags[short]; ok {
+		return long
+	}
+	return short
+}
+
+func (inv *KubectlInvocation) setFlag(name string, value string) {
+	inv.Flags[name] = value
+	switch name {
+	case "namespace":
+		inv.Namespace = value
+	case "context":
+		inv.Context = value
+	case "all-namespaces":
+		inv.AllNamespaces = value != "false"
+	case "all":
+		inv.All = value != "false"
+	case "output":
+		inv.Output = value
+	case "filename":
+		inv.Filenames = append(inv.Filenames, value)
+	case "selector":
+		inv.Selector = value
+	case "dry-run":
+		switch value {
+		case "true", "unchanged":
+			inv.DryRun = "client"
+		case "false":
+			inv.DryRun = "none"
+		default:
+			inv.DryRun = value
+		}
+	}
+}
+
+// parseTargets fills in Resources and Names from the positional arguments after the verb.
+func (inv *KubectlInvocation) parseTargets(positional []string) {
+	switch {
+	case inv.Verb == "create" && inv.SubVerb != "":
+		inv.Resources = []string{inv.SubVerb}
+		if len(positional) > 0 && (inv.SubVerb == "secret" || inv.SubVerb == "service" || inv.SubVerb == "svc") {
+			// "create secret generic NAME", "create service clusterip NAME"
+			positional = positional[1:]
+		}
+		if len(positional) > 0 {
+			inv.Names = []string{positional[0]}
+		}
+
+	case inv.Verb == "top" && inv.SubVerb != "":
+		inv.Resources = []string{inv.SubVerb}
+		inv.Names = positional
+
+	case inv.Verb == "run":
+		inv.Resources = []string{"pod"}
+		if len(positional) > 0 {
+			inv.Names = []string{positional[0]}
+		}
+
+	case inv.Verb == "certificate":
+		inv.Resources = []string{"certificatesigningrequest"}
+		inv.Names = positional
+
+	case inv.Verb == "config" || inv.Verb == "auth" || inv.Verb == "cp":
+		// these don't take resource arguments
+
+	case kubectlNodeVerbs[inv.Verb]:
+		inv.Resources = []string{"node"}
+		inv.Names = positional
+
+	case kubectlPodVerbs[inv.Verb]:
+		if len(positional) == 0 {
+			return
+		}
+		if resource, name, ok := strings.Cut(positional[0], "/"); ok {
+			inv.Resources = []string{resource}
+			inv.Names = []string{name}
+		} else {
+			inv.Resources = []string{"pod"}
+			inv.Names = []string{positional[0]}
+		}
+
+	default:
+		var targets []string
+		for _, arg := range positional {
+			if isResourceArg(inv.Verb, arg) {
+				targets = append(targets, arg)
+			}
+		}
+		inv.parseResourceArgs(targets)
+	}
+}
+
+// isResourceArg returns false for arguments that are not resource types or names,
+// like "key=value" for label, or "container=image" for set image.
+func isResourceArg(verb string, arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	switch verb {
+	case "label", "annotate":
+		// "key-" removes a label
+		return !strings.HasSuffix(arg, "-")
+	case "taint":
+		return !strings.Contains(arg, ":") && !strings.HasSuffix(arg, "-")
+	}
+	return true
+}
+
+// parseResourceArgs handles the "TYPE[,TYPE...] [NAME...]" and "TYPE/NAME [TYPE/NAME...]" forms.
+func (inv *KubectlInvocation) parseResourceArgs(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	if strings.Contains(args[0], "/") {
+		for _, arg := range args {
+			resource, name, _ := strings.Cut(arg, "/")
+			inv.addResource(resource)
+			if name != "" {
+				inv.Names = append(inv.Names, name)
+			}
+		}
+		return
+	}
+
+	for _, resource := range strings.Split(args[0], ",") {
+		inv.addResource(resource)
+	}
+	inv.Names = append(inv.Names, args[1:]...)
+}
+
+func (inv *KubectlInvocation) addResource(resource string) {
+	for _, existing := range inv.Resources {
+		if existing == resource {
+			return
+		}
+	}
+	inv.Resources = append(inv.Resources, resource)
+}
+
+// IsDryRun returns true if the command only simulates its changes.
+func (inv *KubectlInvocation) IsDryRun() bool {
+	return inv.DryRun == "client" || inv.DryRun == "server"
+}
+
+// ModifiesResource classifies the invocation: "yes", "no" or "unknown".
+func (inv *KubectlInvocation) ModifiesResource() string {
+	if inv.Verb == "" {
+		return "unknown"
+	}
+
+	modifies, known := false, false
+	if ops, ok := kubectlSubVerbOps[inv.Verb]; ok && inv.SubVerb != "" {
+		modifies, known = ops[inv.SubVerb]
+	}
+	if !known {
+		switch {
+		case writeOps[inv.Verb]:
+			modifies, known = true, true
+		case readOnlyOps[inv.Verb]:
+			modifies, known = false, true
+		}
+	}
+
+	switch {
+	case !known:
+		return "unknown"
+	case modifies && !inv.IsDryRun():
+		return "yes"
+	default:
+		return "no"
+	}
+}
+
+// String describes the invocation for humans, e.g. "delete deployment web in namespace prod".
+func (inv *KubectlInvocation) String() string {
+	if inv.Verb == "" {
+		return "kubectl"
+	}
+
+	parts := []string{inv.Verb}
+	if inv.SubVerb != "" && (len(inv.Resources) == 0 || inv.Resources[0] != inv.SubVerb) {
+		parts = append(parts, inv.SubVerb)
+	}
+
+	resources := strings.Join(inv.Resources, ",")
+	switch {
+	case inv.All && resources != "":
+		parts = append(parts, "all "+resources)
+	case resources != "":
+		parts = append(parts, resources)
+	}
+	if len(inv.Names) > 0 {
+		parts = append(parts, strings.Join(inv.Names, ", "))
+	}
+	if inv.Selector != "" {
+		parts = append(parts, fmt.Sprintf("matching %q", inv.Selector))
+	}
+	if len(inv.Filenames) > 0 {
+		parts = append(parts, "from "+strings.Join(inv.Filenames, ", "))
+	}
+
+	switch {
+	case inv.AllNamespaces:
+		parts = append(parts, "in all namespaces")
+	case inv.Namespace != "":
+		parts = append(parts, "in namespace "+inv.Namespace)
+	}
+	if inv.Context != "" {
+		parts = append(parts, "(context "+inv.Context+")")
+	}
+	if inv.IsDryRun() {
+		parts = append(parts, "(dry run)")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,312 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseKubectlCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    KubectlInvocation
+	}{
+		// verb detection with global flags
+		{"namespace before verb", "kubectl -n prod delete pod x",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pod"}, Names: []string{"x"}, Namespace: "prod"}},
+		{"long namespace before verb", "kubectl --namespace prod get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}, Namespace: "prod"}},
+		{"attached namespace", "kubectl -nprod get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}, Namespace: "prod"}},
+		{"namespace with equals", "kubectl -n=prod get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}, Namespace: "prod"}},
+		{"context before verb", "kubectl --context staging --kubeconfig /tmp/config apply -f app.yaml",
+			KubectlInvocation{Verb: "apply", Context: "staging", Filenames: []string{"app.yaml"}}},
+		{"context with equals", "kubectl --context=prod get nodes",
+			KubectlInvocation{Verb: "get", Resources: []string{"nodes"}, Context: "prod"}},
+		{"impersonation before verb", "kubectl --as admin --as-group system:masters delete ns test",
+			KubectlInvocation{Verb: "delete", Resources: []string{"ns"}, Names: []string{"test"}}},
+		{"verbosity before verb", "kubectl -v 6 get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}}},
+		{"boolean flag before verb", "kubectl --insecure-skip-tls-verify get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}}},
+		{"no verb", "kubectl --help",
+			KubectlInvocation{}},
+
+		// resources and names
+		{"type and names", "kubectl delete pods a b c",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pods"}, Names: []string{"a", "b", "c"}}},
+		{"type/name", "kubectl delete deploy/web svc/web",
+			KubectlInvocation{Verb: "delete", Resources: []string{"deploy", "svc"}, Names: []string{"web", "web"}}},
+		{"multiple types", "kubectl get pods,svc -A",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods", "svc"}, AllNamespaces: true}},
+		{"delete all", "kubectl delete pods --all -n dev",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pods"}, All: true, Namespace: "dev"}},
+		{"selector", "kubectl delete pods -l app=web",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pods"}, Selector: "app=web"}},
+		{"attached selector", "kubectl get pods -lapp=web",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}, Selector: "app=web"}},
+		{"flags after name", "kubectl delete pod mypod --now --grace-period 0",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pod"}, Names: []string{"mypod"}}},
+		{"scale", "kubectl scale deploy web --replicas 3",
+			KubectlInvocation{Verb: "scale", Resources: []string{"deploy"}, Names: []string{"web"}}},
+		{"label keys are not names", "kubectl label pod nginx app=web tier-",
+			KubectlInvocation{Verb: "label", Resources: []string{"pod"}, Names: []string{"nginx"}}},
+		{"taint", "kubectl taint nodes node1 key=value:NoSchedule",
+			KubectlInvocation{Verb: "taint", Resources: []string{"nodes"}, Names: []string{"node1"}}},
+		{"cordon", "kubectl cordon node1",
+			KubectlInvocation{Verb: "cordon", Resources: []string{"node"}, Names: []string{"node1"}}},
+		{"drain", "kubectl drain node1 --ignore-daemonsets --delete-emptydir-data",
+			KubectlInvocation{Verb: "drain", Resources: []string{"node"}, Names: []string{"node1"}}},
+		{"run", "kubectl run nginx --image nginx --restart Never",
+			KubectlInvocation{Verb: "run", Resources: []string{"pod"}, Names: []string{"nginx"}}},
+		{"stdin filename", "kubectl apply -f -",
+			KubectlInvocation{Verb: "apply", Filenames: []string{"-"}}},
+		{"multiple filenames", "kubectl delete -f a.yaml --filename=b.yaml",
+			KubectlInvocation{Verb: "delete", Filenames: []string{"a.yaml", "b.yaml"}}},
+		{"patch", "kubectl patch deploy web -p '{\"spec\":{}}' --type merge",
+			KubectlInvocation{Verb: "patch", Resources: []string{"deploy"}, Names: []string{"web"}}},
+
+		// pod commands
+		{"logs", "kubectl logs web-123 -c app -f",
+			KubectlInvocation{Verb: "logs", Resources: []string{"pod"}, Names: []string{"web-123"}}},
+		{"logs previous", "kubectl logs -p web-123",
+			KubectlInvocation{Verb: "logs", Resources: []string{"pod"}, Names: []string{"web-123"}}},
+		{"logs of deployment", "kubectl logs deploy/web --tail 20",
+			KubectlInvocation{Verb: "logs", Resources: []string{"deploy"}, Names: []string{"web"}}},
+		{"exec", "kubectl exec -it web-123 -n prod -- rm -rf /data",
+			KubectlInvocation{Verb: "exec", Resources: []string{"pod"}, Names: []string{"web-123"}, Namespace: "prod"}},
+		{"port-forward", "kubectl port-forward svc/web 8080:80",
+			KubectlInvocation{Verb: "port-forward", Resources: []string{"svc"}, Names: []string{"web"}}},
+
+		// sub-commands
+		{"rollout status", "kubectl rollout status deployment/web",
+			KubectlInvocation{Verb: "rollout", SubVerb: "status", Resources: []string{"deployment"}, Names: []string{"web"}}},
+		{"rollout restart", "kubectl rollout restart deploy web -n prod",
+			KubectlInvocation{Verb: "rollout", SubVerb: "restart", Resources: []string{"deploy"}, Names: []string{"web"}, Namespace: "prod"}},
+		{"config view", "kubectl config view --minify",
+			KubectlInvocation{Verb: "config", SubVerb: "view"}},
+		{"config use-context", "kubectl config use-context prod",
+			KubectlInvocation{Verb: "config", SubVerb: "use-context"}},
+		{"set image", "kubectl set image deployment/web app=nginx:1.25",
+			KubectlInvocation{Verb: "set", SubVerb: "image", Resources: []string{"deployment"}, Names: []string{"web"}}},
+		{"create deployment", "kubectl create deployment web --image nginx",
+			KubectlInvocation{Verb: "create", SubVerb: "deployment", Resources: []string{"deployment"}, Names: []string{"web"}}},
+		{"create secret", "kubectl create secret generic creds --from-literal user=admin",
+			KubectlInvocation{Verb: "create", SubVerb: "secret", Resources: []string{"secret"}, Names: []string{"creds"}}},
+		{"create namespace", "kubectl create ns test",
+			KubectlInvocation{Verb: "create", SubVerb: "ns", Resources: []string{"ns"}, Names: []string{"test"}}},
+		{"create from file", "kubectl create -f pod.yaml",
+			KubectlInvocation{Verb: "create", Filenames: []string{"pod.yaml"}}},
+		{"auth can-i", "kubectl auth can-i delete pods --as jane",
+			KubectlInvocation{Verb: "auth", SubVerb: "can-i"}},
+		{"top pods", "kubectl top pods -A",
+			KubectlInvocation{Verb: "top", SubVerb: "pods", Resources: []string{"pods"}, AllNamespaces: true}},
+		{"certificate approve", "kubectl certificate approve csr-1",
+			KubectlInvocation{Verb: "certificate", SubVerb: "approve", Resources: []string{"certificatesigningrequest"}, Names: []string{"csr-1"}}},
+
+		// dry-run and output
+		{"dry-run client", "kubectl apply -f app.yaml --dry-run=client -o yaml",
+			KubectlInvocation{Verb: "apply", Filenames: []string{"app.yaml"}, DryRun: "client", Output: "yaml"}},
+		{"dry-run without value", "kubectl delete pod x --dry-run",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pod"}, Names: []string{"x"}, DryRun: "client"}},
+		{"dry-run none", "kubectl delete pod x --dry-run=none",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pod"}, Names: []string{"x"}, DryRun: "none"}},
+		{"attached output", "kubectl get pods -ojsonpath='{.items[*].metadata.name}'",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}, Output: "jsonpath={.items[*].metadata.name}"}},
+
+		// shell syntax
+		{"env prefix", "KUBECONFIG=/tmp/config kubectl get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}}},
+		{"full path", "/usr/local/bin/kubectl --kubeconfig=/path/config get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}}},
+		{"line continuation", "kubectl delete pod \\\n  my-pod \\\n  --grace-period=30",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pod"}, Names: []string{"my-pod"}}},
+
+		// wrapper programs
+		{"command", "command kubectl --context prod delete ns x",
+			KubectlInvocation{Verb: "delete", Resources: []string{"ns"}, Names: []string{"x"}, Context: "prod"}},
+		{"xargs", "echo web | xargs -n 1 kubectl delete pod",
+			KubectlInvocation{Verb: "delete", Resources: []string{"pod"}}},
+		{"timeout", "timeout -s KILL 5 kubectl get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}}},
+		{"nested wrappers", "sudo -u admin env KUBECONFIG=/tmp/config nice -n 5 nohup kubectl delete ns x",
+			KubectlInvocation{Verb: "delete", Resources: []string{"ns"}, Names: []string{"x"}}},
+		{"exec and watch", "exec watch -n 2 kubectl get pods",
+			KubectlInvocation{Verb: "get", Resources: []string{"pods"}}},
+		{"versioned binary", "kubectl.1.28 --context prod delete ns x",
+			KubectlInvocation{Verb: "delete", Resources: []string{"ns"}, Names: []string{"x"}, Context: "prod"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invocations, err := ParseKubectlCommand(tt.command)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(invocations) != 1 {
+				t.Fatalf("expected 1 invocation, got %d", len(invocations))
+			}
+			got := invocations[0]
+
+			if got.Verb != tt.want.Verb || got.SubVerb != tt.want.SubVerb {
+				t.Errorf("verb = %q %q, want %q %q", got.Verb, got.SubVerb, tt.want.Verb, tt.want.SubVerb)
+			}
+			if !slices.Equal(got.Resources, tt.want.Resources) {
+				t.Errorf("resources = %q, want %q", got.Resources, tt.want.Resources)
+			}
+			if !slices.Equal(got.Names, tt.want.Names) {
+				t.Errorf("names = %q, want %q", got.Names, tt.want.Names)
+			}
+			if got.Namespace != tt.want.Namespace || got.AllNamespaces != tt.want.AllNamespaces {
+				t.Errorf("namespace = %q (all: %v), want %q (all: %v)", got.Namespace, got.AllNamespaces, tt.want.Namespace, tt.want.AllNamespaces)
+			}
+			if got.Context != tt.want.Context {
+				t.Errorf("context = %q, want %q", got.Context, tt.want.Context)
+			}
+			if got.DryRun != tt.want.DryRun || got.Output != tt.want.Output {
+				t.Errorf("dry-run/output = %q/%q, want %q/%q", got.DryRun, got.Output, tt.want.DryRun, tt.want.Output)
+			}
+			if !slices.Equal(got.Filenames, tt.want.Filenames) {
+				t.Errorf("filenames = %q, want %q", got.Filenames, tt.want.Filenames)
+			}
+			if got.Selector != tt.want.Selector || got.All != tt.want.All {
+				t.Errorf("selector/all = %q/%v, want %q/%v", got.Selector, got.All, tt.want.Selector, tt.want.All)
+			}
+		})
+	}
+}
+
+func TestParseKubectlCommand_MultipleCalls(t *testing.T) {
+	invocations, err := ParseKubectlCommand("kubectl get pods -n a | grep web && kubectl -n b delete pod web; echo done")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invocations) != 2 {
+		t.Fatalf("expected 2 invocations, got %d", len(invocations))
+	}
+	if invocations[0].Verb != "get" || invocations[1].Verb != "delete" || invocations[1].Namespace != "b" {
+		t.Errorf("unexpected invocations: %+v, %+v", invocations[0], invocations[1])
+	}
+	if !invocations[0].PipedOutput || invocations[1].PipedOutput {
+		t.Errorf("piped output = %v, %v, want true, false", invocations[0].PipedOutput, invocations[1].PipedOutput)
+	}
+
+	// Wrappers without a command, and other programs, run no kubectl
+	invocations, err = ParseKubectlCommand("timeout 5; xargs -n 1; env FOO=bar ls")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invocations) != 0 {
+		t.Errorf("expected no invocations, got %d", len(invocations))
+	}
+
+	if _, err := ParseKubectlCommand("kubectl get pods 'unterminated"); err == nil {
+		t.Errorf("expected a parse error")
+	}
+}
+
+func TestOnlyRunsKubectl(t *testing.T) {
+	tests := []struct {
+		command string
+		want    bool
+	}{
+		{command: "kubectl scale deployment web --replicas=3 -n shop", want: true},
+		{command: "kubectl get pods && kubectl delete pod web", want: true},
+		{command: "/usr/local/bin/kubectl get pods", want: true},
+		{command: "kubectl get pods | grep web", want: false},
+		{command: "kubectl get pods > pods.txt", want: false},
+		{command: "kubectl delete pod $(cat names.txt)", want: false},
+		{command: "KUBECONFIG=other kubectl get pods", want: false},
+		{command: "kubectl-evil get pods", want: false},
+		{command: "$KUBECTL get pods", want: false},
+		{command: "", want: false},
+	}
+	for _, tc := range tests {
+		if got := OnlyRunsKubectl(tc.command); got != tc.want {
+			t.Errorf("OnlyRunsKubectl(%q) = %v, want %v", tc.command, got, tc.want)
+		}
+	}
+}
+
+func TestKubectlInvocation_ModifiesResource(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"kubectl -n prod delete pod x", "yes"},
+		{"kubectl --context prod -n kube-system get pods", "no"},
+		{"kubectl rollout status deploy/web", "no"},
+		{"kubectl rollout history deploy/web", "no"},
+		{"kubectl rollout restart deploy/web", "yes"},
+		{"kubectl rollout undo deploy/web --dry-run=server", "no"},
+		{"kubectl apply view-last-applied deploy/web", "no"},
+		{"kubectl apply set-last-applied -f app.yaml", "yes"},
+		{"kubectl auth can-i delete pods", "no"},
+		{"kubectl auth reconcile -f rbac.yaml", "yes"},
+		{"kubectl config view", "no"},
+		{"kubectl config get-contexts", "no"},
+		{"kubectl config current-context", "no"},
+		{"kubectl config use-context prod", "yes"},
+		{"kubectl config set-context --current --namespace=web", "yes"},
+		{"kubectl config set-credentials admin --token=x", "yes"},
+		{"kubectl delete pod x --dry-run=none", "yes"},
+		{"kubectl exec web -- ls", "unknown"},
+		{"kubectl --namespace", "unknown"},
+	}
+
+	for _, tt := range tests {
+		invocations, err := ParseKubectlCommand(tt.command)
+		if err != nil || len(invocations) != 1 {
+			t.Fatalf("parsing %q: %v (%d invocations)", tt.command, err, len(invocations))
+		}
+		if got := invocations[0].ModifiesResource(); got != tt.expected {
+			t.Errorf("ModifiesResource(%q) = %q, want %q", tt.command, got, tt.expected)
+		}
+		// the shell-level classification must agree for single calls
+		if got := kubectlModifiesResource(tt.command); got != tt.expected {
+			t.Errorf("kubectlModifiesResource(%q) = %q, want %q", tt.command, got, tt.expected)
+		}
+	}
+}
+
+func TestKubectlInvocation_String(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"kubectl -n prod delete deploy web", "delete deploy web in namespace prod"},
+		{"kubectl delete pods --all -A", "delete all pods in all namespaces"},
+		{"kubectl delete pods -l app=web --context prod", `delete pods matching "app=web" (context prod)`},
+		{"kubectl apply -f app.yaml --dry-run=server", "apply from app.yaml (dry run)"},
+		{"kubectl rollout restart deployment/web", "rollout restart deployment web"},
+		{"kubectl create namespace test", "create namespace test"},
+	}
+
+	for _, tt := range tests {
+		invocations, _ := ParseKubectlCommand(tt.command)
+		if len(invocations) != 1 {
+			t.Fatalf("expected 1 invocation for %q", tt.command)
+		}
+		if got := invocations[0].String(); got != tt.expected {
+			t.Errorf("String(%q) = %q, want %q", tt.command, got, tt.expected)
+		}
+	}
+}
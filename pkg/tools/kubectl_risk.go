@@ -0,0 +1,220 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/kubeconfig"
+	"k8s.io/klog/v2"
+)
+
+// RiskTier grades how much damage a command could do.
+type RiskTier int
+
+const (
+	RiskLow RiskTier = iota
+	RiskMedium
+	RiskHigh
+	RiskCritical
+)
+
+func (r RiskTier) String() string {
+	switch r {
+	case RiskLow:
+		return "low"
+	case RiskMedium:
+		return "medium"
+	case RiskHigh:
+		return "high"
+	case RiskCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("RiskTier(%d)", int(r))
+	}
+}
+
+// RiskConfig tunes the risk assessment of kubectl commands.
+type RiskConfig struct {
+	// ProductionContexts are glob patterns of kubeconfig context names that are considered production.
+	ProductionContexts []string `json:"productionContexts,omitempty"`
+	// SystemNamespaces are glob patterns of namespaces that hold cluster infrastructure.
+	SystemNamespaces []string `json:"systemNamespaces,omitempty"`
+}
+
+// DefaultRiskConfig returns the default risk configuration.
+func DefaultRiskConfig() RiskConfig {
+	return RiskConfig{
+		ProductionContexts: []string{"*prod*"},
+		SystemNamespaces:   []string{"kube-*", "*-system"},
+	}
+}
+
+// RiskAssessment is the outcome of assessing a command.
+type RiskAssessment struct {
+	Tier RiskTier
+	// Reasons explain what raised the tier.
+	Reasons []string
+	// Invocation is the kubectl call the tier comes from, if any.
+	Invocation *KubectlInvocation
+}
+
+// ConfirmationToken is what the user must type to confirm a high-risk operation:
+// the name of the resource, or its type if no name was given.
+func (a *RiskAssessment) ConfirmationToken() string {
+	inv := a.Invocation
+	switch {
+	case inv == nil:
+		return "yes"
+	case len(inv.Names) > 0:
+		return inv.Names[0]
+	case len(inv.Resources) > 0:
+		return inv.Resources[0]
+	default:
+		return inv.Verb
+	}
+}
+
+var (
+	// kubectlClusterCriticalKinds are resource types whose changes affect the whole cluster.
+	kubectlClusterCriticalKinds = stringSet(
+		"namespace", "namespaces", "ns",
+		"customresourcedefinition", "customresourcedefinitions", "crd", "crds",
+		"persistentvolume", "persistentvolumes", "pv",
+		"node", "nodes", "no",
+		"clusterrole", "clusterroles", "clusterrolebinding", "clusterrolebindings",
+		"validatingwebhookconfiguration", "validatingwebhookconfigurations",
+		"mutatingwebhookconfiguration", "mutatingwebhookconfigurations",
+		"storageclass", "storageclasses", "sc",
+		"apiservice", "apiservices",
+	)
+
+	// kubectlDestructiveVerbs remove or evict resources.
+	kubectlDestructiveVerbs = stringSet("delete", "drain", "replace")
+)
+
+// AssessKubectlRisk grades a kubectl invocation.
+// currentContext is the kubeconfig context the command runs against, unless it sets --context,
+// and contextNamespace returns the namespace of a context, which the command acts on unless it sets -n.
+func AssessKubectlRisk(inv *KubectlInvocation, config RiskConfig, currentContext string, contextNamespace func(kubeContext string) string) RiskAssessment {
+	assessment := RiskAssessment{Tier: RiskLow, Invocation: inv}
+
+	switch inv.ModifiesResource() {
+	case "no":
+		return assessment
+	case "unknown":
+		assessment.raise(RiskMedium, fmt.Sprintf("the effect of %q is unknown", inv.Verb))
+	default:
+		assessment.raise(RiskMedium, "modifies resources")
+	}
+
+	destructive := kubectlDestructiveVerbs[inv.Verb] || (inv.Verb == "rollout" && inv.SubVerb == "undo")
+	if destructive {
+		assessment.raise(RiskHigh, fmt.Sprintf("%q is destructive", inv.Verb))
+	}
+
+	for _, resource := range inv.Resources {
+		if kubectlClusterCriticalKinds[strings.ToLower(resource)] {
+			if inv.Verb == "delete" {
+				assessment.raise(RiskCritical, fmt.Sprintf("removes cluster-level %s", resource))
+			} else {
+				assessment.raise(RiskHigh, fmt.Sprintf("changes cluster-level %s", resource))
+			}
+		}
+	}
+
+	kubeContext := inv.Context
+	if kubeContext == "" {
+		kubeContext = currentContext
+	}
+	namespace := inv.Namespace
+	if namespace == "" && !inv.AllNamespaces && contextNamespace != nil {
+		namespace = contextNamespace(kubeContext)
+	}
+
+	// The following raise the tier by one step.
+	var escalations []string
+	if namespace != "" && matchesAny(config.SystemNamespaces, namespace) {
+		escalations = append(escalations, fmt.Sprintf("targets system namespace %s", namespace))
+	} else if targetsNamespaces(inv) {
+		for _, name := range inv.Names {
+			if matchesAny(config.SystemNamespaces, name) {
+				escalations = append(escalations, fmt.Sprintf("targets system namespace %s", name))
+				break
+			}
+		}
+	}
+	switch {
+	case inv.All:
+		escalations = append(escalations, "targets all resources (--all)")
+	case inv.AllNamespaces:
+		escalations = append(escalations, "targets all namespaces")
+	case inv.Selector != "":
+		escalations = append(escalations, fmt.Sprintf("targets every resource matching %q", inv.Selector))
+	}
+	if kubeContext != "" && matchesAny(config.ProductionContexts, kubeContext) {
+		escalations = append(escalations, fmt.Sprintf("runs against production context %s", kubeContext))
+	}
+	for _, reason := range escalations {
+		assessment.raise(min(assessment.Tier+1, RiskCritical), reason)
+	}
+
+	return assessment
+}
+
+// AssessKubectlCommandRisk grades every kubectl call in a shell command, and returns the riskiest.
+// ok is false if the command contains no kubectl calls.
+func AssessKubectlCommandRisk(invocations []*KubectlInvocation, config RiskConfig, currentContext string, contextNamespace func(kubeContext string) string) (assessment RiskAssessment, ok bool) {
+	for i, inv := range invocations {
+		a := AssessKubectlRisk(inv, config, currentContext, contextNamespace)
+		if i == 0 || a.Tier > assessment.Tier {
+			assessment = a
+		}
+	}
+	return assessment, len(invocations) > 0
+}
+
+// targetsNamespaces returns true if the invocation acts on namespace objects themselves.
+func targetsNamespaces(inv *KubectlInvocation) bool {
+	for _, resource := range inv.Resources {
+		switch strings.ToLower(resource) {
+		case "namespace", "namespaces", "ns":
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentKubeContext returns the current context of the kubeconfig, or "" if it cannot be read.
+// Like kubectl, it uses the first file of a KUBECONFIG list.
+func CurrentKubeContext(path string) string {
+	config, err := kubeconfig.Load(path)
+	if err != nil {
+		klog.V(2).Infof("reading current context: %v", err)
+		return ""
+	}
+	return config.CurrentContext()
+}
+
+func (a *RiskAssessment) raise(tier RiskTier, reason string) {
+	if tier > a.Tier {
+		a.Tier = tier
+	}
+	a.Reasons = append(a.Reasons, reason)
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAssessKubectlRisk(t *testing.T) {
+	config := DefaultRiskConfig()
+	tests := []struct {
+		name           string
+		command        string
+		currentContext string
+		want           RiskTier
+		wantToken      string
+	}{
+		{"read only", "kubectl get pods -n kube-system", "prod-eu", RiskLow, "pods"},
+		{"dry run", "kubectl delete ns default --dry-run=client", "", RiskLow, "default"},
+		{"scale in dev", "kubectl scale deploy web --replicas=3 -n dev", "dev", RiskMedium, "web"},
+		{"scale in prod", "kubectl scale deploy web --replicas=3 -n dev", "prod-eu", RiskHigh, "web"},
+		{"context flag overrides current context", "kubectl --context prod-eu scale deploy web --replicas=3", "dev", RiskHigh, "web"},
+		{"delete pod", "kubectl delete pod web-0 -n dev", "dev", RiskHigh, "web-0"},
+		{"delete pod in system namespace", "kubectl delete pod coredns-0 -n kube-system", "dev", RiskCritical, "coredns-0"},
+		{"delete all pods", "kubectl delete pods --all -n dev", "dev", RiskCritical, "pods"},
+		{"delete by selector", "kubectl delete pods -l app=web", "", RiskCritical, "pods"},
+		{"delete system namespace", "kubectl delete ns kube-system", "", RiskCritical, "kube-system"},
+		{"delete namespace", "kubectl delete namespace team-a", "", RiskCritical, "team-a"},
+		{"label node", "kubectl label node worker-1 disk=ssd", "", RiskHigh, "worker-1"},
+		{"drain node", "kubectl drain worker-1", "", RiskHigh, "worker-1"},
+		{"rollout undo", "kubectl rollout undo deploy/web", "", RiskHigh, "web"},
+		{"riskiest call wins", "kubectl get pods && kubectl delete crd widgets.example.com", "", RiskCritical, "widgets.example.com"},
+		{"system namespace of context", "kubectl delete deploy coredns", "ops", RiskCritical, "coredns"},
+		{"namespace flag overrides context namespace", "kubectl delete deploy web -n dev", "ops", RiskHigh, "web"},
+		{"namespace of context flag", "kubectl --context ops scale deploy coredns --replicas=3", "dev", RiskHigh, "coredns"},
+	}
+	contextNamespace := func(kubeContext string) string {
+		return map[string]string{"ops": "kube-system", "dev": "dev"}[kubeContext]
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			invocations, err := ParseKubectlCommand(tc.command)
+			if err != nil {
+				t.Fatalf("ParseKubectlCommand(%q) returned error: %v", tc.command, err)
+			}
+			got, ok := AssessKubectlCommandRisk(invocations, config, tc.currentContext, contextNamespace)
+			if !ok {
+				t.Fatalf("AssessKubectlCommandRisk(%q) found no kubectl calls", tc.command)
+			}
+			if got.Tier != tc.want {
+				t.Errorf("AssessKubectlCommandRisk(%q) = %s (%v), want %s", tc.command, got.Tier, got.Reasons, tc.want)
+			}
+			if token := got.ConfirmationToken(); token != tc.wantToken {
+				t.Errorf("ConfirmationToken() for %q = %q, want %q", tc.command, token, tc.wantToken)
+			}
+		})
+	}
+}
+
+func TestAssessKubectlCommandRisk_NoKubectl(t *testing.T) {
+	invocations, err := ParseKubectlCommand("ls -la")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := AssessKubectlCommandRisk(invocations, DefaultRiskConfig(), "", nil); ok {
+		t.Errorf("expected no assessment for a command without kubectl calls")
+	}
+}
+
+func TestCurrentKubeContext(t *testing.T) {
+	dir := t.TempDir()
+	kubeconfig := filepath.Join(dir, "config")
+	if err := os.WriteFile(kubeconfig, []byte("apiVersion: v1\nkind: Config\ncurrent-context: prod-eu\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := CurrentKubeContext(kubeconfig + string(filepath.ListSeparator) + filepath.Join(dir, "other")); got != "prod-eu" {
+		t.Errorf("CurrentKubeContext() = %q, want %q", got, "prod-eu")
+	}
+	if got := CurrentKubeContext(filepath.Join(dir, "missing")); got != "" {
+		t.Errorf("CurrentKubeContext() for a missing file = %q, want empty", got)
+	}
+}
+
+func TestKubeContextNamespace(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+current-context: ops
+contexts:
+- name: ops
+  context: {cluster: c, user: u, namespace: kube-system}
+- name: dev
+  context: {cluster: c, user: u}
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for context, want := range map[string]string{"ops": "kube-system", "dev": "default", "missing": ""} {
+		if got := KubeContextNamespace(kubeconfig, context); got != want {
+			t.Errorf("KubeContextNamespace(%q) = %q, want %q", context, got, want)
+		}
+	}
+}
@@ -27,7 +27,7 @@ import (
 )
 
 func init() {
-	RegisterTool(&Kubectl{})
+	registerBuiltinTool(&Kubectl{})
 }
 
 type Kubectl struct{}
@@ -87,6 +87,7 @@ assistant: kubectl exec my-pod -- /bin/sh -c "your command here"`,
 				},
 				"modifies_resource": {
 					Type: gollm.TypeString,
+					Enum: []any{"yes", "no", "unknown"},
 					Description: `Whether the command modifies a kubernetes resource.
 Possible values:
 - "yes" if the command modifies a resource
@@ -112,15 +113,24 @@ func (t *Kubectl) Run(ctx context.Context, args map[string]any) (any, error) {
 		return &ExecResult{Error: "kubectl command must be a string"}, nil
 	}
 
-	return runKubectlCommand(ctx, command, workDir, kubeconfig)
+	return runKubectlCommand(ctx, t.Name(), command, workDir, kubeconfig)
 }
 
-func runKubectlCommand(ctx context.Context, command, workDir, kubeconfig string) (*ExecResult, error) {
+// runKubectlCommand runs the command of the named tool, in the sandbox if the sandbox policy selects that tool.
+func runKubectlCommand(ctx context.Context, toolName, command, workDir, kubeconfig string) (*ExecResult, error) {
 	// Check for interactive commands before proceeding
 	if isInteractive, err := IsInteractiveCommand(command); isInteractive {
 		return &ExecResult{Error: err.Error()}, nil
 	}
 
+	if sb := sandboxFor(ctx, toolName); sb != nil {
+		kubeconfig, err := expandShellVar(kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return runSandboxed(ctx, sb, command, workDir, kubeconfig)
+	}
+
 	var cmd *exec.Cmd
 	if runtime.GOOS == "windows" {
 		cmd = exec.CommandContext(ctx, os.Getenv("COMSPEC"), "/c", command)
@@ -20,6 +20,7 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/st-lzh/kubelet-wuhrai/gollm"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/mcp"
@@ -30,16 +31,35 @@ import (
 // Schema Conversion Functions (kubectl-ai specific)
 // =============================================================================
 
-// ConvertToolToGollm converts an MCP tool to gollm.FunctionDefinition with a simple schema
-func ConvertToolToGollm(mcpTool *mcp.Tool) (*gollm.FunctionDefinition, error) {
+// ConvertToolToGollm converts an MCP tool to gollm.FunctionDefinition with a simple schema.
+// The function is named after the tool's namespaced name (see MCPToolName).
+func ConvertToolToGollm(serverName string, mcpTool *mcp.Tool) (*gollm.FunctionDefinition, error) {
 	def := &gollm.FunctionDefinition{
-		Name:        mcpTool.Name,
+		Name:        MCPToolName(serverName, mcpTool.Name),
 		Description: mcpTool.Description,
 		Parameters:  mcpTool.InputSchema,
 	}
 	return def, nil
 }
 
+// MCPToolName returns the namespaced name under which an MCP server's tool is registered,
+// so that tools with the same name on different servers (or built-in tools) do not collide.
+// Characters that LLM function names do not allow are replaced with underscores.
+func MCPToolName(serverName, toolName string) string {
+	return sanitizeToolName(serverName) + "_" + sanitizeToolName(toolName)
+}
+
+func sanitizeToolName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
 // =============================================================================
 // MCP Tool Implementation
 // =============================================================================
@@ -65,8 +85,13 @@ func NewMCPTool(serverName, toolName, description string, schema *gollm.Function
 	}
 }
 
-// Name returns the tool name.
+// Name returns the namespaced tool name, as exposed to the LLM.
 func (t *MCPTool) Name() string {
+	return MCPToolName(t.serverName, t.toolName)
+}
+
+// ToolName returns the name of the tool on its MCP server.
+func (t *MCPTool) ToolName() string {
 	return t.toolName
 }
 
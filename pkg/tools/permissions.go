@@ -0,0 +1,64 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ListPermissions returns what the identity of the kubeconfig may do, as listed by
+// "kubectl auth can-i --list", in namespace (or the namespace of the current context if empty).
+func ListPermissions(ctx context.Context, kubeconfig string, namespace string) (string, error) {
+	args := []string{"auth", "can-i", "--list"}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	return runKubectlPreflight(ctx, kubeconfig, args...)
+}
+
+// WhoAmI returns the identity the API server sees for the kubeconfig, as printed by "kubectl auth whoami".
+func WhoAmI(ctx context.Context, kubeconfig string) (string, error) {
+	return runKubectlPreflight(ctx, kubeconfig, "auth", "whoami")
+}
+
+func runKubectlPreflight(ctx context.Context, kubeconfig string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	cmd.Env = os.Environ()
+	if kubeconfig != "" {
+		kubeconfig, err := expandShellVar(kubeconfig)
+		if err != nil {
+			return "", err
+		}
+		cmd.Env = append(cmd.Env, "KUBECONFIG="+kubeconfig)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", fmt.Errorf("kubectl %s: %w", strings.Join(args, " "), err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeKubectl puts a kubectl on the PATH that prints its arguments and KUBECONFIG.
+func fakeKubectl(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$2\" = fail ]; then echo 'error: forbidden' >&2; exit 1; fi\necho \"args=$* kubeconfig=$KUBECONFIG\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "kubectl"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestPreflightChecks(t *testing.T) {
+	fakeKubectl(t)
+	ctx := context.Background()
+
+	got, err := WhoAmI(ctx, "/tmp/agent/config")
+	if err != nil {
+		t.Fatalf("WhoAmI() returned error: %v", err)
+	}
+	if want := "args=auth whoami kubeconfig=/tmp/agent/config\n"; got != want {
+		t.Errorf("WhoAmI() = %q, want %q", got, want)
+	}
+
+	got, err = ListPermissions(ctx, "/tmp/agent/config", "web")
+	if err != nil {
+		t.Fatalf("ListPermissions() returned error: %v", err)
+	}
+	if want := "args=auth can-i --list --namespace web kubeconfig=/tmp/agent/config\n"; got != want {
+		t.Errorf("ListPermissions() = %q, want %q", got, want)
+	}
+
+	// Errors carry kubectl's message, which the doctor command shows.
+	_, err = runKubectlPreflight(ctx, "", "auth", "fail")
+	if err == nil || !strings.Contains(err.Error(), "error: forbidden") {
+		t.Errorf("runKubectlPreflight() error = %v, want kubectl's message", err)
+	}
+}
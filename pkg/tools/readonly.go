@@ -0,0 +1,214 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// ErrReadOnly is returned for tool calls that are refused in read-only mode.
+var ErrReadOnly = errors.New("refused in read-only mode")
+
+// readOnlyUtilities are the programs, besides kubectl and helm, that read-only shell commands may run.
+// They only read or print data, and cannot run other programs (unlike e.g. xargs, awk or find).
+var readOnlyUtilities = stringSet(
+	"cat", "echo", "printf", "grep", "egrep", "fgrep", "head", "tail", "sort", "uniq",
+	"wc", "cut", "tr", "jq", "yq", "base64", "column", "date", "ls", "diff", "true", "false", "test", "[",
+)
+
+// readOnlyUtilityWriteFlags are the flags that make a read-only utility write files or change the system.
+// Short flags also match when combined with others, e.g. "-no" for sort.
+var readOnlyUtilityWriteFlags = map[string][]string{
+	"sort": {"-o", "--output"},
+	"yq":   {"-i", "--inplace"},
+	"date": {"-s", "--set"},
+}
+
+// readOnlyRedirectTargets are the files output may be redirected to in read-only mode.
+var readOnlyRedirectTargets = stringSet("/dev/null", "/dev/stdout", "/dev/stderr")
+
+// CheckReadOnly returns an error wrapping ErrReadOnly unless the tool call is known not to modify resources.
+// Shell-based tools are checked strictly: every program the command runs must be a read-only kubectl
+// or helm call, or one of a few read-only utilities. Other tools must report they do not modify resources.
+func CheckReadOnly(tool Tool, args map[string]any) error {
+	switch tool := tool.(type) {
+	case *Kubectl, *BashTool, *Helm:
+		command, _ := args["command"].(string)
+		return checkShellReadOnly(command)
+	case *CustomTool:
+		command, _ := args["command"].(string)
+		command, err := tool.addCommandPrefix(command)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrReadOnly, err)
+		}
+		return checkShellReadOnly(command)
+	}
+
+	switch tool.CheckModifiesResource(args) {
+	case "no":
+		return nil
+	case "yes":
+		return fmt.Errorf("%w: %s modifies resources", ErrReadOnly, tool.Name())
+	default:
+		return fmt.Errorf("%w: %s might modify resources", ErrReadOnly, tool.Name())
+	}
+}
+
+func checkShellReadOnly(command string) error {
+	if strings.TrimSpace(command) == "" {
+		return fmt.Errorf("%w: empty command", ErrReadOnly)
+	}
+	file, err := syntax.NewParser().Parse(strings.NewReader(command), "")
+	if err != nil {
+		return fmt.Errorf("%w: cannot parse the command: %v", ErrReadOnly, err)
+	}
+
+	var problem error
+	syntax.Walk(file, func(node syntax.Node) bool {
+		if problem != nil {
+			return false
+		}
+		switch node := node.(type) {
+		case *syntax.CallExpr:
+			if len(node.Args) > 0 {
+				problem = checkCallReadOnly(node)
+			}
+		case *syntax.Redirect:
+			problem = checkRedirectReadOnly(node)
+		}
+		return true
+	})
+	return problem
+}
+
+func checkCallReadOnly(call *syntax.CallExpr) error {
+	program, ok := literalWord(call.Args[0])
+	if !ok {
+		return fmt.Errorf("%w: the program %q is only known at run time", ErrReadOnly, wordValue(call.Args[0].Parts))
+	}
+	args := callArgs(call)
+
+	switch {
+	case filepath.Base(program) == "kubectl":
+		inv := ParseKubectlArgs(args[1:])
+		if result := inv.ModifiesResource(); result != "no" {
+			return fmt.Errorf("%w: %q %s", ErrReadOnly, strings.Join(args, " "), describeModifies(result))
+		}
+	case filepath.Base(program) == "helm":
+		if result := analyzeHelmCall(args); result != "no" {
+			return fmt.Errorf("%w: %q %s", ErrReadOnly, strings.Join(args, " "), describeModifies(result))
+		}
+	case readOnlyUtilities[filepath.Base(program)]:
+		if flag := findWriteFlag(args[1:], readOnlyUtilityWriteFlags[filepath.Base(program)]); flag != "" {
+			return fmt.Errorf("%w: %s %s writes files", ErrReadOnly, filepath.Base(program), flag)
+		}
+	default:
+		return fmt.Errorf("%w: %q is not allowed, only kubectl, helm and simple text utilities (%s) are", ErrReadOnly, program, strings.Join(slices.Sorted(maps.Keys(readOnlyUtilities)), ", "))
+	}
+	return nil
+}
+
+// checkRedirectReadOnly refuses redirections that write to files; duplicating file descriptors
+// (e.g. "2>&1") and writing to /dev/null are allowed.
+func checkRedirectReadOnly(redirect *syntax.Redirect) error {
+	switch redirect.Op {
+	case syntax.RdrOut, syntax.AppOut, syntax.RdrInOut, syntax.ClbOut, syntax.RdrAll, syntax.AppAll:
+	case syntax.DplOut:
+		if target, ok := literalWord(redirect.Word); ok && isFileDescriptor(target) {
+			return nil
+		}
+	default:
+		return nil
+	}
+	target, ok := literalWord(redirect.Word)
+	if ok && readOnlyRedirectTargets[target] {
+		return nil
+	}
+	return fmt.Errorf("%w: redirecting output to %q writes a file", ErrReadOnly, wordValue(redirect.Word.Parts))
+}
+
+// isFileDescriptor returns true for the targets of "n>&m" that duplicate or close descriptors.
+func isFileDescriptor(target string) bool {
+	target = strings.TrimSuffix(target, "-")
+	if target == "" {
+		return true
+	}
+	for _, r := range target {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// findWriteFlag returns the first of args that is one of flags, or "" if there is none.
+func findWriteFlag(args []string, flags []string) string {
+	for _, arg := range args {
+		if arg == "--" {
+			return ""
+		}
+		for _, flag := range flags {
+			long := strings.HasPrefix(flag, "--")
+			switch {
+			case long && (arg == flag || strings.HasPrefix(arg, flag+"=")):
+				return flag
+			case !long && strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg[1:], flag[1:]):
+				return flag
+			}
+		}
+	}
+	return ""
+}
+
+func describeModifies(result string) string {
+	if result == "yes" {
+		return "modifies resources"
+	}
+	return "might modify resources"
+}
+
+// literalWord returns the value of a word that contains no expansions.
+func literalWord(word *syntax.Word) (string, bool) {
+	var sb strings.Builder
+	for _, part := range word.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			for _, inner := range part.Parts {
+				lit, ok := inner.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(lit.Value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReadOnly(t *testing.T) {
+	customTool, err := NewCustomTool(CustomToolConfig{Name: "pods", Command: "kubectl get pods"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tool    Tool
+		command string
+		wantErr bool
+	}{
+		{"kubectl get", &Kubectl{}, "kubectl get pods -n prod", false},
+		{"kubectl pipeline", &BashTool{}, "kubectl get pods -o json | jq '.items[].metadata.name' | sort | head -5", false},
+		{"kubectl dry run", &Kubectl{}, "kubectl apply -f app.yaml --dry-run=server", false},
+		{"helm list", &Helm{}, "helm list -A", false},
+		{"command substitution of reads", &BashTool{}, "echo $(kubectl get ns -o name)", false},
+		{"kubectl delete", &Kubectl{}, "kubectl delete pod web", true},
+		{"delete in a subshell", &BashTool{}, "echo $(kubectl delete pod web)", true},
+		{"xargs", &BashTool{}, "kubectl get pods -o name | xargs kubectl delete", true},
+		{"other programs", &BashTool{}, "kubectl get pods && curl -X DELETE https://example.com", true},
+		{"dynamic program", &BashTool{}, "k=kubectl; $k delete pod web", true},
+		{"eval", &BashTool{}, "eval 'kubectl delete pod web'", true},
+		{"unknown kubectl verb", &Kubectl{}, "kubectl exec web -- rm -rf /data", true},
+		{"lookalike binary", &BashTool{}, "/tmp/kubectl-evil get pods", true},
+		{"helm upgrade", &Helm{}, "helm upgrade web ./chart", true},
+		{"helm upgrade dry run", &Helm{}, "helm upgrade web ./chart --dry-run=server", false},
+		{"helm upgrade dry run false", &Helm{}, "helm upgrade web ./chart --dry-run=false", true},
+		{"helm upgrade dry run none", &Helm{}, "helm upgrade web ./chart --dry-run=none", true},
+		{"empty", &BashTool{}, "", true},
+		{"use-context", &Kubectl{}, "kubectl config use-context prod", true},
+		{"set-context", &BashTool{}, "kubectl config set-context --current --namespace=web", true},
+		{"view config", &Kubectl{}, "kubectl config view --minify", false},
+		{"redirect to file", &BashTool{}, "kubectl get pods > ~/.bashrc", true},
+		{"append to file", &BashTool{}, "kubectl get pods >> /tmp/pods.txt", true},
+		{"redirect all output", &BashTool{}, "kubectl get pods &> out.log", true},
+		{"redirect in subshell", &BashTool{}, "(echo x > /etc/hosts)", true},
+		{"redirect to null", &BashTool{}, "kubectl get pods 2>/dev/null", false},
+		{"duplicate stderr", &BashTool{}, "kubectl get pods 2>&1 | head", false},
+		{"read from file", &BashTool{}, "jq . < pods.json", false},
+		{"sort output file", &BashTool{}, "kubectl get pods | sort -o /tmp/sorted", true},
+		{"sort combined output flag", &BashTool{}, "kubectl get pods | sort -ro/tmp/sorted", true},
+		{"sort long output flag", &BashTool{}, "kubectl get pods | sort --output=/tmp/sorted", true},
+		{"sort", &BashTool{}, "kubectl get pods | sort -k2 -r", false},
+		{"yq in place", &BashTool{}, "yq -i '.a = 1' app.yaml", true},
+		{"date set", &BashTool{}, "date -s '2020-01-01'", true},
+		{"custom tool prefix", customTool, "-n prod", false},
+		{"custom tool script", customTool, "kubectl get pods; kubectl delete pods --all", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckReadOnly(tc.tool, map[string]any{"command": tc.command})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("CheckReadOnly(%q) = %v, wantErr %v", tc.command, err, tc.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrReadOnly) {
+				t.Errorf("CheckReadOnly(%q) = %v, want an error wrapping ErrReadOnly", tc.command, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/redact"
+)
+
+// secretValueOutputs are the output formats that print selected fields without their keys,
+// so the output of "kubectl get secret" cannot be redacted field by field.
+var secretValueOutputs = []string{"jsonpath", "go-template", "template", "custom-columns"}
+
+// secretTableOutputs are the output formats of "kubectl get secret" that do not print the data of Secrets.
+var secretTableOutputs = stringSet("", "wide", "name")
+
+// RedactResult returns a copy of a tool result with secrets replaced by placeholders.
+// invocations are the kubectl calls that produced the result, if any.
+func RedactResult(r *redact.Redactor, invocations []*KubectlInvocation, result any) any {
+	if !r.Enabled() || result == nil {
+		return result
+	}
+
+	switch result := result.(type) {
+	case *ExecResult:
+		if result == nil {
+			return result
+		}
+		redacted := redactExecResult(r, invocations, *result)
+		return &redacted
+	case *HelmResult:
+		if result == nil {
+			return result
+		}
+		// Keep the type (and nil-ness of the lists), so the releases and history are still formatted as tables
+		redacted := HelmResult{ExecResult: redactExecResult(r, invocations, result.ExecResult)}
+		if result.Releases != nil {
+			redacted.Releases = make([]HelmRelease, 0, len(result.Releases))
+		}
+		if result.History != nil {
+			redacted.History = make([]HelmRevision, 0, len(result.History))
+		}
+		for _, release := range result.Releases {
+			release.Name = r.Redact(release.Name)
+			release.Namespace = r.Redact(release.Namespace)
+			release.Revision = r.Redact(release.Revision)
+			release.Updated = r.Redact(release.Updated)
+			release.Status = r.Redact(release.Status)
+			release.Chart = r.Redact(release.Chart)
+			release.AppVersion = r.Redact(release.AppVersion)
+			redacted.Releases = append(redacted.Releases, release)
+		}
+		for _, revision := range result.History {
+			revision.Updated = r.Redact(revision.Updated)
+			revision.Status = r.Redact(revision.Status)
+			revision.Chart = r.Redact(revision.Chart)
+			revision.AppVersion = r.Redact(revision.AppVersion)
+			revision.Description = r.Redact(revision.Description)
+			redacted.History = append(redacted.History, revision)
+		}
+		return &redacted
+	case string:
+		return r.Redact(result)
+	}
+
+	m, err := ToolResultToMap(result)
+	if err != nil {
+		return r.Redact(fmt.Sprintf("%v", result))
+	}
+	return redactStrings(r, m)
+}
+
+// redactExecResult returns a copy of an ExecResult with secrets replaced by placeholders.
+func redactExecResult(r *redact.Redactor, invocations []*KubectlInvocation, result ExecResult) ExecResult {
+	if printsSecretValues(invocations, result.Stdout) {
+		result.Stdout = r.RedactAll(result.Stdout)
+	} else {
+		result.Stdout = r.Redact(result.Stdout)
+	}
+	result.Stderr = r.Redact(result.Stderr)
+	result.Error = r.Redact(result.Error)
+	return result
+}
+
+// redactStrings redacts all the strings in a decoded JSON value.
+func redactStrings(r *redact.Redactor, v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.Redact(v)
+	case map[string]any:
+		for key, value := range v {
+			v[key] = redactStrings(r, value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactStrings(r, value)
+		}
+	}
+	return v
+}
+
+// printsSecretValues returns true if stdout may hold the values of Secrets without the object structure
+// the redactor relies on: e.g. "kubectl get secret db -o jsonpath='{.data.password}'", or
+// "kubectl get secret db -o json | jq -r .data.password", where another program reshapes the output.
+func printsSecretValues(invocations []*KubectlInvocation, stdout string) bool {
+	for _, inv := range invocations {
+		if inv.Verb != "get" || !hasSecretResource(inv) {
+			continue
+		}
+		for _, format := range secretValueOutputs {
+			if inv.Output == format || strings.HasPrefix(inv.Output, format+"=") {
+				return true
+			}
+		}
+		if !secretTableOutputs[inv.Output] && (inv.PipedOutput || !redact.ParsesAsObjects(stdout)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasSecretResource(inv *KubectlInvocation) bool {
+	for _, resource := range inv.Resources {
+		if resource = strings.ToLower(resource); resource == "secret" || resource == "secrets" {
+			return true
+		}
+	}
+	return false
+}
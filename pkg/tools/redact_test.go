@@ -0,0 +1,124 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/redact"
+)
+
+func TestRedactResult(t *testing.T) {
+	r, err := redact.New(redact.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		command string
+		stdout  string
+		leaked  string
+	}{
+		{"secret yaml", "kubectl get secret db -o yaml", "apiVersion: v1\nkind: Secret\nmetadata:\n  name: db\ndata:\n  password: c2VjcmV0\n", "c2VjcmV0"},
+		{"secret jsonpath", "kubectl get secret db -o jsonpath='{.data.password}' | base64 -d", "hunter2\n", "hunter2"},
+		{"bearer token", "kubectl config view --raw", "Authorization: Bearer abcdefghijklmnop\n", "abcdefghijklmnop"},
+		{"secret json through jq", "kubectl get secret db -o json | jq -r .data.password", "c2VjcmV0\n", "c2VjcmV0"},
+		{"secret yaml through grep", "kubectl get secret db -o yaml | grep password", "  password: c2VjcmV0\n", "c2VjcmV0"},
+		{"secret yaml not an object", "kubectl get secret db -o yaml; echo done", "password: c2VjcmV0\ndone\n", "c2VjcmV0"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			invocations, err := ParseKubectlCommand(tc.command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := &ExecResult{Command: tc.command, Stdout: tc.stdout}
+			got := RedactResult(r, invocations, result).(*ExecResult)
+			if strings.Contains(got.Stdout, tc.leaked) {
+				t.Errorf("RedactResult() stdout = %q, leaked %q", got.Stdout, tc.leaked)
+			}
+			if result.Stdout != tc.stdout {
+				t.Errorf("RedactResult() modified the original result")
+			}
+		})
+	}
+
+	// Output of jsonpath queries of other resources is kept
+	invocations, _ := ParseKubectlCommand("kubectl get pod web -o jsonpath='{.status.phase}'")
+	got := RedactResult(r, invocations, &ExecResult{Stdout: "Running"}).(*ExecResult)
+	if got.Stdout != "Running" {
+		t.Errorf("RedactResult() stdout = %q, want %q", got.Stdout, "Running")
+	}
+
+	// Listing Secrets prints no values, even through a pipe
+	invocations, _ = ParseKubectlCommand("kubectl get secrets | grep db")
+	got = RedactResult(r, invocations, &ExecResult{Stdout: "db   Opaque   1   5d\n"}).(*ExecResult)
+	if got.Stdout != "db   Opaque   1   5d\n" {
+		t.Errorf("RedactResult() stdout = %q, want the listing kept", got.Stdout)
+	}
+
+	// Opting out returns the result unmodified
+	r.SetEnabled(false)
+	invocations, _ = ParseKubectlCommand("kubectl get secret db -o jsonpath='{.data.password}'")
+	got = RedactResult(r, invocations, &ExecResult{Stdout: "c2VjcmV0"}).(*ExecResult)
+	if got.Stdout != "c2VjcmV0" {
+		t.Errorf("RedactResult() with redaction disabled = %q, want %q", got.Stdout, "c2VjcmV0")
+	}
+}
+
+func TestRedactResultHelm(t *testing.T) {
+	r, err := redact.New(redact.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := &HelmResult{
+		ExecResult: ExecResult{Command: "helm history web", Stderr: "Authorization: Bearer abcdefghijklmnop"},
+		History: []HelmRevision{
+			{Revision: 1, Status: "superseded", Chart: "web-1.0.0", Description: "Install complete"},
+			{Revision: 2, Status: "deployed", Chart: "web-1.1.0", Description: "Upgrade with Authorization: Bearer abcdefghijklmnop"},
+		},
+	}
+	got, ok := RedactResult(r, nil, result).(*HelmResult)
+	if !ok {
+		t.Fatalf("RedactResult() returned %T, want *HelmResult", RedactResult(r, nil, result))
+	}
+	if strings.Contains(got.Stderr, "abcdefghijklmnop") {
+		t.Errorf("RedactResult() stderr = %q, leaked the token", got.Stderr)
+	}
+	if len(got.History) != 2 || got.History[1].Revision != 2 || got.History[1].Chart != "web-1.1.0" {
+		t.Fatalf("RedactResult() history = %+v, want the two revisions", got.History)
+	}
+	if strings.Contains(got.History[1].Description, "abcdefghijklmnop") {
+		t.Errorf("RedactResult() history description = %q, leaked the token", got.History[1].Description)
+	}
+	if !strings.Contains(result.History[1].Description, "abcdefghijklmnop") {
+		t.Errorf("RedactResult() modified the original result")
+	}
+	if !strings.Contains(string(got.FormatAsHTML()), "web-1.1.0") {
+		t.Errorf("FormatAsHTML() of the redacted result does not show the history: %s", got.FormatAsHTML())
+	}
+
+	// An empty release list is still formatted as a (empty) table
+	got = RedactResult(r, nil, &HelmResult{Releases: []HelmRelease{}}).(*HelmResult)
+	if got.Releases == nil {
+		t.Errorf("RedactResult() cleared the empty releases list")
+	}
+}
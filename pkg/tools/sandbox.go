@@ -0,0 +1,63 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/st-lzh/kubelet-wuhrai/pkg/sandbox"
+)
+
+// sandboxFor returns the sandbox the named tool must run its commands in, or nil.
+func sandboxFor(ctx context.Context, toolName string) *sandbox.Sandbox {
+	sb, _ := ctx.Value(SandboxKey).(*sandbox.Sandbox)
+	if sb == nil {
+		return nil
+	}
+	policy := sb.Policy()
+	if !policy.Applies(toolName) {
+		return nil
+	}
+	return sb
+}
+
+// runSandboxed runs a shell command in the sandbox.
+// Problems with the sandbox itself, and failures of the command, are reported in the result
+// (rather than as errors) so that the LLM can see them and adjust its approach.
+func runSandboxed(ctx context.Context, sb *sandbox.Sandbox, command string, workDir string, kubeconfig string) (*ExecResult, error) {
+	prepared, err := sb.Prepare(ctx, sandbox.Command{
+		Shell:      command,
+		WorkDir:    workDir,
+		Kubeconfig: kubeconfig,
+	})
+	if err != nil {
+		return &ExecResult{Command: command, Error: fmt.Sprintf("could not run the command in the sandbox: %v", err)}, nil
+	}
+	defer prepared.Close()
+
+	result, err := executeCommand(prepared.Cmd)
+	if err != nil {
+		return &ExecResult{Command: command, Error: fmt.Sprintf("could not run the command in the sandbox: %v", err)}, nil
+	}
+	result.Command = command
+	if result.ExitCode != 0 {
+		result.Error = fmt.Sprintf("%s (note: %s)", result.Error, sb.Describe())
+	}
+	return result, nil
+}
@@ -20,18 +20,18 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"maps"
-	"os"
-	"path/filepath"
-	"slices"
+	"path"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/journal"
-	"sigs.k8s.io/yaml"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/redact"
+	"github.com/st-lzh/kubelet-wuhrai/pkg/sandbox"
 )
 
 type ContextKey string
@@ -39,47 +39,233 @@ type ContextKey string
 const (
 	KubeconfigKey ContextKey = "kubeconfig"
 	WorkDirKey    ContextKey = "work_dir"
+	SandboxKey    ContextKey = "sandbox"
 )
 
-var allTools Tools = Tools{
-	tools: make(map[string]Tool),
-}
+// builtinTools holds the tools that are compiled in, registered from init functions.
+var builtinTools []Tool
 
-func Default() Tools {
-	return allTools
+// registerBuiltinTool adds a tool to the set registered by RegisterBuiltinTools.
+func registerBuiltinTool(tool Tool) {
+	builtinTools = append(builtinTools, tool)
 }
 
-// RegisterTool makes a tool available to the LLM.
-func RegisterTool(tool Tool) {
-	allTools.RegisterTool(tool)
+var (
+	defaultTools     *Tools
+	defaultToolsOnce sync.Once
+)
+
+// Default returns a shared registry holding the built-in tools.
+// Prefer NewTools when the tool set must not leak between agents (e.g. one registry per tenant).
+func Default() *Tools {
+	defaultToolsOnce.Do(func() {
+		defaultTools = NewTools()
+		if err := defaultTools.RegisterBuiltinTools(); err != nil {
+			panic(err)
+		}
+	})
+	return defaultTools
 }
 
+// Tools is a registry of the tools available to an agent.
 type Tools struct {
+	// mutex guards tools and disabled; tools can be re-registered at runtime
+	// (e.g. when custom tool configs are reloaded) while the agent is reading them.
+	mutex sync.RWMutex
+
 	tools map[string]Tool
+
+	// disabled holds the names of tools that are registered but hidden from the LLM.
+	disabled map[string]bool
+
+	// filter restricts which tools may be registered, if set.
+	filter *ToolFilter
+}
+
+// ToolsOption configures a Tools registry.
+type ToolsOption func(*Tools)
+
+// WithFilter restricts the registry to the tools allowed by filter.
+func WithFilter(filter *ToolFilter) ToolsOption {
+	return func(t *Tools) {
+		t.filter = filter
+	}
+}
+
+// NewTools creates an empty tool registry.
+func NewTools(opts ...ToolsOption) *Tools {
+	t := &Tools{
+		tools:    make(map[string]Tool),
+		disabled: make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// RegisterBuiltinTools registers the built-in tools (bash, kubectl, ...) into the registry.
+func (t *Tools) RegisterBuiltinTools() error {
+	var errs []error
+	for _, tool := range builtinTools {
+		if err := t.RegisterTool(tool); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ToolFilter is an allowlist / denylist of tool names.
+// Entries are glob patterns as understood by path.Match, e.g. "kubectl" or "github_*".
+type ToolFilter struct {
+	// Enable, if non-empty, lists the only tools that are allowed.
+	Enable []string
+	// Disable lists tools that are never allowed; it takes precedence over Enable.
+	Disable []string
+}
+
+// Allows returns true if the named tool passes the filter.
+func (f *ToolFilter) Allows(name string) bool {
+	if f == nil {
+		return true
+	}
+	if matchesAny(f.Disable, name) {
+		return false
+	}
+	return len(f.Enable) == 0 || matchesAny(f.Enable, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
 }
 
+// ErrToolFiltered is returned when registering a tool that is excluded by the registry's filter.
+var ErrToolFiltered = errors.New("tool excluded by filter")
+
+// Lookup returns the tool with the given name, or nil if it is unknown or disabled.
 func (t *Tools) Lookup(name string) Tool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if t.disabled[name] {
+		return nil
+	}
 	return t.tools[name]
 }
 
+// AllTools returns all enabled tools.
 func (t *Tools) AllTools() []Tool {
-	return slices.Collect(maps.Values(t.tools))
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var tools []Tool
+	for name, tool := range t.tools {
+		if t.disabled[name] {
+			continue
+		}
+		tools = append(tools, tool)
+	}
+	return tools
 }
 
+// Names returns the sorted names of all enabled tools.
 func (t *Tools) Names() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
 	names := make([]string, 0, len(t.tools))
 	for name := range t.tools {
+		if t.disabled[name] {
+			continue
+		}
 		names = append(names, name)
 	}
 	sort.Strings(names)
 	return names
 }
 
-func (t *Tools) RegisterTool(tool Tool) {
+// DisabledNames returns the sorted names of tools that are registered but disabled.
+func (t *Tools) DisabledNames() []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	var names []string
+	for name := range t.tools {
+		if t.disabled[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterTool makes a tool available to the LLM.
+// It returns an error if a tool with the same name is already registered,
+// or ErrToolFiltered if the registry's filter excludes the tool.
+func (t *Tools) RegisterTool(tool Tool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.filter.Allows(tool.Name()) {
+		return fmt.Errorf("registering tool %q: %w", tool.Name(), ErrToolFiltered)
+	}
 	if _, exists := t.tools[tool.Name()]; exists {
-		panic("tool already registered: " + tool.Name())
+		return fmt.Errorf("tool already registered: %s", tool.Name())
 	}
 	t.tools[tool.Name()] = tool
+	return nil
+}
+
+// ReplaceTool registers the tool, replacing any existing tool with the same name.
+// Like RegisterTool, it returns ErrToolFiltered if the registry's filter excludes the tool.
+func (t *Tools) ReplaceTool(tool Tool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.filter.Allows(tool.Name()) {
+		return fmt.Errorf("registering tool %q: %w", tool.Name(), ErrToolFiltered)
+	}
+	t.tools[tool.Name()] = tool
+	return nil
+}
+
+// UnregisterTool removes the named tool; it is a no-op if the tool is not registered.
+func (t *Tools) UnregisterTool(name string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.tools, name)
+	delete(t.disabled, name)
+}
+
+// SetEnabled enables or disables a registered tool.
+// Disabled tools stay registered, but are not offered to the LLM and cannot be invoked.
+func (t *Tools) SetEnabled(name string, enabled bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, exists := t.tools[name]; !exists {
+		return fmt.Errorf("tool %q not registered", name)
+	}
+	if enabled {
+		delete(t.disabled, name)
+	} else {
+		t.disabled[name] = true
+	}
+	return nil
+}
+
+// registered returns the tool with the given name, including disabled tools.
+func (t *Tools) registered(name string) Tool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.tools[name]
 }
 
 type ToolCall struct {
@@ -104,7 +290,7 @@ func (t *ToolCall) Description() string {
 			args = append(args, fmt.Sprintf("%s=%v", k, v))
 		}
 		sort.Strings(args)
-		return fmt.Sprintf("[MCP: %s] %s(%s)", mcpTool.serverName, t.name, strings.Join(args, ", "))
+		return fmt.Sprintf("[MCP: %s] %s(%s)", mcpTool.serverName, mcpTool.toolName, strings.Join(args, ", "))
 	}
 
 	// Default formatting for non-MCP tools
@@ -138,6 +324,12 @@ type InvokeToolOptions struct {
 
 	// Kubeconfig is the path to the kubeconfig file.
 	Kubeconfig string
+
+	// Sandbox, if set, runs the shell commands of the tools selected by its policy.
+	Sandbox *sandbox.Sandbox
+
+	// Redactor, if set, removes secrets from the result before it is recorded and returned.
+	Redactor *redact.Redactor
 }
 
 type ToolRequestEvent struct {
@@ -169,8 +361,14 @@ func (t *ToolCall) InvokeTool(ctx context.Context, opt InvokeToolOptions) (any,
 
 	ctx = context.WithValue(ctx, KubeconfigKey, opt.Kubeconfig)
 	ctx = context.WithValue(ctx, WorkDirKey, opt.WorkDir)
+	if opt.Sandbox != nil {
+		ctx = context.WithValue(ctx, SandboxKey, opt.Sandbox)
+	}
 
 	response, err := t.tool.Run(ctx, t.arguments)
+	if opt.Redactor.Enabled() {
+		response = RedactResult(opt.Redactor, t.KubectlInvocations(), response)
+	}
 
 	{
 		ev := ToolResponseEvent{
@@ -216,65 +414,6 @@ func ToolResultToMap(result any) (map[string]any, error) {
 	return m, nil
 }
 
-// LoadAndRegisterCustomTools loads tool configurations from a YAML file
-// and registers them.
-func LoadAndRegisterCustomTools(configPath string) error {
-	pathInfo, err := os.Stat(configPath)
-	if err != nil {
-		return fmt.Errorf("failed to describe config file %s: %w", configPath, err)
-	}
-
-	if pathInfo.IsDir() {
-		configPaths, err := os.ReadDir(configPath)
-		if err != nil {
-			return fmt.Errorf("failed to read config dir %s: %w", configPath, err)
-		}
-
-		for _, entry := range configPaths {
-			if err := LoadAndRegisterCustomTools(filepath.Join(configPath, entry.Name())); err != nil {
-				return err
-			}
-		}
-
-		return nil
-	}
-
-	yamlFile, err := os.ReadFile(configPath)
-	if os.IsNotExist(err) {
-		return nil
-	} else if err != nil {
-		return fmt.Errorf("failed to read config file %s: %w", configPath, err)
-	}
-
-	var configs []CustomToolConfig
-	err = yaml.Unmarshal(yamlFile, &configs)
-	if err != nil {
-		return fmt.Errorf("failed to parse YAML config file %s: %w", configPath, err)
-	}
-
-	// Register each custom tool
-	var registrationErrors []string
-	for _, config := range configs {
-		tool, err := NewCustomTool(config)
-		if err != nil {
-			registrationErrors = append(registrationErrors, fmt.Sprintf("failed to create tool %q: %v", config.Name, err))
-			continue // Skip registration if creation failed
-		}
-		// Check for duplicate registration attempt
-		if _, exists := allTools.tools[tool.Name()]; exists {
-			registrationErrors = append(registrationErrors, fmt.Sprintf("tool %q already registered (possibly built-in), skipping custom definition", tool.Name()))
-			continue
-		}
-		RegisterTool(tool)
-	}
-
-	if len(registrationErrors) > 0 {
-		return fmt.Errorf("encountered errors during custom tool registration:\n - %s", strings.Join(registrationErrors, "\n - "))
-	}
-
-	return nil
-}
-
 // For CustomTool
 func (t *CustomTool) IsInteractive(args map[string]any) (bool, error) {
 	// Custom tools are not interactive by default
@@ -285,3 +424,27 @@ func (t *CustomTool) IsInteractive(args map[string]any) (bool, error) {
 func (t *ToolCall) GetTool() Tool {
 	return t.tool
 }
+
+// Arguments returns the arguments of the tool call.
+func (t *ToolCall) Arguments() map[string]any {
+	return t.arguments
+}
+
+// KubectlInvocations returns the parsed kubectl calls made by a kubectl or bash tool call.
+// It returns nil for other tools, or if the command cannot be parsed.
+func (t *ToolCall) KubectlInvocations() []*KubectlInvocation {
+	switch t.tool.(type) {
+	case *Kubectl, *BashTool:
+	default:
+		return nil
+	}
+	command, ok := t.arguments["command"].(string)
+	if !ok {
+		return nil
+	}
+	invocations, err := ParseKubectlCommand(command)
+	if err != nil {
+		return nil
+	}
+	return invocations
+}
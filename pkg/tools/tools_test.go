@@ -0,0 +1,110 @@
+// Copyright 2024 kubelet-wuhrai Contributors
+//
+// Licensed under the kubelet-wuhrai Custom License (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://github.com/st-lzh/kubelet-wuhrai/blob/main/LICENSE
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// This software is based on kubectl-ai by Google Cloud Platform:
+// https://github.com/GoogleCloudPlatform/kubectl-ai
+
+package tools
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestTools_RegisterTool(t *testing.T) {
+	a := NewTools()
+	b := NewTools()
+
+	if err := a.RegisterBuiltinTools(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := a.RegisterTool(&BashTool{}); err == nil {
+		t.Errorf("expected an error registering a duplicate tool")
+	}
+
+	// Registries are independent of each other
+	if len(b.Names()) != 0 {
+		t.Errorf("expected empty registry, got %v", b.Names())
+	}
+	if err := b.RegisterTool(&BashTool{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestToolFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   *ToolFilter
+		expected []string
+	}{
+		{
+			name:     "no filter",
+			filter:   nil,
+			expected: []string{"bash", "github_create_issue", "github_list_issues", "kubectl"},
+		},
+		{
+			name:     "allowlist",
+			filter:   &ToolFilter{Enable: []string{"kubectl", "github_list_*"}},
+			expected: []string{"github_list_issues", "kubectl"},
+		},
+		{
+			name:     "denylist",
+			filter:   &ToolFilter{Disable: []string{"bash", "github_*"}},
+			expected: []string{"kubectl"},
+		},
+		{
+			name:     "denylist takes precedence",
+			filter:   &ToolFilter{Enable: []string{"kubectl", "bash"}, Disable: []string{"bash"}},
+			expected: []string{"kubectl"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewTools(WithFilter(tt.filter))
+			for _, tool := range []Tool{
+				&BashTool{},
+				&Kubectl{},
+				NewMCPTool("github", "create_issue", "", nil, nil),
+				NewMCPTool("github", "list_issues", "", nil, nil),
+			} {
+				if err := registry.RegisterTool(tool); err != nil && !errors.Is(err, ErrToolFiltered) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if got := registry.Names(); !slices.Equal(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMCPToolName(t *testing.T) {
+	tests := []struct {
+		server   string
+		tool     string
+		expected string
+	}{
+		{"github", "create_issue", "github_create_issue"},
+		{"my.server", "get-data", "my_server_get-data"},
+		{"fs server", "read/file", "fs_server_read_file"},
+	}
+
+	for _, tt := range tests {
+		if got := MCPToolName(tt.server, tt.tool); got != tt.expected {
+			t.Errorf("MCPToolName(%q, %q) = %q, want %q", tt.server, tt.tool, got, tt.expected)
+		}
+	}
+}
@@ -80,6 +80,66 @@ func (b *AgentTextBlock) AppendText(text string) {
 	b.doc.blockChanged(b)
 }
 
+// ReasoningBlock is used to render the reasoning of the model, which comes before its answer.
+// It is collapsed unless expanded: renderers only show that the model is thinking.
+type ReasoningBlock struct {
+	doc *Document
+
+	// text is populated with the reasoning as it streams in
+	text string
+
+	// expanded is true if the reasoning is shown, not just its summary
+	expanded bool
+
+	// streaming is true if we are still streaming reasoning in
+	streaming bool
+}
+
+func NewReasoningBlock() *ReasoningBlock {
+	return &ReasoningBlock{}
+}
+
+func (b *ReasoningBlock) attached(doc *Document) {
+	b.doc = doc
+}
+
+func (b *ReasoningBlock) Document() *Document {
+	return b.doc
+}
+
+func (b *ReasoningBlock) Text() string {
+	return b.text
+}
+
+func (b *ReasoningBlock) Expanded() bool {
+	return b.expanded
+}
+
+func (b *ReasoningBlock) Streaming() bool {
+	return b.streaming
+}
+
+func (b *ReasoningBlock) SetExpanded(expanded bool) *ReasoningBlock {
+	b.expanded = expanded
+	b.doc.blockChanged(b)
+	return b
+}
+
+func (b *ReasoningBlock) SetStreaming(streaming bool) {
+	b.streaming = streaming
+	b.doc.blockChanged(b)
+}
+
+func (b *ReasoningBlock) SetText(text string) {
+	b.text = text
+	b.doc.blockChanged(b)
+}
+
+func (b *ReasoningBlock) AppendText(text string) {
+	b.text = b.text + text
+	b.doc.blockChanged(b)
+}
+
 // FunctionCallRequestBlock is used to render the LLM's request to invoke a function
 type FunctionCallRequestBlock struct {
 	doc *Document
@@ -171,6 +231,9 @@ type InputTextBlock struct {
 
 	// editable is true if the input text block is editable
 	editable bool
+
+	// prompt is shown when asking for input; the UI uses its default prompt if empty
+	prompt string
 }
 
 func NewInputTextBlock() *InputTextBlock {
@@ -199,6 +262,17 @@ func (b *InputTextBlock) Editable() bool {
 	return b.editable
 }
 
+// SetPrompt sets the prompt to show the user
+func (b *InputTextBlock) SetPrompt(prompt string) *InputTextBlock {
+	b.prompt = prompt
+	b.doc.blockChanged(b)
+	return b
+}
+
+func (b *InputTextBlock) Prompt() string {
+	return b.prompt
+}
+
 func (b *InputTextBlock) Text() (string, error) {
 	return b.text.Get()
 }
@@ -268,3 +342,66 @@ func (b *InputOptionBlock) Document() *Document {
 func (b *InputOptionBlock) Selection() *Observable[string] {
 	return &b.selection
 }
+
+// InputEditBlock is used to let the user edit a text before it is used, e.g. a command before it runs
+type InputEditBlock struct {
+	doc *Document
+
+	// initialText is the text the input is prefilled with
+	initialText string
+
+	// text is populated with the edited text
+	text Observable[string]
+
+	// editable is true until the user has submitted the edited text
+	editable bool
+
+	// prompt is shown when asking for the edit
+	prompt string
+}
+
+func NewInputEditBlock(initialText string) *InputEditBlock {
+	return &InputEditBlock{initialText: initialText, editable: true}
+}
+
+func (b *InputEditBlock) attached(doc *Document) {
+	b.doc = doc
+}
+
+func (b *InputEditBlock) Document() *Document {
+	return b.doc
+}
+
+// InitialText returns the text the input is prefilled with
+func (b *InputEditBlock) InitialText() string {
+	return b.initialText
+}
+
+func (b *InputEditBlock) Observable() *Observable[string] {
+	return &b.text
+}
+
+func (b *InputEditBlock) SetEditable(editable bool) *InputEditBlock {
+	b.editable = editable
+	b.doc.blockChanged(b)
+	return b
+}
+
+func (b *InputEditBlock) Editable() bool {
+	return b.editable
+}
+
+// SetPrompt sets the prompt to show the user
+func (b *InputEditBlock) SetPrompt(prompt string) *InputEditBlock {
+	b.prompt = prompt
+	b.doc.blockChanged(b)
+	return b
+}
+
+func (b *InputEditBlock) Prompt() string {
+	return b.prompt
+}
+
+func (b *InputEditBlock) Text() (string, error) {
+	return b.text.Get()
+}
@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/st-lzh/kubelet-wuhrai/gollm"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/agent"
 	"github.com/st-lzh/kubelet-wuhrai/pkg/journal"
 	"k8s.io/klog/v2"
@@ -197,6 +198,8 @@ func (s *APIServer) handleStatusRequest(w http.ResponseWriter, r *http.Request)
 		"agent":      "ready",
 		"tools":      "available",
 		"mcp_client": "disabled", // This should reflect actual MCP status
+		// 语言模型限流器的指标（请求数、等待时间、429次数、当前并发等）
+		"rate_limiters": gollm.RateLimiterMetrics(),
 	}
 
 	s.writeJSONResponse(w, status, http.StatusOK)
@@ -74,6 +74,7 @@ func NewHTMLUserInterfaceWithAgent(doc *ui.Document, listenAddress string, journ
 	mux.HandleFunc("GET /doc-stream", u.serveDocStream)
 	mux.HandleFunc("POST /send-message", u.handlePOSTSendMessage)
 	mux.HandleFunc("POST /choose-option", u.handlePOSTChooseOption)
+	mux.HandleFunc("POST /edit-input", u.handlePOSTEditInput)
 
 	// Register API routes if API server is available
 	if u.apiServer != nil {
@@ -217,6 +218,40 @@ func (u *HTMLUserInterface) handlePOSTChooseOption(w http.ResponseWriter, req *h
 	w.Write(bb.Bytes())
 }
 
+func (u *HTMLUserInterface) handlePOSTEditInput(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	log := klog.FromContext(ctx)
+
+	if err := req.ParseForm(); err != nil {
+		log.Error(err, "parsing form")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Info("got request", "values", req.Form)
+
+	// TODO: Match by block id
+	var inputEditBlock *ui.InputEditBlock
+	for _, block := range u.doc.Blocks() {
+		if block, ok := block.(*ui.InputEditBlock); ok {
+			inputEditBlock = block
+		}
+	}
+
+	if inputEditBlock == nil || !inputEditBlock.Editable() {
+		log.Info("no input edit block found")
+		http.Error(w, "no input edit block found", http.StatusInternalServerError)
+		return
+	}
+
+	inputEditBlock.Observable().Set(req.FormValue("text"), nil)
+	inputEditBlock.SetEditable(false)
+
+	var bb bytes.Buffer
+	bb.WriteString("ok")
+	w.Write(bb.Bytes())
+}
+
 func (u *HTMLUserInterface) serveDocStream(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	log := klog.FromContext(ctx)
@@ -323,10 +358,14 @@ func (u *HTMLUserInterface) renderBlock(ctx context.Context, w io.Writer, block
 		return renderTemplate(ctx, w, "function_call_request_block.html", block)
 	case *ui.AgentTextBlock:
 		return renderTemplate(ctx, w, "agent_text_block.html", block)
+	case *ui.ReasoningBlock:
+		return renderTemplate(ctx, w, "reasoning_block.html", block)
 	case *ui.InputTextBlock:
 		return renderTemplate(ctx, w, "input_text_block.html", block)
 	case *ui.InputOptionBlock:
 		return renderTemplate(ctx, w, "input_option_block.html", block)
+	case *ui.InputEditBlock:
+		return renderTemplate(ctx, w, "input_edit_block.html", block)
 
 	default:
 		return fmt.Errorf("unknown block type %T", block)
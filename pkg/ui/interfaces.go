@@ -35,6 +35,7 @@ const (
 	ColorGreen ColorValue = "green"
 	ColorWhite            = "white"
 	ColorRed              = "red"
+	ColorGray             = "gray"
 )
 
 type StyleOption func(s *ComputedStyle)
@@ -175,7 +175,14 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block) {
 		}
 		text = block.Text()
 		streaming = block.Streaming()
+	case *ReasoningBlock:
+		styleOptions = append(styleOptions, Foreground(ColorGray))
+		text = reasoningText(block)
 	case *InputTextBlock:
+		prompt := block.Prompt()
+		if prompt == "" {
+			prompt = ">>> "
+		}
 		var query string
 		if u.useTTYForInput {
 			tReader, err := u.ttyReader()
@@ -183,7 +190,7 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block) {
 				block.Observable().Set("", fmt.Errorf("TTY reader not initialized"))
 				return
 			}
-			fmt.Print("\n>>> ") // Print prompt manually
+			fmt.Print("\n" + prompt) // Print prompt manually
 			query, err = tReader.ReadString('\n')
 			if err != nil {
 				block.Observable().Set("", err) // Set error (includes io.EOF)
@@ -196,7 +203,7 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block) {
 				block.Observable().Set("", fmt.Errorf("error creating readline instance: %w", err))
 				return
 			}
-			rlInstance.SetPrompt(">>> ") // Ensure correct prompt
+			rlInstance.SetPrompt(prompt) // Ensure correct prompt
 			query, err = rlInstance.Readline()
 			if err != nil {
 				if err == readline.ErrInterrupt { // Handle Ctrl+C
@@ -212,6 +219,54 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block) {
 		}
 		return
 
+	case *InputEditBlock:
+		if !block.Editable() {
+			return
+		}
+		prompt := block.Prompt()
+		if prompt == "" {
+			prompt = ">>> "
+		}
+		if u.useTTYForInput {
+			tReader, err := u.ttyReader()
+			if err != nil {
+				block.Observable().Set("", fmt.Errorf("TTY reader not initialized"))
+				return
+			}
+			// We cannot prefill the input without readline, so an empty line keeps the text
+			fmt.Printf("\n  %s\n  (press enter to keep it)\n%s", block.InitialText(), prompt)
+			text, err := tReader.ReadString('\n')
+			if err != nil {
+				block.Observable().Set("", err)
+				return
+			}
+			if strings.TrimSpace(text) == "" {
+				text = block.InitialText()
+			}
+			block.Observable().Set(text, nil)
+		} else {
+			rlInstance, err := u.readlineInstance()
+			if err != nil {
+				block.Observable().Set("", fmt.Errorf("error creating readline instance: %w", err))
+				return
+			}
+			originalPrompt := rlInstance.Config.Prompt
+			rlInstance.SetPrompt(prompt)
+			defer rlInstance.SetPrompt(originalPrompt)
+
+			text, err := rlInstance.ReadlineWithDefault(block.InitialText())
+			if err != nil {
+				if err == readline.ErrInterrupt { // Handle Ctrl+C
+					block.Observable().Set("", io.EOF)
+				} else {
+					block.Observable().Set("", err)
+				}
+				return
+			}
+			block.Observable().Set(text, nil)
+		}
+		return
+
 	case *InputOptionBlock:
 		fmt.Printf("%s\n", block.Prompt) // Print initial prompt text
 		for i, option := range block.Options {
@@ -340,6 +395,9 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block) {
 	case ColorWhite:
 		fmt.Printf("\033[37m")
 		reset += "\033[0m"
+	case ColorGray:
+		fmt.Printf("\033[90m")
+		reset += "\033[0m"
 
 	case "":
 	default:
@@ -349,6 +407,20 @@ func (u *TerminalUI) DocumentChanged(doc *Document, block Block) {
 	fmt.Printf("%s%s", printText, reset)
 }
 
+// reasoningText is the text of a reasoning block: the reasoning if the block is expanded, else a summary.
+// Both only grow while the reasoning streams in, so that they are printed incrementally.
+func reasoningText(block *ReasoningBlock) string {
+	if block.Expanded() {
+		return "  Thinking:\n" + block.Text()
+	}
+	text := "  Thinking..."
+	if !block.Streaming() && block.Text() != "" {
+		lines := strings.Count(strings.TrimSpace(block.Text()), "\n") + 1
+		text += fmt.Sprintf(" (%d lines hidden, enter `thinking` to show them)", lines)
+	}
+	return text
+}
+
 func (u *TerminalUI) ClearScreen() {
 	fmt.Print("\033[H\033[2J")
 }